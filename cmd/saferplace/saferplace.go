@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
 	"strings"
 
 	"safer.place/internal/cmd/saferplace"
@@ -20,6 +21,24 @@ func run() error {
 	configFile := flag.String("config", "/etc/saferplace/config.yaml", "Config file")
 	flag.Parse()
 
+	cfg, err := config.Parse(*configFile)
+	if err != nil {
+		return err
+	}
+
+	switch flag.Arg(0) {
+	case "deadletter":
+		return saferplace.DeadLetters(context.Background(), cfg, flag.Args()[1:], os.Stdout)
+	case "roles":
+		return saferplace.Roles(context.Background(), cfg, flag.Args()[1:], os.Stdout)
+	case "migrate":
+		return saferplace.Migrate(context.Background(), cfg, flag.Args()[1:], os.Stdout)
+	case "history":
+		return saferplace.History(context.Background(), cfg, flag.Args()[1:], os.Stdout)
+	case "vapid":
+		return saferplace.VAPID(context.Background(), cfg, flag.Args()[1:], os.Stdout)
+	}
+
 	components := saferplace.AllComponents()
 	if len(flag.Args()) > 0 {
 		if flag.Arg(0) != "all" {
@@ -27,9 +46,5 @@ func run() error {
 		}
 	}
 
-	cfg, err := config.Parse(*configFile)
-	if err != nil {
-		return err
-	}
 	return saferplace.Run(context.Background(), components, cfg)
 }
@@ -0,0 +1,302 @@
+// Package alerts notifies the users subscribed to an area about the incidents alerted in it.
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"api.safer.place/incident/v1"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/notifier"
+	"safer.place/internal/queue"
+	"safer.place/internal/queue/otelhelper"
+)
+
+// Config of the subscriptions and the alerts sent to them.
+type Config struct {
+	// MaxSubscriptions of each user.
+	MaxSubscriptions int `yaml:"max_subscriptions" split_words:"true" default:"5"`
+	// MaxCells each subscription covers. Each cell is a hundredth of a degree on each side.
+	MaxCells int `yaml:"max_cells" split_words:"true" default:"100"`
+	// RateLimit of the alerts sent to each subscription.
+	RateLimit RateLimit `yaml:"rate_limit" split_words:"true"`
+	// Concurrency of the deliveries of each alert.
+	Concurrency int `yaml:"concurrency" default:"10"`
+
+	Webhook WebhookConfig `yaml:"webhook"`
+	WebPush WebPushConfig `yaml:"webpush" split_words:"true"`
+}
+
+// RateLimit allows at most the number of alerts within each window.
+type RateLimit struct {
+	Alerts int           `yaml:"alerts" default:"10"`
+	Window time.Duration `yaml:"window" default:"1h"`
+}
+
+// ErrGone is returned by the channels when the endpoint no longer accepts the alerts, and the
+// subscription is deleted.
+var ErrGone = errors.New("subscription endpoint is gone")
+
+// Channel delivers the alerts to the endpoints of the subscriptions.
+type Channel interface {
+	// Validate the endpoint the user subscribes with.
+	Validate(endpoint string) error
+	// Deliver the alert about the incident to the subscription.
+	Deliver(context.Context, *database.Subscription, *incident.Incident) error
+}
+
+// Alert is sent to the subscribers about the incident.
+type Alert struct {
+	// Subscription the alert was sent to.
+	Subscription string      `json:"subscription"`
+	IncidentID   string      `json:"incident_id"`
+	Timestamp    time.Time   `json:"timestamp"`
+	Location     string      `json:"location"`
+	Coordinates  Coordinates `json:"coordinates"`
+	Description  string      `json:"description"`
+}
+
+// Coordinates of the incident.
+type Coordinates struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// NewAlert returns the alert about the incident sent to the subscription.
+func NewAlert(sub *database.Subscription, i *incident.Incident) Alert {
+	a := Alert{
+		Subscription: sub.ID,
+		IncidentID:   i.Id,
+		Location:     notifier.Location(i),
+		Description:  i.Description,
+	}
+	if i.Timestamp != nil {
+		a.Timestamp = i.Timestamp.AsTime()
+	}
+	if c := i.Coordinates; c != nil {
+		a.Coordinates = Coordinates{Lat: c.Lat, Lon: c.Lon}
+	}
+	return a
+}
+
+// CellOf returns the cell containing the coordinates.
+func CellOf(c *incident.Coordinates) database.Cell {
+	return database.Cell{
+		Lat: int(math.Floor(c.Lat * 100)),
+		Lon: int(math.Floor(c.Lon * 100)),
+	}
+}
+
+// The alerts which fail to be handled are retried a few times, as the subscribers would rather
+// not get them at all than get them hours late.
+const (
+	maxDeliveries = 3
+	retryBackoff  = 30 * time.Second
+)
+
+// Alerter sends the alerts about the incidents from the queue to the subscriptions of their
+// cells.
+type Alerter struct {
+	cfg      Config
+	alerts   queue.Consumer[*incident.Incident]
+	db       database.Subscriptions
+	channels map[string]Channel
+	log      log.Logger
+	tracer   trace.Tracer
+	// now is replaced in the tests.
+	now func() time.Time
+}
+
+// New creates a new alerter.
+func New(cfg Config, opts ...Option) (*Alerter, error) {
+	a := &Alerter{
+		cfg: cfg,
+		now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a, validate(a)
+}
+
+// Run the alerter until the context is cancelled.
+func (a *Alerter) Run(ctx context.Context) error {
+	a.log.Info(ctx, "listening for alerts")
+	for {
+		msg, err := a.alerts.Consume(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			a.log.Error(ctx, "unable to receive alert", log.Error(err))
+			// Avoid spinning when the queue is unavailable.
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryBackoff):
+			}
+			continue
+		}
+
+		inc := msg.Body()
+		// Continue the trace of the reviewed incident.
+		sent, err := a.Handle(otelhelper.ExtractContext(ctx, msg.Metadata()), inc)
+		if err != nil {
+			a.log.Error(ctx, "unable to send alerts",
+				slog.String("id", inc.Id),
+				log.Error(err),
+			)
+			if redeliverable, ok := msg.(queue.Redeliverable); ok && redeliverable.Deliveries() < maxDeliveries {
+				redeliverable.NackAfter(retryBackoff)
+				continue
+			}
+		} else {
+			a.log.Info(ctx, "sent alerts",
+				slog.String("id", inc.Id),
+				slog.Int("subscriptions", sent),
+			)
+		}
+		msg.Ack()
+	}
+}
+
+// Handle sends the alert about the incident to the subscriptions of its cell, which are not over
+// their rate limit, and returns how many were sent. The subscriptions which fail are logged
+// without failing the others, and deleted if their endpoint is gone.
+func (a *Alerter) Handle(ctx context.Context, inc *incident.Incident) (sent int, err error) {
+	ctx, span := a.tracer.Start(ctx, "Handle")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	if inc.Coordinates == nil {
+		return 0, nil
+	}
+
+	subs, err := a.db.CellSubscriptions(ctx, CellOf(inc.Coordinates))
+	if err != nil {
+		return 0, fmt.Errorf("unable to list subscriptions: %w", err)
+	}
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, a.cfg.Concurrency)
+		now = a.now()
+	)
+	for _, sub := range subs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(sub *database.Subscription) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if a.send(ctx, sub, inc, now) {
+				mu.Lock()
+				sent++
+				mu.Unlock()
+			}
+		}(sub)
+	}
+	wg.Wait()
+
+	return sent, nil
+}
+
+// send the alert to the subscription, and return whether it was sent.
+func (a *Alerter) send(ctx context.Context, sub *database.Subscription, inc *incident.Incident, now time.Time) bool {
+	attrs := []slog.Attr{
+		slog.String("subscription", sub.ID),
+		slog.String("channel", sub.Channel),
+		slog.String("incident", inc.Id),
+	}
+
+	channel, ok := a.channels[sub.Channel]
+	if !ok {
+		a.log.Warn(ctx, "subscription has an unknown channel", attrs...)
+		return false
+	}
+
+	taken, err := a.db.TakeAlert(ctx, sub.ID, now, a.cfg.RateLimit.Alerts, a.cfg.RateLimit.Window)
+	switch {
+	case errors.Is(err, database.ErrDoesNotExist):
+		// The user unsubscribed in the meantime.
+		return false
+	case err != nil:
+		a.log.Error(ctx, "unable to rate limit alert", append(attrs, log.Error(err))...)
+		return false
+	case !taken:
+		a.log.Debug(ctx, "subscription is over its rate limit", attrs...)
+		return false
+	}
+
+	err = channel.Deliver(ctx, sub, inc)
+	switch {
+	case errors.Is(err, ErrGone):
+		a.log.Info(ctx, "unsubscribing gone endpoint", attrs...)
+		if err := a.db.DeleteSubscription(ctx, sub.ID, sub.Owner); err != nil && !errors.Is(err, database.ErrDoesNotExist) {
+			a.log.Error(ctx, "unable to unsubscribe gone endpoint", append(attrs, log.Error(err))...)
+		}
+		return false
+	case err != nil:
+		a.log.Error(ctx, "unable to deliver alert", append(attrs, log.Error(err))...)
+		// The alert which wasn't sent doesn't count towards the rate limit.
+		if err := a.db.ReturnAlert(ctx, sub.ID, now); err != nil {
+			a.log.Error(ctx, "unable to return alert", append(attrs, log.Error(err))...)
+		}
+		return false
+	}
+	return true
+}
+
+var (
+	errMissingAlerts        = errors.New("missing alerts queue")
+	errMissingSubscriptions = errors.New("missing subscriptions database")
+	errMissingChannels      = errors.New("missing channels")
+	errMissingLogger        = errors.New("missing logger")
+	errMissingTracer        = errors.New("missing tracer")
+	errInvalidConcurrency   = errors.New("concurrency must be positive")
+	errInvalidRateLimit     = errors.New("rate limit must be positive")
+)
+
+func validate(a *Alerter) error {
+	if a.alerts == nil {
+		return errMissingAlerts
+	}
+	if a.db == nil {
+		return errMissingSubscriptions
+	}
+	if len(a.channels) == 0 {
+		return errMissingChannels
+	}
+	if a.log == nil {
+		return errMissingLogger
+	}
+	if a.tracer == nil {
+		return errMissingTracer
+	}
+	if a.cfg.Concurrency <= 0 {
+		return errInvalidConcurrency
+	}
+	if a.cfg.RateLimit.Alerts <= 0 || a.cfg.RateLimit.Window <= 0 {
+		return errInvalidRateLimit
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/queue/memory"
+)
+
+// fakeDatabase has the subscriptions of a single cell, and allows each of them the alerts left.
+type fakeDatabase struct {
+	database.Subscriptions
+	mu      sync.Mutex
+	cell    database.Cell
+	subs    []*database.Subscription
+	left    map[string]int
+	deleted []string
+}
+
+func (db *fakeDatabase) CellSubscriptions(_ context.Context, cell database.Cell) ([]*database.Subscription, error) {
+	if cell != db.cell {
+		return nil, nil
+	}
+	return db.subs, nil
+}
+
+func (db *fakeDatabase) TakeAlert(_ context.Context, id string, _ time.Time, _ int, _ time.Duration) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	left, ok := db.left[id]
+	if !ok {
+		return false, database.ErrDoesNotExist
+	}
+	if left == 0 {
+		return false, nil
+	}
+	db.left[id]--
+	return true, nil
+}
+
+func (db *fakeDatabase) ReturnAlert(_ context.Context, id string, _ time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.left[id]++
+	return nil
+}
+
+func (db *fakeDatabase) DeleteSubscription(_ context.Context, id, _ string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.deleted = append(db.deleted, id)
+	return nil
+}
+
+// fakeChannel records the alerts, failing the subscriptions with an error.
+type fakeChannel struct {
+	mu        sync.Mutex
+	errs      map[string]error
+	delivered []string
+}
+
+func (c *fakeChannel) Validate(string) error {
+	return nil
+}
+
+func (c *fakeChannel) Deliver(_ context.Context, sub *database.Subscription, _ *incident.Incident) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.errs[sub.ID]; err != nil {
+		return err
+	}
+	c.delivered = append(c.delivered, sub.ID)
+	return nil
+}
+
+func newAlerter(t *testing.T, db *fakeDatabase, channel *fakeChannel, opts ...Option) *Alerter {
+	t.Helper()
+
+	a, err := New(Config{
+		Concurrency: 2,
+		RateLimit:   RateLimit{Alerts: 1, Window: time.Hour},
+	}, append([]Option{
+		Alerts(memory.New[*incident.Incident](memory.Tracer[*incident.Incident](noop.NewTracerProvider().Tracer("")))),
+		Subscriptions(db),
+		Channels(map[string]Channel{"fake": channel}),
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestHandle(t *testing.T) {
+	db := &fakeDatabase{
+		cell: database.Cell{Lat: 5334, Lon: -627},
+		subs: []*database.Subscription{
+			{ID: "first", Channel: "fake"},
+			{ID: "second", Channel: "fake"},
+			{ID: "limited", Channel: "fake"},
+			{ID: "gone", Channel: "fake"},
+			{ID: "broken", Channel: "fake"},
+			{ID: "unsubscribed", Channel: "fake"},
+			{ID: "unknown", Channel: "carrier pigeon"},
+		},
+		left: map[string]int{
+			"first":   2,
+			"second":  1,
+			"limited": 0,
+			"gone":    1,
+			"broken":  1,
+			"unknown": 1,
+		},
+	}
+	channel := &fakeChannel{errs: map[string]error{
+		"gone":   ErrGone,
+		"broken": errors.New("delivery failed"),
+	}}
+	a := newAlerter(t, db, channel)
+
+	inc := &incident.Incident{Id: "incident", Coordinates: &incident.Coordinates{Lat: 53.3498, Lon: -6.2603}}
+	sent, err := a.Handle(context.Background(), inc)
+	if err != nil || sent != 2 {
+		t.Fatalf("Handle() = %d, %v, want 2", sent, err)
+	}
+	slices.Sort(channel.delivered)
+	if want := []string{"first", "second"}; !slices.Equal(channel.delivered, want) {
+		t.Errorf("delivered to %v, want %v", channel.delivered, want)
+	}
+	// The gone endpoint is unsubscribed.
+	if want := []string{"gone"}; !slices.Equal(db.deleted, want) {
+		t.Errorf("deleted %v, want %v", db.deleted, want)
+	}
+	// The alert which failed doesn't count towards the rate limit.
+	if left := db.left["broken"]; left != 1 {
+		t.Errorf("broken subscription has %d alerts left, want 1", left)
+	}
+
+	// The second alert is over the rate limit of the subscriptions which got the first one.
+	channel.delivered = nil
+	if sent, err := a.Handle(context.Background(), inc); err != nil || sent != 1 {
+		t.Errorf("Handle() = %d, %v, want 1", sent, err)
+	}
+
+	// The incidents elsewhere are not sent to the subscriptions.
+	elsewhere := &incident.Incident{Id: "elsewhere", Coordinates: &incident.Coordinates{Lat: 51.8985, Lon: -8.4756}}
+	if sent, err := a.Handle(context.Background(), elsewhere); err != nil || sent != 0 {
+		t.Errorf("Handle() = %d, %v, want 0", sent, err)
+	}
+}
+
+func TestCellOf(t *testing.T) {
+	testCases := map[string]struct {
+		coordinates *incident.Coordinates
+		want        database.Cell
+	}{
+		"north east": {
+			coordinates: &incident.Coordinates{Lat: 53.3498, Lon: 6.2603},
+			want:        database.Cell{Lat: 5334, Lon: 626},
+		},
+		// The cells are identified by their south west corner.
+		"south west": {
+			coordinates: &incident.Coordinates{Lat: -33.8688, Lon: -6.2603},
+			want:        database.Cell{Lat: -3387, Lon: -627},
+		},
+		"corner": {
+			coordinates: &incident.Coordinates{Lat: 1, Lon: -1},
+			want:        database.Cell{Lat: 100, Lon: -100},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := CellOf(tc.coordinates); got != tc.want {
+				t.Errorf("CellOf() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	testCases := map[string]struct {
+		cfg  Config
+		opts []Option
+		err  error
+	}{
+		"valid": {
+			cfg: Config{Concurrency: 1, RateLimit: RateLimit{Alerts: 1, Window: time.Hour}},
+		},
+		"no concurrency": {
+			cfg: Config{RateLimit: RateLimit{Alerts: 1, Window: time.Hour}},
+			err: errInvalidConcurrency,
+		},
+		"no rate limit": {
+			cfg: Config{Concurrency: 1},
+			err: errInvalidRateLimit,
+		},
+		"no channels": {
+			cfg:  Config{Concurrency: 1, RateLimit: RateLimit{Alerts: 1, Window: time.Hour}},
+			opts: []Option{Channels(nil)},
+			err:  errMissingChannels,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(tc.cfg, append([]Option{
+				Alerts(memory.New[*incident.Incident](memory.Tracer[*incident.Incident](noop.NewTracerProvider().Tracer("")))),
+				Subscriptions(&fakeDatabase{}),
+				Channels(map[string]Channel{"fake": &fakeChannel{}}),
+				Logger(log.New(slog.Default().Handler())),
+				Tracer(noop.NewTracerProvider().Tracer("")),
+			}, tc.opts...)...)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("New() = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
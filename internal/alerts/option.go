@@ -0,0 +1,48 @@
+package alerts
+
+import (
+	"go.opentelemetry.io/otel/trace"
+
+	"api.safer.place/incident/v1"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/queue"
+)
+
+// Option to provide configuration to the alerter.
+type Option func(*Alerter)
+
+// Alerts provides the queue of the alerted incidents.
+func Alerts(c queue.Consumer[*incident.Incident]) Option {
+	return func(a *Alerter) {
+		a.alerts = c
+	}
+}
+
+// Subscriptions provides the database of the subscriptions.
+func Subscriptions(db database.Subscriptions) Option {
+	return func(a *Alerter) {
+		a.db = db
+	}
+}
+
+// Channels provides the channels the alerts are delivered through, by their name.
+func Channels(channels map[string]Channel) Option {
+	return func(a *Alerter) {
+		a.channels = channels
+	}
+}
+
+// Logger provides the logger
+func Logger(l log.Logger) Option {
+	return func(a *Alerter) {
+		a.log = l
+	}
+}
+
+// Tracer provides the tracing
+func Tracer(t trace.Tracer) Option {
+	return func(a *Alerter) {
+		a.tracer = t
+	}
+}
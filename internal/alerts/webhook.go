@@ -0,0 +1,161 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"api.safer.place/incident/v1"
+	"safer.place/internal/database"
+	"safer.place/internal/notifier/webhooknotifier"
+)
+
+// WebhookChannel is the name of the webhook channel.
+const WebhookChannel = "webhook"
+
+// maxEndpoint is the longest endpoint accepted, in bytes.
+const maxEndpoint = 2048
+
+// WebhookConfig of the alerts posted to the webhooks of the subscribers.
+type WebhookConfig struct {
+	// Timeout of each delivery.
+	Timeout time.Duration `yaml:"timeout" default:"10s"`
+	// AllowPrivateNetworks allows the webhooks in the private networks and over plain HTTP. The
+	// users choose the webhooks, so it must only be enabled in development.
+	AllowPrivateNetworks bool `yaml:"allow_private_networks" split_words:"true"`
+}
+
+// Webhook posts the alerts to the endpoints of the subscriptions, signed with their secret in
+// the same way as the webhook notifier.
+type Webhook struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+// NewWebhook creates the webhook channel.
+func NewWebhook(cfg WebhookConfig) *Webhook {
+	return &Webhook{
+		cfg:    cfg,
+		client: newClient(cfg.Timeout, cfg.AllowPrivateNetworks),
+	}
+}
+
+// Validate the webhook is an absolute HTTPS URL.
+func (w *Webhook) Validate(endpoint string) error {
+	if len(endpoint) > maxEndpoint {
+		return fmt.Errorf("%w: longer than %d bytes", errInvalidEndpoint, maxEndpoint)
+	}
+	return validateURL(endpoint, w.cfg.AllowPrivateNetworks)
+}
+
+// Deliver posts the alert to the webhook. The webhooks which respond with 404 or 410 are gone.
+func (w *Webhook) Deliver(ctx context.Context, sub *database.Subscription, i *incident.Incident) error {
+	body, err := json.Marshal(NewAlert(sub, i))
+	if err != nil {
+		return fmt.Errorf("unable to encode alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhooknotifier.DeliveryHeader, uuid.NewString())
+	req.Header.Set(webhooknotifier.TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(webhooknotifier.SignatureHeader, webhooknotifier.Sign([]byte(sub.Secret), now, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// The error contains the URL, which is only known to the subscriber.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("unable to post alert: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return fmt.Errorf("%w: %s", ErrGone, resp.Status)
+	default:
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+}
+
+// newClient returns the client of the endpoints chosen by the users, which only connects to the
+// public addresses unless the private networks are allowed.
+func newClient(timeout time.Duration, allowPrivateNetworks bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivateNetworks {
+		// The address is checked once it's resolved, so the host can't resolve to a public
+		// address when it's validated and a private one when it's dialled.
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !public(ip) {
+				return fmt.Errorf("%w: %s", errPrivateNetwork, host)
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		// The proxies from the environment are not used, as they would dial the address
+		// instead.
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
+
+// validateURL checks the endpoint is an absolute HTTPS URL, which isn't a private address.
+func validateURL(endpoint string, allowPrivateNetworks bool) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidEndpoint, err)
+	}
+	if u.Host == "" || u.User != nil {
+		return fmt.Errorf("%w: must be an absolute URL without credentials", errInvalidEndpoint)
+	}
+	if u.Scheme != "https" && (u.Scheme != "http" || !allowPrivateNetworks) {
+		return fmt.Errorf("%w: must use https", errInvalidEndpoint)
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !public(ip) && !allowPrivateNetworks {
+		return fmt.Errorf("%w: %s", errPrivateNetwork, ip)
+	}
+	return nil
+}
+
+// public returns whether the address is in the public internet.
+func public(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !cgnat.Contains(ip)
+}
+
+// cgnat is the shared address space of the carrier-grade NATs, which is not routed on the
+// internet either.
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+var (
+	errInvalidEndpoint = errors.New("invalid endpoint")
+	errPrivateNetwork  = errors.New("address is not public")
+)
@@ -0,0 +1,106 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"api.safer.place/incident/v1"
+	"safer.place/internal/database"
+	"safer.place/internal/webpush"
+)
+
+// WebPushChannel is the name of the web push channel.
+const WebPushChannel = "webpush"
+
+// WebPushConfig of the alerts pushed to the browsers of the subscribers.
+type WebPushConfig struct {
+	// VAPID key and contact of the server. The channel is disabled without the key.
+	VAPID webpush.Config `yaml:"vapid"`
+	// Timeout of each delivery to the push service.
+	Timeout time.Duration `yaml:"timeout" default:"10s"`
+	// AllowPrivateNetworks allows the push services in the private networks and over plain
+	// HTTP, to test against a local push service. It must only be enabled in development.
+	AllowPrivateNetworks bool `yaml:"allow_private_networks" split_words:"true"`
+}
+
+// WebPush pushes the alerts to the browsers of the subscriptions. Their endpoint is the JSON of
+// the PushSubscription of the browser, subscribed with the ApplicationServerKey.
+type WebPush struct {
+	cfg    WebPushConfig
+	sender *webpush.Sender
+}
+
+// NewWebPush creates the web push channel.
+func NewWebPush(cfg WebPushConfig) (*WebPush, error) {
+	sender, err := webpush.New(cfg.VAPID,
+		webpush.Client(newClient(cfg.Timeout, cfg.AllowPrivateNetworks)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create web push sender: %w", err)
+	}
+
+	return &WebPush{
+		cfg:    cfg,
+		sender: sender,
+	}, nil
+}
+
+// ApplicationServerKey returns the VAPID public key the browsers subscribe with.
+func (w *WebPush) ApplicationServerKey() string {
+	return w.sender.PublicKey()
+}
+
+// Validate the endpoint is the push subscription of a browser, with the push service on an
+// HTTPS URL.
+func (w *WebPush) Validate(endpoint string) error {
+	if len(endpoint) > maxEndpoint {
+		return fmt.Errorf("%w: longer than %d bytes", errInvalidEndpoint, maxEndpoint)
+	}
+	sub, err := webpush.ParseSubscription([]byte(endpoint))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidEndpoint, err)
+	}
+	return validateURL(sub.Endpoint, w.cfg.AllowPrivateNetworks)
+}
+
+// Deliver pushes the alert to the browser. The subscriptions the push service no longer knows
+// are gone.
+func (w *WebPush) Deliver(ctx context.Context, sub *database.Subscription, i *incident.Incident) error {
+	push, err := webpush.ParseSubscription([]byte(sub.Endpoint))
+	if err != nil {
+		return err
+	}
+	payload, err := pushPayload(NewAlert(sub, i))
+	if err != nil {
+		return err
+	}
+
+	err = w.sender.Send(ctx, push, payload, webpush.UrgencyHigh)
+	if errors.Is(err, webpush.ErrGone) {
+		return fmt.Errorf("%w: %w", ErrGone, err)
+	}
+	return err
+}
+
+// pushPayload encodes the alert, shortening its description until it fits in a push message.
+func pushPayload(a Alert) ([]byte, error) {
+	for {
+		payload, err := json.Marshal(a)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode alert: %w", err)
+		}
+		if len(payload) <= webpush.MaxPayload || a.Description == "" {
+			return payload, nil
+		}
+
+		cut := len(a.Description) / 2
+		for cut > 0 && !utf8.RuneStart(a.Description[cut]) {
+			cut--
+		}
+		a.Description = a.Description[:cut]
+	}
+}
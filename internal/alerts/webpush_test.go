@@ -0,0 +1,147 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+
+	"safer.place/internal/config/secret"
+	"safer.place/internal/database"
+	"safer.place/internal/webpush"
+)
+
+// pushSubscription returns the push subscription of a browser, with the keys from the example
+// of RFC 8291.
+func pushSubscription(endpoint string) string {
+	sub, _ := json.Marshal(webpush.Subscription{
+		Endpoint: endpoint,
+		Keys: webpush.Keys{
+			P256dh: "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4",
+			Auth:   "BTBZMqHH6r4Tts7J_aSIgg",
+		},
+	})
+	return string(sub)
+}
+
+func newWebPush(t *testing.T, private bool) *WebPush {
+	key, _, err := webpush.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWebPush(WebPushConfig{
+		VAPID: webpush.Config{
+			Subject:    "mailto:admin@safer.place",
+			PrivateKey: secret.Secret(key),
+			TTL:        time.Hour,
+		},
+		Timeout:              time.Second,
+		AllowPrivateNetworks: private,
+	})
+	if err != nil {
+		t.Fatalf("NewWebPush() = %v", err)
+	}
+	return w
+}
+
+func TestWebPushDeliver(t *testing.T) {
+	status := http.StatusCreated
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("Urgency") != "high" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "vapid t=") {
+			t.Errorf("headers = %v, want an encrypted push message", r.Header)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sub := &database.Subscription{ID: "subscription", Endpoint: pushSubscription(server.URL + "/push/abc")}
+	inc := &incident.Incident{
+		Id:          "incident",
+		Coordinates: &incident.Coordinates{Lat: 53.3498, Lon: -6.2603},
+		Description: "Threatened with a weapon",
+	}
+
+	w := newWebPush(t, true)
+	if err := w.Deliver(context.Background(), sub, inc); err != nil {
+		t.Fatalf("Deliver() = %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("%d requests, want 1", requests)
+	}
+
+	status = http.StatusGone
+	if err := w.Deliver(context.Background(), sub, inc); !errors.Is(err, ErrGone) {
+		t.Errorf("Deliver() = %v, want %v", err, ErrGone)
+	}
+
+	// The test server is on the loopback address.
+	status = http.StatusCreated
+	w = newWebPush(t, false)
+	if err := w.Deliver(context.Background(), sub, inc); !errors.Is(err, errPrivateNetwork) {
+		t.Errorf("Deliver() = %v, want %v", err, errPrivateNetwork)
+	}
+}
+
+func TestWebPushValidate(t *testing.T) {
+	testCases := map[string]struct {
+		endpoint string
+		private  bool
+		err      error
+	}{
+		"valid": {
+			endpoint: pushSubscription("https://fcm.googleapis.com/fcm/send/abc"),
+		},
+		"url": {
+			endpoint: "https://fcm.googleapis.com/fcm/send/abc",
+			err:      errInvalidEndpoint,
+		},
+		"missing keys": {
+			endpoint: `{"endpoint": "https://fcm.googleapis.com/fcm/send/abc"}`,
+			err:      errInvalidEndpoint,
+		},
+		"http": {
+			endpoint: pushSubscription("http://fcm.googleapis.com/fcm/send/abc"),
+			err:      errInvalidEndpoint,
+		},
+		"local push service": {
+			endpoint: pushSubscription("http://localhost:8080/push/abc"),
+			private:  true,
+		},
+		"private address": {
+			endpoint: pushSubscription("https://10.0.0.1/push/abc"),
+			err:      errPrivateNetwork,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			w := newWebPush(t, tc.private)
+			if err := w.Validate(tc.endpoint); !errors.Is(err, tc.err) {
+				t.Errorf("Validate(%q) = %v, want %v", tc.endpoint, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestPushPayload(t *testing.T) {
+	payload, err := pushPayload(Alert{Description: strings.Repeat("ż", webpush.MaxPayload)})
+	if err != nil {
+		t.Fatalf("pushPayload() = %v", err)
+	}
+	var a Alert
+	if err := json.Unmarshal(payload, &a); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) > webpush.MaxPayload || a.Description == "" || strings.Trim(a.Description, "ż") != "" {
+		t.Errorf("payload of %d bytes, want the description shortened to fit", len(payload))
+	}
+}
@@ -5,12 +5,16 @@ package auth
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"safer.place/internal/database"
 	"safer.place/internal/log"
@@ -20,10 +24,21 @@ var (
 	ErrBadFormat = errors.New("authorization not in correct Bearer: $token format")
 )
 
+// sessionDuration is how long the reviewers stay logged in.
+const sessionDuration = time.Hour
+
 type githubTokenResponse struct {
 	AccessToken string `json:"access_token"`
 }
 
+type githubUserResponse struct {
+	// ID never changes, unlike the login which can be renamed and then claimed by someone else.
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
 // Configure the authentication. For now we just use Github
 // but if needed this can be expanded.
 type Config struct {
@@ -137,15 +152,39 @@ func (a *Auth) callback(w http.ResponseWriter, r *http.Request) {
 	}
 	resp.Body.Close()
 
-	if err := a.db.SaveSession(r.Context(), tokenData.AccessToken); err != nil {
+	user, err := a.githubUser(ctx, tokenData.AccessToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	id := strconv.FormatInt(user.ID, 10)
+	if err := a.db.SaveReviewer(ctx, &database.Reviewer{
+		ID:    id,
+		Name:  user.Name,
+		Email: user.Email,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The session is not the GitHub token, as we don't need to act on behalf of the reviewer
+	// and don't want to store their credentials.
+	session, err := newSession()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.db.SaveSession(ctx, session, id, time.Now().Add(sessionDuration)); err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     "Authorization",
-		Value:    "Bearer " + tokenData.AccessToken,
-		MaxAge:   3600,
+		Value:    "Bearer " + session,
+		MaxAge:   int(sessionDuration.Seconds()),
 		HttpOnly: true,
 		Path:     "/",
 		SameSite: http.SameSiteLaxMode,
@@ -154,6 +193,54 @@ func (a *Auth) callback(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, a.prefix, http.StatusTemporaryRedirect)
 }
 
+// RedirectWithSession redirects the authenticated reviewer to the URL, passing the session in the
+// URL fragment. This allows the review UI to be hosted on a different domain, where it can't read
+// the session cookie, and send it in the Authorization header instead.
+func RedirectWithSession(url string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := extractSession(r.Header)
+		http.Redirect(w, r, url+"#session="+session, http.StatusTemporaryRedirect)
+	})
+}
+
+// githubUser gets the details of the user who owns the access token.
+func (a *Auth) githubUser(ctx context.Context, accessToken string) (*githubUserResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/user", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get github user: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get github user: %s", resp.Status)
+	}
+
+	user := new(githubUserResponse)
+	if err := json.NewDecoder(resp.Body).Decode(user); err != nil {
+		return nil, fmt.Errorf("unable to decode github user: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, errors.New("unable to get github user: missing id")
+	}
+
+	return user, nil
+}
+
+func newSession() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate session: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 func (a *Auth) authenticated(r *http.Request) (bool, error) {
 	ctx := r.Context()
 	cookie, err := r.Cookie("Authorization")
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Identity of an authenticated user.
+type Identity struct {
+	// Subject uniquely identifies the user, qualified by the identity provider so the users of
+	// different providers never share a subject.
+	Subject string
+	// Email of the user, can be empty if the identity provider did not share it.
+	Email string
+}
+
+// Authenticator resolves the identity of the user making the request from the request headers.
+type Authenticator interface {
+	Authenticate(context.Context, http.Header) (*Identity, error)
+}
+
+// The prefixes of the subjects of each identity provider.
+const (
+	githubPrefix   = "github:"
+	oidcPrefix     = "oidc:"
+	insecurePrefix = "insecure:"
+)
+
+var (
+	errUnqualifiedSubject = errors.New("subject must start with github:, oidc: or insecure:")
+	errGitHubLogin        = errors.New("github subject must be the numeric user id, not the login")
+)
+
+// GitHubSubject returns the subject of the reviewer with the numeric GitHub user id. The logins
+// are not used, as they can be renamed and then claimed by someone else.
+func GitHubSubject(id string) string {
+	return githubPrefix + id
+}
+
+// OIDCSubject returns the subject of the user with the subject issued by the OpenID Connect
+// provider. The subjects are only unique within the issuer.
+func OIDCSubject(issuer, subject string) string {
+	return oidcPrefix + issuer + "|" + subject
+}
+
+// InsecureSubject returns the subject of the user trusted with the email.
+func InsecureSubject(email string) string {
+	return insecurePrefix + email
+}
+
+// ValidateSubject ensures the subject is qualified by its identity provider, such as the subjects
+// the roles are granted to.
+func ValidateSubject(subject string) error {
+	if id, ok := strings.CutPrefix(subject, githubPrefix); ok && id != "" {
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			return fmt.Errorf("%w: %q", errGitHubLogin, subject)
+		}
+		return nil
+	}
+	for _, prefix := range []string{githubPrefix, oidcPrefix, insecurePrefix} {
+		if rest, ok := strings.CutPrefix(subject, prefix); ok && rest != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", errUnqualifiedSubject, subject)
+}
+
+type firstAuthenticator []Authenticator
+
+// FirstOf authenticates the user with the first of the authenticators which succeeds, for the
+// routes used by both the users and the reviewers.
+func FirstOf(authenticators ...Authenticator) Authenticator {
+	return firstAuthenticator(authenticators)
+}
+
+// Authenticate the user with each authenticator in turn, returning the error of the last one if
+// none of them succeed.
+func (as firstAuthenticator) Authenticate(ctx context.Context, h http.Header) (*Identity, error) {
+	err := ErrUserUnauthenticated
+	for _, a := range as {
+		var id *Identity
+		if id, err = a.Authenticate(ctx, h); err == nil {
+			return id, nil
+		}
+	}
+	return nil, err
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of the context containing the identity.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the identity of the authenticated user, if there is one.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
@@ -4,43 +4,71 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"connectrpc.com/connect"
 	"safer.place/internal/database"
 )
 
-// NewAuthInterceptor checks each request for valid session.
-func NewAuthInterceptor(db database.Database) connect.UnaryInterceptorFunc {
+// NewAuthInterceptor checks each request for valid reviewer session, and adds the reviewer
+// identity to the request context.
+func NewAuthInterceptor(db database.Sessions) connect.UnaryInterceptorFunc {
+	sessions := NewSessionAuthenticator(db)
+
 	return connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
 		return connect.UnaryFunc(func(
 			ctx context.Context,
 			req connect.AnyRequest,
 		) (connect.AnyResponse, error) {
-			session := extractSession(req.Header().Values("Cookie"))
-			if session == "" {
-				return nil,
-					connect.NewError(connect.CodeUnauthenticated, errors.New("no valid token"))
-			}
-
-			if err := db.IsValidSession(ctx, session); err != nil {
-				return nil,
-					connect.NewError(connect.CodeUnauthenticated, fmt.Errorf("invalid session: %w", err))
+			id, err := sessions.Authenticate(ctx, req.Header())
+			if err != nil {
+				return nil, connect.NewError(connect.CodeUnauthenticated, ErrUserUnauthenticated)
 			}
 
-			return next(ctx, req)
+			return next(WithIdentity(ctx, id), req)
 		})
 	})
 }
 
-func extractSession(cookies []string) string {
-	for _, cookie := range cookies {
-		if strings.HasPrefix(cookie, `Authorization="Bearer `) {
-			session := strings.TrimPrefix(cookie, `Authorization="Bearer `)
-			session = strings.TrimSuffix(session, `"`)
-			return session
-		}
+type sessionAuthenticator struct {
+	db database.Sessions
+}
+
+// NewSessionAuthenticator authenticates the reviewers by the session they got when logging in.
+func NewSessionAuthenticator(db database.Sessions) Authenticator {
+	return sessionAuthenticator{db: db}
+}
+
+// Authenticate the reviewer by the session in the request headers.
+func (a sessionAuthenticator) Authenticate(ctx context.Context, h http.Header) (*Identity, error) {
+	session := extractSession(h)
+	if session == "" {
+		return nil, errors.New("no valid token")
 	}
 
-	return ""
+	reviewer, err := a.db.SessionReviewer(ctx, session)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session: %w", err)
+	}
+
+	return &Identity{
+		Subject: GitHubSubject(reviewer.ID),
+		Email:   reviewer.Email,
+	}, nil
+}
+
+// extractSession gets the session from the Authorization header, used when the review UI is
+// hosted on another domain, or from the cookie set when logging in.
+func extractSession(h http.Header) string {
+	if session, err := BearerToken(h); err == nil {
+		return session
+	}
+
+	cookie, err := (&http.Request{Header: h}).Cookie("Authorization")
+	if err != nil {
+		return ""
+	}
+	session, _ := strings.CutPrefix(cookie.Value, "Bearer ")
+	return session
 }
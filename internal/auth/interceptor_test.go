@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"connectrpc.com/connect"
+
+	"safer.place/internal/database"
+)
+
+type fakeSessions struct {
+	database.Sessions
+	reviewers map[string]*database.Reviewer
+}
+
+func (s fakeSessions) SessionReviewer(_ context.Context, session string) (*database.Reviewer, error) {
+	if r, ok := s.reviewers[session]; ok {
+		return r, nil
+	}
+	return nil, database.ErrDoesNotExist
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	sessions := fakeSessions{reviewers: map[string]*database.Reviewer{
+		"reviewer-session": {ID: "1234"},
+	}}
+
+	var got *Identity
+	handler := NewAuthInterceptor(sessions)(
+		func(ctx context.Context, _ connect.AnyRequest) (connect.AnyResponse, error) {
+			got, _ = IdentityFromContext(ctx)
+			return nil, nil
+		},
+	)
+
+	testCases := map[string]struct {
+		header string
+		cookie string
+		code   connect.Code
+	}{
+		"bearer":    {header: "Bearer reviewer-session"},
+		"cookie":    {cookie: `Authorization="Bearer reviewer-session"`},
+		"missing":   {code: connect.CodeUnauthenticated},
+		"unknown":   {header: "Bearer unknown", code: connect.CodeUnauthenticated},
+		"malformed": {header: "reviewer-session", code: connect.CodeUnauthenticated},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got = nil
+			req := connect.NewRequest(&struct{}{})
+			if tc.header != "" {
+				req.Header().Set("Authorization", tc.header)
+			}
+			if tc.cookie != "" {
+				req.Header().Set("Cookie", tc.cookie)
+			}
+
+			_, err := handler(context.Background(), req)
+			if tc.code != 0 {
+				var connectErr *connect.Error
+				if !errors.As(err, &connectErr) || connectErr.Code() != tc.code {
+					t.Fatalf("err = %v, want code %v", err, tc.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if got == nil || got.Subject != "github:1234" {
+				t.Errorf("identity = %+v, want subject %q", got, "github:1234")
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errUnknownKey = errors.New("oidc: unknown signing key")
+
+// minRefreshInterval limits how often the keys are fetched when a token signed with an unknown key
+// is received, so we can't be used to flood the issuer.
+const minRefreshInterval = 10 * time.Second
+
+// keySet caches the issuer signing keys, refreshing them when they expire or when a token is
+// signed with a key we haven't seen yet, which happens when the issuer rotates the keys.
+type keySet struct {
+	client        *http.Client
+	issuer        string
+	cacheDuration time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func newKeySet(client *http.Client, issuer string, cacheDuration time.Duration) *keySet {
+	return &keySet{
+		client:        client,
+		issuer:        strings.TrimSuffix(issuer, "/"),
+		cacheDuration: cacheDuration,
+	}
+}
+
+func (ks *keySet) get(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	sinceFetch := time.Since(ks.fetchedAt)
+	if key, ok := ks.keys[kid]; ok && sinceFetch < ks.cacheDuration {
+		return key, nil
+	}
+
+	if ks.keys == nil || sinceFetch >= minRefreshInterval {
+		keys, err := ks.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ks.keys = keys
+		ks.fetchedAt = time.Now()
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownKey, kid)
+	}
+	return key, nil
+}
+
+type discovery struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+func (ks *keySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var d discovery
+	if err := ks.getJSON(ctx, ks.issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("unable to get discovery document: %w", err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != ks.issuer {
+		return nil, fmt.Errorf("discovery document is for a different issuer %q", d.Issuer)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := ks.getJSON(ctx, d.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("unable to get signing keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Skip the keys we don't understand, the issuer might publish keys for algorithms
+			// we don't support.
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	return keys, nil
+}
+
+func (ks *keySet) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
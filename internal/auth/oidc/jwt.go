@@ -0,0 +1,97 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// algorithms are the supported signing algorithms. The "none" algorithm is deliberately missing.
+var algorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// verifySignature checks the token is signed by one of the issuer keys and returns the decoded
+// payload.
+func (v *Verifier) verifySignature(ctx context.Context, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: expected 3 parts, got %d", ErrInvalidToken, len(parts))
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to decode header: %v", ErrInvalidToken, err)
+	}
+	var h header
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return nil, fmt.Errorf("%w: unable to decode header: %v", ErrInvalidToken, err)
+	}
+
+	hash, ok := algorithms[h.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, h.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to decode signature: %v", ErrInvalidToken, err)
+	}
+
+	key, err := v.keys.get(ctx, h.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := hash.New()
+	hasher.Write([]byte(parts[0] + "." + parts[1]))
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(h.Algorithm, "RS") {
+			return nil, fmt.Errorf("%w: %s can't be used with an RSA key", ErrInvalidToken, h.Algorithm)
+		}
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+			return nil, fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(h.Algorithm, "ES") {
+			return nil, fmt.Errorf("%w: %s can't be used with an EC key", ErrInvalidToken, h.Algorithm)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return nil, fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return nil, fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidToken, key)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to decode payload: %v", ErrInvalidToken, err)
+	}
+
+	return payload, nil
+}
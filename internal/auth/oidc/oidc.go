@@ -0,0 +1,141 @@
+// Copyright 2024 SaferPlace
+
+// Package oidc authenticates users using the ID tokens issued by an OpenID Connect provider.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"safer.place/internal/auth"
+)
+
+var (
+	ErrInvalidToken = errors.New("oidc: invalid token")
+	ErrExpired      = errors.New("oidc: token expired")
+)
+
+// Config of the OpenID Connect provider.
+type Config struct {
+	// Issuer is the URL of the identity provider, the discovery document is expected at
+	// $issuer/.well-known/openid-configuration.
+	Issuer string `yaml:"issuer"`
+	// Audience is the client ID the tokens must be issued for.
+	Audience string `yaml:"audience"`
+	// KeysCacheDuration is how long the signing keys are cached before they are fetched again.
+	KeysCacheDuration time.Duration `yaml:"keys_cache_duration" default:"1h"`
+	// Leeway allows for small clock differences when checking the token expiry.
+	Leeway time.Duration `yaml:"leeway" default:"1m"`
+}
+
+// Verifier verifies the ID tokens signed by the issuer.
+type Verifier struct {
+	issuer   string
+	audience string
+	leeway   time.Duration
+
+	client *http.Client
+	keys   *keySet
+}
+
+// New creates a new verifier. The signing keys are fetched on the first verification.
+func New(cfg *Config, opts ...Option) (*Verifier, error) {
+	v := &Verifier{
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		leeway:   cfg.Leeway,
+		client:   http.DefaultClient,
+	}
+
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	if err := validate(v); err != nil {
+		return nil, err
+	}
+
+	v.keys = newKeySet(v.client, v.issuer, cfg.KeysCacheDuration)
+
+	return v, nil
+}
+
+// Authenticate verifies the bearer token in the Authorization header.
+func (v *Verifier) Authenticate(ctx context.Context, h http.Header) (*auth.Identity, error) {
+	token, err := auth.BearerToken(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.Verify(ctx, token)
+}
+
+type claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	Expiry        int64    `json:"exp"`
+	NotBefore     int64    `json:"nbf"`
+	Email         string   `json:"email"`
+	EmailVerified *bool    `json:"email_verified"`
+}
+
+// Verify the token signature and claims, returning the identity of the user.
+func (v *Verifier) Verify(ctx context.Context, token string) (*auth.Identity, error) {
+	payload, err := v.verifySignature(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, fmt.Errorf("%w: unable to decode claims: %v", ErrInvalidToken, err)
+	}
+
+	now := time.Now()
+	switch {
+	case c.Issuer != v.issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, c.Issuer)
+	case !slices.Contains(c.Audience, v.audience):
+		return nil, fmt.Errorf("%w: not issued for %q", ErrInvalidToken, v.audience)
+	case c.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	case c.Expiry == 0:
+		return nil, fmt.Errorf("%w: missing expiry", ErrInvalidToken)
+	case now.Add(-v.leeway).After(time.Unix(c.Expiry, 0)):
+		return nil, ErrExpired
+	case c.NotBefore != 0 && now.Add(v.leeway).Before(time.Unix(c.NotBefore, 0)):
+		return nil, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+
+	id := &auth.Identity{Subject: auth.OIDCSubject(c.Issuer, c.Subject)}
+	// Only trust the email if the provider didn't tell us it wasn't verified.
+	if c.EmailVerified == nil || *c.EmailVerified {
+		id.Email = c.Email
+	}
+
+	return id, nil
+}
+
+// audience can either be a single string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
@@ -0,0 +1,151 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"safer.place/internal/auth"
+	"safer.place/internal/auth/oidc/oidctest"
+)
+
+func newTestVerifier(t *testing.T, iss *oidctest.Issuer) *Verifier {
+	t.Helper()
+
+	v, err := New(&Config{
+		Issuer:            iss.URL(),
+		Audience:          "saferplace",
+		KeysCacheDuration: time.Hour,
+		Leeway:            time.Second,
+	})
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	iss := oidctest.NewIssuer()
+	defer iss.Close()
+	other := oidctest.NewIssuer()
+	defer other.Close()
+
+	v := newTestVerifier(t, iss)
+
+	testCases := map[string]struct {
+		token func() string
+		err   error
+	}{
+		"valid": {
+			token: func() string { return iss.Token(iss.Claims("user", "saferplace")) },
+		},
+		"audience list": {
+			token: func() string {
+				c := iss.Claims("user", "")
+				c["aud"] = []string{"other", "saferplace"}
+				return iss.Token(c)
+			},
+		},
+		"wrong audience": {
+			token: func() string { return iss.Token(iss.Claims("user", "other")) },
+			err:   ErrInvalidToken,
+		},
+		"wrong issuer": {
+			token: func() string {
+				c := iss.Claims("user", "saferplace")
+				c["iss"] = other.URL()
+				return iss.Token(c)
+			},
+			err: ErrInvalidToken,
+		},
+		"expired": {
+			token: func() string {
+				c := iss.Claims("user", "saferplace")
+				c["exp"] = time.Now().Add(-time.Minute).Unix()
+				return iss.Token(c)
+			},
+			err: ErrExpired,
+		},
+		"not valid yet": {
+			token: func() string {
+				c := iss.Claims("user", "saferplace")
+				c["nbf"] = time.Now().Add(time.Minute).Unix()
+				return iss.Token(c)
+			},
+			err: ErrInvalidToken,
+		},
+		"missing subject": {
+			token: func() string { return iss.Token(iss.Claims("", "saferplace")) },
+			err:   ErrInvalidToken,
+		},
+		"signed by another issuer": {
+			token: func() string { return other.Token(iss.Claims("user", "saferplace")) },
+			err:   ErrInvalidToken,
+		},
+		"algorithm none": {
+			token: func() string {
+				parts := strings.Split(iss.Token(iss.Claims("user", "saferplace")), ".")
+				return "eyJhbGciOiJub25lIn0." + parts[1] + "."
+			},
+			err: ErrInvalidToken,
+		},
+		"malformed": {
+			token: func() string { return "not.a.token" },
+			err:   ErrInvalidToken,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			id, err := v.Verify(context.Background(), tc.token())
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Verify() = %v, want %v", err, tc.err)
+			}
+			if want := auth.OIDCSubject(iss.URL(), "user"); err == nil && id.Subject != want {
+				t.Errorf("Verify().Subject = %q, want %q", id.Subject, want)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	iss := oidctest.NewIssuer()
+	defer iss.Close()
+
+	v := newTestVerifier(t, iss)
+	// Make sure the keys are cached before the rotation
+	if _, err := v.Verify(context.Background(), iss.Token(iss.Claims("user", "saferplace"))); err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+
+	iss.RotateKey()
+	v.keys.fetchedAt = time.Now().Add(-minRefreshInterval)
+
+	if _, err := v.Verify(context.Background(), iss.Token(iss.Claims("user", "saferplace"))); err != nil {
+		t.Errorf("Verify() after rotation = %v", err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	iss := oidctest.NewIssuer()
+	defer iss.Close()
+
+	v := newTestVerifier(t, iss)
+
+	h := make(http.Header)
+	if _, err := v.Authenticate(context.Background(), h); !errors.Is(err, auth.ErrUserUnauthenticated) {
+		t.Errorf("Authenticate() without a token = %v, want %v", err, auth.ErrUserUnauthenticated)
+	}
+
+	h.Set("Authorization", "Bearer "+iss.Token(iss.Claims("user", "saferplace")))
+	id, err := v.Authenticate(context.Background(), h)
+	if err != nil {
+		t.Fatalf("Authenticate() = %v", err)
+	}
+	if id.Email != "user@example.com" {
+		t.Errorf("Authenticate().Email = %q, want %q", id.Email, "user@example.com")
+	}
+}
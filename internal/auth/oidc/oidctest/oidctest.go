@@ -0,0 +1,138 @@
+// Package oidctest provides a local OpenID Connect issuer to test the token verification without
+// an identity provider.
+package oidctest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Issuer is a local issuer serving the discovery document and the signing keys.
+type Issuer struct {
+	server *httptest.Server
+
+	mu  sync.Mutex
+	kid int
+	key *ecdsa.PrivateKey
+}
+
+// NewIssuer starts a new issuer. It must be closed once the test is done.
+func NewIssuer() *Issuer {
+	iss := &Issuer{}
+	iss.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   iss.URL(),
+			"jwks_uri": iss.URL() + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{publicKey(iss.keyID(), iss.key)},
+		})
+	})
+	iss.server = httptest.NewServer(mux)
+
+	return iss
+}
+
+// URL of the issuer
+func (iss *Issuer) URL() string {
+	return iss.server.URL
+}
+
+// Close the issuer
+func (iss *Issuer) Close() {
+	iss.server.Close()
+}
+
+// RotateKey replaces the signing key with a new one.
+func (iss *Issuer) RotateKey() {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.kid++
+	iss.key = key
+}
+
+// Claims returns valid claims for the subject and audience, which can be modified before signing.
+func (iss *Issuer) Claims(subject, audience string) map[string]any {
+	return map[string]any{
+		"iss":   iss.URL(),
+		"sub":   subject,
+		"aud":   audience,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"email": subject + "@example.com",
+	}
+}
+
+// Token signs the claims with the current signing key using ES256.
+func (iss *Issuer) Token(claims map[string]any) string {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	return sign(iss.keyID(), iss.key, claims)
+}
+
+func (iss *Issuer) keyID() string {
+	return fmt.Sprintf("key-%d", iss.kid)
+}
+
+func sign(kid string, key *ecdsa.PrivateKey, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+
+	signed := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return signed + "." + encode(signature)
+}
+
+func publicKey(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"use": "sig",
+		"kid": kid,
+		"x":   encodeInt(key.X),
+		"y":   encodeInt(key.Y),
+	}
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func encodeInt(i *big.Int) string {
+	b := make([]byte, 32)
+	i.FillBytes(b)
+	return encode(b)
+}
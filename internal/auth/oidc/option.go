@@ -0,0 +1,35 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Option configures the verifier
+type Option func(*Verifier)
+
+// HTTPClient used to fetch the issuer signing keys.
+func HTTPClient(c *http.Client) Option {
+	return func(v *Verifier) {
+		v.client = c
+	}
+}
+
+var (
+	errMissingIssuer   = errors.New("missing issuer")
+	errMissingAudience = errors.New("missing audience")
+	errMissingClient   = errors.New("missing http client")
+)
+
+func validate(v *Verifier) error {
+	if v.issuer == "" {
+		return errMissingIssuer
+	}
+	if v.audience == "" {
+		return errMissingAudience
+	}
+	if v.client == nil {
+		return errMissingClient
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package rbac
+
+import (
+	"errors"
+
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+)
+
+// Option configures the policy
+type Option func(*Policy)
+
+// RoleStore from which the user roles are read. Without it every user has the default role.
+func RoleStore(roles database.Roles) Option {
+	return func(p *Policy) {
+		p.roles = roles
+	}
+}
+
+// DefaultRole of the users who haven't been granted any role.
+func DefaultRole(role Role) Option {
+	return func(p *Policy) {
+		p.defaultRole = role
+	}
+}
+
+// Logger used by the policy
+func Logger(l log.Logger) Option {
+	return func(p *Policy) {
+		p.log = l
+	}
+}
+
+var (
+	errMissingDefaultRole = errors.New("missing default role")
+	errMissingLogger      = errors.New("missing logger")
+)
+
+func validate(p *Policy) error {
+	if p.defaultRole == "" {
+		return errMissingDefaultRole
+	}
+	if p.log == nil {
+		return errMissingLogger
+	}
+	return nil
+}
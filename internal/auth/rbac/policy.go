@@ -0,0 +1,278 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"api.safer.place/report/v1/reportconnect"
+	"api.safer.place/review/v1/reviewconnect"
+	"api.safer.place/viewer/v1/viewerconnect"
+	"connectrpc.com/connect"
+	"github.com/saferplace/webserver-go/middleware"
+
+	"safer.place/internal/auth"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/service"
+)
+
+var (
+	ErrUnauthenticated  = errors.New("rbac: user unauthenticated")
+	ErrPermissionDenied = errors.New("rbac: permission denied")
+	// errUndeclared is returned for procedures and routes which are missing from the permissions
+	// table, so we don't expose anything by accident.
+	errUndeclared = errors.New("rbac: procedure has no declared permission")
+)
+
+// permissions required to call each connect procedure or HTTP route.
+var permissions = map[string]Permission{
+	reportconnect.ReportServiceSendReportProcedure: PermissionReportIncidents,
+
+	viewerconnect.ViewerServiceViewInRadiusProcedure: PermissionViewIncidents,
+	viewerconnect.ViewerServiceViewInRegionProcedure: PermissionViewIncidents,
+	viewerconnect.ViewerServiceViewIncidentProcedure: PermissionViewIncidents,
+	viewerconnect.ViewerServiceViewAlertingProcedure: PermissionViewIncidents,
+
+	reviewconnect.ReviewServiceIncidentsWithoutReviewProcedure: PermissionReviewIncidents,
+	reviewconnect.ReviewServiceViewIncidentProcedure:           PermissionReviewIncidents,
+	reviewconnect.ReviewServiceReviewIncidentProcedure:         PermissionReviewIncidents,
+
+	"/v1/upload": PermissionUploadImages,
+	// The unpublished images additionally require PermissionReviewIncidents, which is checked
+	// by the image service.
+	"/v1/image/":  PermissionViewIncidents,
+	"/v1/redact/": PermissionReviewIncidents,
+	// The users can only list and delete their own subscriptions, which is checked by the
+	// subscription service.
+	"/v1/subscriptions/": PermissionSubscribeAlerts,
+	// The feed only streams the published incidents.
+	"/v1/feed":   PermissionViewIncidents,
+	"/v1/roles/": PermissionManageRoles,
+}
+
+// route returns the declared route of the HTTP path. The routes ending with a slash match all
+// the paths below them, same as the patterns of http.ServeMux.
+func route(path string) string {
+	if _, ok := permissions[path]; ok {
+		return path
+	}
+
+	var longest string
+	for r := range permissions {
+		if strings.HasSuffix(r, "/") && strings.HasPrefix(path, r) && len(r) > len(longest) {
+			longest = r
+		}
+	}
+	if longest == "" {
+		return path
+	}
+	return longest
+}
+
+// Policy enforces the permissions on the requests of the authenticated users. The users must be
+// authenticated before the policy is enforced.
+type Policy struct {
+	roles       database.Roles
+	defaultRole Role
+	log         log.Logger
+}
+
+// New creates a new policy.
+func New(opts ...Option) (*Policy, error) {
+	p := &Policy{
+		defaultRole: RoleReporter,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p, validate(p)
+}
+
+// Authorize checks if the user in the context is allowed to call the procedure.
+func (p *Policy) Authorize(ctx context.Context, procedure string) error {
+	permission, ok := permissions[procedure]
+	if !ok {
+		return fmt.Errorf("%w: %s", errUndeclared, procedure)
+	}
+
+	if err := p.Check(ctx, permission); err != nil {
+		return fmt.Errorf("%s: %w", procedure, err)
+	}
+
+	return nil
+}
+
+// Check if the user in the context has the permission.
+func (p *Policy) Check(ctx context.Context, permission Permission) error {
+	id, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	roles, err := p.userRoles(ctx, id.Subject)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		if role.Has(permission) {
+			return nil
+		}
+	}
+
+	p.log.Debug(ctx, "permission denied",
+		slog.String("subject", id.Subject),
+		slog.String("permission", string(permission)),
+	)
+
+	return fmt.Errorf("%w: requires %s", ErrPermissionDenied, permission)
+}
+
+// userRoles returns the roles granted to the user, or the default role if they don't have any.
+func (p *Policy) userRoles(ctx context.Context, subject string) ([]Role, error) {
+	if p.roles == nil {
+		return []Role{p.defaultRole}, nil
+	}
+
+	granted, err := p.roles.UserRoles(ctx, subject)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get user roles: %w", err)
+	}
+	if len(granted) == 0 {
+		return []Role{p.defaultRole}, nil
+	}
+
+	roles := make([]Role, 0, len(granted))
+	for _, r := range granted {
+		role, err := ParseRole(r)
+		if err != nil {
+			// A role we don't know about doesn't grant anything, it was probably removed.
+			p.log.Warn(ctx, "ignoring unknown role",
+				slog.String("subject", subject),
+				slog.String("role", r),
+			)
+			continue
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+// Interceptor enforces the policy on the connect procedures, including the streaming ones.
+func (p *Policy) Interceptor() connect.Interceptor {
+	return &interceptor{policy: p}
+}
+
+type interceptor struct {
+	policy *Policy
+}
+
+func (i *interceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return connect.UnaryFunc(func(
+		ctx context.Context,
+		req connect.AnyRequest,
+	) (connect.AnyResponse, error) {
+		if err := i.policy.Authorize(ctx, req.Spec().Procedure); err != nil {
+			return nil, connect.NewError(errorCode(err), err)
+		}
+
+		return next(ctx, req)
+	})
+}
+
+// WrapStreamingClient is a no-op, as the policy is only enforced by the handlers.
+func (i *interceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *interceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return connect.StreamingHandlerFunc(func(
+		ctx context.Context,
+		conn connect.StreamingHandlerConn,
+	) error {
+		if err := i.policy.Authorize(ctx, conn.Spec().Procedure); err != nil {
+			return connect.NewError(errorCode(err), err)
+		}
+
+		return next(ctx, conn)
+	})
+}
+
+// Middleware enforces the policy on the HTTP routes which are not connect services.
+func (p *Policy) Middleware() middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if err := p.Authorize(req.Context(), route(req.URL.Path)); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// Attach the policy to the service. The interceptor is used for the connect services, and the
+// middleware for the services registered on the path of an HTTP route. Attaching a service
+// which has no declared permission panics, so it can't be served without authorization.
+func (p *Policy) Attach(svc service.Service) service.Service {
+	return func(interceptors ...connect.Interceptor) (string, http.Handler) {
+		path, handler := svc(append(slices.Clip(interceptors), p.Interceptor())...)
+		switch {
+		case hasProcedures(path):
+			// The procedures are authorized by the interceptor.
+		case declared(path):
+			handler = p.Middleware()(handler)
+		default:
+			panic(fmt.Errorf("%w: %s", errUndeclared, path))
+		}
+		return path, handler
+	}
+}
+
+// declared returns whether the path is a declared HTTP route.
+func declared(path string) bool {
+	_, ok := permissions[path]
+	return ok
+}
+
+// hasProcedures returns whether the path is the prefix of a connect service with declared
+// procedures.
+func hasProcedures(path string) bool {
+	for procedure := range permissions {
+		if procedure != path && strings.HasPrefix(procedure, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func errorCode(err error) connect.Code {
+	switch {
+	case errors.Is(err, ErrUnauthenticated):
+		return connect.CodeUnauthenticated
+	case errors.Is(err, ErrPermissionDenied), errors.Is(err, errUndeclared):
+		return connect.CodePermissionDenied
+	default:
+		return connect.CodeInternal
+	}
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrPermissionDenied), errors.Is(err, errUndeclared):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,137 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api.safer.place/review/v1/reviewconnect"
+	"api.safer.place/viewer/v1/viewerconnect"
+
+	"safer.place/internal/auth"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+)
+
+type fakeRoles struct {
+	database.Roles
+	grants map[string][]string
+}
+
+func (r fakeRoles) UserRoles(_ context.Context, subject string) ([]string, error) {
+	return r.grants[subject], nil
+}
+
+func TestAuthorize(t *testing.T) {
+	p, err := New(
+		RoleStore(fakeRoles{grants: map[string][]string{
+			"reviewer": {"reviewer"},
+			"admin":    {"admin"},
+			"unknown":  {"superuser"},
+		}}),
+		Logger(log.New(slog.Default().Handler())),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		subject   string
+		procedure string
+		want      error
+	}{
+		"default role can view": {
+			subject:   "someone",
+			procedure: viewerconnect.ViewerServiceViewIncidentProcedure,
+		},
+		"default role can't review": {
+			subject:   "someone",
+			procedure: reviewconnect.ReviewServiceReviewIncidentProcedure,
+			want:      ErrPermissionDenied,
+		},
+		"reviewer can review": {
+			subject:   "reviewer",
+			procedure: reviewconnect.ReviewServiceReviewIncidentProcedure,
+		},
+		"reviewer can upload": {
+			subject:   "reviewer",
+			procedure: "/v1/upload",
+		},
+		"admin can review": {
+			subject:   "admin",
+			procedure: reviewconnect.ReviewServiceIncidentsWithoutReviewProcedure,
+		},
+		"unknown roles grant nothing": {
+			subject:   "unknown",
+			procedure: viewerconnect.ViewerServiceViewIncidentProcedure,
+			want:      ErrPermissionDenied,
+		},
+		"unauthenticated": {
+			procedure: viewerconnect.ViewerServiceViewIncidentProcedure,
+			want:      ErrUnauthenticated,
+		},
+		"undeclared procedure": {
+			subject:   "admin",
+			procedure: "/admin.v1.AdminService/DropEverything",
+			want:      errUndeclared,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.subject != "" {
+				ctx = auth.WithIdentity(ctx, &auth.Identity{Subject: tc.subject})
+			}
+
+			if err := p.Authorize(ctx, tc.procedure); !errors.Is(err, tc.want) {
+				t.Errorf("Authorize(%q, %q) = %v, want %v", tc.subject, tc.procedure, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	p, err := New(
+		DefaultRole(RoleReporter),
+		Logger(log.New(slog.Default().Handler())),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := p.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	testCases := map[string]struct {
+		path          string
+		authenticated bool
+		want          int
+	}{
+		"allowed":         {path: "/v1/upload", authenticated: true, want: http.StatusNoContent},
+		"unauthenticated": {path: "/v1/upload", want: http.StatusUnauthorized},
+		"undeclared":      {path: "/v1/other", authenticated: true, want: http.StatusForbidden},
+		"subtree":         {path: "/v1/image/reference", authenticated: true, want: http.StatusNoContent},
+		"not a subtree":   {path: "/v1/upload/reference", authenticated: true, want: http.StatusForbidden},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+			if tc.authenticated {
+				req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Subject: "user"}))
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
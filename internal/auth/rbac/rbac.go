@@ -0,0 +1,76 @@
+// Package rbac decides what the authenticated users are allowed to do based on the roles they
+// have been granted.
+package rbac
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Role groups the permissions granted to a user.
+type Role string
+
+const (
+	// RoleReporter can report incidents and view the published ones. It is the role of every
+	// authenticated user who hasn't been granted any other role.
+	RoleReporter Role = "reporter"
+	// RoleReviewer can review the reported incidents.
+	RoleReviewer Role = "reviewer"
+	// RoleModerator can moderate the incidents after they have been reviewed.
+	RoleModerator Role = "moderator"
+	// RoleAdmin can do everything, including granting and revoking the roles of the users.
+	RoleAdmin Role = "admin"
+)
+
+// Permission to perform an action.
+type Permission string
+
+const (
+	PermissionReportIncidents   Permission = "incidents.report"
+	PermissionUploadImages      Permission = "images.upload"
+	PermissionViewIncidents     Permission = "incidents.view"
+	PermissionReviewIncidents   Permission = "incidents.review"
+	PermissionModerateIncidents Permission = "incidents.moderate"
+	PermissionSubscribeAlerts   Permission = "alerts.subscribe"
+	PermissionManageRoles       Permission = "roles.manage"
+)
+
+var (
+	reporterPermissions = []Permission{
+		PermissionReportIncidents,
+		PermissionUploadImages,
+		PermissionViewIncidents,
+		PermissionSubscribeAlerts,
+	}
+	reviewerPermissions  = append(slices.Clip(reporterPermissions), PermissionReviewIncidents)
+	moderatorPermissions = append(slices.Clip(reviewerPermissions), PermissionModerateIncidents)
+	adminPermissions     = append(slices.Clip(moderatorPermissions), PermissionManageRoles)
+)
+
+// rolePermissions lists the permissions of each role. Each role has all the permissions of the
+// roles before it.
+var rolePermissions = map[Role][]Permission{
+	RoleReporter:  reporterPermissions,
+	RoleReviewer:  reviewerPermissions,
+	RoleModerator: moderatorPermissions,
+	RoleAdmin:     adminPermissions,
+}
+
+// ParseRole ensures the role is one we know about.
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := rolePermissions[role]; !ok {
+		return "", fmt.Errorf("unrecognised role %q", s)
+	}
+	return role, nil
+}
+
+// Roles returns all the known roles.
+func Roles() []Role {
+	return []Role{RoleReporter, RoleReviewer, RoleModerator, RoleAdmin}
+}
+
+// Has returns true if the role has the permission.
+func (r Role) Has(p Permission) bool {
+	return slices.Contains(rolePermissions[r], p)
+}
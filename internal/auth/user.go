@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strings"
 
 	"connectrpc.com/connect"
 	"github.com/saferplace/webserver-go/middleware"
@@ -13,35 +14,66 @@ var (
 	ErrUserUnauthenticated = errors.New("user unauthenticated")
 )
 
-// NewUserAuthInterceptor in the future will extract the tokens sent by the users to then convert
-// them into the user emails, but for now it just reads the user email and does nothing with it, but
-// does not let the request through if the header is missing.
-func NewUserAuthInterceptor() connect.UnaryInterceptorFunc {
+// NewUserAuthInterceptor authenticates the user using the authenticator, and adds their identity
+// to the request context. Requests without a valid identity are rejected.
+func NewUserAuthInterceptor(a Authenticator) connect.UnaryInterceptorFunc {
 	return connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
 		return connect.UnaryFunc(func(
 			ctx context.Context,
 			req connect.AnyRequest,
 		) (connect.AnyResponse, error) {
-			emailHeader := req.Header().Get("X-Email")
-			if emailHeader == "" {
+			id, err := a.Authenticate(ctx, req.Header())
+			if err != nil {
 				return nil, connect.NewError(connect.CodeUnauthenticated, ErrUserUnauthenticated)
 			}
 
-			return next(ctx, req)
+			return next(WithIdentity(ctx, id), req)
 		})
 	})
 }
 
-// NewUserAuthMiddleware
-func NewUserAuthMiddleware() middleware.Middleware {
+// NewUserAuthMiddleware is the HTTP equivalent of [NewUserAuthInterceptor], used for the
+// services which are not connect services.
+func NewUserAuthMiddleware(a Authenticator) middleware.Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			emailHeader := req.Header.Get("X-Email")
-			if emailHeader == "" {
+			id, err := a.Authenticate(req.Context(), req.Header)
+			if err != nil {
+				// The reason is not shared with the user, as it can reveal how the tokens are
+				// verified.
 				http.Error(w, ErrUserUnauthenticated.Error(), http.StatusUnauthorized)
 				return
 			}
-			next.ServeHTTP(w, req)
+			next.ServeHTTP(w, req.WithContext(WithIdentity(req.Context(), id)))
 		})
 	}
 }
+
+// BearerToken extracts the token from the `Authorization: Bearer $token` header.
+func BearerToken(h http.Header) (string, error) {
+	header := h.Get("Authorization")
+	if header == "" {
+		return "", ErrUserUnauthenticated
+	}
+
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return "", ErrBadFormat
+	}
+
+	return token, nil
+}
+
+// InsecureEmail trusts the email sent by the user in the X-Email header. It performs no
+// verification and must only be used for development.
+type InsecureEmail struct{}
+
+// Authenticate reads the user email from the X-Email header.
+func (InsecureEmail) Authenticate(_ context.Context, h http.Header) (*Identity, error) {
+	email := h.Get("X-Email")
+	if email == "" {
+		return nil, ErrUserUnauthenticated
+	}
+
+	return &Identity{Subject: InsecureSubject(email), Email: email}, nil
+}
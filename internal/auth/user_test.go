@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUserAuthMiddleware(t *testing.T) {
+	var got *Identity
+	handler := NewUserAuthMiddleware(InsecureEmail{})(
+		http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			got, _ = IdentityFromContext(r.Context())
+		}),
+	)
+
+	testCases := map[string]struct {
+		email  string
+		status int
+	}{
+		"authenticated":   {email: "user@example.com", status: http.StatusOK},
+		"unauthenticated": {status: http.StatusUnauthorized},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tc.email != "" {
+				req.Header.Set("X-Email", tc.email)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Errorf("status = %d, want %d", rec.Code, tc.status)
+			}
+			if tc.status == http.StatusUnauthorized && rec.Body.String() != ErrUserUnauthenticated.Error()+"\n" {
+				t.Errorf("body = %q, want only that the user is unauthenticated", rec.Body.String())
+			}
+			if tc.email != "" && (got == nil || got.Email != tc.email || got.Subject != "insecure:"+tc.email) {
+				t.Errorf("identity = %+v, want email %q", got, tc.email)
+			}
+		})
+	}
+}
+
+func TestValidateSubject(t *testing.T) {
+	testCases := map[string]bool{
+		GitHubSubject("1234"):                             true,
+		OIDCSubject("https://accounts.google.com", "123"): true,
+		InsecureSubject("user@example.com"):               true,
+		"reviewer":                                        false,
+		"github:":                                         false,
+		"github:reviewer":                                 false,
+		"saml:user":                                       false,
+	}
+
+	for subject, valid := range testCases {
+		if err := ValidateSubject(subject); (err == nil) != valid {
+			t.Errorf("ValidateSubject(%q) = %v, want valid %v", subject, err, valid)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package bus broadcasts the reviewed incidents to the subscribers in the same process, such as
+// the live feed of the viewer. Each process follows the incidents reviewed by any process from
+// the database, and publishes them to its bus.
+package bus
+
+import (
+	"sync"
+	"time"
+
+	"api.safer.place/incident/v1"
+)
+
+// Event is published when the incident is accepted or alerted.
+type Event struct {
+	Incident *incident.Incident
+	// Reviewed is when the incident was reviewed.
+	Reviewed time.Time
+}
+
+// Bus broadcasts the events to the subscribers. Publishing never waits for the subscribers, so
+// the subscribers which fall behind are closed and catch up some other way.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	// buffer of the events of each subscriber.
+	buffer int
+}
+
+// New creates a bus buffering up to the number of events for each subscriber.
+func New(buffer int) *Bus {
+	return &Bus{
+		subscribers: make(map[*Subscription]struct{}),
+		buffer:      buffer,
+	}
+}
+
+// Subscription receives the events published after it was created, until it is closed.
+type Subscription struct {
+	bus    *Bus
+	events chan *Event
+	// lagged is set before the events are closed by the bus.
+	lagged bool
+}
+
+// Subscribe to the events. The subscription must be closed once it is no longer read.
+func (b *Bus) Subscribe() *Subscription {
+	s := &Subscription{
+		bus:    b,
+		events: make(chan *Event, b.buffer),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[s] = struct{}{}
+
+	return s
+}
+
+// Publish the event to the subscribers. The subscribers which have a full buffer are closed.
+func (b *Bus) Publish(e *Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		select {
+		case s.events <- e:
+		default:
+			s.lagged = true
+			b.remove(s)
+		}
+	}
+}
+
+// Subscribers returns the number of subscribers.
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers)
+}
+
+// remove the subscriber, closing its events. The bus must be locked.
+func (b *Bus) remove(s *Subscription) {
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Events returns the published events, which are closed once the subscription is closed.
+func (s *Subscription) Events() <-chan *Event {
+	return s.events
+}
+
+// Lagged returns whether the subscription was closed by the bus because it fell behind. It is
+// only set once the events are closed.
+func (s *Subscription) Lagged() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	return s.lagged
+}
+
+// Close the subscription. Closing it again does nothing.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	s.bus.remove(s)
+}
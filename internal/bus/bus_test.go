@@ -0,0 +1,43 @@
+package bus
+
+import (
+	"testing"
+
+	"api.safer.place/incident/v1"
+)
+
+func TestBus(t *testing.T) {
+	b := New(2)
+	fast, slow := b.Subscribe(), b.Subscribe()
+	defer fast.Close()
+
+	for _, id := range []string{"first", "second"} {
+		b.Publish(&Event{Incident: &incident.Incident{Id: id}})
+		if e := <-fast.Events(); e.Incident.Id != id {
+			t.Errorf("event = %s, want %s", e.Incident.Id, id)
+		}
+	}
+
+	// The slow subscriber has two events buffered already.
+	b.Publish(&Event{Incident: &incident.Incident{Id: "third"}})
+	var ids []string
+	for e := range slow.Events() {
+		ids = append(ids, e.Incident.Id)
+	}
+	if len(ids) != 2 || !slow.Lagged() {
+		t.Errorf("slow subscriber got %v, lagged %v, want the first two events and lagged", ids, slow.Lagged())
+	}
+	if e := <-fast.Events(); e.Incident.Id != "third" {
+		t.Errorf("event = %s, want third", e.Incident.Id)
+	}
+	if n := b.Subscribers(); n != 1 {
+		t.Errorf("%d subscribers, want 1", n)
+	}
+
+	fast.Close()
+	fast.Close()
+	if _, ok := <-fast.Events(); ok || fast.Lagged() {
+		t.Errorf("closed subscription is open or lagged")
+	}
+	b.Publish(&Event{Incident: &incident.Incident{Id: "fourth"}})
+}
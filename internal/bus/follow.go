@@ -0,0 +1,105 @@
+package bus
+
+import (
+	"context"
+	"time"
+
+	"api.safer.place/viewer/v1"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+)
+
+// lookback is how far before the latest review the database is read again, so the reviews
+// which another process saved with an earlier time, but committed later, are not missed.
+const lookback = 10 * time.Second
+
+// world is the region of every incident, in hundredths of a degree like the regions of the
+// viewer.
+var world = &viewer.Region{North: 9000, South: -9000, East: 18000, West: -18000}
+
+// Follow publishes the incidents reviewed by any process, reading them from the database every
+// interval until the context is cancelled. Every process following the database publishes every
+// review, starting from the reviews saved once it follows them, as the streams resume the earlier
+// ones themselves.
+func (b *Bus) Follow(ctx context.Context, db database.Incidents, interval time.Duration, logger log.Logger) error {
+	f := newFollower(time.Now())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		reviewed, err := db.ReviewedIncidents(ctx, f.since(), world)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// The next read catches up with the reviews, as long as it's within the lookback.
+			logger.Error(ctx, "unable to read reviewed incidents", log.Error(err))
+			continue
+		}
+		for _, e := range f.next(reviewed) {
+			b.Publish(e)
+		}
+	}
+}
+
+// follower keeps track of the reviews which were published.
+type follower struct {
+	// start is when the reviews are followed from.
+	start time.Time
+	// latest is the time of the latest review published.
+	latest time.Time
+	// published are the times of the reviews published within the lookback, by incident.
+	published map[string]time.Time
+}
+
+func newFollower(start time.Time) *follower {
+	// The reviews are saved to the second.
+	start = start.Truncate(time.Second)
+	return &follower{
+		start:     start,
+		latest:    start,
+		published: make(map[string]time.Time),
+	}
+}
+
+// since returns the time the reviews are read from.
+func (f *follower) since() time.Time {
+	since := f.latest.Add(-lookback)
+	if since.Before(f.start) {
+		return f.start
+	}
+	return since
+}
+
+// next returns the events of the reviews which were not published yet.
+func (f *follower) next(reviewed []*database.ReviewedIncident) []*Event {
+	var events []*Event
+	for _, r := range reviewed {
+		if r.Reviewed.Before(f.start) {
+			continue
+		}
+		if published, ok := f.published[r.Incident.Id]; ok && !r.Reviewed.After(published) {
+			continue
+		}
+		f.published[r.Incident.Id] = r.Reviewed
+		if r.Reviewed.After(f.latest) {
+			f.latest = r.Reviewed
+		}
+		events = append(events, &Event{Incident: r.Incident, Reviewed: r.Reviewed})
+	}
+
+	// The older reviews are no longer read.
+	since := f.since()
+	for id, published := range f.published {
+		if published.Before(since) {
+			delete(f.published, id)
+		}
+	}
+	return events
+}
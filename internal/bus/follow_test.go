@@ -0,0 +1,112 @@
+package bus
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"api.safer.place/viewer/v1"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+)
+
+// fakeDatabase has the incidents reviewed by every process.
+type fakeDatabase struct {
+	database.Incidents
+
+	mu       sync.Mutex
+	reviewed []*database.ReviewedIncident
+}
+
+func (db *fakeDatabase) review(id string, reviewed time.Time) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.reviewed = append(db.reviewed, &database.ReviewedIncident{
+		Incident: &incident.Incident{Id: id},
+		Reviewed: reviewed,
+	})
+}
+
+func (db *fakeDatabase) ReviewedIncidents(_ context.Context, since time.Time, _ *viewer.Region) ([]*database.ReviewedIncident, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var res []*database.ReviewedIncident
+	for _, r := range db.reviewed {
+		if !r.Reviewed.Before(since) {
+			res = append(res, r)
+		}
+	}
+	slices.SortStableFunc(res, func(a, b *database.ReviewedIncident) int {
+		return a.Reviewed.Compare(b.Reviewed)
+	})
+	return res, nil
+}
+
+func TestFollow(t *testing.T) {
+	db := &fakeDatabase{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Each bus is in another process, and all of them get every review.
+	var (
+		subs []*Subscription
+		wg   sync.WaitGroup
+	)
+	for range 2 {
+		b := New(10)
+		sub := b.Subscribe()
+		defer sub.Close()
+		subs = append(subs, sub)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.Follow(ctx, db, 10*time.Millisecond, log.New(slog.Default().Handler())); err != context.Canceled {
+				t.Errorf("Follow() = %v, want %v", err, context.Canceled)
+			}
+		}()
+	}
+
+	reviewed := time.Now().Add(2 * time.Second).Truncate(time.Second)
+	db.review("first", reviewed)
+	db.review("second", reviewed)
+	for _, sub := range subs {
+		for _, want := range []string{"first", "second"} {
+			if e := <-sub.Events(); e.Incident.Id != want || !e.Reviewed.Equal(reviewed) {
+				t.Errorf("event = %s reviewed at %v, want %s reviewed at %v", e.Incident.Id, e.Reviewed, want, reviewed)
+			}
+		}
+	}
+
+	// The review committed after the others, with an earlier time, is published once, and so
+	// is the review of the first incident again.
+	db.review("late", reviewed.Add(-time.Second))
+	db.review("first", reviewed.Add(time.Second))
+	for _, sub := range subs {
+		var ids []string
+		for _, want := range []string{"late", "first"} {
+			e := <-sub.Events()
+			ids = append(ids, e.Incident.Id)
+			if e.Incident.Id != want {
+				t.Errorf("events = %v, want late then first", ids)
+			}
+		}
+	}
+
+	// The reviews are read a few more times, without publishing them again.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+	for _, sub := range subs {
+		select {
+		case e := <-sub.Events():
+			t.Errorf("event %s published again", e.Incident.Id)
+		default:
+		}
+	}
+}
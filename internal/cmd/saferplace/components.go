@@ -8,14 +8,23 @@ import (
 
 	"golang.org/x/exp/maps"
 	"golang.org/x/sync/errgroup"
+	"safer.place/internal/alerts"
 	"safer.place/internal/config"
 	"safer.place/internal/consumer"
+	"safer.place/internal/digest"
+	"safer.place/internal/imagegc"
+	"safer.place/internal/redaction"
 	"safer.place/internal/service"
 
 	// Registered services
+	"safer.place/internal/service/feed"
+	"safer.place/internal/service/images"
 	"safer.place/internal/service/imageupload"
+	"safer.place/internal/service/redact"
 	reportv1 "safer.place/internal/service/report/v1"
 	reviewv1 "safer.place/internal/service/review/v1"
+	"safer.place/internal/service/roles"
+	"safer.place/internal/service/subscriptions"
 	viewerv1 "safer.place/internal/service/viewer/v1"
 )
 
@@ -23,35 +32,63 @@ import (
 type Component string
 
 const (
-	ConsumerComponent Component = "consumer"
-	ReviewComponent   Component = "review"
-	ReportComponent   Component = "report"
-	UploaderComponent Component = "uploader"
-	ViewerComponent   Component = "viewer"
+	AlerterComponent       Component = "alerter"
+	ConsumerComponent      Component = "consumer"
+	DigestComponent        Component = "digest"
+	ImageComponent         Component = "image"
+	ImageGCComponent       Component = "imagegc"
+	RedactComponent        Component = "redact"
+	ReviewComponent        Component = "review"
+	ReportComponent        Component = "report"
+	RolesComponent         Component = "roles"
+	SubscriptionsComponent Component = "subscriptions"
+	UploaderComponent      Component = "uploader"
+	ViewerComponent        Component = "viewer"
 )
 
 var componentDependencies = map[Component][]Dependency{
-	ConsumerComponent: {QueueDependency, DatabaseDependency, NotifierDependency},
-	ReviewComponent:   {DatabaseDependency},
-	ReportComponent:   {QueueDependency},
-	UploaderComponent: {StorageDependency},
-	ViewerComponent:   {DatabaseDependency},
+	AlerterComponent:       {QueueDependency, DatabaseDependency},
+	ConsumerComponent:      {QueueDependency, DatabaseDependency, NotifierDependency},
+	DigestComponent:        {DatabaseDependency, NotifierDependency},
+	ImageComponent:         {StorageDependency, DatabaseDependency},
+	ImageGCComponent:       {StorageDependency, DatabaseDependency},
+	RedactComponent:        {StorageDependency, DatabaseDependency},
+	ReviewComponent:        {QueueDependency, DatabaseDependency},
+	ReportComponent:        {QueueDependency, DatabaseDependency},
+	RolesComponent:         {DatabaseDependency},
+	SubscriptionsComponent: {DatabaseDependency},
+	UploaderComponent:      {StorageDependency, DatabaseDependency},
+	ViewerComponent:        {DatabaseDependency},
 }
 
 var headlessComponents = map[Component]registerHeadlessComponentFn{
+	AlerterComponent:  registerAlerter,
 	ConsumerComponent: registerConsumer,
+	DigestComponent:   registerDigest,
+	ImageGCComponent:  registerImageGC,
+	ViewerComponent:   registerFeedFollower,
 }
 
-type ComponentRegisterMap = map[Component]registerComponentFn
+// ComponentRegisterMap registers the services of each component, which most components have
+// one of.
+type ComponentRegisterMap = map[Component][]registerComponentFn
 
 var reviewerComponents = ComponentRegisterMap{
-	ReviewComponent: registerReview,
+	ReviewComponent: {registerReview},
+}
+
+// sharedComponents are used by both the reviewers and the users.
+var sharedComponents = ComponentRegisterMap{
+	ImageComponent:  {registerImage},
+	RedactComponent: {registerRedact},
+	RolesComponent:  {registerRoles},
 }
 
 var userComponents = ComponentRegisterMap{
-	ReportComponent:   registerReport,
-	UploaderComponent: registerUploader,
-	ViewerComponent:   registerViewer,
+	ReportComponent:        {registerReport},
+	SubscriptionsComponent: {registerSubscriptions},
+	UploaderComponent:      {registerUploader},
+	ViewerComponent:        {registerViewer, registerFeed},
 }
 
 // StringsToComponents convert string slice to component slice or panic
@@ -71,12 +108,26 @@ func StringsToComponents(ss []string) []Component {
 // ParseComponent ensures that each component is correctl
 func ParseComponent(s string) (Component, error) {
 	switch s {
+	case string(AlerterComponent):
+		return AlerterComponent, nil
 	case string(ConsumerComponent):
 		return ConsumerComponent, nil
+	case string(DigestComponent):
+		return DigestComponent, nil
+	case string(ImageComponent):
+		return ImageComponent, nil
+	case string(ImageGCComponent):
+		return ImageGCComponent, nil
+	case string(RedactComponent):
+		return RedactComponent, nil
 	case string(ReviewComponent):
 		return ReviewComponent, nil
 	case string(ReportComponent):
 		return ReportComponent, nil
+	case string(RolesComponent):
+		return RolesComponent, nil
+	case string(SubscriptionsComponent):
+		return SubscriptionsComponent, nil
 	case string(UploaderComponent):
 		return UploaderComponent, nil
 	case string(ViewerComponent):
@@ -114,7 +165,9 @@ type registerHeadlessComponentFn func(context.Context, *config.Config, *dependen
 func createHeadlessComponents(ctx context.Context, cfg *config.Config, wantedComponents []Component, deps *dependencies, eg *errgroup.Group) error {
 	for component, fn := range headlessComponents {
 		if slices.Contains(wantedComponents, component) {
-			return fn(ctx, cfg, deps, eg)
+			if err := fn(ctx, cfg, deps, eg); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -125,8 +178,11 @@ type registerComponentFn func(context.Context, *config.Config, *dependencies) (s
 
 func createServices(ctx context.Context, cfg *config.Config, wantedComponents []Component, deps *dependencies, m ComponentRegisterMap) ([]service.Service, error) {
 	services := make([]service.Service, 0, len(wantedComponents))
-	for component, fn := range m {
-		if slices.Contains(wantedComponents, component) {
+	for component, fns := range m {
+		if !slices.Contains(wantedComponents, component) {
+			continue
+		}
+		for _, fn := range fns {
 			service, err := fn(ctx, cfg, deps)
 			if err != nil {
 				return nil, err
@@ -137,14 +193,96 @@ func createServices(ctx context.Context, cfg *config.Config, wantedComponents []
 	return services, nil
 }
 
+func registerAlerter(ctx context.Context, cfg *config.Config, deps *dependencies, eg *errgroup.Group) error {
+	channels, err := newAlertChannels(cfg)
+	if err != nil {
+		return err
+	}
+
+	a, err := alerts.New(cfg.Alerts,
+		alerts.Alerts(deps.alerts),
+		alerts.Subscriptions(deps.database),
+		alerts.Channels(channels),
+		alerts.Logger(deps.logger.With(slog.String("component", "alerter"))),
+		alerts.Tracer(deps.tracing.Tracer("alerter")),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to create alerter: %w", err)
+	}
+
+	eg.Go(func() error {
+		return a.Run(ctx)
+	})
+
+	return nil
+}
+
 func registerConsumer(ctx context.Context, cfg *config.Config, deps *dependencies, eg *errgroup.Group) error {
-	c := consumer.New(
+	opts := []consumer.Option{
 		consumer.Logger(deps.logger.With(slog.String("component", "review"))),
 		consumer.Consumer(deps.queue),
+		consumer.DeadLetter(deps.deadLetters),
+		consumer.Retry(cfg.Consumer.Retry),
 		consumer.Database(deps.database),
 		consumer.Notifier(deps.notifer),
 		consumer.Tracer(deps.tracing.Tracer("consumer")),
+	}
+	if digestCfg := &cfg.Notifier.Digest; digestCfg.Enabled {
+		if err := digestCfg.Validate(); err != nil {
+			return fmt.Errorf("invalid digest configuration: %w", err)
+		}
+		// The digest notifies about the rest of the incidents.
+		opts = append(opts, consumer.NotifyIf(digestCfg.Urgent))
+		if !slices.Contains(deps.components, DigestComponent) {
+			deps.logger.Warn(ctx, "the digest is enabled but doesn't run in this process, the "+
+				"reviewers are only notified about the incidents which are not urgent if the "+
+				"digest component runs in another process",
+			)
+		}
+	}
+	c := consumer.New(opts...)
+
+	eg.Go(func() error {
+		return c.Run(ctx)
+	})
+
+	return nil
+}
+
+func registerDigest(ctx context.Context, cfg *config.Config, deps *dependencies, eg *errgroup.Group) error {
+	log := deps.logger.With(slog.String("component", "digest"))
+	if !cfg.Notifier.Digest.Enabled {
+		log.Info(ctx, "digest is disabled, the consumer notifies about each incident")
+		return nil
+	}
+
+	d, err := digest.New(cfg.Notifier.Digest,
+		digest.Database(deps.database),
+		digest.Notifier(deps.notifer),
+		digest.Logger(log),
+		digest.Tracer(deps.tracing.Tracer("digest")),
 	)
+	if err != nil {
+		return fmt.Errorf("unable to create digest: %w", err)
+	}
+
+	eg.Go(func() error {
+		return d.Run(ctx)
+	})
+
+	return nil
+}
+
+func registerImageGC(ctx context.Context, cfg *config.Config, deps *dependencies, eg *errgroup.Group) error {
+	c, err := imagegc.New(cfg.ImageGC,
+		imagegc.Storage(deps.storage),
+		imagegc.Uploads(deps.database),
+		imagegc.Logger(deps.logger.With(slog.String("component", "imagegc"))),
+		imagegc.Tracer(deps.tracing.Tracer("imagegc")),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to create image collector: %w", err)
+	}
 
 	eg.Go(func() error {
 		return c.Run(ctx)
@@ -153,26 +291,123 @@ func registerConsumer(ctx context.Context, cfg *config.Config, deps *dependencie
 	return nil
 }
 
-func registerReview(_ context.Context, _ *config.Config, deps *dependencies) (service.Service, error) {
-	return reviewv1.Register(
+func registerReview(_ context.Context, cfg *config.Config, deps *dependencies) (service.Service, error) {
+	opts := []reviewv1.Option{
 		reviewv1.Database(deps.database),
+		reviewv1.Authorization(deps.policy),
 		reviewv1.Logger(deps.logger.With(slog.String("service", "reviewv1"))),
 		reviewv1.Tracer(deps.tracing.Tracer("review")),
-	), nil
+	}
+	// The memory queue waits for the alerter to receive each alert, so the alerts are only queued
+	// if it runs in this process.
+	if cfg.Queue.Provider != "memory" || slices.Contains(deps.components, AlerterComponent) {
+		opts = append(opts, reviewv1.Alerts(deps.alerts))
+	}
+	return reviewv1.Register(opts...), nil
 }
 
 func registerReport(_ context.Context, _ *config.Config, deps *dependencies) (service.Service, error) {
 	return reportv1.Register(
 		deps.queue,
+		deps.database,
 		deps.logger.With(slog.String("service", "reportv1")),
 	), nil
 }
 
-func registerUploader(_ context.Context, _ *config.Config, deps *dependencies) (service.Service, error) {
+func registerSubscriptions(_ context.Context, cfg *config.Config, deps *dependencies) (service.Service, error) {
+	channels, err := newAlertChannels(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return subscriptions.Register(
+		subscriptions.Logger(deps.logger.With(slog.String("service", "subscriptions"))),
+		subscriptions.Tracer(deps.tracing.Tracer("subscriptions")),
+		subscriptions.Subscriptions(deps.database),
+		subscriptions.Channels(channels),
+		subscriptions.Configuration(cfg.Alerts),
+	), nil
+}
+
+// newAlertChannels returns the channels the users can subscribe to the alerts with. The web push
+// is only available once its VAPID key is configured.
+func newAlertChannels(cfg *config.Config) (map[string]alerts.Channel, error) {
+	channels := map[string]alerts.Channel{
+		alerts.WebhookChannel: alerts.NewWebhook(cfg.Alerts.Webhook),
+	}
+	if cfg.Alerts.WebPush.VAPID.Enabled() {
+		webPush, err := alerts.NewWebPush(cfg.Alerts.WebPush)
+		if err != nil {
+			return nil, err
+		}
+		channels[alerts.WebPushChannel] = webPush
+	}
+	return channels, nil
+}
+
+func registerUploader(_ context.Context, cfg *config.Config, deps *dependencies) (service.Service, error) {
+	redactor, err := newRedactor(cfg, deps)
+	if err != nil {
+		return nil, err
+	}
+
 	return imageupload.Register(
+		imageupload.Configuration(cfg.Uploader),
 		imageupload.Logger(deps.logger.With(slog.String("service", "imageupload"))),
 		imageupload.Tracer(deps.tracing.Tracer("imageupload")),
 		imageupload.Storage(deps.storage),
+		imageupload.Uploads(deps.database),
+		imageupload.Redactor(redactor),
+	), nil
+}
+
+func registerRedact(_ context.Context, cfg *config.Config, deps *dependencies) (service.Service, error) {
+	redactor, err := newRedactor(cfg, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	return redact.Register(
+		redact.Logger(deps.logger.With(slog.String("service", "redact"))),
+		redact.Tracer(deps.tracing.Tracer("redact")),
+		redact.Storage(deps.storage),
+		redact.Database(deps.database),
+		redact.History(deps.database),
+		redact.Redactor(redactor),
+		redact.Authorization(deps.policy),
+	), nil
+}
+
+func registerRoles(_ context.Context, _ *config.Config, deps *dependencies) (service.Service, error) {
+	return roles.Register(
+		roles.Logger(deps.logger.With(slog.String("service", "roles"))),
+		roles.Tracer(deps.tracing.Tracer("roles")),
+		roles.Roles(deps.database),
+	), nil
+}
+
+// newRedactor creates the redactor storing the redacted images with the same variants as the
+// uploaded images. There are no detectors built in, so the images are only redacted by the
+// reviewers.
+func newRedactor(cfg *config.Config, deps *dependencies) (*redaction.Redactor, error) {
+	redactor, err := redaction.New(
+		redaction.Storage(deps.storage),
+		redaction.Sizes(cfg.Uploader.Variants()),
+		redaction.Tracer(deps.tracing.Tracer("redaction")),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create redactor: %w", err)
+	}
+	return redactor, nil
+}
+
+func registerImage(_ context.Context, _ *config.Config, deps *dependencies) (service.Service, error) {
+	return images.Register(
+		images.Logger(deps.logger.With(slog.String("service", "images"))),
+		images.Tracer(deps.tracing.Tracer("images")),
+		images.Storage(deps.storage),
+		images.Database(deps.database),
+		images.Authorization(deps.policy),
 	), nil
 }
 
@@ -182,3 +417,24 @@ func registerViewer(_ context.Context, _ *config.Config, deps *dependencies) (se
 		deps.logger.With(slog.String("service", "viewerv1")),
 	), nil
 }
+
+// registerFeedFollower follows the incidents reviewed by any process for the live feeds of this
+// one.
+func registerFeedFollower(ctx context.Context, cfg *config.Config, deps *dependencies, eg *errgroup.Group) error {
+	eg.Go(func() error {
+		return deps.events.Follow(ctx, deps.database, cfg.Feed.PollInterval,
+			deps.logger.With(slog.String("component", "feed")),
+		)
+	})
+	return nil
+}
+
+func registerFeed(_ context.Context, cfg *config.Config, deps *dependencies) (service.Service, error) {
+	return feed.Register(
+		feed.Logger(deps.logger.With(slog.String("service", "feed"))),
+		feed.Tracer(deps.tracing.Tracer("feed")),
+		feed.Database(deps.database),
+		feed.Events(deps.events),
+		feed.Configuration(cfg.Feed),
+	), nil
+}
@@ -8,11 +8,17 @@ func TestParseComponent(t *testing.T) {
 		"unknown": Component(""),
 		"":        Component(""),
 
-		"consumer": ConsumerComponent,
-		"review":   ReviewComponent,
-		"report":   ReportComponent,
-		"uploader": UploaderComponent,
-		"viewer":   ViewerComponent,
+		"alerter":       AlerterComponent,
+		"consumer":      ConsumerComponent,
+		"digest":        DigestComponent,
+		"image":         ImageComponent,
+		"imagegc":       ImageGCComponent,
+		"redact":        RedactComponent,
+		"review":        ReviewComponent,
+		"report":        ReportComponent,
+		"subscriptions": SubscriptionsComponent,
+		"uploader":      UploaderComponent,
+		"viewer":        ViewerComponent,
 	}
 
 	for in, want := range testCases {
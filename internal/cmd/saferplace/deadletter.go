@@ -0,0 +1,69 @@
+package saferplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/config"
+)
+
+var errUnknownCommand = errors.New("unknown command")
+
+// DeadLetters lists or replays the incidents which the consumer failed to handle. Supported
+// commands are:
+//
+//	list
+//	replay <id>...
+func DeadLetters(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	if cfg.Queue.Provider == "memory" {
+		return errors.New("dead letters of the memory queue can't be accessed from another process")
+	}
+
+	deps := &dependencies{
+		logger:  newLogger(cfg),
+		tracing: noop.NewTracerProvider(),
+	}
+	if err := registerQueue(ctx, cfg, deps); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected list or replay", errUnknownCommand)
+	}
+
+	switch args[0] {
+	case "list":
+		letters, err := deps.deadLetters.List(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to list dead letters: %w", err)
+		}
+
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTIME\tINCIDENT\tREASON")
+		for _, letter := range letters {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+				letter.ID,
+				letter.Timestamp.Format(time.RFC3339),
+				letter.Body.Id,
+				letter.Reason,
+			)
+		}
+		return w.Flush()
+	case "replay":
+		for _, id := range args[1:] {
+			if err := deps.deadLetters.Replay(ctx, id, deps.queue); err != nil {
+				return fmt.Errorf("unable to replay %s: %w", id, err)
+			}
+			fmt.Fprintf(out, "replayed %s\n", id)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w %q", errUnknownCommand, args[0])
+	}
+}
@@ -18,23 +18,39 @@ import (
 	"github.com/saferplace/webserver-go/certificate"
 	"github.com/saferplace/webserver-go/certificate/insecure"
 	"github.com/saferplace/webserver-go/certificate/temporary"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 
+	"safer.place/internal/auth"
+	"safer.place/internal/auth/oidc"
+	"safer.place/internal/auth/rbac"
+	"safer.place/internal/bus"
 	"safer.place/internal/config"
 	"safer.place/internal/database"
 	"safer.place/internal/database/sqldatabase"
 	"safer.place/internal/database/surreal"
 	"safer.place/internal/log"
 	"safer.place/internal/notifier"
+	"safer.place/internal/notifier/discordnotifier"
+	"safer.place/internal/notifier/emailnotifier"
 	"safer.place/internal/notifier/lognotifier"
+	"safer.place/internal/notifier/multinotifier"
+	"safer.place/internal/notifier/webhooknotifier"
 	"safer.place/internal/queue"
 	"safer.place/internal/queue/memory"
+	"safer.place/internal/queue/sqlqueue"
 	"safer.place/internal/storage"
+	"safer.place/internal/storage/filesystem"
 	"safer.place/internal/storage/minio"
 )
 
-var errProviderNotFound = errors.New("provider not found")
+var (
+	errProviderNotFound = errors.New("provider not found")
+	errNestedChannels   = errors.New("channels cannot be nested")
+	errMissingOIDC      = errors.New("missing oidc config")
+)
 
 type Dependency string
 
@@ -70,33 +86,53 @@ type dependencies struct {
 	logger  log.Logger
 	tracing trace.TracerProvider
 	metrics *prometheus.Registry
+	// components running in this process.
+	components []Component
+	// events of the incidents reviewed by any process, followed from the database by the live
+	// feeds of this process.
+	events *bus.Bus
 
 	// dynamically created dependencies
-	database database.Database
-	queue    queue.Queue[*incident.Incident]
-	storage  storage.Storage
-	notifer  notifier.Notifier
+	database    database.Database
+	queue       queue.Queue[*incident.Incident]
+	deadLetters queue.DeadLetters[*incident.Incident]
+	alerts      queue.Queue[*incident.Incident]
+	storage     storage.Storage
+	notifer     notifier.Notifier
+
+	// policy is created once the database is available, to read the user roles from it.
+	policy *rbac.Policy
+
+	// closers of the dependencies, closed once the process stops.
+	closers multiCloser
 }
 
 type registerDependencyFn func(context.Context, *config.Config, *dependencies) error
 
 func createDependencies(ctx context.Context, cfg *config.Config, components []Component) (*dependencies, io.Closer, error) {
 	wantedDependencies := neededDependencies(components)
+	if slices.Contains(wantedDependencies, NotifierDependency) && discordThumbnails(&cfg.Notifier) {
+		wantedDependencies = append(wantedDependencies, StorageDependency)
+	}
 
 	deps := &dependencies{
-		logger:  newLogger(cfg),
-		metrics: prometheus.NewRegistry(),
+		logger:     newLogger(cfg),
+		metrics:    prometheus.NewRegistry(),
+		components: components,
+		events:     bus.New(cfg.Feed.Buffer),
 	}
 
-	mc := multiCloser{}
-
 	tracing, tracingCloser, err := tracing.NewTracingProvider(ctx, cfg.Tracing)
 	if err != nil {
-		return nil, mc, fmt.Errorf("unable to create tracing provider: %w", err)
+		return nil, deps.closers, fmt.Errorf("unable to create tracing provider: %w", err)
 	}
-	mc = append(mc, tracingCloser)
+	deps.closers = append(deps.closers, tracingCloser)
 	deps.tracing = tracing
 
+	// Propagate the trace context through the queue metadata, so the consumer continues the trace
+	// started by the reporter, even when running in a different process.
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
 	deps.logger.Debug(ctx, "tracing initialized",
 		slog.Bool("enabled", cfg.Tracing.Enabled),
 		slog.String("endpoint", cfg.Tracing.Endpoint),
@@ -114,20 +150,29 @@ func createDependencies(ctx context.Context, cfg *config.Config, components []Co
 		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
 	)
 
-	for dep, fn := range map[Dependency]registerDependencyFn{
-		DatabaseDependency: registerDatabase,
-		QueueDependency:    registerQueue,
-		StorageDependency:  registerStorage,
-		NotifierDependency: registerNotifier,
+	// The notifier is registered after the storage, which presigns the Discord thumbnails.
+	for _, d := range []struct {
+		dep Dependency
+		fn  registerDependencyFn
+	}{
+		{DatabaseDependency, registerDatabase},
+		{QueueDependency, registerQueue},
+		{StorageDependency, registerStorage},
+		{NotifierDependency, registerNotifier},
 	} {
-		if slices.Contains(wantedDependencies, dep) {
-			if err := fn(ctx, cfg, deps); err != nil {
-				return deps, mc, err
+		if slices.Contains(wantedDependencies, d.dep) {
+			if err := d.fn(ctx, cfg, deps); err != nil {
+				return deps, deps.closers, err
 			}
 		}
 	}
 
-	return deps, mc, nil
+	deps.policy, err = newPolicy(ctx, cfg, deps)
+	if err != nil {
+		return deps, deps.closers, fmt.Errorf("unable to create access control policy: %w", err)
+	}
+
+	return deps, deps.closers, nil
 }
 
 func newTLSConfig(ctx context.Context, cfg config.CertConfig) (v *tls.Config, err error) {
@@ -151,6 +196,25 @@ func newTLSConfig(ctx context.Context, cfg config.CertConfig) (v *tls.Config, er
 	return v, nil
 }
 
+func newUserAuthenticator(ctx context.Context, cfg config.UserAuthConfig, logger log.Logger) (auth.Authenticator, error) {
+	switch cfg.Provider {
+	case "oidc":
+		if cfg.OIDC == nil {
+			return nil, fmt.Errorf("%w: configure webserver.auth.user.oidc, or choose the insecure provider for development", errMissingOIDC)
+		}
+		v, err := oidc.New(cfg.OIDC)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create %q authenticator: %w", cfg.Provider, err)
+		}
+		return v, nil
+	case "insecure":
+		logger.Warn(ctx, "users are not authenticated and anyone can act as any user with the X-Email header, only use the insecure provider in development")
+		return auth.InsecureEmail{}, nil
+	default:
+		return nil, errProviderNotFound
+	}
+}
+
 func registerDatabase(_ context.Context, cfg *config.Config, deps *dependencies) (err error) {
 	tracer := deps.tracing.Tracer("database",
 		trace.WithInstrumentationAttributes(
@@ -183,17 +247,58 @@ func registerDatabase(_ context.Context, cfg *config.Config, deps *dependencies)
 }
 
 func registerQueue(_ context.Context, cfg *config.Config, deps *dependencies) (err error) {
-	var v queue.Queue[*incident.Incident]
+	tracer := deps.tracing.Tracer("queue",
+		trace.WithInstrumentationAttributes(
+			attribute.String("provider", cfg.Queue.Provider),
+		),
+	)
+
+	var (
+		v      queue.Queue[*incident.Incident]
+		dl     queue.DeadLetters[*incident.Incident]
+		alerts queue.Queue[*incident.Incident]
+	)
 	switch cfg.Queue.Provider {
 	case "memory":
 		v = memory.New[*incident.Incident](
-			memory.Tracer[*incident.Incident](
-				deps.tracing.Tracer("queue",
-					trace.WithInstrumentationAttributes(
-						attribute.String("provider", "memory"),
-					),
-				),
-			),
+			memory.Tracer[*incident.Incident](tracer),
+		)
+		dl = memory.NewDeadLetters[*incident.Incident]()
+		alerts = memory.New[*incident.Incident](
+			memory.Tracer[*incident.Incident](tracer),
+		)
+	case "sql":
+		// The queues share the connections to the database.
+		var db *sqlqueue.DB
+		db, err = sqlqueue.Open(cfg.Queue.SQL)
+		if err != nil {
+			break
+		}
+		deps.closers = append(deps.closers, db)
+
+		logger := deps.logger.With(slog.String("queue", cfg.Queue.Provider))
+		v, err = sqlqueue.New(db, cfg.Queue.SQL,
+			sqlqueue.Tracer[*incident.Incident](tracer),
+			sqlqueue.Logger[*incident.Incident](logger),
+			sqlqueue.DeadLetter[*incident.Incident](cfg.Queue.DeadLetter),
+		)
+		if err != nil {
+			break
+		}
+		deadLetterCfg := *cfg.Queue.SQL
+		deadLetterCfg.Name = cfg.Queue.DeadLetter
+		dl, err = sqlqueue.New(db, &deadLetterCfg,
+			sqlqueue.Tracer[*incident.Incident](tracer),
+			sqlqueue.Logger[*incident.Incident](logger),
+		)
+		if err != nil {
+			break
+		}
+		alertsCfg := *cfg.Queue.SQL
+		alertsCfg.Name = cfg.Queue.Alerts
+		alerts, err = sqlqueue.New(db, &alertsCfg,
+			sqlqueue.Tracer[*incident.Incident](tracer),
+			sqlqueue.Logger[*incident.Incident](logger),
 		)
 	default:
 		err = errProviderNotFound
@@ -204,6 +309,8 @@ func registerQueue(_ context.Context, cfg *config.Config, deps *dependencies) (e
 	}
 
 	deps.queue = v
+	deps.deadLetters = dl
+	deps.alerts = alerts
 	return nil
 }
 
@@ -221,6 +328,17 @@ func registerStorage(ctx context.Context, cfg *config.Config, deps *dependencies
 				),
 			),
 		)
+	case "filesystem":
+		v, err = filesystem.New(
+			cfg.Storage.Filesystem,
+			filesystem.Tracer(
+				deps.tracing.Tracer("storage",
+					trace.WithInstrumentationAttributes(
+						attribute.String("provider", "filesystem"),
+					),
+				),
+			),
+		)
 	default:
 		err = errProviderNotFound
 	}
@@ -233,24 +351,134 @@ func registerStorage(ctx context.Context, cfg *config.Config, deps *dependencies
 	return nil
 }
 
-func registerNotifier(_ context.Context, cfg *config.Config, deps *dependencies) (err error) {
-	var v notifier.Notifier
+func registerNotifier(ctx context.Context, cfg *config.Config, deps *dependencies) error {
 	log := deps.logger.With(slog.String("notifier", cfg.Notifier.Provider))
-	switch cfg.Notifier.Provider {
-	case "log":
-		v = lognotifier.New(log)
-	default:
-		err = errProviderNotFound
+
+	deliveries := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "saferplace_webhook_deliveries_total",
+		Help: "Deliveries of the incidents by the webhook notifiers, by channel and result.",
+	}, []string{"channel", "result"})
+	deps.metrics.MustRegister(deliveries)
+	shared := notifierDeps{
+		reviewURL:  cfg.Notifier.ReviewURL,
+		images:     deps.storage,
+		deliveries: deliveries,
+	}
+	if deps.database != nil {
+		shared.webhooks = deps.database
+	}
+
+	if cfg.Notifier.Provider != "channels" {
+		v, err := newNotifier(ctx, &cfg.Notifier.NotifierProviderConfig, "", shared, log)
+		if err != nil {
+			return err
+		}
+		deps.notifer = v
+		return nil
+	}
+
+	channels := make([]multinotifier.Channel, 0, len(cfg.Notifier.Channels))
+	for _, c := range cfg.Notifier.Channels {
+		if c.Provider == "channels" {
+			return fmt.Errorf("unable to open channel %q: %w", c.Name, errNestedChannels)
+		}
+		v, err := newNotifier(ctx, &c.NotifierProviderConfig, c.Name, shared,
+			log.With(slog.String("channel", c.Name)),
+		)
+		if err != nil {
+			return fmt.Errorf("unable to open channel %q: %w", c.Name, err)
+		}
+		channels = append(channels, multinotifier.Channel{
+			Name:     c.Name,
+			Notifier: v,
+			Filter:   c.Filter,
+			Policy:   c.Policy,
+		})
 	}
 
+	v, err := multinotifier.New(channels, multinotifier.Logger(log))
 	if err != nil {
-		return fmt.Errorf("unable to open %q database: %w", cfg.Notifier.Provider, err)
+		return fmt.Errorf("unable to open %q notifier: %w", cfg.Notifier.Provider, err)
 	}
 
 	deps.notifer = v
 	return nil
 }
 
+// discordThumbnails returns whether any Discord notifier shows the image thumbnails, which
+// need the storage.
+func discordThumbnails(cfg *config.NotifierConfig) bool {
+	providers := []config.NotifierProviderConfig{cfg.NotifierProviderConfig}
+	if cfg.Provider == "channels" {
+		providers = providers[:0]
+		for _, c := range cfg.Channels {
+			providers = append(providers, c.NotifierProviderConfig)
+		}
+	}
+	for _, p := range providers {
+		if p.Provider == "discord" && p.Discord != nil && p.Discord.Thumbnails {
+			return true
+		}
+	}
+	return false
+}
+
+// notifierDeps are shared by the notifiers of every channel.
+type notifierDeps struct {
+	reviewURL string
+	// images are only needed by the Discord notifier showing the thumbnails.
+	images storage.Storage
+	// deliveries are counted for the webhook notifiers.
+	deliveries *prometheus.CounterVec
+	// webhooks keep the outcome of the webhook deliveries, if there is a database.
+	webhooks database.WebhookDeliveries
+}
+
+// newNotifier opens the notifier of the provider, for the channel if it's one of the channels.
+func newNotifier(ctx context.Context, cfg *config.NotifierProviderConfig, channel string, deps notifierDeps, logger log.Logger) (v notifier.Notifier, err error) {
+	switch cfg.Provider {
+	case "log":
+		v = lognotifier.New(logger, deps.reviewURL)
+	case "discord":
+		opts := []discordnotifier.Option{discordnotifier.ReviewURL(deps.reviewURL)}
+		if cfg.Discord != nil && cfg.Discord.Thumbnails {
+			if p, ok := deps.images.(storage.Presigner); ok {
+				opts = append(opts, discordnotifier.Presigner(p))
+			} else {
+				logger.Warn(ctx, "leaving out the Discord thumbnails, as the storage can't presign them")
+			}
+		}
+		v, err = discordnotifier.New(cfg.Discord, opts...)
+	case "email":
+		v, err = emailnotifier.New(cfg.Email,
+			emailnotifier.ReviewURL(deps.reviewURL),
+		)
+	case "webhook":
+		opts := []webhooknotifier.Option{
+			webhooknotifier.ReviewURL(deps.reviewURL),
+			webhooknotifier.Logger(logger),
+			webhooknotifier.OnDelivery(func(_ context.Context, d webhooknotifier.Delivery) {
+				result := "delivered"
+				if d.Err != nil {
+					result = "failed"
+				}
+				deps.deliveries.WithLabelValues(channel, result).Inc()
+			}),
+		}
+		if deps.webhooks != nil {
+			opts = append(opts, webhooknotifier.Deliveries(deps.webhooks))
+		}
+		v, err = webhooknotifier.New(cfg.Webhook, opts...)
+	default:
+		err = errProviderNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %q notifier: %w", cfg.Provider, err)
+	}
+	return v, nil
+}
+
 func newLogger(cfg *config.Config) log.Logger {
 	var logger log.Logger
 	if cfg.Debug {
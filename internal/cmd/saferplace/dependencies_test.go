@@ -0,0 +1,101 @@
+package saferplace
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"safer.place/internal/auth/oidc"
+	"safer.place/internal/config"
+	"safer.place/internal/log"
+	"safer.place/internal/notifier/discordnotifier"
+)
+
+func TestNewUserAuthenticator(t *testing.T) {
+	testCases := map[string]struct {
+		cfg config.UserAuthConfig
+		err error
+	}{
+		"oidc": {
+			cfg: config.UserAuthConfig{
+				Provider: "oidc",
+				OIDC:     &oidc.Config{Issuer: "https://accounts.google.com", Audience: "saferplace"},
+			},
+		},
+		"oidc without config": {
+			cfg: config.UserAuthConfig{Provider: "oidc"},
+			err: errMissingOIDC,
+		},
+		"insecure": {
+			cfg: config.UserAuthConfig{Provider: "insecure"},
+		},
+		"unknown": {
+			cfg: config.UserAuthConfig{Provider: "unknown"},
+			err: errProviderNotFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := newUserAuthenticator(context.Background(), tc.cfg, log.New(slog.Default().Handler()))
+			if !errors.Is(err, tc.err) {
+				t.Errorf("newUserAuthenticator() = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestDefaultUserAuthentication(t *testing.T) {
+	cfg, err := config.Parse("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Webserver.Auth.User.Provider != "oidc" {
+		t.Errorf("default provider = %q, want oidc", cfg.Webserver.Auth.User.Provider)
+	}
+}
+
+func TestDiscordThumbnails(t *testing.T) {
+	thumbnails := config.NotifierProviderConfig{
+		Provider: "discord",
+		Discord:  &discordnotifier.Config{Thumbnails: true},
+	}
+
+	testCases := map[string]struct {
+		cfg  config.NotifierConfig
+		want bool
+	}{
+		"discord": {
+			cfg:  config.NotifierConfig{NotifierProviderConfig: thumbnails},
+			want: true,
+		},
+		"discord without thumbnails": {
+			cfg: config.NotifierConfig{NotifierProviderConfig: config.NotifierProviderConfig{
+				Provider: "discord",
+				Discord:  &discordnotifier.Config{},
+			}},
+		},
+		"channel": {
+			cfg: config.NotifierConfig{
+				NotifierProviderConfig: config.NotifierProviderConfig{Provider: "channels"},
+				Channels: []config.NotifierChannelConfig{
+					{NotifierProviderConfig: config.NotifierProviderConfig{Provider: "log"}},
+					{NotifierProviderConfig: thumbnails},
+				},
+			},
+			want: true,
+		},
+		"log": {
+			cfg: config.NotifierConfig{NotifierProviderConfig: config.NotifierProviderConfig{Provider: "log"}},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := discordThumbnails(&tc.cfg); got != tc.want {
+				t.Errorf("discordThumbnails() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
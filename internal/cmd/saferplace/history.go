@@ -0,0 +1,49 @@
+package saferplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/config"
+)
+
+// History prints how the resolution of the incidents changed over time, and who changed it.
+func History(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("expected history <incident id>...")
+	}
+
+	deps := &dependencies{
+		logger:  newLogger(cfg),
+		tracing: noop.NewTracerProvider(),
+	}
+	if err := registerDatabase(ctx, cfg, deps); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "INCIDENT\tTIME\tACTOR\tFROM\tTO\tREASON")
+	for _, id := range args {
+		history, err := deps.database.IncidentHistory(ctx, id)
+		if err != nil {
+			return fmt.Errorf("unable to get history of %s: %w", id, err)
+		}
+		for _, t := range history {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				t.IncidentID,
+				t.Timestamp.Format(time.RFC3339),
+				t.Actor,
+				t.From,
+				t.To,
+				t.Reason,
+			)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,74 @@
+package saferplace
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"safer.place/internal/config"
+	"safer.place/internal/database/sqldatabase"
+)
+
+// Migrate applies the pending migrations of the sql database, or shows which migrations have been
+// applied. Supported commands are:
+//
+//	up (default)
+//	status
+func Migrate(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	if cfg.Database.Provider != "sql" {
+		return errors.New("only the sql database provider has migrations")
+	}
+
+	db, err := sql.Open(cfg.Database.SQL.Driver, cfg.Database.SQL.DSN)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	m, err := sqldatabase.NewMigrator(db, cfg.Database.SQL)
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := m.Migrate(ctx)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "database is up to date")
+		}
+		return nil
+	case "status":
+		ms, err := m.Migrations(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, migration := range ms {
+			applied := "pending"
+			if !migration.AppliedAt.IsZero() {
+				applied = migration.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", migration.Version, migration.Name, applied)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("%w %q", errUnknownCommand, command)
+	}
+}
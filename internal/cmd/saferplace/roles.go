@@ -0,0 +1,132 @@
+package saferplace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/auth"
+	"safer.place/internal/auth/rbac"
+	"safer.place/internal/config"
+)
+
+// newPolicy creates the access control policy, syncing the roles from the config first, so the
+// roles removed from the config are revoked. Without a database every user has the default role.
+func newPolicy(ctx context.Context, cfg *config.Config, deps *dependencies) (*rbac.Policy, error) {
+	defaultRole, err := rbac.ParseRole(cfg.Webserver.Auth.Roles.Default)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse default role: %w", err)
+	}
+
+	opts := []rbac.Option{
+		rbac.DefaultRole(defaultRole),
+		rbac.Logger(deps.logger.With(slog.String("component", "rbac"))),
+	}
+
+	if deps.database == nil {
+		deps.logger.Info(ctx, "no database to read the roles from, using the default role",
+			slog.String("role", string(defaultRole)),
+		)
+		return rbac.New(opts...)
+	}
+
+	// The reviewers are GitHub user ids, and the admins can log in with any identity provider.
+	bootstrap := map[rbac.Role][]string{
+		rbac.RoleAdmin: cfg.Webserver.Auth.Roles.Admins,
+	}
+	for _, id := range cfg.Review.Reviewers {
+		bootstrap[rbac.RoleReviewer] = append(bootstrap[rbac.RoleReviewer], auth.GitHubSubject(id))
+	}
+	grants := make(map[string][]string)
+	for role, subjects := range bootstrap {
+		for _, subject := range subjects {
+			if err := auth.ValidateSubject(subject); err != nil {
+				return nil, fmt.Errorf("unable to grant %s: %w", role, err)
+			}
+			grants[subject] = append(grants[subject], string(role))
+		}
+	}
+	if err := deps.database.SyncConfigRoles(ctx, grants); err != nil {
+		return nil, fmt.Errorf("unable to sync the roles from the config: %w", err)
+	}
+
+	return rbac.New(append(opts, rbac.RoleStore(deps.database))...)
+}
+
+// Roles lists, grants or revokes the roles of the users. The subjects are qualified by their
+// identity provider, such as github:<id>, oidc:<issuer>|<subject> or insecure:<email>.
+// Supported commands are:
+//
+//	list
+//	grant <subject> <role>
+//	revoke <subject> <role>
+func Roles(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	deps := &dependencies{
+		logger:  newLogger(cfg),
+		tracing: noop.NewTracerProvider(),
+	}
+	if err := registerDatabase(ctx, cfg, deps); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected list, grant or revoke", errUnknownCommand)
+	}
+
+	switch args[0] {
+	case "list":
+		grants, err := deps.database.RoleGrants(ctx)
+		if err != nil {
+			return err
+		}
+
+		subjects := make([]string, 0, len(grants))
+		for subject := range grants {
+			subjects = append(subjects, subject)
+		}
+		slices.Sort(subjects)
+
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SUBJECT\tROLES")
+		for _, subject := range subjects {
+			fmt.Fprintf(w, "%s\t%s\n", subject, strings.Join(grants[subject], ","))
+		}
+		return w.Flush()
+	case "grant", "revoke":
+		if len(args) != 3 {
+			return fmt.Errorf("expected %s <subject> <role>", args[0])
+		}
+		subject := args[1]
+		role, err := rbac.ParseRole(args[2])
+		if err != nil {
+			return err
+		}
+
+		if args[0] == "grant" {
+			// The roles granted to a subject without its identity provider would never apply,
+			// but they can still be revoked.
+			if err := auth.ValidateSubject(subject); err != nil {
+				return err
+			}
+			if err := deps.database.GrantRole(ctx, subject, string(role)); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "granted %s to %s\n", role, subject)
+			return nil
+		}
+
+		if err := deps.database.RevokeRole(ctx, subject, string(role)); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "revoked %s from %s\n", role, subject)
+		return nil
+	default:
+		return fmt.Errorf("%w %q", errUnknownCommand, args[0])
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"net/http"
 	_ "net/http/pprof"
+	"slices"
 
 	"connectrpc.com/connect"
 	"connectrpc.com/otelconnect"
@@ -15,6 +16,7 @@ import (
 	"github.com/saferplace/webserver-go/middleware"
 	"golang.org/x/sync/errgroup"
 	"safer.place/internal/auth"
+	"safer.place/internal/auth/rbac"
 	"safer.place/internal/config"
 	"safer.place/internal/service"
 )
@@ -59,28 +61,73 @@ func Run(ctx context.Context, components []Component, cfg *config.Config) (err e
 		return fmt.Errorf("unable to create user services: %w", err)
 	}
 
+	sharedServices, err := createServices(ctx, cfg, components, deps, sharedComponents)
+	if err != nil {
+		return fmt.Errorf("unable to create shared services: %w", err)
+	}
+
 	// Setup Webserver based on the provided services
-	userAuthMiddleware := auth.NewUserAuthMiddleware()
+	// The users are only authenticated by the processes serving them, so the processes of the
+	// reviewers don't need the user authentication configured.
+	var userAuthenticator auth.Authenticator
+	if len(userServices) > 0 || len(sharedServices) > 0 {
+		userAuthenticator, err = newUserAuthenticator(ctx, cfg.Webserver.Auth.User, deps.logger)
+		if err != nil {
+			return err
+		}
+	}
 
 	// creates services with the internal services
 	services := []webserver.Service{
 		profile,
 		metrics(deps.metrics),
 	}
+	if len(reviewerServices) > 0 {
+		services = append(services, auth.Register("/auth/", &auth.Config{
+			Handler:      auth.RedirectWithSession(cfg.Review.UIURL),
+			Log:          deps.logger.With(slog.String("component", "auth")),
+			Domain:       cfg.Webserver.Auth.Domain,
+			ClientID:     cfg.Webserver.Auth.ClientID,
+			ClientSecret: cfg.Webserver.Auth.ClientSecret,
+			DB:           deps.database,
+		}))
+	}
 	services = append(services,
 		FinalizeServices(
 			nil,
-			interceptors,
+			append(slices.Clone(interceptors),
+				auth.NewAuthInterceptor(deps.database),
+			),
 			reviewerServices,
+			deps.policy,
 		)...,
 	)
-	services = append(services,
-		FinalizeServices(
-			[]middleware.Middleware{userAuthMiddleware},
-			interceptors,
-			userServices,
-		)...,
-	)
+	if len(userServices) > 0 {
+		services = append(services,
+			FinalizeServices(
+				[]middleware.Middleware{auth.NewUserAuthMiddleware(userAuthenticator)},
+				interceptors,
+				userServices,
+				deps.policy,
+			)...,
+		)
+	}
+	if len(sharedServices) > 0 {
+		// The reviewers are authenticated by their session, which is also sent as a cookie so
+		// the review UI can show the images directly.
+		sharedAuthMiddleware := auth.NewUserAuthMiddleware(auth.FirstOf(
+			auth.NewSessionAuthenticator(deps.database),
+			userAuthenticator,
+		))
+		services = append(services,
+			FinalizeServices(
+				[]middleware.Middleware{sharedAuthMiddleware},
+				interceptors,
+				sharedServices,
+				deps.policy,
+			)...,
+		)
+	}
 
 	tlsConfig, err := newTLSConfig(ctx, cfg.Webserver.Cert)
 	if err != nil {
@@ -106,16 +153,18 @@ func Run(ctx context.Context, components []Component, cfg *config.Config) (err e
 	return eg.Wait()
 }
 
-// FinalizeServices wraps all provided services with the middleware.
+// FinalizeServices wraps all provided services with the middleware, and enforces the access
+// control policy once the users have been authenticated by the middleware and interceptors.
 func FinalizeServices(
 	middlewares []middleware.Middleware,
 	interceptors []connect.Interceptor,
 	services []service.Service,
+	policy *rbac.Policy,
 ) []webserver.Service {
 	wrapped := make([]webserver.Service, 0, len(services))
 
 	for _, service := range services {
-		path, handler := service(interceptors...)
+		path, handler := policy.Attach(service)(interceptors...)
 		for _, middleware := range middlewares {
 			handler = middleware(handler)
 		}
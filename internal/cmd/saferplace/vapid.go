@@ -0,0 +1,31 @@
+package saferplace
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"safer.place/internal/config"
+	"safer.place/internal/webpush"
+)
+
+// VAPID generates a new key for the web push, and prints the private key for the config and the
+// public key the browsers subscribe with. With the key already configured, only its public key
+// is printed.
+func VAPID(_ context.Context, cfg *config.Config, _ []string, out io.Writer) error {
+	if vapid := cfg.Alerts.WebPush.VAPID; vapid.Enabled() {
+		sender, err := webpush.New(vapid)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "public_key: %s\n", sender.PublicKey())
+		return nil
+	}
+
+	privateKey, publicKey, err := webpush.GenerateKey()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "private_key: %s\npublic_key: %s\n", privateKey, publicKey)
+	return nil
+}
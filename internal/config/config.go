@@ -11,8 +11,21 @@ import (
 	"github.com/kelseyhightower/envconfig"
 	"golang.org/x/exp/slog"
 	"gopkg.in/yaml.v3"
+	"safer.place/internal/alerts"
+	"safer.place/internal/auth/oidc"
+	"safer.place/internal/consumer"
 	"safer.place/internal/database/sqldatabase"
 	"safer.place/internal/database/surreal"
+	"safer.place/internal/digest"
+	"safer.place/internal/imagegc"
+	"safer.place/internal/notifier/discordnotifier"
+	"safer.place/internal/notifier/emailnotifier"
+	"safer.place/internal/notifier/multinotifier"
+	"safer.place/internal/notifier/webhooknotifier"
+	"safer.place/internal/queue/sqlqueue"
+	"safer.place/internal/service/feed"
+	"safer.place/internal/service/imageupload"
+	"safer.place/internal/storage/filesystem"
 	"safer.place/internal/storage/minio"
 )
 
@@ -22,12 +35,18 @@ type Config struct {
 	File  string
 	Debug bool `yaml:"debug"`
 
-	Webserver WebserverConfig `yaml:"webserver"`
-	Tracing   *tracing.Config `yaml:"tracing"`
-	Queue     QueueConfig     `yaml:"queue"`
-	Database  DatabaseConfig  `yaml:"database"`
-	Storage   StorageConfig   `yaml:"storage"`
-	Notifier  NotifierConfig  `yaml:"notifier"`
+	Webserver WebserverConfig    `yaml:"webserver"`
+	Tracing   *tracing.Config    `yaml:"tracing"`
+	Queue     QueueConfig        `yaml:"queue"`
+	Consumer  ConsumerConfig     `yaml:"consumer"`
+	Review    ReviewConfig       `yaml:"review"`
+	Database  DatabaseConfig     `yaml:"database"`
+	Storage   StorageConfig      `yaml:"storage"`
+	Uploader  imageupload.Config `yaml:"uploader"`
+	ImageGC   imagegc.Config     `yaml:"image_gc"`
+	Notifier  NotifierConfig     `yaml:"notifier"`
+	Alerts    alerts.Config      `yaml:"alerts"`
+	Feed      feed.Config        `yaml:"feed"`
 }
 
 func (c Config) LogValue() slog.Value {
@@ -48,6 +67,29 @@ type WebserverConfig struct {
 // QueueConfig provides the configuration to consume and produce from the queue
 type QueueConfig struct {
 	Provider string `yaml:"provider" default:"memory"`
+
+	SQL *sqlqueue.Config `yaml:"sql"`
+
+	// DeadLetter is the name of the queue which holds the incidents the consumer failed to handle.
+	// It uses the same provider as the incoming incidents.
+	DeadLetter string `yaml:"dead_letter" default:"incidents_dead_letter"`
+	// Alerts is the name of the queue which holds the alerted incidents, until the users
+	// subscribed to their area are alerted. It uses the same provider as the incoming incidents.
+	Alerts string `yaml:"alerts" default:"alerts"`
+}
+
+// ConsumerConfig configures how the consumer handles incidents it failed to process.
+type ConsumerConfig struct {
+	Retry consumer.RetryPolicy `yaml:"retry"`
+}
+
+// ReviewConfig configures who can review the incidents.
+type ReviewConfig struct {
+	// UIURL is where the reviewers are redirected to once they log in.
+	UIURL string `yaml:"ui_url" default:"http://localhost:5173/review/"`
+	// Reviewers are the numeric GitHub user ids which are granted the reviewer role at startup,
+	// shown by https://api.github.com/users/<login>.
+	Reviewers []string `yaml:"reviewers"`
 }
 
 // DatabaseConfig configures the database used as a backend for all incident data.
@@ -62,12 +104,64 @@ type DatabaseConfig struct {
 type StorageConfig struct {
 	Provider string `yaml:"provider" default:"minio"`
 
-	Minio *minio.Config `yaml:"minio"`
+	Minio      *minio.Config      `yaml:"minio"`
+	Filesystem *filesystem.Config `yaml:"filesystem"`
 }
 
 // Notifier can be configured to notify a third party of a incident.
 type NotifierConfig struct {
+	NotifierProviderConfig `yaml:",inline"`
+	// ReviewURL is the address of the review UI, which the notifications link the incidents to.
+	ReviewURL string `yaml:"review_url" split_words:"true" default:"https://review.safer.place/"`
+	// Channels notified about the incidents matching their filters when the provider is
+	// channels.
+	Channels []NotifierChannelConfig `yaml:"channels" ignored:"true"`
+	// Digest of the incidents sent instead of notifying about each of them.
+	Digest digest.Config `yaml:"digest"`
+}
+
+// NotifierProviderConfig selects the notifier and configures it.
+type NotifierProviderConfig struct {
 	Provider string `yaml:"provider" default:"log"`
+
+	Discord *discordnotifier.Config `yaml:"discord"`
+	Email   *emailnotifier.Config   `yaml:"email"`
+	Webhook *webhooknotifier.Config `yaml:"webhook"`
+}
+
+// NotifierChannelConfig configures one of the channels of the notifier. Each channel can also be
+// configured through the environment variables prefixed with SAFERPLACE_NOTIFIER_CHANNELS_ and
+// its name, such as SAFERPLACE_NOTIFIER_CHANNELS_DUBLIN_DISCORD_ENDPOINT.
+type NotifierChannelConfig struct {
+	NotifierProviderConfig `yaml:",inline"`
+
+	Name   string               `yaml:"name" ignored:"true"`
+	Filter multinotifier.Filter `yaml:"filter" ignored:"true"`
+	Policy multinotifier.Policy `yaml:"policy" ignored:"true"`
+}
+
+// UnmarshalYAML decodes the channel over its defaults and environment variables, as they are not
+// set on the channels listed in the file.
+func (c *NotifierChannelConfig) UnmarshalYAML(value *yaml.Node) error {
+	type plain NotifierChannelConfig
+
+	var named struct {
+		Name string `yaml:"name"`
+	}
+	if err := value.Decode(&named); err != nil {
+		return err
+	}
+
+	channel := plain{}
+	if err := envconfig.Process("saferplace_notifier_channels_"+named.Name, &channel); err != nil {
+		return fmt.Errorf("unable to read channel %q from environment: %w", named.Name, err)
+	}
+	if err := value.Decode(&channel); err != nil {
+		return err
+	}
+
+	*c = NotifierChannelConfig(channel)
+	return nil
 }
 
 // CertConfig specifies how the certificates should be created
@@ -82,6 +176,29 @@ type AuthConfig struct {
 	ClientID     string `split_words:"true"`
 	ClientSecret string `split_words:"true"`
 	Domain       string `default:"http://localhost:8001"`
+
+	User  UserAuthConfig `yaml:"user"`
+	Roles RolesConfig    `yaml:"roles"`
+}
+
+// RolesConfig configures the roles of the users.
+type RolesConfig struct {
+	// Default role of the authenticated users who haven't been granted any role.
+	Default string `yaml:"default" default:"reporter"`
+	// Admins are the subjects of the users granted the admin role at startup, so there is always
+	// someone who can grant the roles to the other users. The subjects are qualified by their
+	// identity provider: github:<id>, oidc:<issuer>|<subject> or insecure:<email>.
+	Admins []string `yaml:"admins"`
+}
+
+// UserAuthConfig configures how the users of the user facing services are authenticated.
+type UserAuthConfig struct {
+	// Provider is either "oidc", or "insecure" which trusts the X-Email header sent by the user
+	// and must only be used for development. The insecure provider is never the default, so it
+	// must be chosen explicitly.
+	Provider string `yaml:"provider" default:"oidc"`
+
+	OIDC *oidc.Config `yaml:"oidc"`
 }
 
 // Parse the configuration from a specific file. We first load the configuration from the
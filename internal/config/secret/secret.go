@@ -2,11 +2,26 @@ package secret
 
 import "log/slog"
 
-// Secret hides secrets which do not want to log by accident.
+// Secret hides secrets which do not want to log by accident. The value is only revealed when
+// converted to a string.
 type Secret string
 
+// redacted replaces the secret when it's logged or formatted.
+const redacted = "<redacted>"
+
 // LogValue implements slog.LogValuer.
 // It avoids revealing the token.
 func (Secret) LogValue() slog.Value {
-	return slog.StringValue("<redacted>")
+	return slog.StringValue(redacted)
+}
+
+// String implements fmt.Stringer, so the secret is redacted when formatted, even as part of the
+// config.
+func (Secret) String() string {
+	return redacted
+}
+
+// GoString implements fmt.GoStringer, so the secret is redacted when formatted with %#v.
+func (Secret) GoString() string {
+	return redacted
 }
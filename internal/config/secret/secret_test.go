@@ -0,0 +1,28 @@
+package secret
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSecretFormat(t *testing.T) {
+	type key struct{ Private Secret }
+	cfg := struct {
+		Key   key
+		Token Secret
+	}{
+		Key:   key{Private: "private"},
+		Token: "token",
+	}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		if got := fmt.Sprintf(format, cfg); strings.Contains(got, "private") || strings.Contains(got, "token") {
+			t.Errorf("%s formatted the secrets as %s", format, got)
+		}
+	}
+
+	if got := string(cfg.Token); got != "token" {
+		t.Errorf("string(Secret) = %q, want the secret", got)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"time"
 
 	"go.opentelemetry.io/otel/trace"
 
@@ -12,6 +14,7 @@ import (
 	"safer.place/internal/log"
 	"safer.place/internal/notifier"
 	"safer.place/internal/queue"
+	"safer.place/internal/queue/otelhelper"
 
 	"api.safer.place/incident/v1"
 )
@@ -19,8 +22,11 @@ import (
 // Review is a big wrapper around incoming reviews
 type Review struct {
 	incoming       queue.Consumer[*incident.Incident]
+	deadLetter     queue.Producer[*incident.Incident]
 	reviewNotifier notifier.Notifier
+	notifyIf       func(*incident.Incident) bool
 	db             database.Database
+	retry          RetryPolicy
 
 	log    log.Logger
 	tracer trace.Tracer
@@ -28,7 +34,13 @@ type Review struct {
 
 // New review handler
 func New(opts ...Option) *Review {
-	r := &Review{}
+	r := &Review{
+		retry: RetryPolicy{
+			MaxAttempts:    5,
+			InitialBackoff: time.Second,
+			MaxBackoff:     5 * time.Minute,
+		},
+	}
 
 	for _, opt := range opts {
 		opt(r)
@@ -37,35 +49,40 @@ func New(opts ...Option) *Review {
 	return r
 }
 
-// Run the review process
+// Run the review process until the context is cancelled. Incidents which fail to be handled are
+// retried according to the retry policy, so a single bad incident doesn't stop the consumer.
 func (r *Review) Run(ctx context.Context) error {
 	r.log.Info(ctx, "listening for incoming reviews")
 	for {
 		if err := r.handleIncoming(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			r.log.Error(ctx, "incident handling failed",
 				log.Error(err),
 			)
-			// TODO: For debugging. We typically don't actually want to shut
-			//       down.
-			return err
 		}
 	}
 }
 
 func (r *Review) handleIncoming(ctx context.Context) (err error) {
-	ctx, span := r.tracer.Start(ctx, "handleIncoming")
-	defer span.End()
-
 	msg, err := r.incoming.Consume(ctx)
 	if err != nil {
+		// Avoid spinning when the queue is unavailable.
+		select {
+		case <-ctx.Done():
+		case <-time.After(r.retry.InitialBackoff):
+		}
 		return fmt.Errorf("unable to receive: %w", err)
 	}
+
+	// Continue the trace of the reported incident.
+	ctx, span := r.tracer.Start(otelhelper.ExtractContext(ctx, msg.Metadata()), "handleIncoming")
+	defer span.End()
+
 	defer func() {
 		if err != nil {
-			r.log.Debug(ctx, "nacking incident",
-				log.Error(err),
-			)
-			msg.Nack()
+			r.retryOrDeadLetter(ctx, msg, err)
 			return
 		}
 		r.log.Debug(ctx, "acking incident")
@@ -86,6 +103,13 @@ func (r *Review) handleIncoming(ctx context.Context) (err error) {
 		return fmt.Errorf("unable to save incident: %w", err)
 	}
 
+	if r.notifyIf != nil && !r.notifyIf(inc) {
+		r.log.Debug(ctx, "not notifying about incident",
+			slog.String("id", inc.Id),
+		)
+		return nil
+	}
+
 	// Notify about incoming review
 	if err := r.reviewNotifier.Notify(ctx, inc); err != nil {
 		return fmt.Errorf("unable to notify about incoming review: %w", err)
@@ -93,3 +117,59 @@ func (r *Review) handleIncoming(ctx context.Context) (err error) {
 
 	return nil
 }
+
+// retryOrDeadLetter nacks the message so it can be retried after a backoff, or moves it to the
+// dead letter queue if it already failed too many times. Without a dead letter queue, the message
+// is dropped instead so it isn't retried forever.
+func (r *Review) retryOrDeadLetter(ctx context.Context, msg queue.Message[*incident.Incident], cause error) {
+	attempt := 1
+	redeliverable, ok := msg.(queue.Redeliverable)
+	if ok {
+		attempt = redeliverable.Deliveries()
+	}
+
+	if attempt < r.retry.MaxAttempts {
+		backoff := r.retry.Backoff(attempt)
+		r.log.Debug(ctx, "nacking incident",
+			slog.String("id", msg.Body().Id),
+			slog.Int("attempt", attempt),
+			slog.Duration("backoff", backoff),
+			log.Error(cause),
+		)
+		if ok {
+			redeliverable.NackAfter(backoff)
+		} else {
+			msg.Nack()
+		}
+		return
+	}
+
+	if r.deadLetter == nil {
+		r.log.Error(ctx, "dropping incident, there is no dead letter queue",
+			slog.String("id", msg.Body().Id),
+			slog.Int("attempt", attempt),
+			log.Error(cause),
+		)
+		msg.Ack()
+		return
+	}
+
+	r.log.Warn(ctx, "moving incident to the dead letter queue",
+		slog.String("id", msg.Body().Id),
+		slog.Int("attempt", attempt),
+		log.Error(cause),
+	)
+
+	md := make(http.Header)
+	md.Set(queue.DeadLetterReasonKey, cause.Error())
+	if err := r.deadLetter.Produce(ctx, queue.NewMessage(msg.Body(), md)); err != nil {
+		r.log.Error(ctx, "unable to dead letter incident",
+			slog.String("id", msg.Body().Id),
+			log.Error(err),
+		)
+		msg.Nack()
+		return
+	}
+
+	msg.Ack()
+}
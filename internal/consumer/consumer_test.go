@@ -0,0 +1,140 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/queue"
+	"safer.place/internal/queue/memory"
+)
+
+type fakeDatabase struct {
+	database.Database
+}
+
+func (fakeDatabase) SaveIncident(context.Context, *incident.Incident) error {
+	return nil
+}
+
+type failingNotifier struct {
+	calls atomic.Int32
+}
+
+func (n *failingNotifier) Notify(context.Context, *incident.Incident) error {
+	n.calls.Add(1)
+	return errors.New("notifier unavailable")
+}
+
+func TestDeadLetter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer := noop.NewTracerProvider().Tracer("")
+	incoming := memory.New(memory.Tracer[*incident.Incident](tracer))
+	deadLetters := memory.NewDeadLetters[*incident.Incident]()
+	notifier := &failingNotifier{}
+
+	c := New(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(tracer),
+		Consumer(incoming),
+		DeadLetter(deadLetters),
+		Database(fakeDatabase{}),
+		Notifier(notifier),
+		// The incidents left to the digest are handled without notifying about them.
+		NotifyIf(func(i *incident.Incident) bool { return i.Id != "digest" }),
+		Retry(RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+		}),
+	)
+
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	for _, id := range []string{"digest", "id"} {
+		if err := incoming.Produce(ctx, queue.NewMessage(&incident.Incident{Id: id}, nil)); err != nil {
+			t.Fatalf("Produce() = %v", err)
+		}
+	}
+
+	var letters []*queue.DeadLetter[*incident.Incident]
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		letters, _ = deadLetters.List(ctx)
+		if len(letters) > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(letters) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(letters))
+	}
+	if got := letters[0].Body.Id; got != "id" {
+		t.Errorf("dead letter id = %q, want %q", got, "id")
+	}
+	if letters[0].Reason == "" {
+		t.Errorf("dead letter is missing the reason")
+	}
+	if got := notifier.calls.Load(); got != 3 {
+		t.Errorf("notifier called %d times, want 3", got)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestDropWithoutDeadLetter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer := noop.NewTracerProvider().Tracer("")
+	incoming := memory.New(memory.Tracer[*incident.Incident](tracer))
+	notifier := &failingNotifier{}
+
+	c := New(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(tracer),
+		Consumer(incoming),
+		Database(fakeDatabase{}),
+		Notifier(notifier),
+		Retry(RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+		}),
+	)
+
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	if err := incoming.Produce(ctx, queue.NewMessage(&incident.Incident{Id: "id"}, nil)); err != nil {
+		t.Fatalf("Produce() = %v", err)
+	}
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline) && notifier.calls.Load() < 3; {
+		time.Sleep(time.Millisecond)
+	}
+	// The incident isn't retried once it is dropped.
+	time.Sleep(50 * time.Millisecond)
+	if got := notifier.calls.Load(); got != 3 {
+		t.Errorf("notifier called %d times, want 3", got)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() = %v, want %v", err, context.Canceled)
+	}
+}
@@ -20,6 +20,21 @@ func Consumer(c queue.Consumer[*incident.Incident]) Option {
 	}
 }
 
+// DeadLetter is where incidents which failed to be handled too many times are moved to. Without it
+// the incidents are dropped once the retries are exhausted.
+func DeadLetter(p queue.Producer[*incident.Incident]) Option {
+	return func(r *Review) {
+		r.deadLetter = p
+	}
+}
+
+// Retry specifies how failed incidents are retried.
+func Retry(p RetryPolicy) Option {
+	return func(r *Review) {
+		r.retry = p
+	}
+}
+
 // Notifier is used to notify about incoming review
 func Notifier(n notifier.Notifier) Option {
 	return func(r *Review) {
@@ -27,6 +42,14 @@ func Notifier(n notifier.Notifier) Option {
 	}
 }
 
+// NotifyIf only notifies about the incidents for which it returns true, leaving the others to be
+// notified about some other way, such as in a digest.
+func NotifyIf(fn func(*incident.Incident) bool) Option {
+	return func(r *Review) {
+		r.notifyIf = fn
+	}
+}
+
 // Database Option is specified to add the database to insert the review.
 func Database(db database.Database) Option {
 	return func(r *Review) {
@@ -0,0 +1,25 @@
+package consumer
+
+import "time"
+
+// RetryPolicy configures how incidents which failed to be handled are retried. Once an incident
+// failed MaxAttempts times it is moved to the dead letter queue, or dropped if there is none.
+type RetryPolicy struct {
+	MaxAttempts    int           `yaml:"max_attempts" default:"5"`
+	InitialBackoff time.Duration `yaml:"initial_backoff" default:"1s"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" default:"5m"`
+}
+
+// Backoff returns how long to wait before the next attempt, doubling the initial backoff for
+// every failed attempt, up to the max backoff.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if backoff >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+
+	return min(backoff, p.MaxBackoff)
+}
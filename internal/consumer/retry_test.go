@@ -0,0 +1,29 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+	}
+
+	testCases := map[int]time.Duration{
+		1:   time.Second,
+		2:   2 * time.Second,
+		3:   4 * time.Second,
+		4:   8 * time.Second,
+		5:   10 * time.Second,
+		100: 10 * time.Second,
+	}
+
+	for attempt, want := range testCases {
+		if got := p.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
@@ -21,6 +21,10 @@ var (
 	// ErrDoesNotExist is returned when we try to update a record but it
 	// does not exist.
 	ErrDoesNotExist = errors.New("database: doesn't exist")
+	// ErrConflict is returned when the record was changed by someone else since we read it.
+	ErrConflict = errors.New("database: changed concurrently")
+	// ErrExpired is returned when the session has expired.
+	ErrExpired = errors.New("database: expired")
 )
 
 // Database defines the interface that a database needs to implement to be
@@ -29,11 +33,22 @@ type Database interface {
 	Review
 	Incidents
 	Sessions
+	Reviewers
+	Roles
+	History
+	Images
+	Uploads
+	Subscriptions
+	Digests
+	WebhookDeliveries
 }
 
 type Review interface {
 	SaveIncident(context.Context, *incident.Incident) error
-	SaveReview(context.Context, string, incident.Resolution, *incident.Comment) error
+	// SaveReview changes the resolution of the incident from the one it was reviewed with, adding
+	// the comment and recording the change in the incident history. ErrConflict is returned if the
+	// resolution has been changed by someone else in the meantime.
+	SaveReview(ctx context.Context, id string, from, to incident.Resolution, comment *incident.Comment) error
 	IncidentsWithoutReview(context.Context) ([]*incident.Incident, error)
 	ViewIncident(context.Context, string) (*incident.Incident, error)
 }
@@ -42,9 +57,181 @@ type Incidents interface {
 	ViewIncident(context.Context, string) (*incident.Incident, error)
 	IncidentsInRegion(context.Context, time.Time, *viewer.Region) ([]*incident.Incident, error)
 	AlertingIncidents(context.Context, time.Time, *viewer.Region) ([]*incident.Incident, error)
+	// ReviewedIncidents returns the incidents in the region which are accepted or alerted, and
+	// were last reviewed to it at or after the time, oldest review first.
+	ReviewedIncidents(ctx context.Context, since time.Time, region *viewer.Region) ([]*ReviewedIncident, error)
+}
+
+// ReviewedIncident is the incident with when it was last accepted or alerted.
+type ReviewedIncident struct {
+	Incident *incident.Incident
+	Reviewed time.Time
 }
 
 type Sessions interface {
-	SaveSession(context.Context, string) error
+	// SaveSession of the reviewer with the ID, which is valid until it expires.
+	SaveSession(ctx context.Context, session string, reviewerID string, expiry time.Time) error
+	// IsValidSession returns nil if the session exists and hasn't expired.
 	IsValidSession(context.Context, string) error
+	// SessionReviewer returns the reviewer the session belongs to, if the session is still valid.
+	SessionReviewer(context.Context, string) (*Reviewer, error)
+}
+
+// Reviewer is a user who can review incidents.
+type Reviewer struct {
+	// ID of the reviewer, which is their numeric GitHub user id.
+	ID    string
+	Name  string
+	Email string
+}
+
+type Reviewers interface {
+	// SaveReviewer creates the reviewer, or updates their details if they already exist.
+	SaveReviewer(context.Context, *Reviewer) error
+}
+
+// Roles stores the roles granted to the users, identified by their subject.
+type Roles interface {
+	// UserRoles returns the roles granted to the user, which is empty if they don't have any.
+	UserRoles(ctx context.Context, subject string) ([]string, error)
+	// GrantRole to the user. Granting a role the user already has is not an error, and keeps it
+	// once it's removed from the config.
+	GrantRole(ctx context.Context, subject string, role string) error
+	// SyncConfigRoles grants the roles of each user in the config, and revokes the roles granted
+	// from the config before which are no longer in it. The roles granted with GrantRole are kept.
+	SyncConfigRoles(ctx context.Context, grants map[string][]string) error
+	// RevokeRole from the user. Revoking a role the user doesn't have is not an error.
+	RevokeRole(ctx context.Context, subject string, role string) error
+	// RoleGrants returns the roles granted to each user.
+	RoleGrants(context.Context) (map[string][]string, error)
+}
+
+// Transition of the incident resolution, recorded each time the incident is reviewed.
+type Transition struct {
+	IncidentID string
+	// Actor is the subject of the user who changed the resolution.
+	Actor     string
+	From      incident.Resolution
+	To        incident.Resolution
+	Reason    string
+	Timestamp time.Time
+}
+
+// History of the incidents, which can only be appended to.
+type History interface {
+	// IncidentHistory returns the transitions of the incident, oldest first.
+	IncidentHistory(ctx context.Context, id string) ([]*Transition, error)
+	// SaveTransition appends the change made to the incident outside of a review, such as its
+	// image being redacted, which keeps its resolution.
+	SaveTransition(context.Context, *Transition) error
+}
+
+// Images links the uploaded images to the incidents they were reported with.
+type Images interface {
+	// ImageIncidents returns the incidents reported with the image, without their comments. The
+	// same image can be reported with several incidents, as the images are stored by their
+	// content. None are returned if no incident has the image.
+	ImageIncidents(ctx context.Context, imageID string) ([]*incident.Incident, error)
+}
+
+// Uploads records who uploaded each image, so the image can only be reported by them, and which
+// images were never reported so they can be deleted.
+type Uploads interface {
+	// SaveUpload records the image uploaded by the user with the subject. Uploading the same
+	// image again updates when it was uploaded.
+	SaveUpload(ctx context.Context, imageID, owner string, uploaded time.Time) error
+	// AttachUpload attaches the image to the incident it is reported with. ErrDoesNotExist is
+	// returned if the user didn't upload the image, and ErrConflict if it is attached to another
+	// incident.
+	AttachUpload(ctx context.Context, imageID, owner, incidentID string) error
+	// DetachUpload detaches the image from the incident, if it is attached to it, so it can be
+	// reported again when the incident failed to be reported.
+	DetachUpload(ctx context.Context, imageID, owner, incidentID string) error
+	// OrphanUploads returns the images last uploaded before the time which no incident has.
+	OrphanUploads(ctx context.Context, before time.Time) ([]string, error)
+	// DeleteUpload removes the records of the image.
+	DeleteUpload(ctx context.Context, imageID string) error
+}
+
+// Digests keep track of the incidents the reviewers were sent in a digest, so each of them is sent
+// once, even by the digests running in several processes or after a restart.
+type Digests interface {
+	// IncidentsToDigest returns the incidents waiting for review which were not taken for a digest.
+	IncidentsToDigest(context.Context) ([]*incident.Incident, error)
+	// TakeDigest records the incident being sent in the digest, unless another digest has taken
+	// it already. It returns false if the incident must not be sent.
+	TakeDigest(ctx context.Context, id string, now time.Time) (bool, error)
+	// ReturnDigest takes back the incident taken at the time, which was not sent, so it is sent in
+	// the next digest.
+	ReturnDigest(ctx context.Context, id string, taken time.Time) error
+}
+
+// WebhookDelivery is the outcome of delivering the incident to one of the webhooks.
+type WebhookDelivery struct {
+	ID         string
+	IncidentID string
+	// URL of the webhook, without its credentials and query.
+	URL string
+	// Attempts to deliver the incident, across every time it was notified about.
+	Attempts int
+	// StatusCode of the last response, zero if there was none.
+	StatusCode int
+	// Error of the last attempt, empty if it was delivered.
+	Error     string
+	Delivered bool
+	Updated   time.Time
+}
+
+// WebhookDeliveries keep the outcome of delivering the incidents to the webhooks, so the incidents
+// are only delivered again to the webhooks which didn't get them.
+type WebhookDeliveries interface {
+	// SaveWebhookDelivery records the outcome of the delivery, adding its attempts to the ones
+	// of the delivery with the same ID.
+	SaveWebhookDelivery(context.Context, *WebhookDelivery) error
+	// WebhookDelivery returns the delivery with the ID. ErrDoesNotExist is returned if it was
+	// never attempted.
+	WebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error)
+}
+
+// Cell is the smallest region the users can subscribe to the alerts in, a hundredth of a degree
+// on each side. It is identified by its south west corner in hundredths of a degree, the same
+// units as the viewer regions.
+type Cell struct {
+	Lat int
+	Lon int
+}
+
+// Subscription of a user to the alerts about the incidents in the cells.
+type Subscription struct {
+	ID string
+	// Owner is the subject of the user who subscribed.
+	Owner string
+	Cells []Cell
+	// Channel the alerts are delivered through, and the Endpoint they are delivered to.
+	Channel  string
+	Endpoint string
+	// Secret signs the alerts, so the subscriber can check they are from us.
+	Secret  string
+	Created time.Time
+}
+
+// Subscriptions of the users to the alerts in their areas.
+type Subscriptions interface {
+	// SaveSubscription creates the subscription. ErrAlreadyExists is returned if there is one
+	// with the same ID.
+	SaveSubscription(context.Context, *Subscription) error
+	// UserSubscriptions returns the subscriptions of the user, oldest first.
+	UserSubscriptions(ctx context.Context, owner string) ([]*Subscription, error)
+	// CellSubscriptions returns the subscriptions to the cell, without their cells.
+	CellSubscriptions(context.Context, Cell) ([]*Subscription, error)
+	// DeleteSubscription of the user. ErrDoesNotExist is returned if the user doesn't have it.
+	DeleteSubscription(ctx context.Context, id, owner string) error
+	// TakeAlert records an alert being sent to the subscription, unless it has been sent limit
+	// alerts already within the window, which starts with the first alert after the previous
+	// window ended. It returns false if the alert must not be sent. ErrDoesNotExist is returned
+	// if the subscription doesn't exist.
+	TakeAlert(ctx context.Context, id string, now time.Time, limit int, window time.Duration) (bool, error)
+	// ReturnAlert takes back the alert taken at the time, which was not sent, unless the window
+	// it was recorded in has ended since.
+	ReturnAlert(ctx context.Context, id string, taken time.Time) error
 }
@@ -0,0 +1,208 @@
+// Package databasetest contains the conformance tests which every implementation of the
+// database.Database interface has to pass.
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"safer.place/internal/database"
+)
+
+// NewDatabase returns a new empty database for the test.
+type NewDatabase func(t *testing.T) database.Database
+
+// Run the conformance tests against the databases created by newDB. Each test gets its own
+// database.
+func Run(t *testing.T, newDB NewDatabase) {
+	t.Run("Incidents", func(t *testing.T) { testIncidents(t, newDB(t)) })
+	t.Run("Reviews", func(t *testing.T) { testReviews(t, newDB(t)) })
+	t.Run("Images", func(t *testing.T) { testImages(t, newDB(t)) })
+	t.Run("Region", func(t *testing.T) { testRegion(t, newDB(t)) })
+	t.Run("Since", func(t *testing.T) { testSince(t, newDB(t)) })
+	t.Run("Resolutions", func(t *testing.T) { testResolutions(t, newDB(t)) })
+	t.Run("ReviewedIncidents", func(t *testing.T) { testReviewedIncidents(t, newDB(t)) })
+	t.Run("ConcurrentIncidents", func(t *testing.T) { testConcurrentIncidents(t, newDB(t)) })
+	t.Run("ConcurrentReviews", func(t *testing.T) { testConcurrentReviews(t, newDB(t)) })
+	t.Run("Sessions", func(t *testing.T) { testSessions(t, newDB(t)) })
+	t.Run("Reviewers", func(t *testing.T) { testReviewers(t, newDB(t)) })
+	t.Run("Roles", func(t *testing.T) { testRoles(t, newDB(t)) })
+	t.Run("ConfigRoles", func(t *testing.T) { testConfigRoles(t, newDB(t)) })
+	t.Run("Uploads", func(t *testing.T) { testUploads(t, newDB(t)) })
+	t.Run("Subscriptions", func(t *testing.T) { testSubscriptions(t, newDB(t)) })
+	t.Run("Digests", func(t *testing.T) { testDigests(t, newDB(t)) })
+	t.Run("WebhookDeliveries", func(t *testing.T) { testWebhookDeliveries(t, newDB(t)) })
+}
+
+func testSessions(t *testing.T, db database.Database) {
+	ctx := context.Background()
+
+	if err := db.SaveReviewer(ctx, &database.Reviewer{ID: "reviewer", Name: "Reviewer"}); err != nil {
+		t.Fatalf("SaveReviewer() = %v", err)
+	}
+	if err := db.SaveSession(ctx, "valid", "reviewer", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("SaveSession() = %v", err)
+	}
+	if err := db.SaveSession(ctx, "expired", "reviewer", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("SaveSession() = %v", err)
+	}
+
+	tests := []struct {
+		session string
+		want    error
+	}{
+		{session: "valid", want: nil},
+		{session: "expired", want: database.ErrExpired},
+		{session: "unknown", want: database.ErrDoesNotExist},
+	}
+	for _, tt := range tests {
+		if err := db.IsValidSession(ctx, tt.session); !errors.Is(err, tt.want) {
+			t.Errorf("IsValidSession(%q) = %v, want %v", tt.session, err, tt.want)
+		}
+		if _, err := db.SessionReviewer(ctx, tt.session); !errors.Is(err, tt.want) {
+			t.Errorf("SessionReviewer(%q) = %v, want %v", tt.session, err, tt.want)
+		}
+	}
+
+	reviewer, err := db.SessionReviewer(ctx, "valid")
+	if err != nil {
+		t.Fatalf("SessionReviewer() = %v", err)
+	}
+	if reviewer.ID != "reviewer" || reviewer.Name != "Reviewer" {
+		t.Errorf("SessionReviewer() = %+v, want the reviewer", reviewer)
+	}
+}
+
+func testReviewers(t *testing.T, db database.Database) {
+	ctx := context.Background()
+
+	if err := db.SaveReviewer(ctx, &database.Reviewer{ID: "reviewer", Name: "Old"}); err != nil {
+		t.Fatalf("SaveReviewer() = %v", err)
+	}
+	// Saving the reviewer again updates their details.
+	want := database.Reviewer{ID: "reviewer", Name: "New", Email: "reviewer@example.com"}
+	if err := db.SaveReviewer(ctx, &want); err != nil {
+		t.Fatalf("SaveReviewer() = %v", err)
+	}
+
+	if err := db.SaveSession(ctx, "session", "reviewer", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("SaveSession() = %v", err)
+	}
+	got, err := db.SessionReviewer(ctx, "session")
+	if err != nil {
+		t.Fatalf("SessionReviewer() = %v", err)
+	}
+	if *got != want {
+		t.Errorf("SessionReviewer() = %+v, want %+v", *got, want)
+	}
+}
+
+func testRoles(t *testing.T, db database.Database) {
+	ctx := context.Background()
+
+	grants := []struct{ subject, role string }{
+		{"alice", "reviewer"},
+		{"alice", "moderator"},
+		// Granting the same role twice is not an error.
+		{"alice", "reviewer"},
+		{"bob", "admin"},
+	}
+	for _, g := range grants {
+		if err := db.GrantRole(ctx, g.subject, g.role); err != nil {
+			t.Fatalf("GrantRole(%q, %q) = %v", g.subject, g.role, err)
+		}
+	}
+	if err := db.RevokeRole(ctx, "bob", "admin"); err != nil {
+		t.Fatalf("RevokeRole() = %v", err)
+	}
+	// Revoking a role the user doesn't have is not an error.
+	if err := db.RevokeRole(ctx, "bob", "admin"); err != nil {
+		t.Fatalf("RevokeRole() = %v", err)
+	}
+
+	tests := []struct {
+		subject string
+		want    []string
+	}{
+		{subject: "alice", want: []string{"moderator", "reviewer"}},
+		{subject: "bob", want: nil},
+		{subject: "unknown", want: nil},
+	}
+	for _, tt := range tests {
+		got, err := db.UserRoles(ctx, tt.subject)
+		if err != nil {
+			t.Fatalf("UserRoles(%q) = %v", tt.subject, err)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("UserRoles(%q) = %v, want %v", tt.subject, got, tt.want)
+		}
+	}
+
+	all, err := db.RoleGrants(ctx)
+	if err != nil {
+		t.Fatalf("RoleGrants() = %v", err)
+	}
+	if len(all) != 1 || len(all["alice"]) != 2 {
+		t.Errorf("RoleGrants() = %v, want the roles of alice", all)
+	}
+}
+
+func testConfigRoles(t *testing.T, db database.Database) {
+	ctx := context.Background()
+
+	if err := db.GrantRole(ctx, "carol", "reviewer"); err != nil {
+		t.Fatalf("GrantRole() = %v", err)
+	}
+	sync := func(grants map[string][]string, want map[string][]string) {
+		t.Helper()
+		if err := db.SyncConfigRoles(ctx, grants); err != nil {
+			t.Fatalf("SyncConfigRoles(%v) = %v", grants, err)
+		}
+		got, err := db.RoleGrants(ctx)
+		if err != nil {
+			t.Fatalf("RoleGrants() = %v", err)
+		}
+		for subject := range got {
+			slices.Sort(got[subject])
+		}
+		if len(got) != len(want) {
+			t.Fatalf("RoleGrants() = %v, want %v", got, want)
+		}
+		for subject, roles := range want {
+			if !slices.Equal(got[subject], roles) {
+				t.Errorf("RoleGrants() = %v, want %v", got, want)
+			}
+		}
+	}
+
+	sync(map[string][]string{
+		"alice": {"admin", "reviewer"},
+		"bob":   {"reviewer"},
+		"carol": {"reviewer"},
+	}, map[string][]string{
+		"alice": {"admin", "reviewer"},
+		"bob":   {"reviewer"},
+		"carol": {"reviewer"},
+	})
+
+	// The roles removed from the config are revoked, unless they were granted with GrantRole,
+	// before or after they were in the config.
+	if err := db.GrantRole(ctx, "alice", "reviewer"); err != nil {
+		t.Fatalf("GrantRole() = %v", err)
+	}
+	sync(map[string][]string{
+		"bob": {"reviewer"},
+	}, map[string][]string{
+		"alice": {"reviewer"},
+		"bob":   {"reviewer"},
+		"carol": {"reviewer"},
+	})
+	sync(nil, map[string][]string{
+		"alice": {"reviewer"},
+		"carol": {"reviewer"},
+	})
+}
@@ -0,0 +1,64 @@
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"safer.place/internal/database"
+)
+
+func testWebhookDeliveries(t *testing.T, db database.Database) {
+	ctx := context.Background()
+	now := time.Unix(time.Now().Unix(), 0)
+
+	if _, err := db.WebhookDelivery(ctx, "delivery"); !errors.Is(err, database.ErrDoesNotExist) {
+		t.Errorf("WebhookDelivery() = %v, want %v", err, database.ErrDoesNotExist)
+	}
+
+	failed := &database.WebhookDelivery{
+		ID:         "delivery",
+		IncidentID: "incident",
+		URL:        "https://hooks.example.com/incidents",
+		Attempts:   3,
+		StatusCode: 503,
+		Error:      "unexpected response: 503 Service Unavailable",
+		Updated:    now.Add(-time.Minute),
+	}
+	if err := db.SaveWebhookDelivery(ctx, failed); err != nil {
+		t.Fatalf("SaveWebhookDelivery() = %v", err)
+	}
+	got, err := db.WebhookDelivery(ctx, "delivery")
+	if err != nil {
+		t.Fatalf("WebhookDelivery() = %v", err)
+	}
+	if *got != *failed {
+		t.Errorf("WebhookDelivery() = %+v, want %+v", got, failed)
+	}
+
+	// The attempts of each time the incident was delivered are added up.
+	if err := db.SaveWebhookDelivery(ctx, &database.WebhookDelivery{
+		ID:         "delivery",
+		IncidentID: "incident",
+		URL:        "https://hooks.example.com/incidents",
+		Attempts:   1,
+		StatusCode: 204,
+		Delivered:  true,
+		Updated:    now,
+	}); err != nil {
+		t.Fatalf("SaveWebhookDelivery() = %v", err)
+	}
+	want := database.WebhookDelivery{
+		ID:         "delivery",
+		IncidentID: "incident",
+		URL:        "https://hooks.example.com/incidents",
+		Attempts:   4,
+		StatusCode: 204,
+		Delivered:  true,
+		Updated:    now,
+	}
+	if got, err := db.WebhookDelivery(ctx, "delivery"); err != nil || *got != want {
+		t.Errorf("WebhookDelivery() = %+v, %v, want %+v", got, err, want)
+	}
+}
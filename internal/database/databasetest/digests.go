@@ -0,0 +1,77 @@
+package databasetest
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"safer.place/internal/database"
+)
+
+func testDigests(t *testing.T, db database.Database) {
+	ctx := context.Background()
+	now := time.Unix(time.Now().Unix(), 0)
+
+	for _, id := range []string{"first", "second", "reviewed"} {
+		if err := db.SaveIncident(ctx, &incident.Incident{
+			Id:          id,
+			Timestamp:   timestamppb.New(now),
+			Coordinates: &incident.Coordinates{Lat: 46.05, Lon: 14.5},
+		}); err != nil {
+			t.Fatalf("SaveIncident(%s) = %v", id, err)
+		}
+	}
+	if err := db.SaveReview(ctx, "reviewed",
+		incident.Resolution_RESOLUTION_UNSPECIFIED,
+		incident.Resolution_RESOLUTION_ACCEPTED,
+		&incident.Comment{AuthorId: "reviewer", Timestamp: now.Unix(), Resolution: incident.Resolution_RESOLUTION_ACCEPTED},
+	); err != nil {
+		t.Fatalf("SaveReview() = %v", err)
+	}
+
+	toDigest := func() []string {
+		t.Helper()
+		incs, err := db.IncidentsToDigest(ctx)
+		if err != nil {
+			t.Fatalf("IncidentsToDigest() = %v", err)
+		}
+		ids := make([]string, 0, len(incs))
+		for _, inc := range incs {
+			ids = append(ids, inc.Id)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	if got := toDigest(); !slices.Equal(got, []string{"first", "second"}) {
+		t.Errorf("IncidentsToDigest() = %v, want first and second", got)
+	}
+
+	// Only one of the digests takes the incident.
+	if taken, err := db.TakeDigest(ctx, "first", now); err != nil || !taken {
+		t.Errorf("TakeDigest() = %v, %v, want true", taken, err)
+	}
+	if taken, err := db.TakeDigest(ctx, "first", now.Add(time.Second)); err != nil || taken {
+		t.Errorf("TakeDigest() again = %v, %v, want false", taken, err)
+	}
+	if taken, err := db.TakeDigest(ctx, "second", now); err != nil || !taken {
+		t.Errorf("TakeDigest() = %v, %v, want true", taken, err)
+	}
+	if got := toDigest(); len(got) != 0 {
+		t.Errorf("IncidentsToDigest() = %v, want none", got)
+	}
+
+	// The incident is only given back by the digest which took it.
+	if err := db.ReturnDigest(ctx, "first", now.Add(time.Second)); err != nil {
+		t.Errorf("ReturnDigest() = %v", err)
+	}
+	if err := db.ReturnDigest(ctx, "second", now); err != nil {
+		t.Errorf("ReturnDigest() = %v", err)
+	}
+	if got := toDigest(); !slices.Equal(got, []string{"second"}) {
+		t.Errorf("IncidentsToDigest() after returning = %v, want second", got)
+	}
+}
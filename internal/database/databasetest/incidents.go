@@ -0,0 +1,610 @@
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"api.safer.place/viewer/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"safer.place/internal/database"
+)
+
+// concurrency is the number of goroutines racing each other in the concurrency tests.
+const concurrency = 16
+
+// testIncident is saved with saveIncidents, and reviewed from the unspecified resolution if it has
+// any other resolution.
+type testIncident struct {
+	id         string
+	lat, lon   float64
+	age        time.Duration
+	resolution incident.Resolution
+}
+
+func saveIncidents(t *testing.T, db database.Database, incidents ...testIncident) {
+	t.Helper()
+	ctx := context.Background()
+
+	for _, inc := range incidents {
+		if err := db.SaveIncident(ctx, &incident.Incident{
+			Id:          inc.id,
+			Timestamp:   timestamppb.New(time.Now().Add(-inc.age)),
+			Coordinates: &incident.Coordinates{Lat: inc.lat, Lon: inc.lon},
+		}); err != nil {
+			t.Fatalf("SaveIncident(%s) = %v", inc.id, err)
+		}
+		if inc.resolution == incident.Resolution_RESOLUTION_UNSPECIFIED {
+			continue
+		}
+		if err := db.SaveReview(ctx, inc.id,
+			incident.Resolution_RESOLUTION_UNSPECIFIED,
+			inc.resolution,
+			&incident.Comment{AuthorId: "reviewer", Timestamp: time.Now().Unix()},
+		); err != nil {
+			t.Fatalf("SaveReview(%s) = %v", inc.id, err)
+		}
+	}
+}
+
+// incidentIDs returns the sorted IDs of the incidents, joined with commas.
+func incidentIDs(incidents []*incident.Incident) string {
+	ids := make([]string, 0, len(incidents))
+	for _, inc := range incidents {
+		ids = append(ids, inc.Id)
+	}
+	slices.Sort(ids)
+	return strings.Join(ids, ",")
+}
+
+func testIncidents(t *testing.T, db database.Database) {
+	ctx := context.Background()
+
+	want := &incident.Incident{
+		Id:          "incident",
+		Timestamp:   timestamppb.New(time.Now().Truncate(time.Second)),
+		Coordinates: &incident.Coordinates{Lat: 46.05, Lon: 14.5},
+		Description: "description",
+		ImageId:     "image",
+	}
+	if err := db.SaveIncident(ctx, want); err != nil {
+		t.Fatalf("SaveIncident() = %v", err)
+	}
+	if err := db.SaveIncident(ctx, &incident.Incident{
+		Id:          "incident",
+		Timestamp:   timestamppb.Now(),
+		Coordinates: &incident.Coordinates{},
+		Description: "duplicate",
+	}); !errors.Is(err, database.ErrAlreadyExists) {
+		t.Errorf("SaveIncident(duplicate) = %v, want %v", err, database.ErrAlreadyExists)
+	}
+
+	got, err := db.ViewIncident(ctx, "incident")
+	if err != nil {
+		t.Fatalf("ViewIncident() = %v", err)
+	}
+	if got.Id != want.Id ||
+		got.Timestamp.GetSeconds() != want.Timestamp.GetSeconds() ||
+		got.Coordinates.GetLat() != want.Coordinates.Lat ||
+		got.Coordinates.GetLon() != want.Coordinates.Lon ||
+		got.Description != want.Description ||
+		got.ImageId != want.ImageId ||
+		got.Resolution != incident.Resolution_RESOLUTION_UNSPECIFIED {
+		t.Errorf("ViewIncident() = %v, want %v", got, want)
+	}
+
+	if _, err := db.ViewIncident(ctx, "unknown"); !errors.Is(err, database.ErrDoesNotExist) {
+		t.Errorf("ViewIncident(unknown) = %v, want %v", err, database.ErrDoesNotExist)
+	}
+	history, err := db.IncidentHistory(ctx, "unknown")
+	if err != nil || len(history) != 0 {
+		t.Errorf("IncidentHistory(unknown) = %v, %v, want no transitions", history, err)
+	}
+}
+
+func testReviews(t *testing.T, db database.Database) {
+	ctx := context.Background()
+
+	if err := db.SaveIncident(ctx, &incident.Incident{
+		Id:          "incident",
+		Timestamp:   timestamppb.Now(),
+		Coordinates: &incident.Coordinates{Lat: 46.05, Lon: 14.5},
+		Description: "description",
+	}); err != nil {
+		t.Fatalf("SaveIncident() = %v", err)
+	}
+
+	pending, err := db.IncidentsWithoutReview(ctx)
+	if err != nil {
+		t.Fatalf("IncidentsWithoutReview() = %v", err)
+	}
+	if len(pending) != 1 || pending[0].Id != "incident" {
+		t.Errorf("IncidentsWithoutReview() = %v, want the incident", pending)
+	}
+
+	unspecified := incident.Resolution_RESOLUTION_UNSPECIFIED
+	accepted := incident.Resolution_RESOLUTION_ACCEPTED
+	alerted := incident.Resolution_RESOLUTION_ALERTED
+
+	comments := []*incident.Comment{
+		{AuthorId: "reviewer", Timestamp: time.Now().Unix(), Message: "looks fine", Resolution: accepted},
+		{AuthorId: "moderator", Timestamp: time.Now().Unix() + 1, Message: "escalating", Resolution: alerted},
+	}
+	if err := db.SaveReview(ctx, "incident", unspecified, accepted, comments[0]); err != nil {
+		t.Fatalf("SaveReview() = %v", err)
+	}
+	// The incident is no longer unspecified, so a second review from the same state conflicts.
+	if err := db.SaveReview(ctx, "incident", unspecified, alerted, comments[1]); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("SaveReview() = %v, want %v", err, database.ErrConflict)
+	}
+	if err := db.SaveReview(ctx, "incident", accepted, alerted, comments[1]); err != nil {
+		t.Fatalf("SaveReview() = %v", err)
+	}
+	if err := db.SaveReview(ctx, "unknown", unspecified, accepted, comments[0]); !errors.Is(err, database.ErrDoesNotExist) {
+		t.Errorf("SaveReview(unknown) = %v, want %v", err, database.ErrDoesNotExist)
+	}
+
+	inc, err := db.ViewIncident(ctx, "incident")
+	if err != nil {
+		t.Fatalf("ViewIncident() = %v", err)
+	}
+	if inc.Resolution != alerted {
+		t.Errorf("ViewIncident().Resolution = %v, want %v", inc.Resolution, alerted)
+	}
+	if len(inc.ReviewerComments) != len(comments) {
+		t.Fatalf("ViewIncident() has %d comments, want %d", len(inc.ReviewerComments), len(comments))
+	}
+	for i, got := range inc.ReviewerComments {
+		if got.AuthorId != comments[i].AuthorId || got.Message != comments[i].Message {
+			t.Errorf("ViewIncident().ReviewerComments[%d] = %v, want %v", i, got, comments[i])
+		}
+	}
+
+	pending, err = db.IncidentsWithoutReview(ctx)
+	if err != nil {
+		t.Fatalf("IncidentsWithoutReview() = %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("IncidentsWithoutReview() = %v, want none", pending)
+	}
+
+	if err := db.SaveTransition(ctx, &database.Transition{
+		IncidentID: "incident",
+		Actor:      "reviewer",
+		From:       alerted,
+		To:         alerted,
+		Reason:     "redacted",
+		Timestamp:  time.Unix(comments[1].Timestamp+1, 0),
+	}); err != nil {
+		t.Fatalf("SaveTransition() = %v", err)
+	}
+
+	history, err := db.IncidentHistory(ctx, "incident")
+	if err != nil {
+		t.Fatalf("IncidentHistory() = %v", err)
+	}
+	want := []database.Transition{
+		{IncidentID: "incident", Actor: "reviewer", From: unspecified, To: accepted, Reason: "looks fine"},
+		{IncidentID: "incident", Actor: "moderator", From: accepted, To: alerted, Reason: "escalating"},
+		{IncidentID: "incident", Actor: "reviewer", From: alerted, To: alerted, Reason: "redacted"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("IncidentHistory() returned %d transitions, want %d", len(history), len(want))
+	}
+	for i, got := range history {
+		got.Timestamp = time.Time{}
+		if *got != want[i] {
+			t.Errorf("IncidentHistory()[%d] = %+v, want %+v", i, *got, want[i])
+		}
+	}
+}
+
+func testImages(t *testing.T, db database.Database) {
+	ctx := context.Background()
+
+	for _, inc := range []*incident.Incident{
+		{Id: "with-image", ImageId: "image"},
+		{Id: "same-image", ImageId: "image"},
+		{Id: "without-image"},
+	} {
+		inc.Timestamp = timestamppb.Now()
+		inc.Coordinates = &incident.Coordinates{}
+		if err := db.SaveIncident(ctx, inc); err != nil {
+			t.Fatalf("SaveIncident(%s) = %v", inc.Id, err)
+		}
+	}
+	if err := db.SaveReview(ctx, "with-image",
+		incident.Resolution_RESOLUTION_UNSPECIFIED,
+		incident.Resolution_RESOLUTION_ACCEPTED,
+		&incident.Comment{AuthorId: "reviewer", Timestamp: time.Now().Unix()},
+	); err != nil {
+		t.Fatalf("SaveReview() = %v", err)
+	}
+
+	// The same image can be reported with each incident.
+	incs, err := db.ImageIncidents(ctx, "image")
+	if err != nil {
+		t.Fatalf("ImageIncidents() = %v", err)
+	}
+	got := make(map[string]incident.Resolution)
+	for _, inc := range incs {
+		got[inc.Id] = inc.Resolution
+	}
+	want := map[string]incident.Resolution{
+		"with-image": incident.Resolution_RESOLUTION_ACCEPTED,
+		"same-image": incident.Resolution_RESOLUTION_UNSPECIFIED,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("ImageIncidents() = %v, want %v", got, want)
+	}
+
+	for _, imageID := range []string{"unknown", ""} {
+		if incs, err := db.ImageIncidents(ctx, imageID); err != nil || len(incs) != 0 {
+			t.Errorf("ImageIncidents(%q) = %v, %v, want none", imageID, incs, err)
+		}
+	}
+}
+
+// testRegion covers the regions in each hemisphere and crossing the equator and the prime
+// meridian. The regions are scaled by 100, and the incidents exactly on the border of the region
+// can be either included or not, so none of them are.
+func testRegion(t *testing.T, db database.Database) {
+	ctx := context.Background()
+	accepted := incident.Resolution_RESOLUTION_ACCEPTED
+
+	saveIncidents(t, db,
+		testIncident{id: "dublin", lat: 53.35, lon: -6.26, resolution: accepted},
+		testIncident{id: "ljubljana", lat: 46.05, lon: 14.51, resolution: accepted},
+		testIncident{id: "buenos-aires", lat: -34.60, lon: -58.38, resolution: accepted},
+		testIncident{id: "sydney", lat: -33.87, lon: 151.21, resolution: accepted},
+		testIncident{id: "null-island", lat: 0.01, lon: -0.01, resolution: accepted},
+		// Just outside the region around Dublin on each side.
+		testIncident{id: "north", lat: 53.41, lon: -6.26, resolution: accepted},
+		testIncident{id: "south", lat: 53.29, lon: -6.26, resolution: accepted},
+		testIncident{id: "west", lat: 53.35, lon: -6.31, resolution: accepted},
+		testIncident{id: "east", lat: 53.35, lon: -6.19, resolution: accepted},
+	)
+
+	tests := map[string]struct {
+		region *viewer.Region
+		want   string
+	}{
+		"north west": {
+			region: &viewer.Region{North: 5340, South: 5330, West: -630, East: -620},
+			want:   "dublin",
+		},
+		"north east": {
+			region: &viewer.Region{North: 4700, South: 4600, West: 1400, East: 1500},
+			want:   "ljubljana",
+		},
+		"south west": {
+			region: &viewer.Region{North: -3400, South: -3500, West: -5900, East: -5800},
+			want:   "buenos-aires",
+		},
+		"south east": {
+			region: &viewer.Region{North: -3300, South: -3400, West: 15100, East: 15200},
+			want:   "sydney",
+		},
+		"equator and prime meridian": {
+			region: &viewer.Region{North: 100, South: -100, West: -100, East: 100},
+			want:   "null-island",
+		},
+		"around dublin": {
+			region: &viewer.Region{North: 5345, South: 5325, West: -635, East: -615},
+			want:   "dublin,east,north,south,west",
+		},
+		"everything": {
+			region: &viewer.Region{North: 9000, South: -9000, West: -18000, East: 18000},
+			want:   "buenos-aires,dublin,east,ljubljana,north,null-island,south,sydney,west",
+		},
+		"nothing there": {
+			region: &viewer.Region{North: 1000, South: 900, West: 1000, East: 1100},
+			want:   "",
+		},
+		"empty": {
+			region: &viewer.Region{North: 5335, South: 5335, West: -626, East: -626},
+			want:   "",
+		},
+		"inverted": {
+			region: &viewer.Region{North: 5330, South: 5340, West: -620, East: -630},
+			want:   "",
+		},
+	}
+
+	since := time.Now().Add(-time.Hour)
+	for name, tt := range tests {
+		got, err := db.IncidentsInRegion(ctx, since, tt.region)
+		if err != nil {
+			t.Errorf("%s: IncidentsInRegion() = %v", name, err)
+			continue
+		}
+		if ids := incidentIDs(got); ids != tt.want {
+			t.Errorf("%s: IncidentsInRegion() = %s, want %s", name, ids, tt.want)
+		}
+	}
+}
+
+func testSince(t *testing.T, db database.Database) {
+	ctx := context.Background()
+	alerted := incident.Resolution_RESOLUTION_ALERTED
+
+	saveIncidents(t, db,
+		testIncident{id: "now", lat: 53.35, lon: -6.26, resolution: alerted},
+		testIncident{id: "hour", lat: 53.35, lon: -6.26, age: time.Hour, resolution: alerted},
+		testIncident{id: "day", lat: 53.35, lon: -6.26, age: 24 * time.Hour, resolution: alerted},
+	)
+
+	region := &viewer.Region{North: 5340, South: 5330, West: -630, East: -620}
+	tests := []struct {
+		since time.Duration
+		want  string
+	}{
+		{since: time.Minute, want: "now"},
+		{since: 2 * time.Hour, want: "hour,now"},
+		{since: 48 * time.Hour, want: "day,hour,now"},
+		{since: -time.Hour, want: ""},
+	}
+	for _, tt := range tests {
+		since := time.Now().Add(-tt.since)
+
+		got, err := db.IncidentsInRegion(ctx, since, region)
+		if err != nil {
+			t.Fatalf("IncidentsInRegion(%v ago) = %v", tt.since, err)
+		}
+		if ids := incidentIDs(got); ids != tt.want {
+			t.Errorf("IncidentsInRegion(%v ago) = %s, want %s", tt.since, ids, tt.want)
+		}
+
+		got, err = db.AlertingIncidents(ctx, since, region)
+		if err != nil {
+			t.Fatalf("AlertingIncidents(%v ago) = %v", tt.since, err)
+		}
+		if ids := incidentIDs(got); ids != tt.want {
+			t.Errorf("AlertingIncidents(%v ago) = %s, want %s", tt.since, ids, tt.want)
+		}
+	}
+}
+
+func testResolutions(t *testing.T, db database.Database) {
+	ctx := context.Background()
+
+	saveIncidents(t, db,
+		testIncident{id: "unspecified", lat: 53.35, lon: -6.26},
+		testIncident{id: "rejected", lat: 53.35, lon: -6.26, resolution: incident.Resolution_RESOLUTION_REJECTED},
+		testIncident{id: "accepted", lat: 53.35, lon: -6.26, resolution: incident.Resolution_RESOLUTION_ACCEPTED},
+		testIncident{id: "alerted", lat: 53.35, lon: -6.26, resolution: incident.Resolution_RESOLUTION_ALERTED},
+	)
+
+	region := &viewer.Region{North: 5340, South: 5330, West: -630, East: -620}
+	since := time.Now().Add(-time.Hour)
+
+	got, err := db.IncidentsInRegion(ctx, since, region)
+	if err != nil {
+		t.Fatalf("IncidentsInRegion() = %v", err)
+	}
+	if ids := incidentIDs(got); ids != "accepted,alerted" {
+		t.Errorf("IncidentsInRegion() = %s, want accepted,alerted", ids)
+	}
+
+	got, err = db.AlertingIncidents(ctx, since, region)
+	if err != nil {
+		t.Fatalf("AlertingIncidents() = %v", err)
+	}
+	if ids := incidentIDs(got); ids != "alerted" {
+		t.Errorf("AlertingIncidents() = %s, want alerted", ids)
+	}
+
+	got, err = db.IncidentsWithoutReview(ctx)
+	if err != nil {
+		t.Fatalf("IncidentsWithoutReview() = %v", err)
+	}
+	if ids := incidentIDs(got); ids != "unspecified" {
+		t.Errorf("IncidentsWithoutReview() = %s, want unspecified", ids)
+	}
+}
+
+func testReviewedIncidents(t *testing.T, db database.Database) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	accepted := incident.Resolution_RESOLUTION_ACCEPTED
+
+	saveIncidents(t, db,
+		testIncident{id: "pending", lat: 53.35, lon: -6.26},
+		testIncident{id: "rejected", lat: 53.35, lon: -6.26, resolution: incident.Resolution_RESOLUTION_REJECTED},
+		testIncident{id: "outside", lat: 46.05, lon: 14.5, resolution: accepted},
+		testIncident{id: "accepted", lat: 53.35, lon: -6.26, resolution: accepted},
+		testIncident{id: "escalated", lat: 53.35, lon: -6.26, resolution: accepted},
+		testIncident{id: "withdrawn", lat: 53.35, lon: -6.26, resolution: accepted},
+	)
+	reviews := []struct {
+		id       string
+		to       incident.Resolution
+		reviewed time.Time
+	}{
+		{id: "escalated", to: incident.Resolution_RESOLUTION_ALERTED, reviewed: now.Add(time.Minute)},
+		{id: "withdrawn", to: incident.Resolution_RESOLUTION_REJECTED, reviewed: now.Add(30 * time.Second)},
+	}
+	for _, r := range reviews {
+		if err := db.SaveReview(ctx, r.id, accepted, r.to,
+			&incident.Comment{AuthorId: "moderator", Timestamp: r.reviewed.Unix()},
+		); err != nil {
+			t.Fatalf("SaveReview(%s) = %v", r.id, err)
+		}
+	}
+	// The changes which keep the resolution aren't reviews.
+	if err := db.SaveTransition(ctx, &database.Transition{
+		IncidentID: "accepted",
+		Actor:      "reviewer",
+		From:       accepted,
+		To:         accepted,
+		Reason:     "redacted",
+		Timestamp:  now.Add(2 * time.Minute),
+	}); err != nil {
+		t.Fatalf("SaveTransition() = %v", err)
+	}
+
+	region := &viewer.Region{North: 5340, South: 5330, West: -630, East: -620}
+	tests := []struct {
+		since time.Time
+		want  []string
+	}{
+		{since: now.Add(-time.Hour), want: []string{"accepted", "escalated"}},
+		{since: now.Add(30 * time.Second), want: []string{"escalated"}},
+		{since: now.Add(time.Minute), want: []string{"escalated"}},
+		{since: now.Add(2 * time.Minute), want: []string{}},
+	}
+	for _, tt := range tests {
+		got, err := db.ReviewedIncidents(ctx, tt.since, region)
+		if err != nil {
+			t.Fatalf("ReviewedIncidents(%v) = %v", tt.since, err)
+		}
+
+		ids := make([]string, 0, len(got))
+		for _, r := range got {
+			ids = append(ids, r.Incident.Id)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("ReviewedIncidents(%v) = %v, want %v", tt.since, ids, tt.want)
+		}
+	}
+
+	got, err := db.ReviewedIncidents(ctx, now.Add(30*time.Second), region)
+	if err != nil {
+		t.Fatalf("ReviewedIncidents() = %v", err)
+	}
+	if len(got) != 1 || !got[0].Reviewed.Equal(now.Add(time.Minute)) ||
+		got[0].Incident.Resolution != incident.Resolution_RESOLUTION_ALERTED {
+		t.Errorf("ReviewedIncidents() = %+v, want the incident escalated a minute later", got)
+	}
+}
+
+// testConcurrentIncidents saves the incidents with different IDs and the same ID at the same
+// time. Only one of the incidents with the same ID is saved.
+func testConcurrentIncidents(t *testing.T, db database.Database) {
+	ctx := context.Background()
+
+	var (
+		wg       sync.WaitGroup
+		distinct = make([]error, concurrency)
+		same     = make([]error, concurrency)
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			distinct[i] = db.SaveIncident(ctx, &incident.Incident{
+				Id:          fmt.Sprintf("incident-%d", i),
+				Timestamp:   timestamppb.Now(),
+				Coordinates: &incident.Coordinates{},
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			same[i] = db.SaveIncident(ctx, &incident.Incident{
+				Id:          "same",
+				Timestamp:   timestamppb.Now(),
+				Coordinates: &incident.Coordinates{},
+				Description: fmt.Sprint(i),
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range distinct {
+		if err != nil {
+			t.Errorf("SaveIncident(incident-%d) = %v", i, err)
+		}
+	}
+
+	saved := 0
+	for _, err := range same {
+		switch {
+		case err == nil:
+			saved++
+		case !errors.Is(err, database.ErrAlreadyExists):
+			t.Errorf("SaveIncident(same) = %v, want nil or %v", err, database.ErrAlreadyExists)
+		}
+	}
+	if saved != 1 {
+		t.Errorf("SaveIncident(same) succeeded %d times, want once", saved)
+	}
+
+	pending, err := db.IncidentsWithoutReview(ctx)
+	if err != nil {
+		t.Fatalf("IncidentsWithoutReview() = %v", err)
+	}
+	if len(pending) != concurrency+1 {
+		t.Errorf("IncidentsWithoutReview() returned %d incidents, want %d", len(pending), concurrency+1)
+	}
+}
+
+// testConcurrentReviews reviews the same incident at the same time. Only one of the reviews wins,
+// the others conflict with it.
+func testConcurrentReviews(t *testing.T, db database.Database) {
+	ctx := context.Background()
+	saveIncidents(t, db, testIncident{id: "incident", lat: 53.35, lon: -6.26})
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, concurrency)
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			to := incident.Resolution_RESOLUTION_ACCEPTED
+			if i%2 == 0 {
+				to = incident.Resolution_RESOLUTION_REJECTED
+			}
+			errs[i] = db.SaveReview(ctx, "incident", incident.Resolution_RESOLUTION_UNSPECIFIED, to,
+				&incident.Comment{
+					AuthorId:  fmt.Sprintf("reviewer-%d", i),
+					Timestamp: time.Now().Unix(),
+					Message:   fmt.Sprint(i),
+				},
+			)
+		}()
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			if winner >= 0 {
+				t.Errorf("SaveReview() by reviewer-%d and reviewer-%d both succeeded", winner, i)
+			}
+			winner = i
+		case !errors.Is(err, database.ErrConflict):
+			t.Errorf("SaveReview() = %v, want nil or %v", err, database.ErrConflict)
+		}
+	}
+	if winner < 0 {
+		t.Fatal("SaveReview() didn't succeed for any reviewer")
+	}
+
+	inc, err := db.ViewIncident(ctx, "incident")
+	if err != nil {
+		t.Fatalf("ViewIncident() = %v", err)
+	}
+	if len(inc.ReviewerComments) != 1 || inc.ReviewerComments[0].Message != fmt.Sprint(winner) {
+		t.Errorf("ViewIncident().ReviewerComments = %v, want only the comment of reviewer-%d",
+			inc.ReviewerComments, winner)
+	}
+
+	history, err := db.IncidentHistory(ctx, "incident")
+	if err != nil {
+		t.Fatalf("IncidentHistory() = %v", err)
+	}
+	if len(history) != 1 || history[0].Actor != fmt.Sprintf("reviewer-%d", winner) {
+		t.Errorf("IncidentHistory() = %v, want only the transition by reviewer-%d", history, winner)
+	}
+}
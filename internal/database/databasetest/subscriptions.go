@@ -0,0 +1,140 @@
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"safer.place/internal/database"
+)
+
+func testSubscriptions(t *testing.T, db database.Database) {
+	ctx := context.Background()
+	now := time.Unix(time.Now().Unix(), 0)
+	dublin := database.Cell{Lat: 5334, Lon: -627}
+
+	subs := []*database.Subscription{
+		{
+			ID:       "home",
+			Owner:    "alice",
+			Cells:    []database.Cell{dublin, {Lat: 5334, Lon: -626}},
+			Channel:  "webhook",
+			Endpoint: "https://alice.example.com/alerts",
+			Secret:   "secret",
+			Created:  now.Add(-time.Hour),
+		},
+		{
+			ID:      "work",
+			Owner:   "alice",
+			Cells:   []database.Cell{{Lat: 5190, Lon: -848}},
+			Channel: "webhook",
+			Created: now,
+		},
+		{
+			ID:      "bob",
+			Owner:   "bob",
+			Cells:   []database.Cell{dublin},
+			Channel: "webhook",
+			Created: now,
+		},
+	}
+	for _, sub := range subs {
+		if err := db.SaveSubscription(ctx, sub); err != nil {
+			t.Fatalf("SaveSubscription(%s) = %v", sub.ID, err)
+		}
+	}
+	if err := db.SaveSubscription(ctx, &database.Subscription{ID: "home", Owner: "bob"}); !errors.Is(err, database.ErrAlreadyExists) {
+		t.Errorf("SaveSubscription() = %v, want %v", err, database.ErrAlreadyExists)
+	}
+
+	got, err := db.UserSubscriptions(ctx, "alice")
+	if err != nil {
+		t.Fatalf("UserSubscriptions() = %v", err)
+	}
+	if len(got) != 2 || got[0].ID != "home" || got[1].ID != "work" {
+		t.Fatalf("UserSubscriptions() = %+v, want home and work", got)
+	}
+	home := got[0]
+	slices.SortFunc(home.Cells, func(a, b database.Cell) int { return a.Lon - b.Lon })
+	if !slices.Equal(home.Cells, subs[0].Cells) || home.Endpoint != subs[0].Endpoint ||
+		home.Secret != subs[0].Secret || !home.Created.Equal(subs[0].Created) {
+		t.Errorf("UserSubscriptions() = %+v, want %+v", home, subs[0])
+	}
+
+	cellSubs, err := db.CellSubscriptions(ctx, dublin)
+	if err != nil {
+		t.Fatalf("CellSubscriptions() = %v", err)
+	}
+	var ids []string
+	for _, sub := range cellSubs {
+		ids = append(ids, sub.ID)
+	}
+	slices.Sort(ids)
+	if want := []string{"bob", "home"}; !slices.Equal(ids, want) {
+		t.Errorf("CellSubscriptions() = %v, want %v", ids, want)
+	}
+
+	// The alerts are limited within each window.
+	takes := []struct {
+		after time.Duration
+		want  bool
+	}{
+		{want: true},
+		{after: time.Minute, want: true},
+		{after: time.Minute, want: false},
+		{after: time.Hour, want: true},
+		{want: true},
+		{want: false},
+	}
+	for i, tt := range takes {
+		now = now.Add(tt.after)
+		taken, err := db.TakeAlert(ctx, "home", now, 2, time.Hour)
+		if err != nil || taken != tt.want {
+			t.Errorf("take %d: TakeAlert() = %v, %v, want %v", i, taken, err, tt.want)
+		}
+	}
+	// The alerts taken in the window which ended aren't given back.
+	if err := db.ReturnAlert(ctx, "home", now.Add(-time.Hour)); err != nil {
+		t.Errorf("ReturnAlert() = %v", err)
+	}
+	if taken, err := db.TakeAlert(ctx, "home", now, 2, time.Hour); err != nil || taken {
+		t.Errorf("TakeAlert() after returning an ended window = %v, %v, want false", taken, err)
+	}
+	if err := db.ReturnAlert(ctx, "home", now); err != nil {
+		t.Errorf("ReturnAlert() = %v", err)
+	}
+	if taken, err := db.TakeAlert(ctx, "home", now, 2, time.Hour); err != nil || !taken {
+		t.Errorf("TakeAlert() after returning = %v, %v, want true", taken, err)
+	}
+	// The limit is per subscription.
+	if taken, err := db.TakeAlert(ctx, "bob", now, 2, time.Hour); err != nil || !taken {
+		t.Errorf("TakeAlert() = %v, %v, want true", taken, err)
+	}
+	if _, err := db.TakeAlert(ctx, "unknown", now, 2, time.Hour); !errors.Is(err, database.ErrDoesNotExist) {
+		t.Errorf("TakeAlert() = %v, want %v", err, database.ErrDoesNotExist)
+	}
+
+	// Only the owner can delete the subscription.
+	if err := db.DeleteSubscription(ctx, "home", "bob"); !errors.Is(err, database.ErrDoesNotExist) {
+		t.Errorf("DeleteSubscription() = %v, want %v", err, database.ErrDoesNotExist)
+	}
+	if err := db.DeleteSubscription(ctx, "home", "alice"); err != nil {
+		t.Fatalf("DeleteSubscription() = %v", err)
+	}
+	if err := db.DeleteSubscription(ctx, "home", "alice"); !errors.Is(err, database.ErrDoesNotExist) {
+		t.Errorf("DeleteSubscription() = %v, want %v", err, database.ErrDoesNotExist)
+	}
+
+	cellSubs, err = db.CellSubscriptions(ctx, dublin)
+	if err != nil {
+		t.Fatalf("CellSubscriptions() = %v", err)
+	}
+	if len(cellSubs) != 1 || cellSubs[0].ID != "bob" {
+		t.Errorf("CellSubscriptions() = %+v, want bob", cellSubs)
+	}
+	if got, err := db.UserSubscriptions(ctx, "alice"); err != nil || len(got) != 1 {
+		t.Errorf("UserSubscriptions() = %+v, %v, want work", got, err)
+	}
+}
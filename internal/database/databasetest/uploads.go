@@ -0,0 +1,112 @@
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"safer.place/internal/database"
+)
+
+func testUploads(t *testing.T, db database.Database) {
+	ctx := context.Background()
+	now := time.Now()
+
+	uploads := []struct {
+		image, owner string
+		age          time.Duration
+	}{
+		{image: "reported", owner: "alice", age: 2 * time.Hour},
+		{image: "orphan", owner: "alice", age: 2 * time.Hour},
+		{image: "recent", owner: "alice", age: time.Minute},
+		// The image is an orphan only once every upload of it is old enough.
+		{image: "shared", owner: "alice", age: 2 * time.Hour},
+		{image: "shared", owner: "bob", age: time.Minute},
+		// Uploading the same image again updates when it was uploaded.
+		{image: "reuploaded", owner: "bob", age: 2 * time.Hour},
+		{image: "reuploaded", owner: "bob", age: time.Minute},
+	}
+	for _, u := range uploads {
+		if err := db.SaveUpload(ctx, u.image, u.owner, now.Add(-u.age)); err != nil {
+			t.Fatalf("SaveUpload(%s, %s) = %v", u.image, u.owner, err)
+		}
+	}
+
+	attach := []struct {
+		image, owner, incident string
+		want                   error
+	}{
+		{image: "reported", owner: "alice", incident: "incident", want: nil},
+		// Attaching the image to the same incident again is not an error.
+		{image: "reported", owner: "alice", incident: "incident", want: nil},
+		{image: "reported", owner: "alice", incident: "other", want: database.ErrConflict},
+		{image: "reported", owner: "bob", incident: "other", want: database.ErrDoesNotExist},
+		{image: "unknown", owner: "alice", incident: "other", want: database.ErrDoesNotExist},
+	}
+	for _, tt := range attach {
+		err := db.AttachUpload(ctx, tt.image, tt.owner, tt.incident)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("AttachUpload(%s, %s, %s) = %v, want %v", tt.image, tt.owner, tt.incident, err, tt.want)
+		}
+	}
+
+	// The image detached from the incident which failed to be reported can be reported again,
+	// but only by detaching it from the incident it is attached to.
+	if err := db.AttachUpload(ctx, "orphan", "alice", "failed"); err != nil {
+		t.Fatalf("AttachUpload() = %v", err)
+	}
+	if err := db.DetachUpload(ctx, "orphan", "alice", "other"); err != nil {
+		t.Fatalf("DetachUpload() = %v", err)
+	}
+	if err := db.AttachUpload(ctx, "orphan", "alice", "retried"); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("AttachUpload() = %v, want %v", err, database.ErrConflict)
+	}
+	if err := db.DetachUpload(ctx, "orphan", "alice", "failed"); err != nil {
+		t.Fatalf("DetachUpload() = %v", err)
+	}
+	if err := db.AttachUpload(ctx, "orphan", "alice", "retried"); err != nil {
+		t.Errorf("AttachUpload() = %v, want it attached to the retried incident", err)
+	}
+
+	if err := db.SaveIncident(ctx, &incident.Incident{
+		Id:          "incident",
+		Timestamp:   timestamppb.Now(),
+		Coordinates: &incident.Coordinates{},
+		ImageId:     "reported",
+	}); err != nil {
+		t.Fatalf("SaveIncident() = %v", err)
+	}
+
+	got, err := db.OrphanUploads(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("OrphanUploads() = %v", err)
+	}
+	if want := []string{"orphan"}; !slices.Equal(got, want) {
+		t.Errorf("OrphanUploads() = %v, want %v", got, want)
+	}
+
+	if err := db.DeleteUpload(ctx, "orphan"); err != nil {
+		t.Fatalf("DeleteUpload() = %v", err)
+	}
+	// Deleting the image again is not an error.
+	if err := db.DeleteUpload(ctx, "orphan"); err != nil {
+		t.Fatalf("DeleteUpload() = %v", err)
+	}
+	if err := db.AttachUpload(ctx, "orphan", "alice", "other"); !errors.Is(err, database.ErrDoesNotExist) {
+		t.Errorf("AttachUpload() = %v, want %v", err, database.ErrDoesNotExist)
+	}
+
+	got, err = db.OrphanUploads(ctx, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("OrphanUploads() = %v", err)
+	}
+	slices.Sort(got)
+	if want := []string{"recent", "reuploaded", "shared"}; !slices.Equal(got, want) {
+		t.Errorf("OrphanUploads() = %v, want %v", got, want)
+	}
+}
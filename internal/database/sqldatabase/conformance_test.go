@@ -0,0 +1,57 @@
+package sqldatabase
+
+import (
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/database"
+	"safer.place/internal/database/databasetest"
+)
+
+// The Postgres tests run against the databases at SAFERPLACE_TEST_POSTGRES_DSN and
+// SAFERPLACE_TEST_POSTGIS_DSN, each test in its own schema. The Database Tests job of the Go
+// workflow runs them against the postgres and postgis/postgis containers.
+func TestConformance(t *testing.T) {
+	testCases := map[string]struct {
+		driver  string
+		dsnEnv  string
+		memory  bool
+		postGIS bool
+	}{
+		"sqlite":        {driver: "sqlite3"},
+		"sqlite memory": {driver: "sqlite3", memory: true},
+		"postgres":      {driver: "postgres", dsnEnv: "SAFERPLACE_TEST_POSTGRES_DSN"},
+		"postgis":       {driver: "postgres", dsnEnv: "SAFERPLACE_TEST_POSTGIS_DSN", postGIS: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if tc.dsnEnv != "" && os.Getenv(tc.dsnEnv) == "" {
+				t.Skipf("%s is not set", tc.dsnEnv)
+			}
+
+			databasetest.Run(t, func(t *testing.T) database.Database {
+				dsn := newTestDSN(t)
+				switch {
+				case tc.memory:
+					dsn = ":memory:"
+				case tc.dsnEnv != "":
+					dsn = newPostgresSchema(t, os.Getenv(tc.dsnEnv))
+				}
+
+				db, err := New(&Config{
+					Driver:      tc.driver,
+					DSN:         dsn,
+					PostGIS:     tc.postGIS,
+					AutoMigrate: true,
+				}, Tracer(noop.NewTracerProvider().Tracer("")))
+				if err != nil {
+					t.Fatalf("New() = %v", err)
+				}
+				return db
+			})
+		})
+	}
+}
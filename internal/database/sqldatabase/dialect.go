@@ -0,0 +1,125 @@
+package sqldatabase
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"api.safer.place/incident/v1"
+)
+
+var (
+	errUnsupportedDriver       = errors.New("unsupported driver")
+	errPostGISRequiresPostgres = errors.New("postgis requires the postgres driver")
+)
+
+// dialect contains everything which differs between the supported databases.
+type dialect struct {
+	// migrations are the directories of the migrations, applied in the version order.
+	migrations []string
+	// rebind rewrites the queries, which are written with ? placeholders, for the database.
+	rebind func(string) string
+	// maxOpenConns limits the connections to the database, where 0 is unlimited.
+	maxOpenConns int
+
+	incidentsInRegionQuery string
+	alertingIncidentsQuery string
+}
+
+func newDialect(cfg *Config) (*dialect, error) {
+	if cfg.PostGIS && cfg.Driver != "postgres" {
+		return nil, errPostGISRequiresPostgres
+	}
+
+	switch cfg.Driver {
+	case "sqlite3":
+		return &dialect{
+			migrations: []string{"migrations/sqlite"},
+			rebind:     func(query string) string { return query },
+			// SQLite allows a single writer, and the transactions which read before writing
+			// fail with "database is locked" instead of waiting for each other. A single
+			// connection serializes them, and also keeps the in-memory databases alive.
+			maxOpenConns:           1,
+			incidentsInRegionQuery: incidentsInRegionQuery,
+			alertingIncidentsQuery: alertingIncidentsQuery,
+		}, nil
+	case "postgres":
+		if cfg.PostGIS {
+			return &dialect{
+				migrations:             []string{"migrations/postgres", "migrations/postgis"},
+				rebind:                 RebindDollar,
+				incidentsInRegionQuery: postgisIncidentsInRegionQuery,
+				alertingIncidentsQuery: postgisAlertingIncidentsQuery,
+			}, nil
+		}
+		return &dialect{
+			migrations:             []string{"migrations/postgres"},
+			rebind:                 RebindDollar,
+			incidentsInRegionQuery: incidentsInRegionQuery,
+			alertingIncidentsQuery: alertingIncidentsQuery,
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w %q", errUnsupportedDriver, cfg.Driver)
+	}
+}
+
+// RebindDollar replaces the ? placeholders with the numbered $n placeholders used by Postgres,
+// leaving the question marks in string literals alone. The SQL queue rebinds its queries with it
+// too.
+func RebindDollar(query string) string {
+	var (
+		b        strings.Builder
+		n        int
+		inString bool
+	)
+	b.Grow(len(query) + 8)
+
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// postgisIncidentsInRegionQuery uses the location index to find the incidents in the region,
+// with the same parameters as incidentsInRegionQuery. The envelope is built from the west, south,
+// east and north parameters.
+var postgisIncidentsInRegionQuery = fmt.Sprintf(`
+SELECT %s
+FROM incidents
+WHERE
+	(resolution='%s' OR resolution='%s')
+	AND
+		timestamp > $1
+	AND
+		ST_Intersects(location, ST_MakeEnvelope($4, $3, $5, $2, 4326)::geography)
+`,
+	incidentColumns,
+	incident.Resolution_RESOLUTION_ACCEPTED,
+	incident.Resolution_RESOLUTION_ALERTED,
+)
+
+// postgisAlertingIncidentsQuery is the alertingIncidentsQuery using the location index.
+var postgisAlertingIncidentsQuery = fmt.Sprintf(`
+SELECT %s
+FROM incidents
+WHERE
+	resolution='%s'
+	AND
+		timestamp > $1
+	AND
+		ST_Intersects(location, ST_MakeEnvelope($4, $3, $5, $2, 4326)::geography)
+`,
+	incidentColumns,
+	incident.Resolution_RESOLUTION_ALERTED,
+)
@@ -0,0 +1,92 @@
+package sqldatabase
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRebindDollar(t *testing.T) {
+	testCases := []struct {
+		query string
+		want  string
+	}{
+		{
+			query: "SELECT id FROM incidents WHERE id=?",
+			want:  "SELECT id FROM incidents WHERE id=$1",
+		},
+		{
+			query: "UPDATE incidents SET resolution=? WHERE id=? AND resolution=?",
+			want:  "UPDATE incidents SET resolution=$1 WHERE id=$2 AND resolution=$3",
+		},
+		{
+			query: "SELECT id FROM incidents WHERE description='why?' AND id=?",
+			want:  "SELECT id FROM incidents WHERE description='why?' AND id=$1",
+		},
+		{
+			query: "SELECT id FROM incidents",
+			want:  "SELECT id FROM incidents",
+		},
+	}
+
+	for _, tc := range testCases {
+		if got := RebindDollar(tc.query); got != tc.want {
+			t.Errorf("RebindDollar(%q) = %q, want %q", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestDialectMigrations(t *testing.T) {
+	testCases := map[string]struct {
+		cfg     Config
+		wantErr error
+	}{
+		"sqlite":         {cfg: Config{Driver: "sqlite3"}},
+		"postgres":       {cfg: Config{Driver: "postgres"}},
+		"postgis":        {cfg: Config{Driver: "postgres", PostGIS: true}},
+		"sqlite postgis": {cfg: Config{Driver: "sqlite3", PostGIS: true}, wantErr: errPostGISRequiresPostgres},
+		"unknown driver": {cfg: Config{Driver: "mysql"}, wantErr: errUnsupportedDriver},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			d, err := newDialect(&tc.cfg)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("newDialect() = %v, want %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			ms, err := migrations(d.migrations)
+			if err != nil {
+				t.Fatalf("migrations() = %v", err)
+			}
+			if len(ms) == 0 {
+				t.Errorf("no migrations found in %v", d.migrations)
+			}
+		})
+	}
+}
+
+// TestMigrationsInSync ensures every dialect has the same migrations, so the schema is the same
+// whichever database is used.
+func TestMigrationsInSync(t *testing.T) {
+	sqlite, err := migrations([]string{"migrations/sqlite"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	postgres, err := migrations([]string{"migrations/postgres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sqlite) != len(postgres) {
+		t.Fatalf("sqlite has %d migrations, postgres has %d", len(sqlite), len(postgres))
+	}
+	for i := range sqlite {
+		if sqlite[i].Version != postgres[i].Version || sqlite[i].Name != postgres[i].Name {
+			t.Errorf("sqlite migration %d_%s, postgres migration %d_%s",
+				sqlite[i].Version, sqlite[i].Name, postgres[i].Version, postgres[i].Name)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package sqldatabase
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrChecksumMismatch is returned when a migration was changed after it was applied.
+	ErrChecksumMismatch = errors.New("sqldatabase: migration checksum mismatch")
+	// ErrSchemaOutdated is returned when the database has pending migrations, but they are not
+	// applied automatically.
+	ErrSchemaOutdated = errors.New("sqldatabase: schema has pending migrations")
+	// ErrUnknownMigration is returned when the database was migrated by a newer version.
+	ErrUnknownMigration = errors.New("sqldatabase: unknown migration applied")
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is a versioned change of the database schema. The migrations are embedded from the
+// migrations directory of each dialect, named <version>_<name>.sql, and are applied in the
+// version order.
+type Migration struct {
+	Version  int
+	Name     string
+	Checksum string
+	// AppliedAt is set when the migration has been applied to the database.
+	AppliedAt time.Time
+
+	query string
+}
+
+var createSchemaMigrationsQuery = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	checksum   TEXT NOT NULL,
+	applied_at BIGINT NOT NULL
+);
+`
+
+var recordMigrationQuery = `
+INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?);
+`
+
+// Migrator applies the migrations of the database dialect.
+type Migrator struct {
+	db      *sql.DB
+	dialect *dialect
+}
+
+// NewMigrator for the database opened with the config.
+func NewMigrator(db *sql.DB, cfg *Config) (*Migrator, error) {
+	d, err := newDialect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, dialect: d}, nil
+}
+
+// migrations returns all the embedded migrations in the directories, ordered by version.
+func migrations(dirs []string) ([]*Migration, error) {
+	var files []string
+	for _, dir := range dirs {
+		matches, err := fs.Glob(migrationFiles, path.Join(dir, "*.sql"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	ms := make([]*Migration, 0, len(files))
+	for _, file := range files {
+		version, name, ok := strings.Cut(strings.TrimSuffix(path.Base(file), ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", file)
+		}
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has invalid version: %w", file, err)
+		}
+
+		query, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		checksum := sha256.Sum256(query)
+
+		ms = append(ms, &Migration{
+			Version:  v,
+			Name:     name,
+			Checksum: hex.EncodeToString(checksum[:]),
+			query:    string(query),
+		})
+	}
+
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	for i := 1; i < len(ms); i++ {
+		if ms[i].Version == ms[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", ms[i].Version)
+		}
+	}
+
+	return ms, nil
+}
+
+// Migrations returns all the known migrations, with the time they were applied to the database
+// if they have been. The applied migrations are verified against the known ones.
+func (m *Migrator) Migrations(ctx context.Context) ([]*Migration, error) {
+	if _, err := m.db.ExecContext(ctx, createSchemaMigrationsQuery); err != nil {
+		return nil, fmt.Errorf("unable to create schema_migrations: %w", err)
+	}
+
+	ms, err := migrations(m.dialect.migrations)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read migrations: %w", err)
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	byVersion := make(map[int]*Migration, len(ms))
+	for _, migration := range ms {
+		byVersion[migration.Version] = migration
+	}
+
+	for rows.Next() {
+		var (
+			version   int
+			checksum  string
+			appliedAt int64
+		)
+		if err := rows.Scan(&version, &checksum, &appliedAt); err != nil {
+			return nil, fmt.Errorf("unable to scan applied migration: %w", err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: version %d", ErrUnknownMigration, version)
+		}
+		if migration.Checksum != checksum {
+			return nil, fmt.Errorf("%w: version %d", ErrChecksumMismatch, version)
+		}
+		migration.AppliedAt = time.Unix(appliedAt, 0)
+	}
+
+	return ms, rows.Err()
+}
+
+// Migrate applies the pending migrations, each in its own transaction, and returns the migrations
+// which were applied.
+func (m *Migrator) Migrate(ctx context.Context) ([]*Migration, error) {
+	ms, err := m.Migrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]*Migration, 0)
+	for _, migration := range ms {
+		if !migration.AppliedAt.IsZero() {
+			continue
+		}
+		if err := m.apply(ctx, migration); err != nil {
+			return applied, fmt.Errorf("unable to apply migration %d_%s: %w",
+				migration.Version, migration.Name, err)
+		}
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, migration *Migration) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, migration.query); err != nil {
+		return err
+	}
+
+	appliedAt := time.Now()
+	if _, err := tx.ExecContext(ctx, m.dialect.rebind(recordMigrationQuery),
+		migration.Version, migration.Name, migration.Checksum, appliedAt.Unix(),
+	); err != nil {
+		return fmt.Errorf("unable to record migration: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	migration.AppliedAt = appliedAt
+	return nil
+}
+
+// checkMigrated returns ErrSchemaOutdated if there are pending migrations.
+func (m *Migrator) checkMigrated(ctx context.Context) error {
+	ms, err := m.Migrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range ms {
+		if migration.AppliedAt.IsZero() {
+			return fmt.Errorf("%w: %d_%s", ErrSchemaOutdated, migration.Version, migration.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package sqldatabase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func newTestDSN(t *testing.T) string {
+	t.Helper()
+	return "file:" + filepath.Join(t.TempDir(), "incidents.db")
+}
+
+func openTestDatabase(dsn string, autoMigrate bool) (*Database, error) {
+	return New(&Config{
+		Driver:      "sqlite3",
+		DSN:         dsn,
+		AutoMigrate: autoMigrate,
+	}, Tracer(noop.NewTracerProvider().Tracer("")))
+}
+
+func exec(t *testing.T, dsn string, query string) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(query); err != nil {
+		t.Fatalf("Exec() = %v", err)
+	}
+}
+
+func TestMigrateFromV0(t *testing.T) {
+	ctx := context.Background()
+	dsn := newTestDSN(t)
+
+	fixture, err := os.ReadFile("testdata/v0.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec(t, dsn, string(fixture))
+
+	db, err := openTestDatabase(dsn, true)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+
+	m, err := NewMigrator(db.db, &Config{Driver: "sqlite3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err := m.Migrations(ctx)
+	if err != nil {
+		t.Fatalf("Migrations() = %v", err)
+	}
+	for _, migration := range ms {
+		if migration.AppliedAt.IsZero() {
+			t.Errorf("migration %d_%s was not applied", migration.Version, migration.Name)
+		}
+	}
+
+	inc, err := db.ViewIncident(ctx, "reviewed")
+	if err != nil {
+		t.Fatalf("ViewIncident() = %v", err)
+	}
+	if inc.Resolution != incident.Resolution_RESOLUTION_ACCEPTED || len(inc.ReviewerComments) != 1 {
+		t.Errorf("ViewIncident() = %v, want the accepted incident with its comment", inc)
+	}
+
+	// The tables added by the migrations are usable.
+	if err := db.SaveReview(ctx, "pending",
+		incident.Resolution_RESOLUTION_UNSPECIFIED,
+		incident.Resolution_RESOLUTION_REJECTED,
+		&incident.Comment{AuthorId: "reviewer", Timestamp: time.Now().Unix(), Message: "spam"},
+	); err != nil {
+		t.Errorf("SaveReview() = %v", err)
+	}
+	if err := db.SaveSession(ctx, "session", "reviewer", time.Now().Add(time.Hour)); err != nil {
+		t.Errorf("SaveSession() = %v", err)
+	}
+	if err := db.GrantRole(ctx, "reviewer", "reviewer"); err != nil {
+		t.Errorf("GrantRole() = %v", err)
+	}
+
+	// Opening the database again doesn't apply anything.
+	applied, err := m.Migrate(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Migrate() = %v, %v, want nothing applied", applied, err)
+	}
+}
+
+func TestMigrateErrors(t *testing.T) {
+	testCases := map[string]struct {
+		tamper      string
+		autoMigrate bool
+		want        error
+	}{
+		"changed migration": {
+			tamper:      "UPDATE schema_migrations SET checksum='changed' WHERE version=1",
+			autoMigrate: true,
+			want:        ErrChecksumMismatch,
+		},
+		"newer migration": {
+			tamper:      "INSERT INTO schema_migrations VALUES (9999, 'future', 'checksum', 0)",
+			autoMigrate: true,
+			want:        ErrUnknownMigration,
+		},
+		"pending migration": {
+			tamper: "DELETE FROM schema_migrations WHERE version=(SELECT MAX(version) FROM schema_migrations)",
+			want:   ErrSchemaOutdated,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dsn := newTestDSN(t)
+			if _, err := openTestDatabase(dsn, true); err != nil {
+				t.Fatalf("New() = %v", err)
+			}
+
+			exec(t, dsn, tc.tamper)
+
+			if _, err := openTestDatabase(dsn, tc.autoMigrate); !errors.Is(err, tc.want) {
+				t.Errorf("New() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
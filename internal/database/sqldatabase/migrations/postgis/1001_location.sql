@@ -0,0 +1,9 @@
+-- The PostGIS migrations are numbered from 1000 so they never clash with the postgres ones which
+-- they are applied on top of.
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+-- The location is derived from the coordinates, so the incidents are saved the same way with or
+-- without PostGIS.
+ALTER TABLE incidents ADD COLUMN location geography(Point, 4326)
+	GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(lon, lat), 4326)::geography) STORED;
+CREATE INDEX incidents_location ON incidents USING GIST (location);
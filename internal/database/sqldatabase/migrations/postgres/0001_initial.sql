@@ -0,0 +1,21 @@
+CREATE TABLE incidents (
+	id          TEXT PRIMARY KEY,
+	timestamp   BIGINT NOT NULL,
+	description TEXT,
+	lat         DOUBLE PRECISION NOT NULL,
+	lon         DOUBLE PRECISION NOT NULL,
+	resolution  TEXT NOT NULL,
+	image       TEXT NOT NULL
+);
+CREATE INDEX lat ON incidents (lat);
+CREATE INDEX lon ON incidents (lon);
+
+CREATE TABLE comments (
+	id          TEXT PRIMARY KEY,
+	incident_id TEXT NOT NULL,
+	timestamp   BIGINT NOT NULL,
+	author      TEXT NOT NULL,
+	comment     TEXT NOT NULL,
+	resolution  TEXT NOT NULL
+);
+CREATE INDEX incident_ids ON comments (incident_id);
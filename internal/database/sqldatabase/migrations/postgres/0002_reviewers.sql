@@ -0,0 +1,11 @@
+CREATE TABLE sessions (
+	id          TEXT PRIMARY KEY,
+	reviewer_id TEXT NOT NULL,
+	expiry      BIGINT NOT NULL
+);
+
+CREATE TABLE reviewers (
+	id    TEXT PRIMARY KEY,
+	name  TEXT NOT NULL,
+	email TEXT NOT NULL
+);
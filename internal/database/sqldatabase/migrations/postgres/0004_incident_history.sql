@@ -0,0 +1,20 @@
+CREATE TABLE incident_history (
+	id             BIGSERIAL PRIMARY KEY,
+	incident_id    TEXT NOT NULL,
+	actor          TEXT NOT NULL,
+	old_resolution TEXT NOT NULL,
+	new_resolution TEXT NOT NULL,
+	reason         TEXT NOT NULL,
+	timestamp      BIGINT NOT NULL
+);
+CREATE INDEX history_incident_ids ON incident_history (incident_id);
+
+-- The history is an audit log, so it can only be appended to.
+CREATE FUNCTION incident_history_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'incident history is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER incident_history_append_only BEFORE UPDATE OR DELETE ON incident_history
+	FOR EACH ROW EXECUTE FUNCTION incident_history_append_only();
@@ -0,0 +1,2 @@
+-- The images are looked up to find the incident they were reported with.
+CREATE INDEX incidents_image ON incidents (image);
@@ -0,0 +1,8 @@
+-- The uploads record who uploaded each image, and the incident it was reported with.
+CREATE TABLE uploads (
+	image    TEXT NOT NULL,
+	owner    TEXT NOT NULL,
+	incident TEXT,
+	uploaded BIGINT NOT NULL,
+	PRIMARY KEY (image, owner)
+);
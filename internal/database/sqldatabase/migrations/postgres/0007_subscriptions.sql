@@ -0,0 +1,22 @@
+-- The subscriptions of the users to the alerts about the incidents in their cells.
+CREATE TABLE subscriptions (
+	id       TEXT PRIMARY KEY,
+	owner    TEXT NOT NULL,
+	channel  TEXT NOT NULL,
+	endpoint TEXT NOT NULL,
+	secret   TEXT NOT NULL,
+	created  BIGINT NOT NULL,
+	-- The alerts sent within the rate limiting window, which started at window_start.
+	window_start  BIGINT NOT NULL DEFAULT 0,
+	window_alerts INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX subscriptions_owner ON subscriptions (owner);
+
+-- The cells of each subscription, which are looked up by the cell of the alerting incident.
+CREATE TABLE subscription_cells (
+	subscription TEXT NOT NULL,
+	lat          INTEGER NOT NULL,
+	lon          INTEGER NOT NULL,
+	PRIMARY KEY (lat, lon, subscription)
+);
+CREATE INDEX subscription_cells_subscription ON subscription_cells (subscription);
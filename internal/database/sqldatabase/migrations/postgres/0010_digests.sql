@@ -0,0 +1,3 @@
+-- When the incident was sent in a digest, so it is sent once even by several processes or after a
+-- restart. The incidents waiting for review before are sent in the next digest.
+ALTER TABLE incidents ADD COLUMN digested_at BIGINT;
@@ -0,0 +1,12 @@
+-- The outcome of delivering each incident to each webhook, so the incidents notified about again
+-- are only delivered to the webhooks which didn't get them.
+CREATE TABLE webhook_deliveries (
+	id          TEXT PRIMARY KEY,
+	incident_id TEXT NOT NULL,
+	url         TEXT NOT NULL,
+	attempts    INTEGER NOT NULL,
+	status_code INTEGER NOT NULL,
+	error       TEXT NOT NULL,
+	delivered   BOOLEAN NOT NULL,
+	updated     BIGINT NOT NULL
+);
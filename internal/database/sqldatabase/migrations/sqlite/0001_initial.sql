@@ -0,0 +1,27 @@
+-- The schema before the migrations were introduced, so existing databases are adopted as is.
+CREATE TABLE IF NOT EXISTS incidents (
+	id TEXT PRIMARY KEY,
+	timestamp INTEGER NOT NULL,
+	description TEXT,
+	lat REAL NOT NULL,
+	lon REAL NOT NULL,
+	resolution TEXT NOT NULL,
+	image TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS lat ON incidents (lat);
+CREATE INDEX IF NOT EXISTS lon ON incidents (lon);
+
+CREATE TABLE IF NOT EXISTS comments (
+	id TEXT PRIMARY KEY,
+	incident_id TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	author TEXT NOT NULL,
+	comment TEXT NOT NULL,
+	resolution TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS incident_ids ON comments (incident_id);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id     TEXT PRIMARY KEY,
+	expiry INTEGER NOT NULL
+);
@@ -0,0 +1,14 @@
+-- Sessions created before they belonged to a reviewer can't be resolved to one. They are short
+-- lived so it's safe to recreate the table.
+DROP TABLE IF EXISTS sessions;
+CREATE TABLE sessions (
+	id          TEXT PRIMARY KEY,
+	reviewer_id TEXT NOT NULL,
+	expiry      INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS reviewers (
+	id    TEXT PRIMARY KEY,
+	name  TEXT NOT NULL,
+	email TEXT NOT NULL
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS user_roles (
+	subject TEXT NOT NULL,
+	role    TEXT NOT NULL,
+	PRIMARY KEY (subject, role)
+);
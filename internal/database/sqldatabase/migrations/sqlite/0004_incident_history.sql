@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS incident_history (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	incident_id    TEXT NOT NULL,
+	actor          TEXT NOT NULL,
+	old_resolution TEXT NOT NULL,
+	new_resolution TEXT NOT NULL,
+	reason         TEXT NOT NULL,
+	timestamp      INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS history_incident_ids ON incident_history (incident_id);
+
+-- The history is an audit log, so it can only be appended to.
+CREATE TRIGGER IF NOT EXISTS incident_history_no_update BEFORE UPDATE ON incident_history
+BEGIN
+	SELECT RAISE(ABORT, 'incident history is append-only');
+END;
+CREATE TRIGGER IF NOT EXISTS incident_history_no_delete BEFORE DELETE ON incident_history
+BEGIN
+	SELECT RAISE(ABORT, 'incident history is append-only');
+END;
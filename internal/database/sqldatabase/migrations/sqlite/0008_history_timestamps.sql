@@ -0,0 +1,2 @@
+-- The live feed is resumed from the incidents reviewed since a time.
+CREATE INDEX IF NOT EXISTS history_timestamps ON incident_history (timestamp);
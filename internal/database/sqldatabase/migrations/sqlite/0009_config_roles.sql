@@ -0,0 +1,3 @@
+-- The roles granted from the config are revoked once they are removed from it. The roles granted
+-- before are kept, as it's unknown where they came from.
+ALTER TABLE user_roles ADD COLUMN from_config INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,149 @@
+package sqldatabase
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"api.safer.place/viewer/v1"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestIncidentsInRegion(t *testing.T) {
+	testCases := map[string]struct {
+		driver  string
+		dsnEnv  string
+		postGIS bool
+	}{
+		"sqlite":   {driver: "sqlite3"},
+		"postgres": {driver: "postgres", dsnEnv: "SAFERPLACE_TEST_POSTGRES_DSN"},
+		"postgis":  {driver: "postgres", dsnEnv: "SAFERPLACE_TEST_POSTGIS_DSN", postGIS: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dsn := newTestDSN(t)
+			if tc.dsnEnv != "" {
+				dsn = os.Getenv(tc.dsnEnv)
+				if dsn == "" {
+					t.Skipf("%s is not set", tc.dsnEnv)
+				}
+				dsn = newPostgresSchema(t, dsn)
+			}
+
+			db, err := New(&Config{
+				Driver:      tc.driver,
+				DSN:         dsn,
+				PostGIS:     tc.postGIS,
+				AutoMigrate: true,
+			}, Tracer(noop.NewTracerProvider().Tracer("")))
+			if err != nil {
+				t.Fatalf("New() = %v", err)
+			}
+
+			testIncidentsInRegion(t, db)
+		})
+	}
+}
+
+func testIncidentsInRegion(t *testing.T, db *Database) {
+	t.Helper()
+	ctx := context.Background()
+
+	incidents := map[string]struct {
+		lat, lon   float64
+		resolution incident.Resolution
+	}{
+		"dublin":   {lat: 53.35, lon: -6.26, resolution: incident.Resolution_RESOLUTION_ACCEPTED},
+		"alerting": {lat: 53.34, lon: -6.27, resolution: incident.Resolution_RESOLUTION_ALERTED},
+		"pending":  {lat: 53.36, lon: -6.25, resolution: incident.Resolution_RESOLUTION_UNSPECIFIED},
+		"cork":     {lat: 51.90, lon: -8.47, resolution: incident.Resolution_RESOLUTION_ACCEPTED},
+	}
+	for id, inc := range incidents {
+		if err := db.SaveIncident(ctx, &incident.Incident{
+			Id:          id,
+			Timestamp:   timestamppb.Now(),
+			Coordinates: &incident.Coordinates{Lat: inc.lat, Lon: inc.lon},
+		}); err != nil {
+			t.Fatalf("SaveIncident(%s) = %v", id, err)
+		}
+		if inc.resolution == incident.Resolution_RESOLUTION_UNSPECIFIED {
+			continue
+		}
+		if err := db.SaveReview(ctx, id,
+			incident.Resolution_RESOLUTION_UNSPECIFIED,
+			inc.resolution,
+			&incident.Comment{AuthorId: "reviewer", Timestamp: time.Now().Unix()},
+		); err != nil {
+			t.Fatalf("SaveReview(%s) = %v", id, err)
+		}
+	}
+
+	// The region is scaled by 100.
+	dublin := &viewer.Region{North: 5340, South: 5330, West: -630, East: -620}
+	since := time.Now().Add(-time.Hour)
+
+	got, err := db.IncidentsInRegion(ctx, since, dublin)
+	if err != nil {
+		t.Fatalf("IncidentsInRegion() = %v", err)
+	}
+	if ids := incidentIDs(got); ids != "alerting,dublin" {
+		t.Errorf("IncidentsInRegion() = %s, want alerting,dublin", ids)
+	}
+
+	got, err = db.AlertingIncidents(ctx, since, dublin)
+	if err != nil {
+		t.Fatalf("AlertingIncidents() = %v", err)
+	}
+	if ids := incidentIDs(got); ids != "alerting" {
+		t.Errorf("AlertingIncidents() = %s, want alerting", ids)
+	}
+}
+
+func incidentIDs(incidents []*incident.Incident) string {
+	ids := make([]string, 0, len(incidents))
+	for _, inc := range incidents {
+		ids = append(ids, inc.Id)
+	}
+	slices.Sort(ids)
+	return strings.Join(ids, ",")
+}
+
+// newPostgresSchema creates a schema which is dropped once the test is done, and returns the DSN
+// using it so the tests don't interfere with each other.
+func newPostgresSchema(t *testing.T, dsn string) string {
+	t.Helper()
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("unable to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("unable to drop schema: %v", err)
+		}
+	})
+
+	// The public schema is kept in the search path for the PostGIS types.
+	if strings.Contains(dsn, "://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return dsn + sep + "search_path=" + schema + ",public"
+	}
+	return dsn + " search_path=" + schema + ",public"
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
 	"sort"
 	"time"
 
@@ -18,13 +19,21 @@ import (
 	"safer.place/internal/database"
 
 	// Acceptable database drivers
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // Config of the SQLDatabase
 type Config struct {
+	// Driver is either sqlite3 or postgres.
 	Driver string `yaml:"driver" default:"sqlite3"`
 	DSN    string `yaml:"dsn" default:"file:incidents.db"`
+	// PostGIS indexes the incident locations to find the incidents in a region, it requires the
+	// postgres driver and the PostGIS extension.
+	PostGIS bool `yaml:"postgis"`
+	// AutoMigrate applies the pending migrations when the database is opened. When disabled, the
+	// migrations have to be applied with `saferplace migrate` before the database can be used.
+	AutoMigrate bool `yaml:"auto_migrate" default:"true"`
 }
 
 // Database contains the database connection
@@ -32,102 +41,320 @@ type Database struct {
 	db     *sql.DB
 	tracer trace.Tracer
 
-	hasIncidentStmt            *sql.Stmt
-	saveIncidentStmt           *sql.Stmt
-	updateResolutionStmt       *sql.Stmt
-	saveCommentStmt            *sql.Stmt
-	viewIncidentStmt           *sql.Stmt
-	viewCommentsStmt           *sql.Stmt
-	incidentsWithoutReviewStmt *sql.Stmt
-	incidentsInRadiusStmt      *sql.Stmt
-	incidentsInRegionStmt      *sql.Stmt
-	saveSessionStmt            *sql.Stmt
-	isValidSessionStmt         *sql.Stmt
-	alertingIncidentsStmt      *sql.Stmt
+	hasIncidentStmt             *sql.Stmt
+	saveIncidentStmt            *sql.Stmt
+	updateResolutionStmt        *sql.Stmt
+	saveCommentStmt             *sql.Stmt
+	viewIncidentStmt            *sql.Stmt
+	viewCommentsStmt            *sql.Stmt
+	incidentsWithoutReviewStmt  *sql.Stmt
+	incidentsInRadiusStmt       *sql.Stmt
+	incidentsInRegionStmt       *sql.Stmt
+	saveSessionStmt             *sql.Stmt
+	isValidSessionStmt          *sql.Stmt
+	sessionReviewerStmt         *sql.Stmt
+	saveReviewerStmt            *sql.Stmt
+	userRolesStmt               *sql.Stmt
+	grantRoleStmt               *sql.Stmt
+	revokeRoleStmt              *sql.Stmt
+	roleGrantsStmt              *sql.Stmt
+	grantConfigRoleStmt         *sql.Stmt
+	revokeConfigRoleStmt        *sql.Stmt
+	configRolesStmt             *sql.Stmt
+	saveTransitionStmt          *sql.Stmt
+	incidentHistoryStmt         *sql.Stmt
+	alertingIncidentsStmt       *sql.Stmt
+	reviewedIncidentsStmt       *sql.Stmt
+	imageIncidentsStmt          *sql.Stmt
+	saveUploadStmt              *sql.Stmt
+	attachUploadStmt            *sql.Stmt
+	uploadIncidentStmt          *sql.Stmt
+	detachUploadStmt            *sql.Stmt
+	orphanUploadsStmt           *sql.Stmt
+	deleteUploadStmt            *sql.Stmt
+	saveSubscriptionStmt        *sql.Stmt
+	saveSubscriptionCellStmt    *sql.Stmt
+	userSubscriptionsStmt       *sql.Stmt
+	subscriptionCellsStmt       *sql.Stmt
+	cellSubscriptionsStmt       *sql.Stmt
+	deleteSubscriptionStmt      *sql.Stmt
+	deleteSubscriptionCellsStmt *sql.Stmt
+	takeAlertStmt               *sql.Stmt
+	returnAlertStmt             *sql.Stmt
+	hasSubscriptionStmt         *sql.Stmt
+	incidentsToDigestStmt       *sql.Stmt
+	takeDigestStmt              *sql.Stmt
+	returnDigestStmt            *sql.Stmt
+	saveWebhookDeliveryStmt     *sql.Stmt
+	webhookDeliveryStmt         *sql.Stmt
 }
 
 // New creates a new SQL database
 func New(cfg *Config, opts ...Option) (*Database, error) {
+	d, err := newDialect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	db, err := sql.Open(cfg.Driver, cfg.DSN)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open database: %w", err)
 	}
+	db.SetMaxOpenConns(d.maxOpenConns)
 
-	// TODO: Probably uncomment to allow migrations
-	if _, err := db.Exec(createTableQuery); err != nil {
-		return nil, fmt.Errorf("unable to prepare database: %w", err)
+	m := &Migrator{db: db, dialect: d}
+	if cfg.AutoMigrate {
+		if _, err := m.Migrate(context.Background()); err != nil {
+			return nil, fmt.Errorf("unable to migrate database: %w", err)
+		}
+	} else if err := m.checkMigrated(context.Background()); err != nil {
+		return nil, err
 	}
 
-	hasIncidentStmt, err := db.Prepare("SELECT id FROM incidents WHERE id=?")
+	prepare := func(query string) (*sql.Stmt, error) {
+		return db.Prepare(d.rebind(query))
+	}
+
+	hasIncidentStmt, err := prepare(hasIncidentQuery)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare hasIncidents query: %w", err)
 	}
-	saveIncidentStmt, err := db.Prepare(saveIncidentQuery)
+	saveIncidentStmt, err := prepare(saveIncidentQuery)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare saveIncident query: %w", err)
 	}
-	updateResolutionStmt, err := db.Prepare(updateResolutionQuery)
+	updateResolutionStmt, err := prepare(updateResolutionQuery)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare updateResolution query: %w", err)
 	}
-	saveCommentStmt, err := db.Prepare(saveCommentQuery)
+	saveCommentStmt, err := prepare(saveCommentQuery)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare saveComment query: %w", err)
 	}
-	viewIncidentStmt, err := db.Prepare(viewIncidentQuery)
+	viewIncidentStmt, err := prepare(viewIncidentQuery)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare viewIncident query: %w", err)
 	}
-	viewCommentsStmt, err := db.Prepare(viewCommentsQuery)
+	viewCommentsStmt, err := prepare(viewCommentsQuery)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare viewComments query: %w", err)
 	}
-	incidentsWithoutReviewStmt, err := db.Prepare(incidentsWithoutReviewQuery)
+	incidentsWithoutReviewStmt, err := prepare(incidentsWithoutReviewQuery)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare incidentsWithoutReview query: %w", err)
 	}
-	incidentsInRadiusStmt, err := db.Prepare(incidentsInRadiusQuery)
+	incidentsInRadiusStmt, err := prepare(incidentsInRadiusQuery)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare incidentsInRadius query: %w", err)
 	}
-	incidentsInRegionStmt, err := db.Prepare(incidentsInRegionQuery)
+	incidentsInRegionStmt, err := prepare(d.incidentsInRegionQuery)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare incidentsInRegion query: %w", err)
 	}
-	saveSessionStmt, err := db.Prepare(saveSessionQuery)
+	saveSessionStmt, err := prepare(saveSessionQuery)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare saveComment query: %w", err)
 	}
-	isValidSessionStmt, err := db.Prepare(isValidSessionQuery)
+	isValidSessionStmt, err := prepare(isValidSessionQuery)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare isValidSession query: %w", err)
 	}
-	alertingIncidentsStmt, err := db.Prepare(alertingIncidentsQuery)
+	sessionReviewerStmt, err := prepare(sessionReviewerQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare sessionReviewer query: %w", err)
+	}
+	saveReviewerStmt, err := prepare(saveReviewerQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare saveReviewer query: %w", err)
+	}
+	userRolesStmt, err := prepare(userRolesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare userRoles query: %w", err)
+	}
+	grantRoleStmt, err := prepare(grantRoleQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare grantRole query: %w", err)
+	}
+	revokeRoleStmt, err := prepare(revokeRoleQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare revokeRole query: %w", err)
+	}
+	roleGrantsStmt, err := prepare(roleGrantsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare roleGrants query: %w", err)
+	}
+	grantConfigRoleStmt, err := prepare(grantConfigRoleQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare grantConfigRole query: %w", err)
+	}
+	revokeConfigRoleStmt, err := prepare(revokeConfigRoleQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare revokeConfigRole query: %w", err)
+	}
+	configRolesStmt, err := prepare(configRolesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare configRoles query: %w", err)
+	}
+	saveTransitionStmt, err := prepare(saveTransitionQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare saveTransition query: %w", err)
+	}
+	incidentHistoryStmt, err := prepare(incidentHistoryQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare incidentHistory query: %w", err)
+	}
+	alertingIncidentsStmt, err := prepare(d.alertingIncidentsQuery)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare isValidSession query: %w", err)
 	}
+	reviewedIncidentsStmt, err := prepare(reviewedIncidentsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare reviewedIncidents query: %w", err)
+	}
+	imageIncidentsStmt, err := prepare(imageIncidentsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare imageIncidents query: %w", err)
+	}
+	saveUploadStmt, err := prepare(saveUploadQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare saveUpload query: %w", err)
+	}
+	attachUploadStmt, err := prepare(attachUploadQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare attachUpload query: %w", err)
+	}
+	uploadIncidentStmt, err := prepare(uploadIncidentQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare uploadIncident query: %w", err)
+	}
+	detachUploadStmt, err := prepare(detachUploadQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare detachUpload query: %w", err)
+	}
+	orphanUploadsStmt, err := prepare(orphanUploadsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare orphanUploads query: %w", err)
+	}
+	deleteUploadStmt, err := prepare(deleteUploadQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare deleteUpload query: %w", err)
+	}
+	saveSubscriptionStmt, err := prepare(saveSubscriptionQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare saveSubscription query: %w", err)
+	}
+	saveSubscriptionCellStmt, err := prepare(saveSubscriptionCellQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare saveSubscriptionCell query: %w", err)
+	}
+	userSubscriptionsStmt, err := prepare(userSubscriptionsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare userSubscriptions query: %w", err)
+	}
+	subscriptionCellsStmt, err := prepare(subscriptionCellsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare subscriptionCells query: %w", err)
+	}
+	cellSubscriptionsStmt, err := prepare(cellSubscriptionsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare cellSubscriptions query: %w", err)
+	}
+	deleteSubscriptionStmt, err := prepare(deleteSubscriptionQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare deleteSubscription query: %w", err)
+	}
+	deleteSubscriptionCellsStmt, err := prepare(deleteSubscriptionCellsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare deleteSubscriptionCells query: %w", err)
+	}
+	takeAlertStmt, err := prepare(takeAlertQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare takeAlert query: %w", err)
+	}
+	returnAlertStmt, err := prepare(returnAlertQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare returnAlert query: %w", err)
+	}
+	hasSubscriptionStmt, err := prepare(hasSubscriptionQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare hasSubscription query: %w", err)
+	}
+	incidentsToDigestStmt, err := prepare(incidentsToDigestQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare incidentsToDigest query: %w", err)
+	}
+	takeDigestStmt, err := prepare(takeDigestQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare takeDigest query: %w", err)
+	}
+	returnDigestStmt, err := prepare(returnDigestQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare returnDigest query: %w", err)
+	}
+	saveWebhookDeliveryStmt, err := prepare(saveWebhookDeliveryQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare saveWebhookDelivery query: %w", err)
+	}
+	webhookDeliveryStmt, err := prepare(webhookDeliveryQuery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare webhookDelivery query: %w", err)
+	}
 
-	d := &Database{
-		db:                         db,
-		hasIncidentStmt:            hasIncidentStmt,
-		saveIncidentStmt:           saveIncidentStmt,
-		updateResolutionStmt:       updateResolutionStmt,
-		saveCommentStmt:            saveCommentStmt,
-		viewIncidentStmt:           viewIncidentStmt,
-		viewCommentsStmt:           viewCommentsStmt,
-		incidentsWithoutReviewStmt: incidentsWithoutReviewStmt,
-		incidentsInRadiusStmt:      incidentsInRadiusStmt,
-		saveSessionStmt:            saveSessionStmt,
-		isValidSessionStmt:         isValidSessionStmt,
-		alertingIncidentsStmt:      alertingIncidentsStmt,
-		incidentsInRegionStmt:      incidentsInRegionStmt,
+	v := &Database{
+		db:                          db,
+		hasIncidentStmt:             hasIncidentStmt,
+		saveIncidentStmt:            saveIncidentStmt,
+		updateResolutionStmt:        updateResolutionStmt,
+		saveCommentStmt:             saveCommentStmt,
+		viewIncidentStmt:            viewIncidentStmt,
+		viewCommentsStmt:            viewCommentsStmt,
+		incidentsWithoutReviewStmt:  incidentsWithoutReviewStmt,
+		incidentsInRadiusStmt:       incidentsInRadiusStmt,
+		saveSessionStmt:             saveSessionStmt,
+		isValidSessionStmt:          isValidSessionStmt,
+		sessionReviewerStmt:         sessionReviewerStmt,
+		saveReviewerStmt:            saveReviewerStmt,
+		userRolesStmt:               userRolesStmt,
+		grantRoleStmt:               grantRoleStmt,
+		revokeRoleStmt:              revokeRoleStmt,
+		roleGrantsStmt:              roleGrantsStmt,
+		grantConfigRoleStmt:         grantConfigRoleStmt,
+		revokeConfigRoleStmt:        revokeConfigRoleStmt,
+		configRolesStmt:             configRolesStmt,
+		saveTransitionStmt:          saveTransitionStmt,
+		incidentHistoryStmt:         incidentHistoryStmt,
+		alertingIncidentsStmt:       alertingIncidentsStmt,
+		reviewedIncidentsStmt:       reviewedIncidentsStmt,
+		incidentsInRegionStmt:       incidentsInRegionStmt,
+		imageIncidentsStmt:          imageIncidentsStmt,
+		saveUploadStmt:              saveUploadStmt,
+		attachUploadStmt:            attachUploadStmt,
+		uploadIncidentStmt:          uploadIncidentStmt,
+		detachUploadStmt:            detachUploadStmt,
+		orphanUploadsStmt:           orphanUploadsStmt,
+		deleteUploadStmt:            deleteUploadStmt,
+		saveSubscriptionStmt:        saveSubscriptionStmt,
+		saveSubscriptionCellStmt:    saveSubscriptionCellStmt,
+		userSubscriptionsStmt:       userSubscriptionsStmt,
+		subscriptionCellsStmt:       subscriptionCellsStmt,
+		cellSubscriptionsStmt:       cellSubscriptionsStmt,
+		deleteSubscriptionStmt:      deleteSubscriptionStmt,
+		deleteSubscriptionCellsStmt: deleteSubscriptionCellsStmt,
+		takeAlertStmt:               takeAlertStmt,
+		returnAlertStmt:             returnAlertStmt,
+		hasSubscriptionStmt:         hasSubscriptionStmt,
+		incidentsToDigestStmt:       incidentsToDigestStmt,
+		takeDigestStmt:              takeDigestStmt,
+		returnDigestStmt:            returnDigestStmt,
+		saveWebhookDeliveryStmt:     saveWebhookDeliveryStmt,
+		webhookDeliveryStmt:         webhookDeliveryStmt,
 	}
 
 	for _, opt := range opts {
-		opt(d)
+		opt(v)
 	}
 
-	return d, validate(d)
+	return v, validate(v)
 }
 
 // SaveIncident to the sql database
@@ -143,19 +370,9 @@ func (db *Database) SaveIncident(ctx context.Context, inc *incident.Incident) (e
 		span.End()
 	}()
 
-	tx, err := db.db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("unable to start transaction: %w", err)
-	}
-	defer func() { _ = tx.Rollback() }()
-
-	if exists, err := db.hasIncident(ctx, tx, inc.Id); err != nil {
-		return fmt.Errorf("unable to check does the incident exist: %w", err)
-	} else if exists {
-		return database.ErrAlreadyExists
-	}
-
-	if _, err := tx.Stmt(db.saveIncidentStmt).ExecContext(ctx,
+	// The incident is only inserted if there isn't one with the same ID, so the incidents saved
+	// at the same time can't both succeed.
+	res, err := db.saveIncidentStmt.ExecContext(ctx,
 		inc.Id,
 		inc.Timestamp.Seconds,
 		inc.Description,
@@ -163,22 +380,25 @@ func (db *Database) SaveIncident(ctx context.Context, inc *incident.Incident) (e
 		inc.Coordinates.Lon,
 		inc.Resolution.String(),
 		inc.ImageId,
-	); err != nil {
+	)
+	if err != nil {
 		return fmt.Errorf("unable to save incident: %w", err)
 	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("unable to commit transaction: %w", err)
+	if saved, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to check the incident was saved: %w", err)
+	} else if saved == 0 {
+		return database.ErrAlreadyExists
 	}
 
 	return nil
 }
 
-// SaveReview updates the incident record with the resolution and adds a comment.
+// SaveReview updates the incident record with the resolution, adds a comment and records the
+// transition in the incident history.
 func (db *Database) SaveReview(
 	ctx context.Context,
 	id string,
-	res incident.Resolution,
+	from, to incident.Resolution,
 	comment *incident.Comment,
 ) (err error) {
 	ctx, span := db.tracer.Start(ctx, "SaveReview")
@@ -204,11 +424,17 @@ func (db *Database) SaveReview(
 		return database.ErrDoesNotExist
 	}
 
-	if _, err := tx.Stmt(db.updateResolutionStmt).ExecContext(
-		ctx, res.String(), id,
-	); err != nil {
+	res, err := tx.Stmt(db.updateResolutionStmt).ExecContext(
+		ctx, to.String(), id, from.String(),
+	)
+	if err != nil {
 		return fmt.Errorf("unable to update incident resolution: %w", err)
 	}
+	if updated, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to check incident resolution was updated: %w", err)
+	} else if updated == 0 {
+		return database.ErrConflict
+	}
 
 	if _, err := tx.Stmt(db.saveCommentStmt).ExecContext(
 		ctx,
@@ -217,12 +443,24 @@ func (db *Database) SaveReview(
 		comment.Timestamp,   // timestamp
 		comment.AuthorId,    // author
 		comment.Message,     // comment
-		res.String(),        // resolution
+		to.String(),         // resolution
 
 	); err != nil {
 		return fmt.Errorf("unable to save comment: %w", err)
 	}
 
+	if _, err := tx.Stmt(db.saveTransitionStmt).ExecContext(
+		ctx,
+		id,
+		comment.AuthorId,
+		from.String(),
+		to.String(),
+		comment.Message,
+		comment.Timestamp,
+	); err != nil {
+		return fmt.Errorf("unable to save transition: %w", err)
+	}
+
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("unable to commit transaction: %w", err)
 	}
@@ -230,6 +468,31 @@ func (db *Database) SaveReview(
 	return nil
 }
 
+// SaveTransition records the transition in the history of the incident.
+func (db *Database) SaveTransition(ctx context.Context, t *database.Transition) (err error) {
+	ctx, span := db.tracer.Start(ctx, "SaveTransition")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	if _, err := db.saveTransitionStmt.ExecContext(
+		ctx,
+		t.IncidentID,
+		t.Actor,
+		t.From.String(),
+		t.To.String(),
+		t.Reason,
+		t.Timestamp.Unix(),
+	); err != nil {
+		return fmt.Errorf("unable to save transition: %w", err)
+	}
+	return nil
+}
+
 // ViewIncident recovers incident information
 func (db *Database) ViewIncident(
 	ctx context.Context, id string,
@@ -264,6 +527,8 @@ func (db *Database) ViewIncident(
 	if err != nil {
 		return nil, fmt.Errorf("unable to get incident comments: %w", err)
 	}
+	defer rows.Close()
+
 	for rows.Next() {
 		comment := new(incident.Comment)
 		discard := ""
@@ -280,15 +545,511 @@ func (db *Database) ViewIncident(
 		inc.ReviewerComments = append(inc.ReviewerComments, comment)
 	}
 
-	// Sort the reviewer comments
-	sort.Sort(ByTimestamp(inc.ReviewerComments))
+	// Sort the reviewer comments
+	sort.Sort(ByTimestamp(inc.ReviewerComments))
+
+	// We don't actually change anything but we are using this to close the
+	// transaction
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return inc, nil
+}
+
+// ImageIncidents returns the incidents which were reported with the image.
+func (db *Database) ImageIncidents(
+	ctx context.Context, imageID string,
+) (incidents []*incident.Incident, err error) {
+	ctx, span := db.tracer.Start(ctx, "ImageIncidents")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		} else {
+			span.SetStatus(codes.Ok, "")
+		}
+		span.End()
+	}()
+
+	// The incidents reported without an image have an empty image.
+	if imageID == "" {
+		return nil, nil
+	}
+
+	rows, err := db.imageIncidentsStmt.QueryContext(ctx, imageID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list image incidents: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		inc, err := scanIncident(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get incident info: %w", err)
+		}
+		incidents = append(incidents, inc)
+	}
+
+	return incidents, rows.Err()
+}
+
+// SaveUpload records the user who uploaded the image.
+func (db *Database) SaveUpload(ctx context.Context, imageID, owner string, uploaded time.Time) (err error) {
+	ctx, span := db.tracer.Start(ctx, "SaveUpload")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	if _, err := db.saveUploadStmt.ExecContext(ctx, imageID, owner, uploaded.Unix()); err != nil {
+		return fmt.Errorf("unable to save upload: %w", err)
+	}
+	return nil
+}
+
+// AttachUpload attaches the image uploaded by the owner to the incident, unless it is attached
+// to another incident already.
+func (db *Database) AttachUpload(ctx context.Context, imageID, owner, incidentID string) (err error) {
+	ctx, span := db.tracer.Start(ctx, "AttachUpload")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	res, err := db.attachUploadStmt.ExecContext(ctx, incidentID, imageID, owner, incidentID)
+	if err != nil {
+		return fmt.Errorf("unable to attach upload: %w", err)
+	}
+	if attached, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to check the upload was attached: %w", err)
+	} else if attached > 0 {
+		return nil
+	}
+
+	// Find out why the upload wasn't attached.
+	var incident sql.NullString
+	err = db.uploadIncidentStmt.QueryRowContext(ctx, imageID, owner).Scan(&incident)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return database.ErrDoesNotExist
+	case err != nil:
+		return fmt.Errorf("unable to get upload: %w", err)
+	default:
+		return database.ErrConflict
+	}
+}
+
+// DetachUpload detaches the image uploaded by the owner from the incident, if it is attached to
+// it.
+func (db *Database) DetachUpload(ctx context.Context, imageID, owner, incidentID string) (err error) {
+	ctx, span := db.tracer.Start(ctx, "DetachUpload")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	if _, err := db.detachUploadStmt.ExecContext(ctx, imageID, owner, incidentID); err != nil {
+		return fmt.Errorf("unable to detach upload: %w", err)
+	}
+	return nil
+}
+
+// OrphanUploads returns the images last uploaded before the time, which no incident has.
+func (db *Database) OrphanUploads(ctx context.Context, before time.Time) (_ []string, err error) {
+	ctx, span := db.tracer.Start(ctx, "OrphanUploads")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	rows, err := db.orphanUploadsStmt.QueryContext(ctx, before.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("unable to list orphan uploads: %w", err)
+	}
+	defer rows.Close()
+
+	var images []string
+	for rows.Next() {
+		var image string
+		if err := rows.Scan(&image); err != nil {
+			return nil, fmt.Errorf("unable to scan orphan upload: %w", err)
+		}
+		images = append(images, image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list orphan uploads: %w", err)
+	}
+
+	return images, nil
+}
+
+// DeleteUpload removes the records of the image.
+func (db *Database) DeleteUpload(ctx context.Context, imageID string) (err error) {
+	ctx, span := db.tracer.Start(ctx, "DeleteUpload")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	if _, err := db.deleteUploadStmt.ExecContext(ctx, imageID); err != nil {
+		return fmt.Errorf("unable to delete upload: %w", err)
+	}
+	return nil
+}
+
+// SaveSubscription creates the subscription with its cells.
+func (db *Database) SaveSubscription(ctx context.Context, sub *database.Subscription) (err error) {
+	ctx, span := db.tracer.Start(ctx, "SaveSubscription")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.Stmt(db.saveSubscriptionStmt).ExecContext(ctx,
+		sub.ID,
+		sub.Owner,
+		sub.Channel,
+		sub.Endpoint,
+		sub.Secret,
+		sub.Created.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to save subscription: %w", err)
+	}
+	if saved, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to check the subscription was saved: %w", err)
+	} else if saved == 0 {
+		return database.ErrAlreadyExists
+	}
+
+	for _, cell := range sub.Cells {
+		if _, err := tx.Stmt(db.saveSubscriptionCellStmt).ExecContext(ctx, sub.ID, cell.Lat, cell.Lon); err != nil {
+			return fmt.Errorf("unable to save subscription cell: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// UserSubscriptions returns the subscriptions of the user with their cells, oldest first.
+func (db *Database) UserSubscriptions(
+	ctx context.Context, owner string,
+) (subs []*database.Subscription, err error) {
+	ctx, span := db.tracer.Start(ctx, "UserSubscriptions")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	subs, err = scanSubscriptions(tx.Stmt(db.userSubscriptionsStmt).QueryContext(ctx, owner))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list user subscriptions: %w", err)
+	}
+
+	for _, sub := range subs {
+		rows, err := tx.Stmt(db.subscriptionCellsStmt).QueryContext(ctx, sub.ID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get subscription cells: %w", err)
+		}
+		for rows.Next() {
+			var cell database.Cell
+			if err := rows.Scan(&cell.Lat, &cell.Lon); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("unable to scan subscription cell: %w", err)
+			}
+			sub.Cells = append(sub.Cells, cell)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("unable to get subscription cells: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return subs, nil
+}
+
+// CellSubscriptions returns the subscriptions to the cell, without their cells.
+func (db *Database) CellSubscriptions(
+	ctx context.Context, cell database.Cell,
+) (subs []*database.Subscription, err error) {
+	ctx, span := db.tracer.Start(ctx, "CellSubscriptions")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	subs, err = scanSubscriptions(db.cellSubscriptionsStmt.QueryContext(ctx, cell.Lat, cell.Lon))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list cell subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// DeleteSubscription of the user with its cells.
+func (db *Database) DeleteSubscription(ctx context.Context, id, owner string) (err error) {
+	ctx, span := db.tracer.Start(ctx, "DeleteSubscription")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.Stmt(db.deleteSubscriptionStmt).ExecContext(ctx, id, owner)
+	if err != nil {
+		return fmt.Errorf("unable to delete subscription: %w", err)
+	}
+	if deleted, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("unable to check the subscription was deleted: %w", err)
+	} else if deleted == 0 {
+		return database.ErrDoesNotExist
+	}
+
+	if _, err := tx.Stmt(db.deleteSubscriptionCellsStmt).ExecContext(ctx, id); err != nil {
+		return fmt.Errorf("unable to delete subscription cells: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// TakeAlert records the alert in the window of the subscription, starting a new window if the
+// previous one ended.
+func (db *Database) TakeAlert(
+	ctx context.Context, id string, now time.Time, limit int, window time.Duration,
+) (_ bool, err error) {
+	ctx, span := db.tracer.Start(ctx, "TakeAlert")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	ended := now.Add(-window).Unix()
+	res, err := db.takeAlertStmt.ExecContext(ctx, ended, ended, now.Unix(), id, ended, limit)
+	if err != nil {
+		return false, fmt.Errorf("unable to take alert: %w", err)
+	}
+	if taken, err := res.RowsAffected(); err != nil {
+		return false, fmt.Errorf("unable to check the alert was taken: %w", err)
+	} else if taken > 0 {
+		return true, nil
+	}
+
+	// Find out whether the subscription is over its limit, or doesn't exist.
+	var existing string
+	err = db.hasSubscriptionStmt.QueryRowContext(ctx, id).Scan(&existing)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return false, database.ErrDoesNotExist
+	case err != nil:
+		return false, fmt.Errorf("unable to get subscription: %w", err)
+	default:
+		return false, nil
+	}
+}
+
+// ReturnAlert uncounts the alert from the window of the subscription, if the window is the one it
+// was counted in.
+func (db *Database) ReturnAlert(ctx context.Context, id string, taken time.Time) (err error) {
+	ctx, span := db.tracer.Start(ctx, "ReturnAlert")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	if _, err := db.returnAlertStmt.ExecContext(ctx, id, taken.Unix()); err != nil {
+		return fmt.Errorf("unable to return alert: %w", err)
+	}
+	return nil
+}
+
+// IncidentsToDigest gets the incidents without review which were not taken for a digest.
+func (db *Database) IncidentsToDigest(
+	ctx context.Context,
+) (incidents []*incident.Incident, err error) {
+	ctx, span := db.tracer.Start(ctx, "IncidentsToDigest")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	rows, err := db.incidentsToDigestStmt.QueryContext(ctx,
+		incident.Resolution_RESOLUTION_UNSPECIFIED.String(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable list incidents: %w", err)
+	}
+	defer rows.Close()
+
+	incidents = make([]*incident.Incident, 0)
+	for rows.Next() {
+		inc, err := scanIncident(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get incident info: %w", err)
+		}
+		incidents = append(incidents, inc)
+	}
+
+	return incidents, rows.Err()
+}
+
+// TakeDigest marks the incident as digested at the time, unless it was taken already.
+func (db *Database) TakeDigest(ctx context.Context, id string, now time.Time) (_ bool, err error) {
+	ctx, span := db.tracer.Start(ctx, "TakeDigest")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	res, err := db.takeDigestStmt.ExecContext(ctx, now.Unix(), id)
+	if err != nil {
+		return false, fmt.Errorf("unable to take digest: %w", err)
+	}
+	taken, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("unable to check the digest was taken: %w", err)
+	}
+	return taken > 0, nil
+}
+
+// ReturnDigest marks the incident taken at the time as not digested.
+func (db *Database) ReturnDigest(ctx context.Context, id string, taken time.Time) (err error) {
+	ctx, span := db.tracer.Start(ctx, "ReturnDigest")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	if _, err := db.returnDigestStmt.ExecContext(ctx, id, taken.Unix()); err != nil {
+		return fmt.Errorf("unable to return digest: %w", err)
+	}
+	return nil
+}
+
+// SaveWebhookDelivery records the outcome of the delivery, counting the attempts of every time the
+// incident was delivered.
+func (db *Database) SaveWebhookDelivery(ctx context.Context, d *database.WebhookDelivery) (err error) {
+	ctx, span := db.tracer.Start(ctx, "SaveWebhookDelivery")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	if _, err := db.saveWebhookDeliveryStmt.ExecContext(ctx,
+		d.ID,
+		d.IncidentID,
+		d.URL,
+		d.Attempts,
+		d.StatusCode,
+		d.Error,
+		d.Delivered,
+		d.Updated.Unix(),
+	); err != nil {
+		return fmt.Errorf("unable to save webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// WebhookDelivery returns the outcome of the delivery.
+func (db *Database) WebhookDelivery(ctx context.Context, id string) (_ *database.WebhookDelivery, err error) {
+	ctx, span := db.tracer.Start(ctx, "WebhookDelivery")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
 
-	// We don't actually change anything but we are using this to close the
-	// transaction
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("unable to commit transaction: %w", err)
+	d := &database.WebhookDelivery{}
+	var updated int64
+	err = db.webhookDeliveryStmt.QueryRowContext(ctx, id).Scan(
+		&d.ID,
+		&d.IncidentID,
+		&d.URL,
+		&d.Attempts,
+		&d.StatusCode,
+		&d.Error,
+		&d.Delivered,
+		&updated,
+	)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, database.ErrDoesNotExist
+	case err != nil:
+		return nil, fmt.Errorf("unable to get webhook delivery: %w", err)
 	}
-	return inc, nil
+	d.Updated = time.Unix(updated, 0)
+	return d, nil
 }
 
 // IncidentsWithoutReview gets all the incidents which have the UNDEFINED
@@ -315,6 +1076,7 @@ func (db *Database) IncidentsWithoutReview(
 		}
 		return nil, fmt.Errorf("unable list incidents: %w", err)
 	}
+	defer rows.Close()
 
 	incidents = make([]*incident.Incident, 0)
 	for rows.Next() {
@@ -359,6 +1121,7 @@ func (db *Database) IncidentsInRegion(
 		}
 		return nil, fmt.Errorf("unable list incidents: %w", err)
 	}
+	defer rows.Close()
 
 	incidents = make([]*incident.Incident, 0)
 	for rows.Next() {
@@ -376,12 +1139,10 @@ func (db *Database) IncidentsInRegion(
 }
 
 // SaveSession in the database
-// TODO: Decide should the database layer decide on the session expiry or should it be
-// determined somewhere else.
-func (db *Database) SaveSession(ctx context.Context, session string) error {
-	// TODO: At least make the expiry configurable.
-	expiry := time.Now().Add(1 * time.Hour)
-	if _, err := db.saveSessionStmt.ExecContext(ctx, session, expiry.Unix()); err != nil {
+func (db *Database) SaveSession(
+	ctx context.Context, session string, reviewerID string, expiry time.Time,
+) error {
+	if _, err := db.saveSessionStmt.ExecContext(ctx, session, reviewerID, expiry.Unix()); err != nil {
 		return fmt.Errorf("unable to save session: %w", err)
 	}
 
@@ -416,6 +1177,7 @@ func (db *Database) AlertingIncidents(
 		}
 		return nil, fmt.Errorf("unable list incidents: %w", err)
 	}
+	defer rows.Close()
 
 	incidents = make([]*incident.Incident, 0)
 	for rows.Next() {
@@ -432,6 +1194,50 @@ func (db *Database) AlertingIncidents(
 	return incidents, nil
 }
 
+// ReviewedIncidents returns the incidents in the region by when they were last accepted or
+// alerted.
+func (db *Database) ReviewedIncidents(
+	ctx context.Context, since time.Time, region *viewer.Region,
+) (incidents []*database.ReviewedIncident, err error) {
+	ctx, span := db.tracer.Start(ctx, "ReviewedIncidents")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		} else {
+			span.SetStatus(codes.Ok, "")
+		}
+		span.End()
+	}()
+
+	rows, err := db.reviewedIncidentsStmt.QueryContext(ctx,
+		since.Unix(),
+		region.North/100,
+		region.South/100,
+		region.West/100,
+		region.East/100,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable list incidents: %w", err)
+	}
+	defer rows.Close()
+
+	incidents = make([]*database.ReviewedIncident, 0)
+	for rows.Next() {
+		var reviewed int64
+		inc, err := scanIncident(withColumns{rows, []any{&reviewed}})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get incident info: %w", err)
+		}
+		incidents = append(incidents, &database.ReviewedIncident{
+			Incident: inc,
+			Reviewed: time.Unix(reviewed, 0),
+		})
+	}
+
+	return incidents, rows.Err()
+}
+
 // IsValidSession determines if the session is still active and within date.
 // It returns nil if the session is valid, otherwise some error.
 // TODO: If the session is expired, delete it
@@ -442,17 +1248,203 @@ func (db *Database) IsValidSession(ctx context.Context, session string) error {
 	}
 	var expiryUnix int64
 	if err := row.Scan(&expiryUnix); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.ErrDoesNotExist
+		}
 		return fmt.Errorf("unable to scan row: %w", err)
 	}
 
 	expiry := time.Unix(expiryUnix, 0)
 	if time.Since(expiry) > 0 {
-		return errors.New("session expired")
+		return database.ErrExpired
+	}
+
+	return nil
+}
+
+// SessionReviewer returns the reviewer who owns the session, if the session did not expire.
+func (db *Database) SessionReviewer(ctx context.Context, session string) (*database.Reviewer, error) {
+	reviewer := new(database.Reviewer)
+	var expiryUnix int64
+	if err := db.sessionReviewerStmt.QueryRowContext(ctx, session).Scan(
+		&reviewer.ID,
+		&reviewer.Name,
+		&reviewer.Email,
+		&expiryUnix,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, database.ErrDoesNotExist
+		}
+		return nil, fmt.Errorf("unable to get session reviewer: %w", err)
+	}
+
+	if time.Since(time.Unix(expiryUnix, 0)) > 0 {
+		return nil, database.ErrExpired
+	}
+
+	return reviewer, nil
+}
+
+// SaveReviewer creates the reviewer or updates their details.
+func (db *Database) SaveReviewer(ctx context.Context, reviewer *database.Reviewer) error {
+	if _, err := db.saveReviewerStmt.ExecContext(ctx,
+		reviewer.ID,
+		reviewer.Name,
+		reviewer.Email,
+	); err != nil {
+		return fmt.Errorf("unable to save reviewer: %w", err)
+	}
+
+	return nil
+}
+
+// UserRoles returns the roles granted to the user.
+func (db *Database) UserRoles(ctx context.Context, subject string) ([]string, error) {
+	rows, err := db.userRolesStmt.QueryContext(ctx, subject)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get user roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := make([]string, 0)
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, fmt.Errorf("unable to scan role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GrantRole to the user.
+func (db *Database) GrantRole(ctx context.Context, subject string, role string) error {
+	if _, err := db.grantRoleStmt.ExecContext(ctx, subject, role); err != nil {
+		return fmt.Errorf("unable to grant role: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeRole from the user.
+func (db *Database) RevokeRole(ctx context.Context, subject string, role string) error {
+	if _, err := db.revokeRoleStmt.ExecContext(ctx, subject, role); err != nil {
+		return fmt.Errorf("unable to revoke role: %w", err)
+	}
+
+	return nil
+}
+
+// SyncConfigRoles grants the roles from the config, and revokes the ones which were removed from
+// it.
+func (db *Database) SyncConfigRoles(ctx context.Context, grants map[string][]string) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.Stmt(db.configRolesStmt).QueryContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to list config roles: %w", err)
+	}
+	var removed [][2]string
+	for rows.Next() {
+		var subject, role string
+		if err := rows.Scan(&subject, &role); err != nil {
+			rows.Close()
+			return fmt.Errorf("unable to scan config role: %w", err)
+		}
+		if !slices.Contains(grants[subject], role) {
+			removed = append(removed, [2]string{subject, role})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("unable to list config roles: %w", err)
+	}
+
+	for _, grant := range removed {
+		if _, err := tx.Stmt(db.revokeConfigRoleStmt).ExecContext(ctx, grant[0], grant[1]); err != nil {
+			return fmt.Errorf("unable to revoke role: %w", err)
+		}
+	}
+	for subject, roles := range grants {
+		for _, role := range roles {
+			if _, err := tx.Stmt(db.grantConfigRoleStmt).ExecContext(ctx, subject, role); err != nil {
+				return fmt.Errorf("unable to grant role: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
 	}
 
 	return nil
 }
 
+// RoleGrants returns the roles granted to each user.
+func (db *Database) RoleGrants(ctx context.Context) (map[string][]string, error) {
+	rows, err := db.roleGrantsStmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list role grants: %w", err)
+	}
+	defer rows.Close()
+
+	grants := make(map[string][]string)
+	for rows.Next() {
+		var subject, role string
+		if err := rows.Scan(&subject, &role); err != nil {
+			return nil, fmt.Errorf("unable to scan role grant: %w", err)
+		}
+		grants[subject] = append(grants[subject], role)
+	}
+
+	return grants, rows.Err()
+}
+
+// IncidentHistory returns the resolution transitions of the incident, oldest first.
+func (db *Database) IncidentHistory(
+	ctx context.Context, id string,
+) (history []*database.Transition, err error) {
+	ctx, span := db.tracer.Start(ctx, "IncidentHistory")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		} else {
+			span.SetStatus(codes.Ok, "")
+		}
+		span.End()
+	}()
+
+	rows, err := db.incidentHistoryStmt.QueryContext(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get incident history: %w", err)
+	}
+	defer rows.Close()
+
+	history = make([]*database.Transition, 0)
+	for rows.Next() {
+		var (
+			t         = &database.Transition{IncidentID: id}
+			from, to  string
+			timestamp int64
+		)
+		if err := rows.Scan(&t.Actor, &from, &to, &t.Reason, &timestamp); err != nil {
+			return nil, fmt.Errorf("unable to scan transition: %w", err)
+		}
+		t.From = incident.Resolution(incident.Resolution_value[from])
+		t.To = incident.Resolution(incident.Resolution_value[to])
+		t.Timestamp = time.Unix(timestamp, 0)
+		history = append(history, t)
+	}
+
+	return history, rows.Err()
+}
+
 func (db *Database) hasIncident(
 	ctx context.Context, tx *sql.Tx, id string,
 ) (exists bool, err error) {
@@ -512,40 +1504,60 @@ func scanIncident(s scanner) (*incident.Incident, error) {
 	return inc, nil
 }
 
-var createTableQuery = `
-CREATE TABLE IF NOT EXISTS incidents (
-	id TEXT PRIMARY KEY,
-	timestamp INTEGER NOT NULL,
-	description TEXT,
-	lat REAL NOT NULL,
-	lon REAL NOT NULL,
-	resolution TEXT NOT NULL,
-	image TEXT NOT NULL
-);
-CREATE INDEX IF NOT EXISTS lat ON incidents (lat);
-CREATE INDEX IF NOT EXISTS lon ON incidents (lon);
-
-CREATE TABLE IF NOT EXISTS comments (
-	id TEXT PRIMARY KEY,
-	incident_id TEXT NOT NULL,
-	timestamp INTEGER NOT NULL,
-	author TEXT NOT NULL,
-	comment TEXT NOT NULL,
-	resolution TEXT NOT NULL
-);
-CREATE INDEX IF NOT EXISTS incident_ids ON comments (incident_id);
-
-CREATE TABLE IF NOT EXISTS sessions (
-	id     TEXT PRIMARY KEY,
-	expiry INTEGER NOT NULL
-);
+// withColumns scans the additional columns selected after the scanned ones.
+type withColumns struct {
+	scanner
+	dest []any
+}
+
+func (s withColumns) Scan(dest ...any) error {
+	return s.scanner.Scan(append(dest, s.dest...)...)
+}
+
+// scanSubscriptions scans the subscriptions selected with subscriptionColumns.
+func scanSubscriptions(rows *sql.Rows, err error) ([]*database.Subscription, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := make([]*database.Subscription, 0)
+	for rows.Next() {
+		var (
+			sub     = new(database.Subscription)
+			created int64
+		)
+		if err := rows.Scan(
+			&sub.ID,
+			&sub.Owner,
+			&sub.Channel,
+			&sub.Endpoint,
+			&sub.Secret,
+			&created,
+		); err != nil {
+			return nil, err
+		}
+		sub.Created = time.Unix(created, 0)
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+// incidentColumns are selected when scanning the incidents, as the database might have additional
+// columns used to query the incidents.
+const incidentColumns = "id, timestamp, description, lat, lon, resolution, image"
+
+var hasIncidentQuery = `
+SELECT id FROM incidents WHERE id=?;
 `
 
 var saveIncidentQuery = `
 INSERT INTO incidents
 	(id, timestamp, description, lat, lon, resolution, image)
 VALUES
-	(?, ?, ?, ?, ?, ?, ?);
+	(?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO NOTHING;
 `
 
 var updateResolutionQuery = `
@@ -553,7 +1565,7 @@ UPDATE incidents
 SET
 	resolution=?
 WHERE
-	id=?;
+	id=? AND resolution=?;
 `
 
 var saveCommentQuery = `
@@ -564,7 +1576,143 @@ VALUES
 `
 
 var viewIncidentQuery = `
-SELECT * FROM incidents WHERE id=?;
+SELECT ` + incidentColumns + ` FROM incidents WHERE id=?;
+`
+
+var imageIncidentsQuery = `
+SELECT ` + incidentColumns + ` FROM incidents WHERE image=?;
+`
+
+var saveUploadQuery = `
+INSERT INTO uploads
+	(image, owner, uploaded)
+VALUES
+	(?, ?, ?)
+ON CONFLICT (image, owner) DO UPDATE SET uploaded = excluded.uploaded;
+`
+
+var attachUploadQuery = `
+UPDATE uploads SET incident = ?
+WHERE image = ? AND owner = ? AND (incident IS NULL OR incident = ?);
+`
+
+var uploadIncidentQuery = `
+SELECT incident FROM uploads WHERE image = ? AND owner = ?;
+`
+
+var detachUploadQuery = `
+UPDATE uploads SET incident = NULL
+WHERE image = ? AND owner = ? AND incident = ?;
+`
+
+// orphanUploadsQuery returns the images which no incident has. The images which were attached
+// to an incident are included too, as the incident might have failed to be saved.
+var orphanUploadsQuery = `
+SELECT image FROM uploads
+WHERE NOT EXISTS (SELECT 1 FROM incidents WHERE incidents.image = uploads.image)
+GROUP BY image
+HAVING MAX(uploaded) < ?
+ORDER BY image;
+`
+
+var deleteUploadQuery = `
+DELETE FROM uploads WHERE image = ?;
+`
+
+const subscriptionColumns = "id, owner, channel, endpoint, secret, created"
+
+var saveSubscriptionQuery = `
+INSERT INTO subscriptions
+	(` + subscriptionColumns + `)
+VALUES
+	(?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO NOTHING;
+`
+
+var saveSubscriptionCellQuery = `
+INSERT INTO subscription_cells
+	(subscription, lat, lon)
+VALUES
+	(?, ?, ?)
+ON CONFLICT (lat, lon, subscription) DO NOTHING;
+`
+
+var userSubscriptionsQuery = `
+SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE owner = ? ORDER BY created, id;
+`
+
+var subscriptionCellsQuery = `
+SELECT lat, lon FROM subscription_cells WHERE subscription = ? ORDER BY lat, lon;
+`
+
+var cellSubscriptionsQuery = `
+SELECT ` + subscriptionColumns + `
+FROM subscriptions
+WHERE id IN (SELECT subscription FROM subscription_cells WHERE lat = ? AND lon = ?)
+ORDER BY created, id;
+`
+
+var deleteSubscriptionQuery = `
+DELETE FROM subscriptions WHERE id = ? AND owner = ?;
+`
+
+var deleteSubscriptionCellsQuery = `
+DELETE FROM subscription_cells WHERE subscription = ?;
+`
+
+// takeAlertQuery counts the alert in the window of the subscription, unless it has reached the
+// limit. The window which started at or before the first parameter has ended, so a new one is
+// started at the third parameter instead.
+var takeAlertQuery = `
+UPDATE subscriptions
+SET
+	window_alerts = CASE WHEN window_start <= ? THEN 1 ELSE window_alerts + 1 END,
+	window_start = CASE WHEN window_start <= ? THEN ? ELSE window_start END
+WHERE
+	id = ? AND (window_start <= ? OR window_alerts < ?);
+`
+
+// returnAlertQuery uncounts the alert, unless a new window was started after it was taken.
+var returnAlertQuery = `
+UPDATE subscriptions
+SET window_alerts = window_alerts - 1
+WHERE id = ? AND window_start <= ? AND window_alerts > 0;
+`
+
+var incidentsToDigestQuery = `
+SELECT ` + incidentColumns + ` FROM incidents WHERE resolution=? AND digested_at IS NULL;
+`
+
+// takeDigestQuery marks the incident as digested, unless another digest has taken it already.
+var takeDigestQuery = `
+UPDATE incidents SET digested_at=? WHERE id=? AND digested_at IS NULL;
+`
+
+// returnDigestQuery unmarks the incident, unless it was taken again since.
+var returnDigestQuery = `
+UPDATE incidents SET digested_at=NULL WHERE id=? AND digested_at=?;
+`
+
+var saveWebhookDeliveryQuery = `
+INSERT INTO webhook_deliveries
+	(id, incident_id, url, attempts, status_code, error, delivered, updated)
+VALUES
+	(?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET
+	attempts = webhook_deliveries.attempts + excluded.attempts,
+	status_code = excluded.status_code,
+	error = excluded.error,
+	delivered = excluded.delivered,
+	updated = excluded.updated;
+`
+
+var webhookDeliveryQuery = `
+SELECT id, incident_id, url, attempts, status_code, error, delivered, updated
+FROM webhook_deliveries WHERE id = ?;
+`
+
+var hasSubscriptionQuery = `
+SELECT id FROM subscriptions WHERE id = ?;
 `
 
 var viewCommentsQuery = `
@@ -572,28 +1720,100 @@ SELECT * FROM comments WHERE incident_id=?;
 `
 
 var incidentsWithoutReviewQuery = `
-SELECT * FROM incidents WHERE resolution=?;
+SELECT ` + incidentColumns + ` FROM incidents WHERE resolution=?;
 `
 
-// incidentsInRadiusQuery gets all incidents as some SQL databases might not contain geospatial functions
-// We might have to look into altenative databases for more efficient querying.
+// incidentsInRadiusQuery gets every accepted and alerted incident, without filtering them by the
+// radius, for the deprecated ViewInRadius which is no longer served. The incidents are found by
+// their location with incidentsInRegionQuery instead, or with postgisIncidentsInRegionQuery when
+// the database has PostGIS.
 var incidentsInRadiusQuery = fmt.Sprintf(`
-SELECT *
+SELECT %s
 FROM incidents
 WHERE
-	resolution=%q
+	resolution='%s'
 	OR
-	resolution=%q;
+	resolution='%s';
 `,
+	incidentColumns,
 	incident.Resolution_RESOLUTION_ACCEPTED,
 	incident.Resolution_RESOLUTION_ALERTED,
 )
 
 var saveSessionQuery = `
 INSERT INTO sessions
-	(id, expiry)
+	(id, reviewer_id, expiry)
+VALUES
+	(?, ?, ?);
+`
+
+var sessionReviewerQuery = `
+SELECT reviewers.id, reviewers.name, reviewers.email, sessions.expiry
+FROM sessions
+JOIN reviewers ON reviewers.id = sessions.reviewer_id
+WHERE sessions.id=?;
+`
+
+var saveReviewerQuery = `
+INSERT INTO reviewers
+	(id, name, email)
+VALUES
+	(?, ?, ?)
+ON CONFLICT(id) DO UPDATE SET
+	name=excluded.name,
+	email=excluded.email;
+`
+
+var saveTransitionQuery = `
+INSERT INTO incident_history
+	(incident_id, actor, old_resolution, new_resolution, reason, timestamp)
+VALUES
+	(?, ?, ?, ?, ?, ?);
+`
+
+var incidentHistoryQuery = `
+SELECT actor, old_resolution, new_resolution, reason, timestamp
+FROM incident_history
+WHERE incident_id=?
+ORDER BY id;
+`
+
+var userRolesQuery = `
+SELECT role FROM user_roles WHERE subject=? ORDER BY role;
+`
+
+// grantRoleQuery grants the role, which is kept once it's removed from the config.
+var grantRoleQuery = `
+INSERT INTO user_roles
+	(subject, role, from_config)
 VALUES
-	(?, ?);
+	(?, ?, FALSE)
+ON CONFLICT(subject, role) DO UPDATE SET from_config=FALSE;
+`
+
+// grantConfigRoleQuery grants the role from the config, unless it's granted already.
+var grantConfigRoleQuery = `
+INSERT INTO user_roles
+	(subject, role, from_config)
+VALUES
+	(?, ?, TRUE)
+ON CONFLICT(subject, role) DO NOTHING;
+`
+
+var revokeConfigRoleQuery = `
+DELETE FROM user_roles WHERE subject=? AND role=? AND from_config=TRUE;
+`
+
+var configRolesQuery = `
+SELECT subject, role FROM user_roles WHERE from_config=TRUE;
+`
+
+var revokeRoleQuery = `
+DELETE FROM user_roles WHERE subject=? AND role=?;
+`
+
+var roleGrantsQuery = `
+SELECT subject, role FROM user_roles ORDER BY subject, role;
 `
 
 var isValidSessionQuery = `
@@ -610,10 +1830,10 @@ SELECT expiry FROM sessions WHERE id=?;
 //	west
 //	east
 var incidentsInRegionQuery = fmt.Sprintf(`
-SELECT *
+SELECT %s
 FROM incidents
 WHERE
-	(resolution=%q OR resolution=%q)
+	(resolution='%s' OR resolution='%s')
 	AND
 		timestamp > ?
 	AND
@@ -625,6 +1845,43 @@ WHERE
 	AND
 		lon < ?
 `,
+	incidentColumns,
+	incident.Resolution_RESOLUTION_ACCEPTED,
+	incident.Resolution_RESOLUTION_ALERTED,
+)
+
+// reviewedIncidentsQuery gets the incidents in the region by when they were last accepted or
+// alerted, with the same parameters as incidentsInRegionQuery. The time of the review is selected
+// after the incident columns.
+var reviewedIncidentsQuery = fmt.Sprintf(`
+SELECT %s, reviewed
+FROM incidents
+JOIN (
+	SELECT incident_id, MAX(timestamp) AS reviewed
+	FROM incident_history
+	WHERE
+		(new_resolution='%s' OR new_resolution='%s')
+		AND
+			new_resolution <> old_resolution
+		AND
+			timestamp >= ?
+	GROUP BY incident_id
+) AS reviews ON reviews.incident_id = incidents.id
+WHERE
+	(resolution='%s' OR resolution='%s')
+	AND
+		lat < ?
+	AND
+		lat > ?
+	AND
+		lon > ?
+	AND
+		lon < ?
+ORDER BY reviewed, id
+`,
+	incidentColumns,
+	incident.Resolution_RESOLUTION_ACCEPTED,
+	incident.Resolution_RESOLUTION_ALERTED,
 	incident.Resolution_RESOLUTION_ACCEPTED,
 	incident.Resolution_RESOLUTION_ALERTED,
 )
@@ -639,10 +1896,10 @@ WHERE
 //	west
 //	east
 var alertingIncidentsQuery = fmt.Sprintf(`
-SELECT *
+SELECT %s
 FROM incidents
 WHERE
-	resolution=%q
+	resolution='%s'
 	AND
 		timestamp > ?
 	AND
@@ -654,5 +1911,6 @@ WHERE
 	AND
 		lon < ?
 `,
+	incidentColumns,
 	incident.Resolution_RESOLUTION_ALERTED,
 )
@@ -0,0 +1,75 @@
+package sqldatabase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"safer.place/internal/database"
+)
+
+func TestSaveReviewHistory(t *testing.T) {
+	ctx := context.Background()
+	db, err := openTestDatabase(newTestDSN(t), true)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+
+	if err := db.SaveIncident(ctx, &incident.Incident{
+		Id:          "incident",
+		Timestamp:   timestamppb.Now(),
+		Coordinates: &incident.Coordinates{},
+	}); err != nil {
+		t.Fatalf("SaveIncident() = %v", err)
+	}
+
+	review := func(from, to incident.Resolution, reason string) error {
+		return db.SaveReview(ctx, "incident", from, to, &incident.Comment{
+			AuthorId:  "reviewer",
+			Timestamp: time.Now().Unix(),
+			Message:   reason,
+		})
+	}
+
+	unspecified := incident.Resolution_RESOLUTION_UNSPECIFIED
+	accepted := incident.Resolution_RESOLUTION_ACCEPTED
+	alerted := incident.Resolution_RESOLUTION_ALERTED
+
+	if err := review(unspecified, accepted, "looks fine"); err != nil {
+		t.Fatalf("SaveReview() = %v", err)
+	}
+	// The incident is no longer unspecified, so a second review from the same state conflicts.
+	if err := review(unspecified, alerted, "too late"); !errors.Is(err, database.ErrConflict) {
+		t.Fatalf("SaveReview() = %v, want %v", err, database.ErrConflict)
+	}
+	if err := review(accepted, alerted, "escalating"); err != nil {
+		t.Fatalf("SaveReview() = %v", err)
+	}
+
+	history, err := db.IncidentHistory(ctx, "incident")
+	if err != nil {
+		t.Fatalf("IncidentHistory() = %v", err)
+	}
+
+	want := []database.Transition{
+		{IncidentID: "incident", Actor: "reviewer", From: unspecified, To: accepted, Reason: "looks fine"},
+		{IncidentID: "incident", Actor: "reviewer", From: accepted, To: alerted, Reason: "escalating"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("IncidentHistory() returned %d transitions, want %d", len(history), len(want))
+	}
+	for i, got := range history {
+		got.Timestamp = time.Time{}
+		if *got != want[i] {
+			t.Errorf("IncidentHistory()[%d] = %+v, want %+v", i, *got, want[i])
+		}
+	}
+
+	if _, err := db.db.Exec("DELETE FROM incident_history"); err == nil {
+		t.Error("deleting the incident history succeeded, want it to be append-only")
+	}
+}
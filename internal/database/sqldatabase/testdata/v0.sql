@@ -0,0 +1,34 @@
+-- A database created before the migrations were introduced.
+CREATE TABLE incidents (
+	id TEXT PRIMARY KEY,
+	timestamp INTEGER NOT NULL,
+	description TEXT,
+	lat REAL NOT NULL,
+	lon REAL NOT NULL,
+	resolution TEXT NOT NULL,
+	image TEXT NOT NULL
+);
+CREATE INDEX lat ON incidents (lat);
+CREATE INDEX lon ON incidents (lon);
+
+CREATE TABLE comments (
+	id TEXT PRIMARY KEY,
+	incident_id TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	author TEXT NOT NULL,
+	comment TEXT NOT NULL,
+	resolution TEXT NOT NULL
+);
+CREATE INDEX incident_ids ON comments (incident_id);
+
+CREATE TABLE sessions (
+	id     TEXT PRIMARY KEY,
+	expiry INTEGER NOT NULL
+);
+
+INSERT INTO incidents VALUES
+	('reviewed', 1700000000, 'broken street light', 53.34, -6.26, 'RESOLUTION_ACCEPTED', 'image-1'),
+	('pending', 1700000100, 'flooding', 53.35, -6.27, 'RESOLUTION_UNSPECIFIED', 'image-2');
+INSERT INTO comments VALUES
+	('comment-1', 'reviewed', 1700000050, 'reviewer@example.com', 'confirmed', 'RESOLUTION_ACCEPTED');
+INSERT INTO sessions VALUES ('old-session', 1700003600);
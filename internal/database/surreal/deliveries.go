@@ -0,0 +1,89 @@
+package surreal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/surrealdb/surrealdb.go"
+
+	"safer.place/internal/database"
+)
+
+type webhookDelivery struct {
+	IncidentID string `json:"incident_id"`
+	URL        string `json:"url"`
+	Attempts   int    `json:"attempts"`
+	StatusCode int    `json:"status_code"`
+	Error      string `json:"error"`
+	Delivered  bool   `json:"delivered"`
+	Updated    int64  `json:"updated"`
+}
+
+// Each delivery is identified by its ID, so delivering the incident again updates the record.
+var (
+	saveWebhookDeliveryQuery = `
+UPDATE type::thing("webhook_delivery", $id)
+SET
+	incident_id = $delivery.incident_id,
+	url = $delivery.url,
+	attempts = (attempts ?? 0) + $delivery.attempts,
+	status_code = $delivery.status_code,
+	error = $delivery.error,
+	delivered = $delivery.delivered,
+	updated = $delivery.updated
+`
+	webhookDeliveryQuery = `
+SELECT * FROM type::thing("webhook_delivery", $id)
+`
+)
+
+func (db *Database) SaveWebhookDelivery(ctx context.Context, d *database.WebhookDelivery) error {
+	_, span := db.tracer.Start(ctx, "SaveWebhookDelivery")
+	defer span.End()
+
+	if _, err := db.db.Query(saveWebhookDeliveryQuery, map[string]any{
+		"id": d.ID,
+		"delivery": &webhookDelivery{
+			IncidentID: d.IncidentID,
+			URL:        d.URL,
+			Attempts:   d.Attempts,
+			StatusCode: d.StatusCode,
+			Error:      d.Error,
+			Delivered:  d.Delivered,
+			Updated:    d.Updated.Unix(),
+		},
+	}); err != nil {
+		return fmt.Errorf("unable to save webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) WebhookDelivery(ctx context.Context, id string) (*database.WebhookDelivery, error) {
+	_, span := db.tracer.Start(ctx, "WebhookDelivery")
+	defer span.End()
+
+	results, err := db.db.Query(webhookDeliveryQuery, map[string]any{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get webhook delivery: %w", err)
+	}
+	deliveries, err := surrealdb.SmartUnmarshal[[]*webhookDelivery](results, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal webhook delivery: %w", err)
+	}
+	if len(deliveries) == 0 {
+		return nil, database.ErrDoesNotExist
+	}
+
+	d := deliveries[0]
+	return &database.WebhookDelivery{
+		ID:         id,
+		IncidentID: d.IncidentID,
+		URL:        d.URL,
+		Attempts:   d.Attempts,
+		StatusCode: d.StatusCode,
+		Error:      d.Error,
+		Delivered:  d.Delivered,
+		Updated:    time.Unix(d.Updated, 0),
+	}, nil
+}
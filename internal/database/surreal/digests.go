@@ -0,0 +1,72 @@
+package surreal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/surrealdb/surrealdb.go"
+
+	"api.safer.place/incident/v1"
+)
+
+// The incidents taken for a digest have digested_at set to when they were taken.
+var (
+	incidentsToDigestQuery = `
+SELECT * FROM incident WHERE (resolution ?? 0) = 0 AND digested_at = NONE
+`
+	takeDigestQuery = `
+UPDATE type::thing("incident", $id) SET digested_at = $now WHERE digested_at = NONE RETURN AFTER
+`
+	returnDigestQuery = `
+UPDATE type::thing("incident", $id) SET digested_at = NONE WHERE digested_at = $taken
+`
+)
+
+func (db *Database) IncidentsToDigest(ctx context.Context) ([]*incident.Incident, error) {
+	_, span := db.tracer.Start(ctx, "IncidentsToDigest")
+	defer span.End()
+
+	results, err := db.db.Query(incidentsToDigestQuery, map[string]any{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query for incidents to digest: %w", err)
+	}
+
+	incs, err := surrealdb.SmartUnmarshal[[]*incident.Incident](results, nil)
+	for i := range incs {
+		incs[i].Id = strings.TrimPrefix(incs[i].Id, "incident:")
+	}
+	return incs, err
+}
+
+func (db *Database) TakeDigest(ctx context.Context, id string, now time.Time) (bool, error) {
+	_, span := db.tracer.Start(ctx, "TakeDigest")
+	defer span.End()
+
+	results, err := db.db.Query(takeDigestQuery, map[string]any{
+		"id":  id,
+		"now": now.Unix(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to take digest: %w", err)
+	}
+	taken, err := surrealdb.SmartUnmarshal[[]*incident.Incident](results, nil)
+	if err != nil {
+		return false, fmt.Errorf("unable to unmarshal incident: %w", err)
+	}
+	return len(taken) > 0, nil
+}
+
+func (db *Database) ReturnDigest(ctx context.Context, id string, taken time.Time) error {
+	_, span := db.tracer.Start(ctx, "ReturnDigest")
+	defer span.End()
+
+	if _, err := db.db.Query(returnDigestQuery, map[string]any{
+		"id":    id,
+		"taken": taken.Unix(),
+	}); err != nil {
+		return fmt.Errorf("unable to return digest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package surreal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/surrealdb/surrealdb.go"
+)
+
+type userRole struct {
+	Subject string `json:"subject"`
+	Role    string `json:"role"`
+	// Config is set on the roles granted from the config, which are revoked once they are
+	// removed from it.
+	Config bool `json:"config"`
+}
+
+// Each grant is identified by the subject and the role, so granting the same role twice doesn't
+// create a second record.
+var (
+	grantRoleQuery = `
+UPDATE type::thing("user_role", [$subject, $role]) CONTENT { subject: $subject, role: $role, config: $config }
+`
+	revokeRoleQuery = `
+DELETE type::thing("user_role", [$subject, $role])
+`
+	userRolesQuery = `
+SELECT subject, role FROM user_role WHERE subject = $subject ORDER BY role
+`
+	roleGrantsQuery = `
+SELECT subject, role, config FROM user_role ORDER BY subject, role
+`
+)
+
+func (db *Database) UserRoles(ctx context.Context, subject string) ([]string, error) {
+	grants, err := db.queryRoles(ctx, userRolesQuery, map[string]any{"subject": subject})
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]string, 0, len(grants))
+	for _, grant := range grants {
+		roles = append(roles, grant.Role)
+	}
+	return roles, nil
+}
+
+func (db *Database) GrantRole(ctx context.Context, subject string, role string) error {
+	_, span := db.tracer.Start(ctx, "GrantRole")
+	defer span.End()
+
+	return db.grantRole(subject, role, false)
+}
+
+// SyncConfigRoles grants the roles from the config, and revokes the ones which were removed from
+// it.
+func (db *Database) SyncConfigRoles(ctx context.Context, grants map[string][]string) error {
+	ctx, span := db.tracer.Start(ctx, "SyncConfigRoles")
+	defer span.End()
+
+	existing, err := db.queryRoles(ctx, roleGrantsQuery, map[string]any{})
+	if err != nil {
+		return err
+	}
+
+	granted := make(map[[2]string]bool, len(existing))
+	for _, grant := range existing {
+		granted[[2]string{grant.Subject, grant.Role}] = true
+		if grant.Config && !slices.Contains(grants[grant.Subject], grant.Role) {
+			if err := db.RevokeRole(ctx, grant.Subject, grant.Role); err != nil {
+				return err
+			}
+		}
+	}
+	// The roles which are granted already are kept as they are, so the ones granted with
+	// GrantRole are not revoked once they are removed from the config.
+	for subject, roles := range grants {
+		for _, role := range roles {
+			if granted[[2]string{subject, role}] {
+				continue
+			}
+			if err := db.grantRole(subject, role, true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (db *Database) grantRole(subject string, role string, config bool) error {
+	if _, err := db.db.Query(grantRoleQuery, map[string]any{
+		"subject": subject,
+		"role":    role,
+		"config":  config,
+	}); err != nil {
+		return fmt.Errorf("unable to grant role: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) RevokeRole(ctx context.Context, subject string, role string) error {
+	_, span := db.tracer.Start(ctx, "RevokeRole")
+	defer span.End()
+
+	if _, err := db.db.Query(revokeRoleQuery, map[string]any{
+		"subject": subject,
+		"role":    role,
+	}); err != nil {
+		return fmt.Errorf("unable to revoke role: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) RoleGrants(ctx context.Context) (map[string][]string, error) {
+	grants, err := db.queryRoles(ctx, roleGrantsQuery, map[string]any{})
+	if err != nil {
+		return nil, err
+	}
+
+	bySubject := make(map[string][]string)
+	for _, grant := range grants {
+		bySubject[grant.Subject] = append(bySubject[grant.Subject], grant.Role)
+	}
+	return bySubject, nil
+}
+
+func (db *Database) queryRoles(ctx context.Context, query string, vars map[string]any) ([]*userRole, error) {
+	_, span := db.tracer.Start(ctx, "queryRoles")
+	defer span.End()
+
+	results, err := db.db.Query(query, vars)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query roles: %w", err)
+	}
+
+	grants, err := surrealdb.SmartUnmarshal[[]*userRole](results, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal roles: %w", err)
+	}
+	return grants, nil
+}
@@ -0,0 +1,137 @@
+package surreal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/surrealdb/surrealdb.go"
+
+	"safer.place/internal/database"
+)
+
+type session struct {
+	ReviewerID string `json:"reviewer_id"`
+	Expiry     int64  `json:"expiry"`
+}
+
+type reviewer struct {
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// The session and reviewer IDs can contain characters which are not allowed in the record IDs,
+// so the record IDs are always created with type::thing.
+var (
+	saveSessionQuery = `
+CREATE type::thing("session", $id) CONTENT $session
+`
+	getSessionQuery = `
+SELECT * FROM type::thing("session", $id)
+`
+	deleteSessionQuery = `
+DELETE type::thing("session", $id)
+`
+	getReviewerQuery = `
+SELECT * FROM type::thing("reviewer", $id)
+`
+	saveReviewerQuery = `
+UPDATE type::thing("reviewer", $id) CONTENT $reviewer
+`
+)
+
+func (db *Database) SaveSession(
+	ctx context.Context, id string, reviewerID string, expiry time.Time,
+) error {
+	_, span := db.tracer.Start(ctx, "SaveSession")
+	defer span.End()
+
+	if _, err := db.db.Query(saveSessionQuery, map[string]any{
+		"id": id,
+		"session": &session{
+			ReviewerID: reviewerID,
+			Expiry:     expiry.Unix(),
+		},
+	}); err != nil {
+		return fmt.Errorf("unable to save session: %w", err)
+	}
+
+	return nil
+}
+
+func (db *Database) IsValidSession(ctx context.Context, id string) error {
+	_, err := db.session(ctx, id)
+	return err
+}
+
+func (db *Database) SessionReviewer(ctx context.Context, id string) (*database.Reviewer, error) {
+	s, err := db.session(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := db.db.Query(getReviewerQuery, map[string]any{"id": s.ReviewerID})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get session reviewer: %w", err)
+	}
+	reviewers, err := surrealdb.SmartUnmarshal[[]*reviewer](results, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal reviewer: %w", err)
+	}
+	if len(reviewers) == 0 {
+		return nil, database.ErrDoesNotExist
+	}
+
+	return &database.Reviewer{
+		ID:    reviewers[0].Login,
+		Name:  reviewers[0].Name,
+		Email: reviewers[0].Email,
+	}, nil
+}
+
+// session returns the session if it exists and hasn't expired yet. The expired sessions are
+// deleted.
+func (db *Database) session(ctx context.Context, id string) (*session, error) {
+	_, span := db.tracer.Start(ctx, "session")
+	defer span.End()
+
+	results, err := db.db.Query(getSessionQuery, map[string]any{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get session: %w", err)
+	}
+	sessions, err := surrealdb.SmartUnmarshal[[]*session](results, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal session: %w", err)
+	}
+	if len(sessions) == 0 {
+		return nil, database.ErrDoesNotExist
+	}
+
+	if time.Since(time.Unix(sessions[0].Expiry, 0)) > 0 {
+		if _, err := db.db.Query(deleteSessionQuery, map[string]any{"id": id}); err != nil {
+			return nil, fmt.Errorf("unable to delete expired session: %w", err)
+		}
+		return nil, database.ErrExpired
+	}
+
+	return sessions[0], nil
+}
+
+func (db *Database) SaveReviewer(ctx context.Context, r *database.Reviewer) error {
+	_, span := db.tracer.Start(ctx, "SaveReviewer")
+	defer span.End()
+
+	if _, err := db.db.Query(saveReviewerQuery, map[string]any{
+		"id": r.ID,
+		"reviewer": &reviewer{
+			Login: r.ID,
+			Name:  r.Name,
+			Email: r.Email,
+		},
+	}); err != nil {
+		return fmt.Errorf("unable to save reviewer: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package surreal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/surrealdb/surrealdb.go"
+
+	"safer.place/internal/database"
+)
+
+// subscription is stored with its ID in a field, as the record IDs are escaped when they contain
+// dashes. The window fields are always set, so the rate limit doesn't have to handle them missing.
+type subscription struct {
+	ID           string `json:"subscription"`
+	Owner        string `json:"owner"`
+	Cells        []cell `json:"cells"`
+	Channel      string `json:"channel"`
+	Endpoint     string `json:"endpoint"`
+	Secret       string `json:"secret"`
+	Created      int64  `json:"created"`
+	WindowStart  int64  `json:"window_start"`
+	WindowAlerts int    `json:"window_alerts"`
+}
+
+type cell struct {
+	Lat int `json:"lat"`
+	Lon int `json:"lon"`
+}
+
+var (
+	saveSubscriptionQuery = `
+CREATE type::thing("subscription", $id) CONTENT $subscription
+`
+	hasSubscriptionQuery = `
+SELECT * FROM type::thing("subscription", $id)
+`
+	userSubscriptionsQuery = `
+SELECT * FROM subscription WHERE owner = $owner ORDER BY created
+`
+	cellSubscriptionsQuery = `
+SELECT * FROM subscription WHERE cells CONTAINS $cell ORDER BY created
+`
+	deleteSubscriptionQuery = `
+DELETE type::thing("subscription", $id) WHERE owner = $owner RETURN BEFORE
+`
+	// takeAlertQuery sets the alerts before the window start, so both see the window start
+	// before the update.
+	takeAlertQuery = `
+UPDATE type::thing("subscription", $id)
+SET
+	window_alerts = IF window_start <= $ended THEN 1 ELSE window_alerts + 1 END,
+	window_start = IF window_start <= $ended THEN $now ELSE window_start END
+WHERE
+	window_start <= $ended OR window_alerts < $limit
+RETURN AFTER
+`
+	returnAlertQuery = `
+UPDATE type::thing("subscription", $id)
+SET window_alerts = window_alerts - 1
+WHERE window_start <= $taken AND window_alerts > 0
+`
+)
+
+func (db *Database) SaveSubscription(ctx context.Context, sub *database.Subscription) error {
+	ctx, span := db.tracer.Start(ctx, "SaveSubscription")
+	defer span.End()
+
+	if subs, err := db.querySubscriptions(ctx, hasSubscriptionQuery, map[string]any{"id": sub.ID}); err != nil {
+		return fmt.Errorf("unable to check does the subscription exist: %w", err)
+	} else if len(subs) > 0 {
+		return database.ErrAlreadyExists
+	}
+
+	record := &subscription{
+		ID:       sub.ID,
+		Owner:    sub.Owner,
+		Cells:    make([]cell, 0, len(sub.Cells)),
+		Channel:  sub.Channel,
+		Endpoint: sub.Endpoint,
+		Secret:   sub.Secret,
+		Created:  sub.Created.Unix(),
+	}
+	for _, c := range sub.Cells {
+		record.Cells = append(record.Cells, cell{Lat: c.Lat, Lon: c.Lon})
+	}
+
+	if _, err := db.db.Query(saveSubscriptionQuery, map[string]any{
+		"id":           sub.ID,
+		"subscription": record,
+	}); err != nil {
+		return fmt.Errorf("unable to create subscription: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) UserSubscriptions(ctx context.Context, owner string) ([]*database.Subscription, error) {
+	subs, err := db.querySubscriptions(ctx, userSubscriptionsQuery, map[string]any{"owner": owner})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list user subscriptions: %w", err)
+	}
+
+	result := make([]*database.Subscription, 0, len(subs))
+	for _, s := range subs {
+		sub := s.subscription()
+		for _, c := range s.Cells {
+			sub.Cells = append(sub.Cells, database.Cell{Lat: c.Lat, Lon: c.Lon})
+		}
+		result = append(result, sub)
+	}
+	return result, nil
+}
+
+func (db *Database) CellSubscriptions(ctx context.Context, c database.Cell) ([]*database.Subscription, error) {
+	subs, err := db.querySubscriptions(ctx, cellSubscriptionsQuery, map[string]any{
+		"cell": cell{Lat: c.Lat, Lon: c.Lon},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list cell subscriptions: %w", err)
+	}
+
+	result := make([]*database.Subscription, 0, len(subs))
+	for _, s := range subs {
+		result = append(result, s.subscription())
+	}
+	return result, nil
+}
+
+func (db *Database) DeleteSubscription(ctx context.Context, id, owner string) error {
+	deleted, err := db.querySubscriptions(ctx, deleteSubscriptionQuery, map[string]any{
+		"id":    id,
+		"owner": owner,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete subscription: %w", err)
+	}
+	if len(deleted) == 0 {
+		return database.ErrDoesNotExist
+	}
+	return nil
+}
+
+func (db *Database) TakeAlert(
+	ctx context.Context, id string, now time.Time, limit int, window time.Duration,
+) (bool, error) {
+	taken, err := db.querySubscriptions(ctx, takeAlertQuery, map[string]any{
+		"id":    id,
+		"now":   now.Unix(),
+		"ended": now.Add(-window).Unix(),
+		"limit": limit,
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to take alert: %w", err)
+	}
+	if len(taken) > 0 {
+		return true, nil
+	}
+
+	// Find out whether the subscription is over its limit, or doesn't exist.
+	subs, err := db.querySubscriptions(ctx, hasSubscriptionQuery, map[string]any{"id": id})
+	if err != nil {
+		return false, fmt.Errorf("unable to get subscription: %w", err)
+	}
+	if len(subs) == 0 {
+		return false, database.ErrDoesNotExist
+	}
+	return false, nil
+}
+
+func (db *Database) ReturnAlert(ctx context.Context, id string, taken time.Time) error {
+	if _, err := db.querySubscriptions(ctx, returnAlertQuery, map[string]any{
+		"id":    id,
+		"taken": taken.Unix(),
+	}); err != nil {
+		return fmt.Errorf("unable to return alert: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) querySubscriptions(
+	ctx context.Context, query string, vars map[string]any,
+) ([]*subscription, error) {
+	_, span := db.tracer.Start(ctx, "querySubscriptions")
+	defer span.End()
+
+	results, err := db.db.Query(query, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	subs, err := surrealdb.SmartUnmarshal[[]*subscription](results, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// subscription returns the subscription without its cells.
+func (s *subscription) subscription() *database.Subscription {
+	return &database.Subscription{
+		ID:       s.ID,
+		Owner:    s.Owner,
+		Channel:  s.Channel,
+		Endpoint: s.Endpoint,
+		Secret:   s.Secret,
+		Created:  time.Unix(s.Created, 0),
+	}
+}
@@ -2,16 +2,17 @@ package surreal
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/surrealdb/surrealdb.go"
 	"go.opentelemetry.io/otel/trace"
-	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"api.safer.place/incident/v1"
 	"api.safer.place/viewer/v1"
@@ -60,9 +61,28 @@ func New(cfg *Config, opts ...Option) (*Database, error) {
 		return nil, fmt.Errorf("unable to use namespace/database: %w", err)
 	}
 
+	results, err := db.db.Query(defineTablesQuery, map[string]any{})
+	if err == nil {
+		_, err = lastResult[any](results)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to define tables: %w", err)
+	}
+
 	return db, nil
 }
 
+// defineTablesQuery defines the tables which don't use the default permissions. The incident
+// history is the audit log of the reviews, so the records can be created and read, but never
+// changed or deleted. The permissions apply to every user except the root, namespace and database
+// users.
+var defineTablesQuery = `
+DEFINE TABLE incident_history SCHEMALESS
+	PERMISSIONS
+		FOR select, create FULL
+		FOR update, delete NONE;
+`
+
 func (db *Database) SaveIncident(ctx context.Context, inc *incident.Incident) error {
 	ctx, span := db.tracer.Start(ctx, "SaveIncident")
 	defer span.End()
@@ -74,6 +94,10 @@ func (db *Database) SaveIncident(ctx context.Context, inc *incident.Incident) er
 	}
 
 	if _, err := db.db.Create("incident", inc); err != nil {
+		// The incident could have been created since it was checked.
+		if exists, existsErr := db.hasIncident(ctx, inc.Id); existsErr == nil && exists {
+			return database.ErrAlreadyExists
+		}
 		return fmt.Errorf("unable to create incident: %w", err)
 	}
 
@@ -82,40 +106,156 @@ func (db *Database) SaveIncident(ctx context.Context, inc *incident.Incident) er
 	return nil
 }
 
+// saveReviewQuery updates the resolution only if it hasn't changed since it was read, and records
+// the transition in the same transaction. The unspecified resolution is omitted from the records,
+// so it is compared as 0. It returns the updated incident, if any.
+var saveReviewQuery = `
+BEGIN TRANSACTION;
+LET $updated = (
+	UPDATE type::thing("incident", $id)
+	SET
+		resolution = $to,
+		reviewer_comments = array::append(reviewer_comments ?? [], $comment)
+	WHERE
+		(resolution ?? 0) = $from
+	RETURN AFTER
+);
+IF array::len($updated) > 0 {
+	CREATE incident_history CONTENT $transition;
+};
+RETURN $updated;
+COMMIT TRANSACTION;
+`
+
 func (db *Database) SaveReview(
 	ctx context.Context,
 	id string,
-	res incident.Resolution,
+	from, to incident.Resolution,
 	comment *incident.Comment,
 ) error {
 	ctx, span := db.tracer.Start(ctx, "SaveReview")
 	defer span.End()
 
-	if exists, err := db.hasIncident(ctx, id); err != nil {
-		return fmt.Errorf("unable to check does the incident exist: %w", err)
-	} else if !exists {
-		return database.ErrDoesNotExist
+	results, err := db.db.Query(saveReviewQuery, map[string]any{
+		"id":      id,
+		"from":    from,
+		"to":      to,
+		"comment": comment,
+		"transition": &transition{
+			IncidentID: id,
+			Actor:      comment.AuthorId,
+			From:       from.String(),
+			To:         to.String(),
+			Reason:     comment.Message,
+			Timestamp:  comment.Timestamp,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to update incident with comment: %w", err)
 	}
-
-	incData, err := db.db.Select("incident:" + id)
+	updated, err := lastResult[[]*incident.Incident](results)
 	if err != nil {
-		return fmt.Errorf("unable to get incident data: %w", err)
+		return fmt.Errorf("unable to update incident with comment: %w", err)
 	}
-	inc := new(incident.Incident)
-	if err := surrealdb.Unmarshal(incData, inc); err != nil {
-		return fmt.Errorf("unable to unmarshal incident: %w", err)
+
+	// Nothing was updated either because the incident doesn't exist, or because someone else
+	// changed the resolution first.
+	if len(updated) == 0 {
+		if exists, err := db.hasIncident(ctx, id); err != nil {
+			return fmt.Errorf("unable to check does the incident exist: %w", err)
+		} else if !exists {
+			return database.ErrDoesNotExist
+		}
+		return database.ErrConflict
 	}
 
-	inc.Resolution = res
-	inc.ReviewerComments = append(inc.ReviewerComments, comment)
+	return nil
+}
 
-	if _, err := db.db.Update(inc.Id, inc); err != nil {
-		return fmt.Errorf("unable to update incident with comment: %w", err)
+// lastResult unmarshals the result of the last statement of the query, such as the RETURN of a
+// transaction. The query fails if any of its statements did, as the transaction was cancelled.
+func lastResult[T any](results any) (res T, err error) {
+	b, err := json.Marshal(results)
+	if err != nil {
+		return res, fmt.Errorf("unable to marshal results: %w", err)
+	}
+	var raw []surrealdb.RawQuery[json.RawMessage]
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return res, fmt.Errorf("unable to unmarshal results: %w", err)
+	}
+	if len(raw) == 0 {
+		return res, errors.New("no results")
+	}
+	for _, r := range raw {
+		if r.Status != "OK" {
+			return res, fmt.Errorf("%s: %s", r.Status, r.Detail)
+		}
+	}
+	if err := json.Unmarshal(raw[len(raw)-1].Result, &res); err != nil {
+		return res, fmt.Errorf("unable to unmarshal result: %w", err)
 	}
+	return res, nil
+}
+
+func (db *Database) SaveTransition(ctx context.Context, t *database.Transition) error {
+	_, span := db.tracer.Start(ctx, "SaveTransition")
+	defer span.End()
 
+	if _, err := db.db.Create("incident_history", &transition{
+		IncidentID: t.IncidentID,
+		Actor:      t.Actor,
+		From:       t.From.String(),
+		To:         t.To.String(),
+		Reason:     t.Reason,
+		Timestamp:  t.Timestamp.Unix(),
+	}); err != nil {
+		return fmt.Errorf("unable to save transition: %w", err)
+	}
 	return nil
 }
 
+type transition struct {
+	IncidentID string `json:"incident_id"`
+	Actor      string `json:"actor"`
+	From       string `json:"old_resolution"`
+	To         string `json:"new_resolution"`
+	Reason     string `json:"reason"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+var incidentHistoryQuery = `
+SELECT * FROM incident_history WHERE incident_id = $id ORDER BY timestamp
+`
+
+func (db *Database) IncidentHistory(ctx context.Context, id string) ([]*database.Transition, error) {
+	_, span := db.tracer.Start(ctx, "IncidentHistory")
+	defer span.End()
+
+	results, err := db.db.Query(incidentHistoryQuery, map[string]any{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query incident history: %w", err)
+	}
+
+	transitions, err := surrealdb.SmartUnmarshal[[]*transition](results, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal incident history: %w", err)
+	}
+
+	history := make([]*database.Transition, 0, len(transitions))
+	for _, t := range transitions {
+		history = append(history, &database.Transition{
+			IncidentID: t.IncidentID,
+			Actor:      t.Actor,
+			From:       incident.Resolution(incident.Resolution_value[t.From]),
+			To:         incident.Resolution(incident.Resolution_value[t.To]),
+			Reason:     t.Reason,
+			Timestamp:  time.Unix(t.Timestamp, 0),
+		})
+	}
+
+	return history, nil
+}
+
 func (db *Database) ViewIncident(ctx context.Context, id string) (*incident.Incident, error) {
 	_, span := db.tracer.Start(ctx, "ViewIncident")
 	defer span.End()
@@ -138,8 +278,37 @@ func (db *Database) ViewIncident(ctx context.Context, id string) (*incident.Inci
 	return inc, nil
 }
 
+var imageIncidentsQuery = `
+SELECT * FROM incident WHERE image_id = $image_id
+`
+
+func (db *Database) ImageIncidents(ctx context.Context, imageID string) ([]*incident.Incident, error) {
+	_, span := db.tracer.Start(ctx, "ImageIncidents")
+	defer span.End()
+
+	// The incidents reported without an image don't have the image_id.
+	if imageID == "" {
+		return nil, nil
+	}
+
+	results, err := db.db.Query(imageIncidentsQuery, map[string]any{"image_id": imageID})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query for the image incidents: %w", err)
+	}
+
+	incs, err := surrealdb.SmartUnmarshal[[]*incident.Incident](results, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal incidents: %w", err)
+	}
+	for _, inc := range incs {
+		inc.Id = strings.TrimPrefix(inc.Id, "incident:")
+		inc.ReviewerComments = nil
+	}
+	return incs, nil
+}
+
 var incidentsWithoutReviewQuery = `
-SELECT * FROM incident WHERE resolution = nil
+SELECT * FROM incident WHERE (resolution ?? 0) = 0
 `
 
 func (db *Database) IncidentsWithoutReview(ctx context.Context) ([]*incident.Incident, error) {
@@ -162,7 +331,9 @@ var incidentsInRegionQuery = `
 SELECT *
 FROM incident
 WHERE
-	array::matches($resolutions, resolution)
+	resolution IN $resolutions
+AND
+	timestamp.seconds > $since
 AND
 	coordinates.lat < $north
 AND
@@ -179,14 +350,12 @@ func (db *Database) IncidentsInRegion(
 	_, span := db.tracer.Start(ctx, "IncidentsInRegion")
 	defer span.End()
 
-	fmt.Println(incidentsInRegionQuery)
-
 	results, err := db.db.Query(incidentsInRegionQuery, map[string]any{
 		"resolutions": []incident.Resolution{
 			incident.Resolution_RESOLUTION_ACCEPTED,
 			incident.Resolution_RESOLUTION_ALERTED,
 		},
-		"since": timestamppb.New(since), // for type compat
+		"since": since.Unix(),
 		"north": region.North / 100,
 		"south": region.South / 100,
 		"west":  region.West / 100,
@@ -203,7 +372,6 @@ func (db *Database) IncidentsInRegion(
 	return incs, err
 }
 
-// TODO: Change the query so it uses different resolutions.
 func (db *Database) AlertingIncidents(
 	ctx context.Context, since time.Time, region *viewer.Region,
 ) ([]*incident.Incident, error) {
@@ -212,7 +380,7 @@ func (db *Database) AlertingIncidents(
 
 	results, err := db.db.Query(incidentsInRegionQuery, map[string]any{
 		"resolutions": []incident.Resolution{incident.Resolution_RESOLUTION_ALERTED},
-		"since":       timestamppb.New(since), // for type compat
+		"since":       since.Unix(),
 		"north":       region.North / 100,
 		"south":       region.South / 100,
 		"west":        region.West / 100,
@@ -229,12 +397,75 @@ func (db *Database) AlertingIncidents(
 	return incs, err
 }
 
-func (db *Database) SaveSession(_ context.Context, _ string) error {
-	return errors.New("unsupported")
+var reviewedIncidentsQuery = `
+SELECT incident_id, math::max(timestamp) AS reviewed
+FROM incident_history
+WHERE
+	new_resolution IN $resolutions
+AND
+	new_resolution != old_resolution
+AND
+	timestamp >= $since
+GROUP BY incident_id
+`
+
+type review struct {
+	IncidentID string `json:"incident_id"`
+	Reviewed   int64  `json:"reviewed"`
 }
 
-func (db *Database) IsValidSession(_ context.Context, _ string) error {
-	return errors.New("unsupported")
+func (db *Database) ReviewedIncidents(
+	ctx context.Context, since time.Time, region *viewer.Region,
+) ([]*database.ReviewedIncident, error) {
+	ctx, span := db.tracer.Start(ctx, "ReviewedIncidents")
+	defer span.End()
+
+	results, err := db.db.Query(reviewedIncidentsQuery, map[string]any{
+		"resolutions": []string{
+			incident.Resolution_RESOLUTION_ACCEPTED.String(),
+			incident.Resolution_RESOLUTION_ALERTED.String(),
+		},
+		"since": since.Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query for reviewed incidents: %w", err)
+	}
+	reviews, err := surrealdb.SmartUnmarshal[[]*review](results, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal reviews: %w", err)
+	}
+
+	// Only a few incidents are reviewed since the feed was last read, so they are filtered
+	// here instead of joining them in the query.
+	incidents := make([]*database.ReviewedIncident, 0)
+	for _, r := range reviews {
+		inc, err := db.ViewIncident(ctx, r.IncidentID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get reviewed incident: %w", err)
+		}
+		if inc.Resolution != incident.Resolution_RESOLUTION_ACCEPTED &&
+			inc.Resolution != incident.Resolution_RESOLUTION_ALERTED {
+			continue
+		}
+		if c := inc.Coordinates; c == nil ||
+			c.Lat >= region.North/100 || c.Lat <= region.South/100 ||
+			c.Lon <= region.West/100 || c.Lon >= region.East/100 {
+			continue
+		}
+		inc.ReviewerComments = nil
+		incidents = append(incidents, &database.ReviewedIncident{
+			Incident: inc,
+			Reviewed: time.Unix(r.Reviewed, 0),
+		})
+	}
+
+	slices.SortFunc(incidents, func(a, b *database.ReviewedIncident) int {
+		if c := a.Reviewed.Compare(b.Reviewed); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Incident.Id, b.Incident.Id)
+	})
+	return incidents, nil
 }
 
 func (db *Database) hasIncident(ctx context.Context, id string) (bool, error) {
@@ -0,0 +1,55 @@
+package surreal
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/config/secret"
+	"safer.place/internal/database"
+	"safer.place/internal/database/databasetest"
+	"safer.place/internal/log"
+)
+
+// The tests run against the SurrealDB at SAFERPLACE_TEST_SURREAL_ENDPOINT, signing in with
+// SAFERPLACE_TEST_SURREAL_USERNAME and SAFERPLACE_TEST_SURREAL_PASSWORD. Each test uses its own
+// database, which is removed afterwards.
+func newTestDatabase(t *testing.T) *Database {
+	endpoint := os.Getenv("SAFERPLACE_TEST_SURREAL_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("SAFERPLACE_TEST_SURREAL_ENDPOINT is not set")
+	}
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	db, err := New(&Config{
+		Endpoint:  endpoint,
+		Namespace: "saferplace_test",
+		Database:  name,
+		Username:  os.Getenv("SAFERPLACE_TEST_SURREAL_USERNAME"),
+		Password:  secret.Secret(os.Getenv("SAFERPLACE_TEST_SURREAL_PASSWORD")),
+	},
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+	)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.db.Query("REMOVE DATABASE "+name, map[string]any{}); err != nil {
+			t.Errorf("unable to remove the test database: %v", err)
+		}
+		db.db.Close()
+	})
+
+	return db
+}
+
+func TestConformance(t *testing.T) {
+	databasetest.Run(t, func(t *testing.T) database.Database {
+		return newTestDatabase(t)
+	})
+}
@@ -0,0 +1,153 @@
+package surreal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/surrealdb/surrealdb.go"
+
+	"safer.place/internal/database"
+)
+
+type upload struct {
+	Image    string `json:"image"`
+	Owner    string `json:"owner"`
+	Incident string `json:"incident,omitempty"`
+	Uploaded int64  `json:"uploaded"`
+}
+
+// Each upload is identified by the image and the owner, so uploading the same image again
+// doesn't create a second record.
+var (
+	saveUploadQuery = `
+UPDATE type::thing("upload", [$image, $owner]) MERGE { image: $image, owner: $owner, uploaded: $uploaded }
+`
+	attachUploadQuery = `
+UPDATE upload SET incident = $incident
+WHERE image = $image AND owner = $owner AND (incident = NONE OR incident = $incident)
+RETURN AFTER
+`
+	detachUploadQuery = `
+UPDATE upload SET incident = NONE
+WHERE image = $image AND owner = $owner AND incident = $incident
+`
+	uploadQuery = `
+SELECT * FROM type::thing("upload", [$image, $owner])
+`
+	uploadTimesQuery = `
+SELECT image, math::max(uploaded) AS uploaded FROM upload GROUP BY image
+`
+	deleteUploadQuery = `
+DELETE upload WHERE image = $image
+`
+)
+
+func (db *Database) SaveUpload(ctx context.Context, imageID, owner string, uploaded time.Time) error {
+	_, span := db.tracer.Start(ctx, "SaveUpload")
+	defer span.End()
+
+	if _, err := db.db.Query(saveUploadQuery, map[string]any{
+		"image":    imageID,
+		"owner":    owner,
+		"uploaded": uploaded.Unix(),
+	}); err != nil {
+		return fmt.Errorf("unable to save upload: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) AttachUpload(ctx context.Context, imageID, owner, incidentID string) error {
+	_, span := db.tracer.Start(ctx, "AttachUpload")
+	defer span.End()
+
+	vars := map[string]any{
+		"image":    imageID,
+		"owner":    owner,
+		"incident": incidentID,
+	}
+	attached, err := db.queryUploads(ctx, attachUploadQuery, vars)
+	if err != nil {
+		return fmt.Errorf("unable to attach upload: %w", err)
+	}
+	if len(attached) > 0 {
+		return nil
+	}
+
+	// Find out why the upload wasn't attached.
+	uploads, err := db.queryUploads(ctx, uploadQuery, vars)
+	if err != nil {
+		return fmt.Errorf("unable to get upload: %w", err)
+	}
+	if len(uploads) == 0 {
+		return database.ErrDoesNotExist
+	}
+	return database.ErrConflict
+}
+
+func (db *Database) DetachUpload(ctx context.Context, imageID, owner, incidentID string) error {
+	_, span := db.tracer.Start(ctx, "DetachUpload")
+	defer span.End()
+
+	if _, err := db.db.Query(detachUploadQuery, map[string]any{
+		"image":    imageID,
+		"owner":    owner,
+		"incident": incidentID,
+	}); err != nil {
+		return fmt.Errorf("unable to detach upload: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) OrphanUploads(ctx context.Context, before time.Time) ([]string, error) {
+	_, span := db.tracer.Start(ctx, "OrphanUploads")
+	defer span.End()
+
+	uploads, err := db.queryUploads(ctx, uploadTimesQuery, map[string]any{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list uploads: %w", err)
+	}
+
+	var images []string
+	for _, u := range uploads {
+		if u.Uploaded >= before.Unix() {
+			continue
+		}
+		// The images which were attached to an incident are checked too, as the incident might
+		// have failed to be saved.
+		incs, err := db.ImageIncidents(ctx, u.Image)
+		if err != nil {
+			return nil, err
+		}
+		if len(incs) == 0 {
+			images = append(images, u.Image)
+		}
+	}
+	return images, nil
+}
+
+func (db *Database) DeleteUpload(ctx context.Context, imageID string) error {
+	_, span := db.tracer.Start(ctx, "DeleteUpload")
+	defer span.End()
+
+	if _, err := db.db.Query(deleteUploadQuery, map[string]any{"image": imageID}); err != nil {
+		return fmt.Errorf("unable to delete upload: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) queryUploads(ctx context.Context, query string, vars map[string]any) ([]*upload, error) {
+	_, span := db.tracer.Start(ctx, "queryUploads")
+	defer span.End()
+
+	results, err := db.db.Query(query, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads, err := surrealdb.SmartUnmarshal[[]*upload](results, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal uploads: %w", err)
+	}
+	return uploads, nil
+}
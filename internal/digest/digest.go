@@ -0,0 +1,258 @@
+// Package digest notifies the reviewers about the incidents waiting for review in batches, so
+// they get a single summary instead of a notification about each incident.
+package digest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"api.safer.place/incident/v1"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/notifier"
+	"safer.place/internal/notifier/multinotifier"
+)
+
+// Config of the digest.
+type Config struct {
+	// Enabled stops the consumer notifying about each incident, leaving all but the urgent ones
+	// to the digest.
+	Enabled bool `yaml:"enabled"`
+	// Window is the longest an incident waits for the digest.
+	Window time.Duration `yaml:"window" default:"15m"`
+	// MaxIncidents sends the digest as soon as this many incidents are waiting for it, without
+	// waiting for the window. Zero only sends it after the window.
+	MaxIncidents int `yaml:"max_incidents" split_words:"true" default:"20"`
+	// PollInterval between the checks for new incidents.
+	PollInterval time.Duration `yaml:"poll_interval" split_words:"true" default:"1m"`
+	// Immediate is the lowest severity of the incidents the reviewers are notified about
+	// immediately.
+	Immediate Severity `yaml:"immediate" default:"high"`
+	// Rules giving the incidents their severity, which is the highest level of the rules
+	// matching them, and low if none do.
+	Rules []Rule `yaml:"rules" ignored:"true"`
+}
+
+// Rule gives the incidents matching the filter the severity level.
+type Rule struct {
+	Level  Severity             `yaml:"level"`
+	Filter multinotifier.Filter `yaml:"filter"`
+}
+
+// Severity of the incident according to the rules.
+func (c *Config) Severity(i *incident.Incident) Severity {
+	severity := Low
+	for _, r := range c.Rules {
+		if r.Level > severity && r.Filter.Match(i) {
+			severity = r.Level
+		}
+	}
+	return severity
+}
+
+// Urgent returns whether the reviewers are notified about the incident immediately, instead of
+// in the digest.
+func (c *Config) Urgent(i *incident.Incident) bool {
+	return c.Severity(i) >= c.Immediate
+}
+
+// Validate checks the severity rules.
+func (c *Config) Validate() error {
+	for _, r := range c.Rules {
+		if r.Level < Low || r.Level > Critical {
+			return fmt.Errorf("%w: %d", errUnknownSeverity, r.Level)
+		}
+		if err := r.Filter.Validate(); err != nil {
+			return fmt.Errorf("invalid filter of %s severity: %w", r.Level, err)
+		}
+	}
+	return nil
+}
+
+// Digest periodically sends a summary of the new incidents waiting for review.
+type Digest struct {
+	cfg      Config
+	db       database.Digests
+	notifier notifier.Notifier
+	log      log.Logger
+	tracer   trace.Tracer
+	// now is replaced in the tests.
+	now func() time.Time
+
+	// pending are the incidents waiting for the digest, with when they were first seen. The
+	// incidents sent in a digest are recorded in the database instead, so they are sent once.
+	pending map[string]time.Time
+}
+
+// New creates a new digest.
+func New(cfg Config, opts ...Option) (*Digest, error) {
+	d := &Digest{
+		cfg:     cfg,
+		now:     time.Now,
+		pending: make(map[string]time.Time),
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d, validate(d)
+}
+
+// Run the digest until the context is cancelled. The incidents sent by any digest, including the
+// digests of the other processes and before a restart, are not sent again.
+func (d *Digest) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if sent, err := d.Poll(ctx); err != nil {
+			d.log.Error(ctx, "unable to send digest", log.Error(err))
+		} else if sent > 0 {
+			d.log.Info(ctx, "sent digest", slog.Int("incidents", sent))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll checks for new incidents waiting for review, and sends the digest of them once the oldest
+// one has waited for the window or there are enough of them. It returns how many incidents the
+// digest had, or zero if it wasn't sent. The incidents are kept for the next poll if the digest
+// fails to be sent. Each incident is taken for the digest before it is sent, so the digests of the
+// other processes leave it out, and the incidents taken by a digest which stopped before sending
+// them are never sent.
+func (d *Digest) Poll(ctx context.Context) (sent int, err error) {
+	ctx, span := d.tracer.Start(ctx, "Poll")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	incidents, err := d.db.IncidentsToDigest(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unable to list incidents to digest: %w", err)
+	}
+
+	now := d.now()
+	waiting := make(map[string]struct{}, len(incidents))
+	for _, i := range incidents {
+		// The consumer has notified about the urgent incidents already.
+		if d.cfg.Urgent(i) {
+			continue
+		}
+		waiting[i.Id] = struct{}{}
+		if _, ok := d.pending[i.Id]; !ok {
+			d.pending[i.Id] = now
+		}
+	}
+
+	// Forget the incidents reviewed or sent by another digest in the meantime.
+	for id := range d.pending {
+		if _, ok := waiting[id]; !ok {
+			delete(d.pending, id)
+		}
+	}
+
+	if !d.due(now) {
+		return 0, nil
+	}
+
+	batch := make([]*incident.Incident, 0, len(d.pending))
+	for _, i := range incidents {
+		if _, ok := d.pending[i.Id]; !ok {
+			continue
+		}
+		taken, err := d.db.TakeDigest(ctx, i.Id, now)
+		if err != nil {
+			d.returnDigest(ctx, batch, now)
+			return 0, fmt.Errorf("unable to take incident %s for the digest: %w", i.Id, err)
+		}
+		if !taken {
+			delete(d.pending, i.Id)
+			continue
+		}
+		batch = append(batch, i)
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := notifier.NotifyDigest(ctx, d.notifier, batch); err != nil {
+		d.returnDigest(ctx, batch, now)
+		return 0, fmt.Errorf("unable to notify about %d incidents: %w", len(batch), err)
+	}
+
+	for _, i := range batch {
+		delete(d.pending, i.Id)
+	}
+	return len(batch), nil
+}
+
+// returnDigest gives back the incidents taken at the time which were not sent, so they are sent
+// in the next digest.
+func (d *Digest) returnDigest(ctx context.Context, batch []*incident.Incident, taken time.Time) {
+	for _, i := range batch {
+		if err := d.db.ReturnDigest(ctx, i.Id, taken); err != nil {
+			d.log.Warn(ctx, "unable to return incident to the digest",
+				slog.String("id", i.Id),
+				log.Error(err),
+			)
+		}
+	}
+}
+
+// due returns whether the digest of the pending incidents should be sent.
+func (d *Digest) due(now time.Time) bool {
+	if len(d.pending) == 0 {
+		return false
+	}
+	if d.cfg.MaxIncidents > 0 && len(d.pending) >= d.cfg.MaxIncidents {
+		return true
+	}
+	for _, seen := range d.pending {
+		if now.Sub(seen) >= d.cfg.Window {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	errMissingDatabase     = errors.New("missing database")
+	errMissingNotifier     = errors.New("missing notifier")
+	errMissingLogger       = errors.New("missing logger")
+	errMissingTracer       = errors.New("missing tracer")
+	errInvalidPollInterval = errors.New("poll interval must be positive")
+)
+
+func validate(d *Digest) error {
+	if d.db == nil {
+		return errMissingDatabase
+	}
+	if d.notifier == nil {
+		return errMissingNotifier
+	}
+	if d.log == nil {
+		return errMissingLogger
+	}
+	if d.tracer == nil {
+		return errMissingTracer
+	}
+	if d.cfg.PollInterval <= 0 {
+		return errInvalidPollInterval
+	}
+	return d.cfg.Validate()
+}
@@ -0,0 +1,272 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/notifier/multinotifier"
+)
+
+// fakeDatabase has the incidents waiting for review, and when they were taken for a digest.
+type fakeDatabase struct {
+	database.Digests
+	waiting []*incident.Incident
+	taken   map[string]time.Time
+}
+
+func (db *fakeDatabase) IncidentsToDigest(context.Context) ([]*incident.Incident, error) {
+	var incidents []*incident.Incident
+	for _, i := range db.waiting {
+		if _, ok := db.taken[i.Id]; !ok {
+			incidents = append(incidents, i)
+		}
+	}
+	return incidents, nil
+}
+
+func (db *fakeDatabase) TakeDigest(_ context.Context, id string, now time.Time) (bool, error) {
+	if _, ok := db.taken[id]; ok {
+		return false, nil
+	}
+	if db.taken == nil {
+		db.taken = make(map[string]time.Time)
+	}
+	db.taken[id] = now
+	return true, nil
+}
+
+func (db *fakeDatabase) ReturnDigest(_ context.Context, id string, taken time.Time) error {
+	if db.taken[id].Equal(taken) {
+		delete(db.taken, id)
+	}
+	return nil
+}
+
+// fakeNotifier records the digests, failing while it's broken.
+type fakeNotifier struct {
+	broken  bool
+	digests []string
+}
+
+func (n *fakeNotifier) Notify(context.Context, *incident.Incident) error {
+	return errors.New("notified about a single incident")
+}
+
+func (n *fakeNotifier) NotifyDigest(_ context.Context, incidents []*incident.Incident) error {
+	if n.broken {
+		return errors.New("digest failed")
+	}
+	ids := make([]string, 0, len(incidents))
+	for _, i := range incidents {
+		ids = append(ids, i.Id)
+	}
+	n.digests = append(n.digests, strings.Join(ids, ","))
+	return nil
+}
+
+func newDigest(t *testing.T, cfg Config, db *fakeDatabase, n *fakeNotifier) (*Digest, *time.Time) {
+	t.Helper()
+
+	d, err := New(cfg,
+		Database(db),
+		Notifier(n),
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 1, 2, 20, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	return d, &now
+}
+
+func TestPoll(t *testing.T) {
+	db := &fakeDatabase{}
+	n := &fakeNotifier{}
+	d, now := newDigest(t, Config{
+		Window:       15 * time.Minute,
+		MaxIncidents: 3,
+		PollInterval: time.Minute,
+		Immediate:    High,
+		Rules: []Rule{{
+			Level:  High,
+			Filter: multinotifier.Filter{Keywords: []string{"weapon"}},
+		}},
+	}, db, n)
+
+	steps := []struct {
+		after   time.Duration
+		waiting []string
+		// elsewhere is taken by the digest of another process.
+		elsewhere string
+		broken    bool
+		err       bool
+		sent      int
+	}{
+		// The urgent incident was notified about already, so it's never in the digest.
+		{waiting: []string{"first", "urgent"}},
+		{after: 10 * time.Minute, waiting: []string{"first", "urgent", "second"}},
+		// The first incident has waited for the window.
+		{after: 5 * time.Minute, waiting: []string{"first", "urgent", "second"}, sent: 2},
+		// The incidents which were sent are not sent again, even if they're still waiting.
+		{after: 20 * time.Minute, waiting: []string{"first", "urgent", "second", "third"}},
+		// The digest which fails is sent on the next poll.
+		{after: 15 * time.Minute, waiting: []string{"first", "third"}, broken: true, err: true},
+		{after: time.Minute, waiting: []string{"first", "third"}, sent: 1},
+		// The digest is sent once enough incidents are waiting for it.
+		{waiting: []string{"fourth", "fifth", "sixth"}, sent: 3},
+		// The incidents which were reviewed before the digest are left out.
+		{waiting: []string{"seventh"}},
+		{after: 15 * time.Minute, waiting: []string{"eighth"}},
+		{after: 15 * time.Minute, waiting: []string{"eighth"}, sent: 1},
+		// The incidents taken by the digest of another process are left out.
+		{waiting: []string{"ninth", "tenth"}},
+		{after: 15 * time.Minute, waiting: []string{"ninth", "tenth"}, elsewhere: "ninth", sent: 1},
+	}
+
+	for i, step := range steps {
+		*now = now.Add(step.after)
+		db.waiting = nil
+		for _, id := range step.waiting {
+			description := "Parked on the footpath"
+			if id == "urgent" {
+				description = "Threatened with a weapon"
+			}
+			db.waiting = append(db.waiting, &incident.Incident{Id: id, Description: description})
+		}
+		n.broken = step.broken
+		if step.elsewhere != "" {
+			db.TakeDigest(context.Background(), step.elsewhere, *now)
+		}
+
+		sent, err := d.Poll(context.Background())
+		if (err != nil) != step.err || sent != step.sent {
+			t.Errorf("step %d: Poll() = %d, %v, want %d and error %v", i, sent, err, step.sent, step.err)
+		}
+	}
+
+	want := []string{"first,second", "third", "fourth,fifth,sixth", "eighth", "tenth"}
+	if strings.Join(n.digests, " ") != strings.Join(want, " ") {
+		t.Errorf("digests = %q, want %q", n.digests, want)
+	}
+
+	// The digest started again doesn't send the incidents which were sent already.
+	restarted, now := newDigest(t, Config{Window: 15 * time.Minute, PollInterval: time.Minute}, db, n)
+	*now = now.Add(time.Hour)
+	if sent, err := restarted.Poll(context.Background()); err != nil || sent != 0 {
+		t.Errorf("Poll() after restarting = %d, %v, want nothing sent", sent, err)
+	}
+	*now = now.Add(15 * time.Minute)
+	if sent, err := restarted.Poll(context.Background()); err != nil || sent != 0 {
+		t.Errorf("Poll() after restarting = %d, %v, want nothing sent", sent, err)
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	yes := true
+	cfg := Config{
+		Immediate: High,
+		Rules: []Rule{
+			{Level: Medium, Filter: multinotifier.Filter{Image: &yes}},
+			{Level: Critical, Filter: multinotifier.Filter{Keywords: []string{"weapon"}}},
+			{Level: High, Filter: multinotifier.Filter{Locations: []string{"transportation"}}},
+		},
+	}
+
+	testCases := map[string]struct {
+		inc    *incident.Incident
+		want   Severity
+		urgent bool
+	}{
+		"no rule": {
+			inc:  &incident.Incident{},
+			want: Low,
+		},
+		"medium": {
+			inc:  &incident.Incident{ImageId: "image"},
+			want: Medium,
+		},
+		"highest rule": {
+			inc: &incident.Incident{
+				ImageId:     "image",
+				Location:    incident.Location_LOCATION_TRANSPORTATION,
+				Description: "Threatened with a weapon",
+			},
+			want:   Critical,
+			urgent: true,
+		},
+		"threshold": {
+			inc:    &incident.Incident{Location: incident.Location_LOCATION_TRANSPORTATION},
+			want:   High,
+			urgent: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := cfg.Severity(tc.inc); got != tc.want {
+				t.Errorf("Severity() = %s, want %s", got, tc.want)
+			}
+			if got := cfg.Urgent(tc.inc); got != tc.urgent {
+				t.Errorf("Urgent() = %v, want %v", got, tc.urgent)
+			}
+		})
+	}
+}
+
+func TestSeverityUnmarshalText(t *testing.T) {
+	var s Severity
+	if err := s.UnmarshalText([]byte("Critical")); err != nil || s != Critical {
+		t.Errorf("UnmarshalText() = %s, %v, want critical", s, err)
+	}
+	if err := s.UnmarshalText([]byte("severe")); !errors.Is(err, errUnknownSeverity) {
+		t.Errorf("UnmarshalText() = %v, want %v", err, errUnknownSeverity)
+	}
+}
+
+func TestNew(t *testing.T) {
+	testCases := map[string]struct {
+		cfg Config
+		err error
+	}{
+		"valid": {
+			cfg: Config{PollInterval: time.Minute},
+		},
+		"no poll interval": {
+			err: errInvalidPollInterval,
+		},
+		"unknown severity": {
+			cfg: Config{PollInterval: time.Minute, Rules: []Rule{{Level: Critical + 1}}},
+			err: errUnknownSeverity,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(tc.cfg,
+				Database(&fakeDatabase{}),
+				Notifier(&fakeNotifier{}),
+				Logger(log.New(slog.Default().Handler())),
+				Tracer(noop.NewTracerProvider().Tracer("")),
+			)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("New() = %v, want %v", err, tc.err)
+			}
+		})
+	}
+
+	if _, err := New(Config{PollInterval: time.Minute}); !errors.Is(err, errMissingDatabase) {
+		t.Errorf("New() = %v, want %v", err, errMissingDatabase)
+	}
+}
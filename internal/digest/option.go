@@ -0,0 +1,40 @@
+package digest
+
+import (
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/notifier"
+)
+
+// Option to provide configuration to the digest.
+type Option func(*Digest)
+
+// Database provides the incidents waiting for review, and records which of them were sent.
+func Database(db database.Digests) Option {
+	return func(d *Digest) {
+		d.db = db
+	}
+}
+
+// Notifier the digests are sent through.
+func Notifier(n notifier.Notifier) Option {
+	return func(d *Digest) {
+		d.notifier = n
+	}
+}
+
+// Logger provides the logger
+func Logger(l log.Logger) Option {
+	return func(d *Digest) {
+		d.log = l
+	}
+}
+
+// Tracer provides the tracing
+func Tracer(tp trace.Tracer) Option {
+	return func(d *Digest) {
+		d.tracer = tp
+	}
+}
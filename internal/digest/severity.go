@@ -0,0 +1,42 @@
+package digest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Severity of the incident, which decides whether the reviewers are notified about it
+// immediately or in the digest.
+type Severity int
+
+// Severities from the lowest, which is the severity of the incidents no rule matches.
+const (
+	Low Severity = iota
+	Medium
+	High
+	Critical
+)
+
+var severityNames = []string{"low", "medium", "high", "critical"}
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	if s < Low || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// UnmarshalText parses the name of the severity, ignoring the case.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, name := range severityNames {
+		if strings.EqualFold(string(text), name) {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", errUnknownSeverity, text)
+}
+
+var errUnknownSeverity = errors.New("unknown severity")
@@ -0,0 +1,140 @@
+// Package imagegc deletes the uploaded images which were never reported with an incident.
+package imagegc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/storage"
+)
+
+// Config of the collector.
+type Config struct {
+	// Interval between the collections.
+	Interval time.Duration `yaml:"interval" default:"1h"`
+	// GracePeriod is how long the users have to report the image after uploading it.
+	GracePeriod time.Duration `yaml:"grace_period" default:"24h"`
+}
+
+// Collector periodically deletes the orphaned images, which were uploaded but never reported.
+type Collector struct {
+	cfg     Config
+	storage storage.Storage
+	uploads database.Uploads
+	log     log.Logger
+	tracer  trace.Tracer
+	// now is replaced in the tests.
+	now func() time.Time
+}
+
+// New creates a new collector.
+func New(cfg Config, opts ...Option) (*Collector, error) {
+	c := &Collector{
+		cfg: cfg,
+		now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, validate(c)
+}
+
+// Run the collections until the context is cancelled. Failed collections are retried on the
+// next interval.
+func (c *Collector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if deleted, err := c.Collect(ctx); err != nil {
+			c.log.Error(ctx, "unable to collect orphaned images", log.Error(err))
+		} else if deleted > 0 {
+			c.log.Info(ctx, "deleted orphaned images", slog.Int("deleted", deleted))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect deletes the images uploaded before the grace period which no incident has, together
+// with their variants, and returns how many were deleted.
+func (c *Collector) Collect(ctx context.Context) (deleted int, err error) {
+	ctx, span := c.tracer.Start(ctx, "Collect")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	images, err := c.uploads.OrphanUploads(ctx, c.now().Add(-c.cfg.GracePeriod))
+	if err != nil {
+		return 0, fmt.Errorf("unable to list orphaned images: %w", err)
+	}
+
+	// The images which fail to be deleted are kept in the database, so they are deleted on the
+	// next collection.
+	var errs []error
+	for _, image := range images {
+		if err := c.delete(ctx, image); err != nil {
+			errs = append(errs, fmt.Errorf("unable to delete image %s: %w", image, err))
+			continue
+		}
+		deleted++
+	}
+
+	return deleted, errors.Join(errs...)
+}
+
+// delete the image and its variants from the storage, and then the record of it being uploaded.
+func (c *Collector) delete(ctx context.Context, image string) error {
+	for _, variant := range append([]storage.Variant{""}, storage.Variants...) {
+		if err := c.storage.Delete(ctx, storage.VariantReference(image, variant)); err != nil {
+			return err
+		}
+	}
+
+	return c.uploads.DeleteUpload(ctx, image)
+}
+
+var (
+	errMissingStorage  = errors.New("missing storage")
+	errMissingUploads  = errors.New("missing uploads database")
+	errMissingLogger   = errors.New("missing logger")
+	errMissingTracer   = errors.New("missing tracer")
+	errInvalidInterval = errors.New("interval must be positive")
+)
+
+func validate(c *Collector) error {
+	if c.storage == nil {
+		return errMissingStorage
+	}
+	if c.uploads == nil {
+		return errMissingUploads
+	}
+	if c.log == nil {
+		return errMissingLogger
+	}
+	if c.tracer == nil {
+		return errMissingTracer
+	}
+	if c.cfg.Interval <= 0 {
+		return errInvalidInterval
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package imagegc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/storage"
+	"safer.place/internal/storage/storagetest"
+)
+
+type fakeUploads struct {
+	database.Uploads
+	orphans []string
+	before  time.Time
+	deleted []string
+}
+
+func (u *fakeUploads) OrphanUploads(_ context.Context, before time.Time) ([]string, error) {
+	u.before = before
+	return u.orphans, nil
+}
+
+func (u *fakeUploads) DeleteUpload(_ context.Context, imageID string) error {
+	u.deleted = append(u.deleted, imageID)
+	return nil
+}
+
+func TestCollect(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	store := storagetest.New(t)
+	orphan := store.Store([]byte("orphan"))
+	failing := store.Store([]byte("failing"))
+	for _, variant := range storage.Variants {
+		store.StoreAs(storage.VariantReference(orphan, variant), []byte("variant"))
+	}
+	store.Fail("delete "+storage.VariantReference(failing, storage.VariantMedium), errors.New("delete failed"))
+	uploads := &fakeUploads{orphans: []string{orphan, failing}}
+
+	c, err := New(Config{Interval: time.Hour, GracePeriod: 24 * time.Hour},
+		Storage(store),
+		Uploads(uploads),
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.now = func() time.Time { return now }
+
+	deleted, err := c.Collect(context.Background())
+	if err == nil {
+		t.Errorf("Collect() = nil, want the error deleting failing")
+	}
+	if deleted != 1 {
+		t.Errorf("Collect() deleted %d, want 1", deleted)
+	}
+
+	if want := now.Add(-24 * time.Hour); !uploads.before.Equal(want) {
+		t.Errorf("OrphanUploads() before %v, want %v", uploads.before, want)
+	}
+	for _, variant := range append([]storage.Variant{""}, storage.Variants...) {
+		reference := storage.VariantReference(orphan, variant)
+		if !slices.Contains(store.Ops(), "delete "+reference) || store.Read(reference) != nil {
+			t.Errorf("%s not deleted", reference)
+		}
+	}
+	// The image which failed to be deleted is kept, so it is deleted on the next collection.
+	if !slices.Equal(uploads.deleted, []string{orphan}) {
+		t.Errorf("DeleteUpload() called with %v, want orphan", uploads.deleted)
+	}
+}
+
+func TestNew(t *testing.T) {
+	testCases := map[string]struct {
+		cfg  Config
+		opts []Option
+		err  error
+	}{
+		"valid": {
+			cfg: Config{Interval: time.Hour},
+		},
+		"no interval": {
+			err: errInvalidInterval,
+		},
+		"missing uploads": {
+			cfg:  Config{Interval: time.Hour},
+			opts: []Option{Uploads(nil)},
+			err:  errMissingUploads,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			opts := append([]Option{
+				Storage(storagetest.New(t)),
+				Uploads(&fakeUploads{}),
+				Logger(log.New(slog.Default().Handler())),
+				Tracer(noop.NewTracerProvider().Tracer("")),
+			}, tc.opts...)
+
+			if _, err := New(tc.cfg, opts...); !errors.Is(err, tc.err) {
+				t.Errorf("New() = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package imagegc
+
+import (
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/storage"
+)
+
+// Option to provide configuration to the collector.
+type Option func(*Collector)
+
+// Storage provides the storage holding the images.
+func Storage(store storage.Storage) Option {
+	return func(c *Collector) {
+		c.storage = store
+	}
+}
+
+// Uploads provides the database recording the uploaded images.
+func Uploads(uploads database.Uploads) Option {
+	return func(c *Collector) {
+		c.uploads = uploads
+	}
+}
+
+// Logger provides the logger
+func Logger(l log.Logger) Option {
+	return func(c *Collector) {
+		c.log = l
+	}
+}
+
+// Tracer provides the tracing
+func Tracer(tp trace.Tracer) Option {
+	return func(c *Collector) {
+		c.tracer = tp
+	}
+}
@@ -0,0 +1,153 @@
+// Package imaging processes the images uploaded by the users before they are stored.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"slices"
+
+	// WebP images are decoded, but encoded as PNG as there is no WebP encoder.
+	"golang.org/x/image/webp"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for the images which are not in one of the allowed
+	// formats.
+	ErrUnsupportedFormat = errors.New("imaging: unsupported image format")
+	// ErrTooLarge is returned for the images which are larger than the allowed dimensions.
+	ErrTooLarge = errors.New("imaging: image dimensions too large")
+)
+
+// The formats of the images which can be processed.
+const (
+	JPEG = "jpeg"
+	PNG  = "png"
+	WebP = "webp"
+)
+
+// Formats are all the image formats which can be processed.
+var Formats = []string{JPEG, PNG, WebP}
+
+// jpegQuality of the JPEG images once they are encoded again.
+const jpegQuality = 90
+
+type decoder struct {
+	decode func(io.Reader) (image.Image, error)
+	config func(io.Reader) (image.Config, error)
+}
+
+// decoders of each format. They are used directly instead of image.Decode, so a format
+// registered by any other package can't be uploaded.
+var decoders = map[string]decoder{
+	JPEG: {decode: jpeg.Decode, config: jpeg.DecodeConfig},
+	PNG:  {decode: png.Decode, config: png.DecodeConfig},
+	WebP: {decode: webp.Decode, config: webp.DecodeConfig},
+}
+
+// MaxBytesPerPixel is the most memory each pixel of the decoded image takes, which is for the
+// 16-bit PNG images with an alpha channel. Most images take 4 bytes, and the grayscale ones less.
+const MaxBytesPerPixel = 8
+
+// Limits restrict which images are processed. The zero value allows all the formats of any
+// size.
+type Limits struct {
+	// Formats which are allowed, all of them if empty.
+	Formats []string
+	// MaxWidth and MaxHeight of the image in pixels, unlimited if 0.
+	MaxWidth  int
+	MaxHeight int
+	// MaxPixels is the maximum width times height, unlimited if 0. Each decoded pixel takes up
+	// to MaxBytesPerPixel bytes of memory, no matter how well the image is compressed.
+	MaxPixels int
+}
+
+func (l Limits) allows(format string) bool {
+	return len(l.Formats) == 0 || slices.Contains(l.Formats, format)
+}
+
+func (l Limits) check(cfg image.Config) error {
+	if (l.MaxWidth > 0 && cfg.Width > l.MaxWidth) ||
+		(l.MaxHeight > 0 && cfg.Height > l.MaxHeight) ||
+		(l.MaxPixels > 0 && cfg.Width*cfg.Height > l.MaxPixels) {
+		return fmt.Errorf("%w: %dx%d", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+// Sniff returns the format of the image from its magic bytes, ignoring what the user claims it
+// to be.
+func Sniff(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xFF\xD8\xFF")):
+		return JPEG, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1A\n")):
+		return PNG, nil
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return WebP, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// Decode the image after checking it against the limits, and apply its JPEG orientation, which
+// would be lost with the rest of the metadata once it's encoded again. It returns the image and
+// its format.
+//
+// The format and dimensions are checked against the limits before the image is decoded, so a
+// small image claiming to be huge doesn't exhaust the memory.
+func Decode(r io.Reader, limits Limits) (image.Image, string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read image: %w", err)
+	}
+
+	format, err := Sniff(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if !limits.allows(format) {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	dec := decoders[format]
+
+	cfg, err := dec.config(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to decode %s image config: %w", format, err)
+	}
+	if err := limits.check(cfg); err != nil {
+		return nil, "", err
+	}
+
+	img, err := dec.decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to decode %s image: %w", format, err)
+	}
+	if format == JPEG {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	return img, format, nil
+}
+
+// Encode the image decoded from the format, without any metadata, so the location, device and
+// time the photo was taken don't leak. JPEG images are encoded as JPEG, and the rest as PNG, so
+// the WebP images can be several times larger once encoded. It returns the content type of the
+// encoded image.
+func Encode(w io.Writer, img image.Image, format string) (string, error) {
+	if format == JPEG {
+		if err := jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return "", fmt.Errorf("unable to encode jpeg image: %w", err)
+		}
+		return "image/jpeg", nil
+	}
+
+	if err := png.Encode(w, img); err != nil {
+		return "", fmt.Errorf("unable to encode png image: %w", err)
+	}
+	return "image/png", nil
+}
@@ -0,0 +1,258 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// metadata which is in all the fixtures, and must not be in the stripped images.
+var metadata = []string{
+	"Exif", "eXIf", "tEXt", "EXIF",
+	"Phone", "Model X", "2024:01:02 03:04:05",
+}
+
+// strip the metadata from the image the same way as the uploader, by decoding and encoding it.
+func strip(w io.Writer, r io.Reader, limits Limits) (string, error) {
+	img, format, err := Decode(r, limits)
+	if err != nil {
+		return "", err
+	}
+	return Encode(w, img, format)
+}
+
+func TestStrip(t *testing.T) {
+	testCases := map[string]struct {
+		fixture     string
+		contentType string
+		width       int
+		height      int
+	}{
+		"jpeg":    {fixture: "gps.jpg", contentType: "image/jpeg", width: 16, height: 8},
+		"rotated": {fixture: "gps_rotated.jpg", contentType: "image/jpeg", width: 8, height: 16},
+		"png":     {fixture: "gps.png", contentType: "image/png", width: 16, height: 8},
+		"webp":    {fixture: "gps.webp", contentType: "image/png", width: 16, height: 8},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			in, err := os.ReadFile(filepath.Join("testdata", tc.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The fixture has to have the metadata for the test to mean anything.
+			if !bytes.Contains(in, []byte("Model X")) {
+				t.Fatalf("%s doesn't contain the metadata", tc.fixture)
+			}
+
+			var out bytes.Buffer
+			contentType, err := strip(&out, bytes.NewReader(in), Limits{})
+			if err != nil {
+				t.Fatalf("strip() = %v", err)
+			}
+			if contentType != tc.contentType {
+				t.Errorf("strip() content type = %s, want %s", contentType, tc.contentType)
+			}
+
+			for _, m := range metadata {
+				if bytes.Contains(out.Bytes(), []byte(m)) {
+					t.Errorf("strip() output contains %q", m)
+				}
+			}
+
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(out.Bytes()))
+			if err != nil {
+				t.Fatalf("DecodeConfig() = %v", err)
+			}
+			if cfg.Width != tc.width || cfg.Height != tc.height {
+				t.Errorf("strip() image is %dx%d, want %dx%d", cfg.Width, cfg.Height, tc.width, tc.height)
+			}
+		})
+	}
+}
+
+func TestStripRotated(t *testing.T) {
+	in, err := os.ReadFile(filepath.Join("testdata", "gps_rotated.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if _, err := strip(&out, bytes.NewReader(in), Limits{}); err != nil {
+		t.Fatalf("strip() = %v", err)
+	}
+	img, _, err := image.Decode(&out)
+	if err != nil {
+		t.Fatalf("Decode() = %v", err)
+	}
+
+	// The red left half of the stored image is on top once it is rotated clockwise.
+	isRed := func(c color.Color) bool {
+		r, _, b, _ := c.RGBA()
+		return r > b
+	}
+	if !isRed(img.At(4, 2)) || isRed(img.At(4, 13)) {
+		t.Errorf("strip() image is not rotated: top %v, bottom %v", img.At(4, 2), img.At(4, 13))
+	}
+}
+
+func TestDecodeUnsupported(t *testing.T) {
+	for _, in := range []string{"", "not an image", "GIF89a"} {
+		if _, _, err := Decode(strings.NewReader(in), Limits{}); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("Decode(%q) = %v, want %v", in, err, ErrUnsupportedFormat)
+		}
+	}
+}
+
+func TestSniff(t *testing.T) {
+	testCases := map[string]struct {
+		fixture string
+		data    string
+		want    string
+		err     error
+	}{
+		"jpeg":      {fixture: "gps.jpg", want: JPEG},
+		"png":       {fixture: "gps.png", want: PNG},
+		"webp":      {fixture: "gps.webp", want: WebP},
+		"gif":       {data: "GIF89a", err: ErrUnsupportedFormat},
+		"riff":      {data: "RIFF\x00\x00\x00\x00WAVE", err: ErrUnsupportedFormat},
+		"truncated": {data: "RIFF", err: ErrUnsupportedFormat},
+		"empty":     {data: "", err: ErrUnsupportedFormat},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			data := []byte(tc.data)
+			if tc.fixture != "" {
+				var err error
+				if data, err = os.ReadFile(filepath.Join("testdata", tc.fixture)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := Sniff(data)
+			if got != tc.want || !errors.Is(err, tc.err) {
+				t.Errorf("Sniff() = %q, %v, want %q, %v", got, err, tc.want, tc.err)
+			}
+		})
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	testCases := map[string]struct {
+		fixture string
+		limits  Limits
+		err     error
+	}{
+		"allowed":     {fixture: "gps.jpg", limits: Limits{Formats: []string{JPEG}, MaxWidth: 16, MaxHeight: 8, MaxPixels: 128}},
+		"format":      {fixture: "gps.png", limits: Limits{Formats: []string{JPEG, WebP}}, err: ErrUnsupportedFormat},
+		"width":       {fixture: "gps.jpg", limits: Limits{MaxWidth: 15}, err: ErrTooLarge},
+		"height":      {fixture: "gps.webp", limits: Limits{MaxHeight: 7}, err: ErrTooLarge},
+		"pixels":      {fixture: "gps.png", limits: Limits{MaxPixels: 127}, err: ErrTooLarge},
+		"stored size": {fixture: "gps_rotated.jpg", limits: Limits{MaxWidth: 16, MaxHeight: 8}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			in, err := os.ReadFile(filepath.Join("testdata", tc.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := Decode(bytes.NewReader(in), tc.limits); !errors.Is(err, tc.err) {
+				t.Errorf("Decode() = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+// TestDecodeBomb checks the dimensions are checked before the image is decoded, as the PNG claims
+// to be 100000x100000, which would take 10GB of memory once decoded.
+func TestDecodeBomb(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	// The IHDR chunk follows the 8 byte signature, its length and type. Its data starts with the
+	// width and height, and is followed by the CRC of the type and data.
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[20:], 100000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	limits := Limits{MaxWidth: 8192, MaxHeight: 8192, MaxPixels: 40_000_000}
+	if _, _, err := Decode(bytes.NewReader(data), limits); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Decode() = %v, want %v", err, ErrTooLarge)
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	testCases := map[string]struct {
+		fixture string
+		data    []byte
+		want    int
+	}{
+		"upright":   {fixture: "gps.jpg", want: 1},
+		"rotated":   {fixture: "gps_rotated.jpg", want: 6},
+		"png":       {fixture: "gps.png", want: 1},
+		"empty":     {data: []byte{}, want: 1},
+		"truncated": {data: []byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF}, want: 1},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			data := tc.data
+			if tc.fixture != "" {
+				var err error
+				if data, err = os.ReadFile(filepath.Join("testdata", tc.fixture)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := jpegOrientation(data); got != tc.want {
+				t.Errorf("jpegOrientation() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// The top left pixel of the 3x2 image is marked, and is moved by the orientation.
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	marked := color.RGBA{R: 255, A: 255}
+	src.Set(0, 0, marked)
+
+	testCases := map[int]struct {
+		x, y          int
+		width, height int
+	}{
+		1: {x: 0, y: 0, width: 3, height: 2},
+		2: {x: 2, y: 0, width: 3, height: 2},
+		3: {x: 2, y: 1, width: 3, height: 2},
+		4: {x: 0, y: 1, width: 3, height: 2},
+		5: {x: 0, y: 0, width: 2, height: 3},
+		6: {x: 1, y: 0, width: 2, height: 3},
+		7: {x: 1, y: 2, width: 2, height: 3},
+		8: {x: 0, y: 2, width: 2, height: 3},
+	}
+
+	for orientation, tc := range testCases {
+		dst := orient(src, orientation)
+		if b := dst.Bounds(); b.Dx() != tc.width || b.Dy() != tc.height {
+			t.Errorf("orient(%d) is %dx%d, want %dx%d", orientation, b.Dx(), b.Dy(), tc.width, tc.height)
+			continue
+		}
+		if got := color.RGBAModel.Convert(dst.At(tc.x, tc.y)); got != marked {
+			t.Errorf("orient(%d).At(%d, %d) = %v, want %v", orientation, tc.x, tc.y, got, marked)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// Resize encodes the image as JPEG scaled down to fit in a square of the size, keeping its
+// aspect ratio. Smaller images are not scaled up. The transparent parts of the image are white,
+// as JPEG has no transparency.
+//
+// It returns the content type of the encoded image.
+func Resize(w io.Writer, img image.Image, size int) (string, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	switch {
+	case width <= size && height <= size:
+	case width >= height:
+		width, height = size, max(1, height*size/width)
+	default:
+		width, height = max(1, width*size/height), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+
+	if err := jpeg.Encode(w, dst, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return "", fmt.Errorf("unable to encode resized image: %w", err)
+	}
+	return "image/jpeg", nil
+}
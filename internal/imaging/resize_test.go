@@ -0,0 +1,63 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	testCases := map[string]struct {
+		width, height int
+		size          int
+		wantWidth     int
+		wantHeight    int
+	}{
+		"landscape":    {width: 400, height: 200, size: 100, wantWidth: 100, wantHeight: 50},
+		"portrait":     {width: 200, height: 400, size: 100, wantWidth: 50, wantHeight: 100},
+		"square":       {width: 300, height: 300, size: 100, wantWidth: 100, wantHeight: 100},
+		"small":        {width: 40, height: 20, size: 100, wantWidth: 40, wantHeight: 20},
+		"thin":         {width: 1000, height: 2, size: 100, wantWidth: 100, wantHeight: 1},
+		"exactly size": {width: 100, height: 10, size: 100, wantWidth: 100, wantHeight: 10},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			contentType, err := Resize(&out, image.NewGray(image.Rect(0, 0, tc.width, tc.height)), tc.size)
+			if err != nil {
+				t.Fatalf("Resize() = %v", err)
+			}
+			if contentType != "image/jpeg" {
+				t.Errorf("Resize() content type = %s, want image/jpeg", contentType)
+			}
+
+			cfg, err := jpeg.DecodeConfig(&out)
+			if err != nil {
+				t.Fatalf("DecodeConfig() = %v", err)
+			}
+			if cfg.Width != tc.wantWidth || cfg.Height != tc.wantHeight {
+				t.Errorf("Resize() image is %dx%d, want %dx%d", cfg.Width, cfg.Height, tc.wantWidth, tc.wantHeight)
+			}
+		})
+	}
+}
+
+func TestResizeTransparent(t *testing.T) {
+	// A transparent image would be black without the background.
+	src := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+
+	var out bytes.Buffer
+	if _, err := Resize(&out, src, 10); err != nil {
+		t.Fatalf("Resize() = %v", err)
+	}
+	img, err := jpeg.Decode(&out)
+	if err != nil {
+		t.Fatalf("Decode() = %v", err)
+	}
+	if y := color.GrayModel.Convert(img.At(5, 5)).(color.Gray).Y; y < 250 {
+		t.Errorf("Resize() transparent pixel is %d, want white", y)
+	}
+}
@@ -0,0 +1,57 @@
+// Package lifecycle defines how the resolution of an incident can change once it has been
+// reported, and who is allowed to change it.
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+
+	"api.safer.place/incident/v1"
+
+	"safer.place/internal/auth/rbac"
+)
+
+// ErrInvalidTransition is returned when the incident can't move from its current resolution to
+// the requested one.
+var ErrInvalidTransition = errors.New("lifecycle: invalid transition")
+
+const (
+	unspecified = incident.Resolution_RESOLUTION_UNSPECIFIED
+	rejected    = incident.Resolution_RESOLUTION_REJECTED
+	accepted    = incident.Resolution_RESOLUTION_ACCEPTED
+	alerted     = incident.Resolution_RESOLUTION_ALERTED
+)
+
+// transitions lists the allowed resolution changes and the permission needed to make them. Once
+// reviewed, an incident can't be reviewed again and only moderators can change the resolution,
+// nobody can move it back to unspecified.
+var transitions = map[incident.Resolution]map[incident.Resolution]rbac.Permission{
+	unspecified: {
+		// Commenting without resolving, so someone else can give their opinion.
+		unspecified: rbac.PermissionReviewIncidents,
+		rejected:    rbac.PermissionReviewIncidents,
+		accepted:    rbac.PermissionReviewIncidents,
+		alerted:     rbac.PermissionReviewIncidents,
+	},
+	rejected: {
+		accepted: rbac.PermissionModerateIncidents,
+	},
+	accepted: {
+		rejected: rbac.PermissionModerateIncidents,
+		alerted:  rbac.PermissionModerateIncidents,
+	},
+	alerted: {
+		rejected: rbac.PermissionModerateIncidents,
+		accepted: rbac.PermissionModerateIncidents,
+	},
+}
+
+// Permission returns the permission needed to move the incident from one resolution to another,
+// or ErrInvalidTransition if it can't be done at all.
+func Permission(from, to incident.Resolution) (rbac.Permission, error) {
+	permission, ok := transitions[from][to]
+	if !ok {
+		return "", fmt.Errorf("%w from %s to %s", ErrInvalidTransition, from, to)
+	}
+	return permission, nil
+}
@@ -0,0 +1,34 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+
+	"api.safer.place/incident/v1"
+
+	"safer.place/internal/auth/rbac"
+)
+
+func TestPermission(t *testing.T) {
+	testCases := []struct {
+		from, to incident.Resolution
+		want     rbac.Permission
+		wantErr  error
+	}{
+		{from: unspecified, to: accepted, want: rbac.PermissionReviewIncidents},
+		{from: unspecified, to: unspecified, want: rbac.PermissionReviewIncidents},
+		{from: accepted, to: alerted, want: rbac.PermissionModerateIncidents},
+		{from: rejected, to: accepted, want: rbac.PermissionModerateIncidents},
+		{from: alerted, to: unspecified, wantErr: ErrInvalidTransition},
+		{from: accepted, to: accepted, wantErr: ErrInvalidTransition},
+		{from: rejected, to: alerted, wantErr: ErrInvalidTransition},
+	}
+
+	for _, tc := range testCases {
+		got, err := Permission(tc.from, tc.to)
+		if got != tc.want || !errors.Is(err, tc.wantErr) {
+			t.Errorf("Permission(%v, %v) = %q, %v, want %q, %v",
+				tc.from, tc.to, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
@@ -1,55 +1,167 @@
+// Package discordnotifier notifies the reviewers about the incidents through a Discord webhook.
 package discordnotifier
 
 import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/kelseyhightower/envconfig"
 
 	"api.safer.place/incident/v1"
+	"safer.place/internal/config/secret"
+	"safer.place/internal/notifier"
+	"safer.place/internal/storage"
 )
 
+// Config used to parse the notifier confiuration
+type Config struct {
+	// Endpoint is the URL of the webhook, which contains its token.
+	Endpoint secret.Secret `yaml:"endpoint"`
+	// Thumbnails shows the image thumbnails, which Discord loads from the short-lived URLs
+	// presigned by the storage. They are left out if the storage can't presign them.
+	Thumbnails bool `yaml:"thumbnails"`
+}
+
 // Notifier sends a notification to discord about an incident.
 type Notifier struct {
-	client   *http.Client
-	endpoint string
+	client     *http.Client
+	endpoint   string
+	thumbnails bool
+	presigner  storage.Presigner
+	reviewURL  string
 }
 
 // New creates a new discord notifier
-func New(c *http.Client) (*Notifier, error) {
-	var cfg Config
-	if err := envconfig.Process("discord", &cfg); err != nil {
-		return nil, fmt.Errorf("unable to process discord settings: %w", err)
+func New(cfg *Config, opts ...Option) (*Notifier, error) {
+	if cfg == nil || cfg.Endpoint == "" {
+		return nil, errMissingEndpoint
+	}
+
+	endpoint, err := url.Parse(string(cfg.Endpoint))
+	if err != nil {
+		// The error contains the URL, which must not be logged.
+		return nil, errInvalidEndpoint
+	}
+	// Webhooks which don't belong to an application only send the link buttons when asked to.
+	query := endpoint.Query()
+	query.Set("with_components", "true")
+	endpoint.RawQuery = query.Encode()
+
+	n := &Notifier{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		endpoint:   endpoint.String(),
+		thumbnails: cfg.Thumbnails,
+		reviewURL:  "https://review.safer.place/",
+	}
+
+	for _, opt := range opts {
+		opt(n)
 	}
 
-	return &Notifier{
-		client:   c,
-		endpoint: cfg.Endpoint,
-	}, nil
+	return n, nil
 }
 
 // Notify sends the discord webhook notification
 func (n *Notifier) Notify(ctx context.Context, i *incident.Incident) error {
-	msg := fmt.Sprintf(messageFmt,
-		i.Id, i.Coordinates.Lat, i.Coordinates.Lon, i.Description, i.Id)
+	reviewURL, err := notifier.ReviewURL(n.reviewURL, i)
+	if err != nil {
+		return fmt.Errorf("unable to create review link: %w", err)
+	}
+
+	data := discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{n.embed(ctx, i, reviewURL)},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label: "Review Incident",
+						Style: discordgo.LinkButton,
+						URL:   reviewURL,
+					},
+				},
+			},
+		},
+		// The description is written by the user, so it mustn't mention anyone.
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+
+	return n.send(ctx, data)
+}
+
+// NotifyDigest sends a single message listing the incidents, each linking to its review.
+func (n *Notifier) NotifyDigest(ctx context.Context, incidents []*incident.Incident) error {
+	var (
+		lines  []string
+		length int
+	)
+	for idx, i := range incidents {
+		reviewURL, err := notifier.ReviewURL(n.reviewURL, i)
+		if err != nil {
+			return fmt.Errorf("unable to create review link: %w", err)
+		}
+
+		line := fmt.Sprintf("- [%s](%s): %s", notifier.Location(i), reviewURL, summary(i.Description))
+		more := fmt.Sprintf("…and %d more", len(incidents)-idx)
+		// Leave room for the note about the incidents which don't fit.
+		if length+len([]rune(line))+len([]rune(more))+2 > maxDescription {
+			lines = append(lines, more)
+			break
+		}
+		lines = append(lines, line)
+		length += len([]rune(line)) + 1
+	}
+
+	title := fmt.Sprintf("%d new incidents for review", len(incidents))
+	if len(incidents) == 1 {
+		title = "1 new incident for review"
+	}
 
 	data := discordgo.WebhookParams{
-		Content:    msg,
+		Embeds: []*discordgo.MessageEmbed{{
+			Title:       title,
+			URL:         n.reviewURL,
+			Description: strings.Join(lines, "\n"),
+			Color:       embedColor,
+		}},
 		Components: []discordgo.MessageComponent{
-			// discordgo.Button{
-			// 	Label: "Review Incident",
-			// 	// Style: discordgo.LinkButton,
-			// 	// TODO: Maybe this can be customized?
-			// 	URL: "https://review.safer.place/incident/" + i.Id,
-			// },
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label: "Review Incidents",
+						Style: discordgo.LinkButton,
+						URL:   n.reviewURL,
+					},
+				},
+			},
 		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+
+	return n.send(ctx, data)
+}
+
+// maxSummary is the longest description listed in the digest.
+const maxSummary = 100
+
+// summary shortens the description to a single line listed in the digest.
+func summary(description string) string {
+	summary := []rune(strings.Join(strings.Fields(description), " "))
+	if len(summary) > maxSummary {
+		summary = append(summary[:maxSummary-1], '…')
 	}
+	return string(summary)
+}
 
+// send the message to the webhook.
+func (n *Notifier) send(ctx context.Context, data discordgo.WebhookParams) error {
 	body := new(bytes.Buffer)
 	if err := json.NewEncoder(body).Encode(data); err != nil {
 		return fmt.Errorf("unable to encode webhook body: %w", err)
@@ -67,28 +179,70 @@ func (n *Notifier) Notify(ctx context.Context, i *incident.Incident) error {
 
 	resp, err := n.client.Do(req)
 	if err != nil {
+		// The error contains the URL, which must not be logged.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
 		return fmt.Errorf("unable to send discord notification: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusNoContent {
-		respBody, _ := io.ReadAll(resp.Body)
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
 		return fmt.Errorf("unexpected response %q: %s", string(respBody), resp.Status)
 	}
 
 	return nil
 }
 
-// Config used to parse the notifier confiuration
-type Config struct {
-	Endpoint string `required:"true"`
-}
+// embedColor is the color of the bar next to the embed.
+const embedColor = 0xE67E22
+
+// maxDescription is the longest description Discord accepts in an embed.
+const maxDescription = 4096
 
-var messageFmt = `
-New Incident for review: %s
-Lat: %.6f
-Lon: %.6f
-Description: %s
+// embed describes the incident, linking to where it happened and its review.
+func (n *Notifier) embed(ctx context.Context, i *incident.Incident, reviewURL string) *discordgo.MessageEmbed {
+	description := []rune(i.Description)
+	if len(description) > maxDescription {
+		description = append(description[:maxDescription-1], '…')
+	}
 
-REVIEW: https://review.safer.place/incident/%s
-`
+	embed := &discordgo.MessageEmbed{
+		Title:       "New Incident for review",
+		URL:         reviewURL,
+		Description: string(description),
+		Color:       embedColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Location", Value: notifier.Location(i), Inline: true},
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: i.Id},
+	}
+	if i.Timestamp != nil {
+		embed.Timestamp = i.Timestamp.AsTime().Format(time.RFC3339)
+	}
+
+	if c := i.Coordinates; c != nil {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Coordinates",
+			Value:  fmt.Sprintf("[%.6f, %.6f](%s)", c.Lat, c.Lon, notifier.MapURL(i)),
+			Inline: true,
+		})
+	}
+
+	// The incident is still worth notifying about without its thumbnail.
+	if n.thumbnails && n.presigner != nil && i.ImageId != "" {
+		if thumbnail, err := n.presigner.PresignGet(ctx,
+			storage.VariantReference(i.ImageId, storage.VariantThumbnail)); err == nil {
+			embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: thumbnail.String()}
+		}
+	}
+
+	return embed
+}
+
+var (
+	errMissingEndpoint = errors.New("missing discord webhook endpoint")
+	errInvalidEndpoint = errors.New("invalid discord webhook endpoint")
+)
@@ -0,0 +1,239 @@
+package discordnotifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"api.safer.place/incident/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"safer.place/internal/config/secret"
+)
+
+// webhook is the request received by the test webhook.
+type webhook struct {
+	Embeds []struct {
+		Title       string `json:"title"`
+		URL         string `json:"url"`
+		Description string `json:"description"`
+		Fields      []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"fields"`
+		Thumbnail *struct {
+			URL string `json:"url"`
+		} `json:"thumbnail"`
+	} `json:"embeds"`
+	Components []struct {
+		Components []struct {
+			Label string `json:"label"`
+			Style int    `json:"style"`
+			URL   string `json:"url"`
+		} `json:"components"`
+	} `json:"components"`
+}
+
+// fakePresigner presigns the URLs of the images at the address.
+type fakePresigner string
+
+func (p fakePresigner) PresignGet(_ context.Context, reference string) (*url.URL, error) {
+	return url.Parse(string(p) + reference + "?signature=signed")
+}
+
+// newWebhook starts the stand-in for the Discord webhook, which records the requests and
+// responds with the status.
+func newWebhook(t *testing.T, status int) (*httptest.Server, *[]webhook) {
+	t.Helper()
+
+	var received []webhook
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("with_components") != "true" {
+			t.Errorf("webhook called without components: %s", r.URL)
+		}
+		var body webhook
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("unable to decode webhook: %v", err)
+		}
+		received = append(received, body)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &received
+}
+
+func TestNotify(t *testing.T) {
+	srv, received := newWebhook(t, http.StatusNoContent)
+	n, err := New(&Config{
+		Endpoint:   secret.Secret(srv.URL + "/api/webhooks/1/token"),
+		Thumbnails: true,
+	}, Client(srv.Client()), ReviewURL("https://review.example.com/review/"),
+		Presigner(fakePresigner("https://images.example.com/")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Notify(context.Background(), &incident.Incident{
+		Id:                       "incident",
+		Timestamp:                timestamppb.Now(),
+		Description:              "Parked on the footpath",
+		Location:                 incident.Location_LOCATION_TRANSPORTATION,
+		TransportationIdentifier: "46A",
+		Coordinates:              &incident.Coordinates{Lat: 53.35, Lon: -6.26},
+		ImageId:                  "image",
+	}); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	if len(*received) != 1 || len((*received)[0].Embeds) != 1 {
+		t.Fatalf("webhook received %+v, want one embed", *received)
+	}
+	got := (*received)[0]
+	embed := got.Embeds[0]
+
+	const reviewURL = "https://review.example.com/review/incident/incident"
+	if embed.URL != reviewURL || embed.Description != "Parked on the footpath" {
+		t.Errorf("embed = %+v, want the incident linking to %s", embed, reviewURL)
+	}
+	fields := make(map[string]string)
+	for _, f := range embed.Fields {
+		fields[f.Name] = f.Value
+	}
+	if fields["Location"] != "Transportation: 46A" {
+		t.Errorf("Location = %q, want the transportation", fields["Location"])
+	}
+	if !strings.Contains(fields["Coordinates"], "openstreetmap.org/?mlat=53.350000&mlon=-6.260000") {
+		t.Errorf("Coordinates = %q, want the map link", fields["Coordinates"])
+	}
+	if embed.Thumbnail == nil || embed.Thumbnail.URL != "https://images.example.com/image_thumbnail?signature=signed" {
+		t.Errorf("Thumbnail = %+v, want the image thumbnail", embed.Thumbnail)
+	}
+
+	if len(got.Components) != 1 || len(got.Components[0].Components) != 1 {
+		t.Fatalf("components = %+v, want the review button", got.Components)
+	}
+	button := got.Components[0].Components[0]
+	if button.URL != reviewURL || button.Style != 5 {
+		t.Errorf("button = %+v, want the link to %s", button, reviewURL)
+	}
+}
+
+func TestNotifyWithoutImage(t *testing.T) {
+	testCases := map[string]struct {
+		cfg  Config
+		opts []Option
+	}{
+		"thumbnails disabled": {
+			opts: []Option{Presigner(fakePresigner("https://images.example.com/"))},
+		},
+		"storage can't presign": {
+			cfg: Config{Thumbnails: true},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			srv, received := newWebhook(t, http.StatusNoContent)
+			tc.cfg.Endpoint = secret.Secret(srv.URL)
+			n, err := New(&tc.cfg, append(tc.opts, Client(srv.Client()))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := n.Notify(context.Background(), &incident.Incident{Id: "incident", ImageId: "image"}); err != nil {
+				t.Fatalf("Notify() = %v", err)
+			}
+
+			// The thumbnail is left out, and so are the unknown coordinates.
+			embed := (*received)[0].Embeds[0]
+			if embed.Thumbnail != nil || len(embed.Fields) != 1 {
+				t.Errorf("embed = %+v, want only the location", embed)
+			}
+			if embed.URL != "https://review.safer.place/incident/incident" {
+				t.Errorf("embed URL = %s, want the default review URL", embed.URL)
+			}
+		})
+	}
+}
+
+func TestNotifyDigest(t *testing.T) {
+	srv, received := newWebhook(t, http.StatusNoContent)
+	n, err := New(&Config{Endpoint: secret.Secret(srv.URL)}, Client(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	incidents := []*incident.Incident{
+		{Id: "first", Location: incident.Location_LOCATION_OUTSIDE, Description: "Parked on\nthe footpath"},
+		{Id: "second", Location: incident.Location_LOCATION_INSIDE, Description: strings.Repeat("a", 200)},
+	}
+	if err := n.NotifyDigest(context.Background(), incidents); err != nil {
+		t.Fatalf("NotifyDigest() = %v", err)
+	}
+
+	if len(*received) != 1 || len((*received)[0].Embeds) != 1 {
+		t.Fatalf("webhook received %+v, want one embed", *received)
+	}
+	embed := (*received)[0].Embeds[0]
+	lines := strings.Split(embed.Description, "\n")
+	if embed.Title != "2 new incidents for review" || len(lines) != 2 {
+		t.Fatalf("embed = %+v, want both incidents", embed)
+	}
+	if want := "- [Outside](https://review.safer.place/incident/first): Parked on the footpath"; lines[0] != want {
+		t.Errorf("first line = %q, want %q", lines[0], want)
+	}
+	if !strings.HasSuffix(lines[1], strings.Repeat("a", maxSummary-1)+"…") {
+		t.Errorf("second line = %q, want the shortened description", lines[1])
+	}
+
+	// The incidents which don't fit in the embed are counted instead.
+	many := make([]*incident.Incident, 100)
+	for i := range many {
+		many[i] = &incident.Incident{Id: "incident", Description: strings.Repeat("a", 200)}
+	}
+	if err := n.NotifyDigest(context.Background(), many); err != nil {
+		t.Fatalf("NotifyDigest() = %v", err)
+	}
+	embed = (*received)[1].Embeds[0]
+	if len([]rune(embed.Description)) > maxDescription || !strings.Contains(embed.Description, "more") {
+		t.Errorf("embed description of %d characters, want the rest counted", len([]rune(embed.Description)))
+	}
+}
+
+func TestNotifyError(t *testing.T) {
+	srv, _ := newWebhook(t, http.StatusBadRequest)
+	n, err := New(&Config{Endpoint: secret.Secret(srv.URL)}, Client(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Notify(context.Background(), &incident.Incident{Id: "incident"}); err == nil {
+		t.Error("Notify() = nil, want the unexpected response")
+	}
+}
+
+func TestNew(t *testing.T) {
+	testCases := map[string]struct {
+		cfg *Config
+		err error
+	}{
+		"valid":            {cfg: &Config{Endpoint: "https://discord.com/api/webhooks/1/token"}},
+		"missing config":   {err: errMissingEndpoint},
+		"missing endpoint": {cfg: &Config{}, err: errMissingEndpoint},
+		"invalid endpoint": {cfg: &Config{Endpoint: "://token"}, err: errInvalidEndpoint},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := New(tc.cfg); !errors.Is(err, tc.err) {
+				t.Errorf("New() = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package discordnotifier
+
+import (
+	"net/http"
+
+	"safer.place/internal/storage"
+)
+
+// Option to provide configuration to the notifier.
+type Option func(*Notifier)
+
+// Client provides the HTTP client sending the webhooks.
+func Client(c *http.Client) Option {
+	return func(n *Notifier) {
+		n.client = c
+	}
+}
+
+// ReviewURL provides the address of the review UI, which the incidents are linked to.
+func ReviewURL(u string) Option {
+	return func(n *Notifier) {
+		n.reviewURL = u
+	}
+}
+
+// Presigner provides the storage presigning the URLs of the image thumbnails.
+func Presigner(p storage.Presigner) Option {
+	return func(n *Notifier) {
+		n.presigner = p
+	}
+}
@@ -0,0 +1,408 @@
+// Package emailnotifier notifies the reviewers about the incidents by email.
+package emailnotifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"safer.place/internal/config/secret"
+	"safer.place/internal/notifier"
+)
+
+// TLS modes of the connection to the SMTP server.
+const (
+	// StartTLS upgrades the plain connection, usually on port 587.
+	StartTLS = "starttls"
+	// ImplicitTLS connects with TLS straight away, usually on port 465.
+	ImplicitTLS = "tls"
+	// NoTLS sends the emails in plain text, and should only be used with a local relay.
+	NoTLS = "none"
+)
+
+// Config of the SMTP server the emails are sent through.
+type Config struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port" default:"587"`
+	// TLS is either starttls, tls or none.
+	TLS string `yaml:"tls" default:"starttls"`
+	// Username and Password are used to log in, if the username is set.
+	Username string        `yaml:"username"`
+	Password secret.Secret `yaml:"password"`
+
+	// From is the address the emails are sent from.
+	From string `yaml:"from"`
+	// To are the addresses of the reviewers, who each get the same email.
+	To []string `yaml:"to"`
+
+	// Timeout of each attempt to send the email.
+	Timeout time.Duration `yaml:"timeout" default:"30s"`
+	// MaxAttempts to send the email when the SMTP server fails temporarily.
+	MaxAttempts int `yaml:"max_attempts" split_words:"true" default:"3"`
+	// Backoff before the first retry, doubled on each retry.
+	Backoff time.Duration `yaml:"backoff" default:"1s"`
+}
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templates, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/*.html"))
+)
+
+// Notifier sends an email to the reviewers about each incident.
+type Notifier struct {
+	cfg       Config
+	addr      string
+	from      string
+	to        []string
+	reviewURL string
+}
+
+// New creates a new email notifier
+func New(cfg *Config, opts ...Option) (*Notifier, error) {
+	if err := validate(cfg); err != nil {
+		return nil, err
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+	to := make([]string, 0, len(cfg.To))
+	for _, addr := range cfg.To {
+		parsed, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", addr, err)
+		}
+		to = append(to, parsed.Address)
+	}
+
+	n := &Notifier{
+		cfg:       *cfg,
+		addr:      net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		from:      from.Address,
+		to:        to,
+		reviewURL: "https://review.safer.place/",
+	}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	return n, nil
+}
+
+// Notify sends the email about the incident to all the reviewers. Sending is retried when the
+// SMTP server fails temporarily.
+func (n *Notifier) Notify(ctx context.Context, i *incident.Incident) error {
+	data, err := n.templateData(i)
+	if err != nil {
+		return err
+	}
+	msg, err := n.message("incident", i.Id, "New incident for review: "+data.Location, data)
+	if err != nil {
+		return fmt.Errorf("unable to create email: %w", err)
+	}
+
+	return n.deliver(ctx, msg)
+}
+
+// NotifyDigest sends a single email listing the incidents to all the reviewers.
+func (n *Notifier) NotifyDigest(ctx context.Context, incidents []*incident.Incident) error {
+	data := digestData{ReviewURL: n.reviewURL}
+	for _, i := range incidents {
+		d, err := n.templateData(i)
+		if err != nil {
+			return err
+		}
+		data.Incidents = append(data.Incidents, d)
+	}
+
+	subject := fmt.Sprintf("%d new incidents for review", len(incidents))
+	if len(incidents) == 1 {
+		subject = "1 new incident for review"
+	}
+	msg, err := n.message("digest", "digest", subject, data)
+	if err != nil {
+		return fmt.Errorf("unable to create email: %w", err)
+	}
+
+	return n.deliver(ctx, msg)
+}
+
+// deliver the message, retrying when the SMTP server fails temporarily.
+func (n *Notifier) deliver(ctx context.Context, msg []byte) error {
+	var err error
+	backoff := n.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		err = n.send(ctx, msg)
+		if err == nil {
+			return nil
+		}
+		if attempt >= n.cfg.MaxAttempts || !transient(err) {
+			return fmt.Errorf("unable to send email after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("unable to send email: %w", errors.Join(err, ctx.Err()))
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// transient returns whether sending the email can succeed if it's tried again. The SMTP servers
+// reply with 4xx codes to the temporary failures and 5xx codes to the permanent ones, while the
+// network errors are always worth retrying.
+func transient(err error) bool {
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
+	}
+	return !errors.Is(err, errNoStartTLS)
+}
+
+// send the message in a single SMTP session.
+func (n *Notifier) send(ctx context.Context, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, n.cfg.Timeout)
+	defer cancel()
+
+	conn, err := n.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to connect: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return fmt.Errorf("unable to set deadline: %w", err)
+		}
+	}
+
+	c, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		return fmt.Errorf("unable to start session: %w", err)
+	}
+	defer c.Close()
+
+	if n.cfg.TLS == StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errNoStartTLS
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: n.cfg.Host}); err != nil {
+			return fmt.Errorf("unable to start TLS: %w", err)
+		}
+	}
+
+	if n.cfg.Username != "" {
+		auth := smtp.PlainAuth("", n.cfg.Username, string(n.cfg.Password), n.cfg.Host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("unable to log in: %w", err)
+		}
+	}
+
+	if err := c.Mail(n.from); err != nil {
+		return fmt.Errorf("unable to set sender: %w", err)
+	}
+	for _, to := range n.to {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("unable to add recipient: %w", err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("unable to start email: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("unable to write email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("unable to send email: %w", err)
+	}
+
+	// The server accepted the email, so it must not be sent again when the session doesn't end
+	// cleanly.
+	_ = c.Quit()
+	return nil
+}
+
+func (n *Notifier) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	if n.cfg.TLS == ImplicitTLS {
+		tlsDialer := &tls.Dialer{
+			NetDialer: dialer,
+			Config:    &tls.Config{ServerName: n.cfg.Host},
+		}
+		return tlsDialer.DialContext(ctx, "tcp", n.addr)
+	}
+	return dialer.DialContext(ctx, "tcp", n.addr)
+}
+
+// templateData is passed to the templates of the email.
+type templateData struct {
+	Incident  *incident.Incident
+	Location  string
+	MapURL    string
+	ReviewURL string
+	// Reported is when the incident was reported, empty if it's unknown.
+	Reported string
+}
+
+// digestData is passed to the templates of the digest email.
+type digestData struct {
+	Incidents []templateData
+	// ReviewURL is the address of the review UI.
+	ReviewURL string
+}
+
+func (n *Notifier) templateData(i *incident.Incident) (templateData, error) {
+	reviewURL, err := notifier.ReviewURL(n.reviewURL, i)
+	if err != nil {
+		return templateData{}, fmt.Errorf("unable to create review link: %w", err)
+	}
+	data := templateData{
+		Incident:  i,
+		Location:  notifier.Location(i),
+		MapURL:    notifier.MapURL(i),
+		ReviewURL: reviewURL,
+	}
+	if i.Timestamp != nil {
+		data.Reported = i.Timestamp.AsTime().UTC().Format(time.RFC1123)
+	}
+	return data, nil
+}
+
+// message creates the email from the templates with the name, with both the plain text and HTML
+// versions. The id is part of the message ID.
+func (n *Notifier) message(name, id, subject string, data any) ([]byte, error) {
+	var text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return nil, fmt.Errorf("unable to render text: %w", err)
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return nil, fmt.Errorf("unable to render html: %w", err)
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		// The last part is preferred by the email clients.
+		{contentType: "text/plain; charset=utf-8", content: text.Bytes()},
+		{contentType: "text/html; charset=utf-8", content: html.Bytes()},
+	} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	for _, header := range [][2]string{
+		{"From", n.cfg.From},
+		{"To", strings.Join(n.cfg.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID(id, n.from)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + w.Boundary()},
+	} {
+		fmt.Fprintf(&msg, "%s: %s\r\n", header[0], header[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// messageID is unique to each email, and the same for each attempt to send it.
+func messageID(id, from string) string {
+	domain := "safer.place"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+
+	random := make([]byte, 8)
+	_, _ = rand.Read(random)
+	return fmt.Sprintf("<%s.%s@%s>", id, hex.EncodeToString(random), domain)
+}
+
+var (
+	errMissingHost       = errors.New("missing SMTP host")
+	errMissingFrom       = errors.New("missing from address")
+	errMissingRecipients = errors.New("missing recipients")
+	errUnknownTLS        = errors.New("unknown TLS mode")
+	errInvalidAttempts   = errors.New("max attempts must be positive")
+	errInvalidTimeout    = errors.New("timeout must be positive")
+	errNoStartTLS        = errors.New("SMTP server doesn't support STARTTLS")
+	errUnencryptedLogin  = errors.New("logging in without TLS is only allowed to localhost")
+)
+
+func validate(cfg *Config) error {
+	if cfg == nil || cfg.Host == "" {
+		return errMissingHost
+	}
+	if cfg.From == "" {
+		return errMissingFrom
+	}
+	if len(cfg.To) == 0 {
+		return errMissingRecipients
+	}
+	if !slices.Contains([]string{StartTLS, ImplicitTLS, NoTLS}, cfg.TLS) {
+		return fmt.Errorf("%w: %q", errUnknownTLS, cfg.TLS)
+	}
+	// smtp.PlainAuth refuses to send the password in plain text to any other host, which would
+	// fail every email.
+	if cfg.Username != "" && cfg.TLS == NoTLS && !isLocalhost(cfg.Host) {
+		return fmt.Errorf("%w: %q", errUnencryptedLogin, cfg.Host)
+	}
+	if cfg.MaxAttempts <= 0 {
+		return errInvalidAttempts
+	}
+	if cfg.Timeout <= 0 {
+		return errInvalidTimeout
+	}
+	return nil
+}
+
+// isLocalhost returns whether smtp.PlainAuth sends the password to the host without TLS.
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
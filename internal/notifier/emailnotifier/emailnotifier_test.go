@@ -0,0 +1,427 @@
+package emailnotifier
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeServer is an SMTP server which accepts the emails, and replies to the MAIL commands with
+// the queued replies before accepting them.
+type fakeServer struct {
+	addr string
+
+	mu          sync.Mutex
+	mailReplies []string
+	quitReply   string
+	sessions    int
+	auth        string
+	recipients  []string
+	messages    []string
+}
+
+func newFakeServer(t *testing.T, mailReplies ...string) *fakeServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &fakeServer{addr: l.Addr().String(), mailReplies: mailReplies}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+
+	s.mu.Lock()
+	s.sessions++
+	s.mu.Unlock()
+
+	_ = c.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			_ = c.PrintfLine("250-localhost")
+			_ = c.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			s.mu.Lock()
+			s.auth = strings.TrimPrefix(arg, "PLAIN ")
+			s.mu.Unlock()
+			_ = c.PrintfLine("235 Authenticated")
+		case "MAIL":
+			s.mu.Lock()
+			reply := "250 OK"
+			if len(s.mailReplies) > 0 {
+				reply, s.mailReplies = s.mailReplies[0], s.mailReplies[1:]
+			}
+			s.mu.Unlock()
+			_ = c.PrintfLine("%s", reply)
+		case "RCPT":
+			s.mu.Lock()
+			s.recipients = append(s.recipients, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			s.mu.Unlock()
+			_ = c.PrintfLine("250 OK")
+		case "DATA":
+			_ = c.PrintfLine("354 Go ahead")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mu.Unlock()
+			_ = c.PrintfLine("250 Queued")
+		case "QUIT":
+			s.mu.Lock()
+			reply := s.quitReply
+			s.mu.Unlock()
+			if reply == "" {
+				reply = "221 Bye"
+			}
+			_ = c.PrintfLine("%s", reply)
+			return
+		default:
+			_ = c.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func (s *fakeServer) config() *Config {
+	host, port, _ := net.SplitHostPort(s.addr)
+	p, _ := strconv.Atoi(port)
+	return &Config{
+		Host:        host,
+		Port:        p,
+		TLS:         NoTLS,
+		From:        "SaferPlace <noreply@safer.place>",
+		To:          []string{"alice@example.com", "Bob <bob@example.com>"},
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+	}
+}
+
+var testIncident = &incident.Incident{
+	Id:          "incident",
+	Timestamp:   timestamppb.New(time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)),
+	Description: "Parked on the footpath <again>",
+	Location:    incident.Location_LOCATION_OUTSIDE,
+	Coordinates: &incident.Coordinates{Lat: 53.35, Lon: -6.26},
+}
+
+func TestNotify(t *testing.T) {
+	srv := newFakeServer(t)
+	cfg := srv.config()
+	cfg.Username = "user"
+	cfg.Password = "password"
+
+	n, err := New(cfg, ReviewURL("https://review.example.com/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), testIncident); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.messages) != 1 {
+		t.Fatalf("server received %d emails, want 1", len(srv.messages))
+	}
+	if got := strings.Join(srv.recipients, ","); got != "alice@example.com,bob@example.com" {
+		t.Errorf("recipients = %s, want alice and bob", got)
+	}
+	if auth, _ := base64.StdEncoding.DecodeString(srv.auth); string(auth) != "\x00user\x00password" {
+		t.Errorf("auth = %q, want the username and password", auth)
+	}
+
+	subject, parts := readEmail(t, srv.messages[0])
+	if subject != "New incident for review: Outside" {
+		t.Errorf("Subject = %q, want the location", subject)
+	}
+
+	for contentType, want := range map[string][]string{
+		"text/plain": {
+			"Parked on the footpath <again>",
+			"https://review.example.com/incident/incident",
+			"openstreetmap.org/?mlat=53.350000&mlon=-6.260000",
+		},
+		"text/html": {
+			"Parked on the footpath &lt;again&gt;",
+			`href="https://review.example.com/incident/incident"`,
+		},
+	} {
+		for _, w := range want {
+			if !strings.Contains(parts[contentType], w) {
+				t.Errorf("%s part doesn't contain %q:\n%s", contentType, w, parts[contentType])
+			}
+		}
+	}
+}
+
+// readEmail returns the subject of the email and the content of each of its parts.
+func readEmail(t *testing.T, raw string) (string, map[string]string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("unable to read email: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Errorf("invalid subject: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %s, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+
+	parts := make(map[string]string)
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(content)
+	}
+
+	return subject, parts
+}
+
+func TestNotifyDigest(t *testing.T) {
+	srv := newFakeServer(t)
+	n, err := New(srv.config(), ReviewURL("https://review.example.com/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := &incident.Incident{
+		Id:          "other",
+		Description: "Blocking the bus lane",
+		Location:    incident.Location_LOCATION_TRANSPORTATION,
+	}
+	if err := n.NotifyDigest(context.Background(), []*incident.Incident{testIncident, other}); err != nil {
+		t.Fatalf("NotifyDigest() = %v", err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.messages) != 1 {
+		t.Fatalf("server received %d emails, want 1", len(srv.messages))
+	}
+
+	subject, parts := readEmail(t, srv.messages[0])
+	if subject != "2 new incidents for review" {
+		t.Errorf("Subject = %q, want the number of incidents", subject)
+	}
+	for contentType, want := range map[string][]string{
+		"text/plain": {
+			"2 new incidents are up for review.",
+			"Parked on the footpath <again>",
+			"https://review.example.com/incident/incident",
+			"Blocking the bus lane",
+			"https://review.example.com/incident/other",
+		},
+		"text/html": {
+			"Parked on the footpath &lt;again&gt;",
+			`href="https://review.example.com/incident/other"`,
+			`href="https://review.example.com/"`,
+		},
+	} {
+		for _, w := range want {
+			if !strings.Contains(parts[contentType], w) {
+				t.Errorf("%s part doesn't contain %q:\n%s", contentType, w, parts[contentType])
+			}
+		}
+	}
+}
+
+func TestNotifyRetries(t *testing.T) {
+	testCases := map[string]struct {
+		replies  []string
+		quit     string
+		err      bool
+		sessions int
+	}{
+		"temporary failure": {
+			replies:  []string{"451 Try again later"},
+			sessions: 2,
+		},
+		"permanent failure": {
+			replies:  []string{"550 Mailbox unavailable"},
+			err:      true,
+			sessions: 1,
+		},
+		"too many failures": {
+			replies:  []string{"421 Busy", "421 Busy", "421 Busy"},
+			err:      true,
+			sessions: 3,
+		},
+		// The email was already accepted, so it isn't sent twice.
+		"quit failure": {
+			quit:     "421 Closing",
+			sessions: 1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			srv := newFakeServer(t, tc.replies...)
+			srv.quitReply = tc.quit
+			n, err := New(srv.config())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = n.Notify(context.Background(), testIncident)
+			if (err != nil) != tc.err {
+				t.Errorf("Notify() = %v, want error %v", err, tc.err)
+			}
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if srv.sessions != tc.sessions {
+				t.Errorf("Notify() tried %d times, want %d", srv.sessions, tc.sessions)
+			}
+			if !tc.err && len(srv.messages) != 1 {
+				t.Errorf("server received %d emails, want 1", len(srv.messages))
+			}
+		})
+	}
+}
+
+func TestNotifyUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	// The connection errors are retried.
+	srv := &fakeServer{addr: addr}
+	cfg := srv.config()
+	cfg.MaxAttempts = 2
+	n, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = n.Notify(context.Background(), testIncident)
+	if err == nil || !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Errorf("Notify() = %v, want the connection error after 2 attempts", err)
+	}
+}
+
+func TestNotifyStartTLS(t *testing.T) {
+	srv := newFakeServer(t)
+	cfg := srv.config()
+	cfg.TLS = StartTLS
+	n, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server doesn't advertise STARTTLS, so the email isn't sent in plain text.
+	if err := n.Notify(context.Background(), testIncident); !errors.Is(err, errNoStartTLS) {
+		t.Errorf("Notify() = %v, want %v", err, errNoStartTLS)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.sessions != 1 || len(srv.messages) != 0 {
+		t.Errorf("Notify() tried %d times and sent %d emails, want a single try", srv.sessions, len(srv.messages))
+	}
+}
+
+func TestNew(t *testing.T) {
+	valid := func() *Config {
+		return &Config{
+			Host:        "smtp.example.com",
+			TLS:         StartTLS,
+			From:        "noreply@safer.place",
+			To:          []string{"alice@example.com"},
+			Timeout:     time.Second,
+			MaxAttempts: 1,
+		}
+	}
+
+	testCases := map[string]struct {
+		modify func(*Config)
+		err    error
+	}{
+		"valid":         {modify: func(*Config) {}},
+		"missing host":  {modify: func(c *Config) { c.Host = "" }, err: errMissingHost},
+		"missing from":  {modify: func(c *Config) { c.From = "" }, err: errMissingFrom},
+		"no recipients": {modify: func(c *Config) { c.To = nil }, err: errMissingRecipients},
+		"unknown tls":   {modify: func(c *Config) { c.TLS = "ssl" }, err: errUnknownTLS},
+		"no attempts":   {modify: func(c *Config) { c.MaxAttempts = 0 }, err: errInvalidAttempts},
+		"no timeout":    {modify: func(c *Config) { c.Timeout = 0 }, err: errInvalidTimeout},
+		"login without tls": {
+			modify: func(c *Config) { c.TLS, c.Username = NoTLS, "saferplace" },
+			err:    errUnencryptedLogin,
+		},
+		"login without tls to localhost": {
+			modify: func(c *Config) { c.Host, c.TLS, c.Username = "localhost", NoTLS, "saferplace" },
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cfg := valid()
+			tc.modify(cfg)
+			if _, err := New(cfg); !errors.Is(err, tc.err) {
+				t.Errorf("New() = %v, want %v", err, tc.err)
+			}
+		})
+	}
+
+	if _, err := New(nil); !errors.Is(err, errMissingHost) {
+		t.Errorf("New(nil) = %v, want %v", err, errMissingHost)
+	}
+	cfg := valid()
+	cfg.To = []string{"not an address"}
+	if _, err := New(cfg); err == nil {
+		t.Error("New() = nil, want the invalid recipient")
+	}
+}
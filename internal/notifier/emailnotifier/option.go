@@ -0,0 +1,11 @@
+package emailnotifier
+
+// Option to provide configuration to the notifier.
+type Option func(*Notifier)
+
+// ReviewURL provides the address of the review UI, which the incidents are linked to.
+func ReviewURL(u string) Option {
+	return func(n *Notifier) {
+		n.reviewURL = u
+	}
+}
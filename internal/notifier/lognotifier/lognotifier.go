@@ -2,24 +2,47 @@ package lognotifier
 
 import (
 	"context"
-	"fmt"
 	"log/slog"
 
 	"api.safer.place/incident/v1"
 	"safer.place/internal/log"
+	"safer.place/internal/notifier"
 )
 
 type Notifier struct {
-	log log.Logger
+	log       log.Logger
+	reviewURL string
 }
 
-func New(log log.Logger) *Notifier {
-	return &Notifier{log: log}
+// New creates the notifier logging the links to the incidents in the review UI at reviewURL.
+func New(log log.Logger, reviewURL string) *Notifier {
+	return &Notifier{log: log, reviewURL: reviewURL}
 }
 
 func (n *Notifier) Notify(ctx context.Context, inc *incident.Incident) error {
+	u, err := notifier.ReviewURL(n.reviewURL, inc)
+	if err != nil {
+		return err
+	}
 	n.log.Info(ctx, "incident for review",
-		slog.String("url", fmt.Sprintf("https://review.safer.place/incident/%s", inc.Id)),
+		slog.String("url", u),
+	)
+	return nil
+}
+
+// NotifyDigest logs the links to all the incidents at once.
+func (n *Notifier) NotifyDigest(ctx context.Context, incidents []*incident.Incident) error {
+	urls := make([]string, 0, len(incidents))
+	for _, inc := range incidents {
+		u, err := notifier.ReviewURL(n.reviewURL, inc)
+		if err != nil {
+			return err
+		}
+		urls = append(urls, u)
+	}
+	n.log.Info(ctx, "incidents for review",
+		slog.Int("count", len(incidents)),
+		slog.Any("urls", urls),
 	)
 	return nil
 }
@@ -0,0 +1,104 @@
+package multinotifier
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"api.safer.place/incident/v1"
+)
+
+// Filter selects the incidents a channel is notified about. The empty filter matches all the
+// incidents, and each set field narrows them down further.
+type Filter struct {
+	// Locations where the incident happened: outside, inside or transportation.
+	Locations []string `yaml:"locations"`
+	// Region the incident happened in. The incidents without coordinates never match it.
+	Region *Region `yaml:"region"`
+	// Image, if set, matches only the incidents with an image when true, and without one when
+	// false.
+	Image *bool `yaml:"image"`
+	// Keywords of which at least one appears in the description, ignoring the case.
+	Keywords []string `yaml:"keywords"`
+}
+
+// Region is the bounding box of the coordinates in degrees. Regions crossing the antimeridian
+// have the west edge east of the east edge.
+type Region struct {
+	North float64 `yaml:"north"`
+	South float64 `yaml:"south"`
+	East  float64 `yaml:"east"`
+	West  float64 `yaml:"west"`
+}
+
+// Match reports whether the incident passes the filter.
+func (f *Filter) Match(i *incident.Incident) bool {
+	if len(f.Locations) > 0 && !f.matchLocation(i.Location) {
+		return false
+	}
+	if f.Region != nil && !f.Region.contains(i.Coordinates) {
+		return false
+	}
+	if f.Image != nil && *f.Image != (i.ImageId != "") {
+		return false
+	}
+	if len(f.Keywords) > 0 && !f.matchKeywords(i.Description) {
+		return false
+	}
+	return true
+}
+
+func (f *Filter) matchLocation(l incident.Location) bool {
+	for _, location := range f.Locations {
+		if locationValue(location) == l {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Filter) matchKeywords(description string) bool {
+	description = strings.ToLower(description)
+	for _, keyword := range f.Keywords {
+		if strings.Contains(description, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Region) contains(c *incident.Coordinates) bool {
+	if c == nil || c.Lat > r.North || c.Lat < r.South {
+		return false
+	}
+	if r.West <= r.East {
+		return c.Lon >= r.West && c.Lon <= r.East
+	}
+	return c.Lon >= r.West || c.Lon <= r.East
+}
+
+// locationValue returns the location with the name, such as outside for LOCATION_OUTSIDE.
+func locationValue(name string) incident.Location {
+	return incident.Location(incident.Location_value["LOCATION_"+strings.ToUpper(name)])
+}
+
+var (
+	errUnknownLocation = errors.New("unknown location")
+	errInvalidRegion   = errors.New("invalid region")
+)
+
+// Validate checks the locations are known and the region is within the coordinates.
+func (f *Filter) Validate() error {
+	for _, location := range f.Locations {
+		if locationValue(location) == incident.Location_LOCATION_UNSPECIFIED {
+			return fmt.Errorf("%w: %q", errUnknownLocation, location)
+		}
+	}
+	if r := f.Region; r != nil {
+		if r.South > r.North || r.North > 90 || r.South < -90 ||
+			r.West < -180 || r.West > 180 || r.East < -180 || r.East > 180 {
+			return fmt.Errorf("%w: %+v", errInvalidRegion, *r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Package multinotifier notifies several channels about each incident, each only about the
+// incidents matching its filter.
+package multinotifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"safer.place/internal/log"
+	"safer.place/internal/notifier"
+)
+
+// Defaults of the policy fields which are not set.
+const (
+	defaultTimeout = 30 * time.Second
+	defaultBackoff = time.Second
+)
+
+// Policy of notifying the channel.
+type Policy struct {
+	// Attempts to notify the channel before giving up, 1 if not set.
+	Attempts int `yaml:"attempts"`
+	// Backoff before the first retry, doubled on each retry. 1s if not set.
+	Backoff time.Duration `yaml:"backoff"`
+	// Timeout of each attempt, 30s if not set.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.Attempts <= 0 {
+		p.Attempts = 1
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = defaultBackoff
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = defaultTimeout
+	}
+	return p
+}
+
+// Channel is a notifier which is only notified about the incidents matching the filter.
+type Channel struct {
+	// Name identifies the channel in the logs.
+	Name     string
+	Notifier notifier.Notifier
+	Filter   Filter
+	Policy   Policy
+}
+
+// Notifier notifies all the matching channels at the same time.
+type Notifier struct {
+	channels []Channel
+	log      log.Logger
+}
+
+// New creates the notifier of the channels.
+func New(channels []Channel, opts ...Option) (*Notifier, error) {
+	n := &Notifier{}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	if n.log == nil {
+		return nil, errMissingLogger
+	}
+	if len(channels) == 0 {
+		return nil, errMissingChannels
+	}
+	for _, c := range channels {
+		if c.Notifier == nil {
+			return nil, fmt.Errorf("%w: %s", errMissingNotifier, c.Name)
+		}
+		if err := c.Filter.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid filter of channel %s: %w", c.Name, err)
+		}
+		c.Policy = c.Policy.withDefaults()
+		n.channels = append(n.channels, c)
+	}
+
+	return n, nil
+}
+
+// Notify the channels matching the incident. The channels which fail are retried according to
+// their policy, and their failures are logged without failing the others. The error is only
+// returned if none of the matching channels were notified.
+func (n *Notifier) Notify(ctx context.Context, i *incident.Incident) error {
+	return n.fanOut(ctx, []*incident.Incident{i}, func(ctx context.Context, c Channel, _ []*incident.Incident) error {
+		return c.Notifier.Notify(ctx, i)
+	})
+}
+
+// NotifyDigest sends each channel the summary of the incidents matching its filter, in the same
+// way as Notify.
+func (n *Notifier) NotifyDigest(ctx context.Context, incidents []*incident.Incident) error {
+	return n.fanOut(ctx, incidents, func(ctx context.Context, c Channel, matching []*incident.Incident) error {
+		return notifier.NotifyDigest(ctx, c.Notifier, matching)
+	})
+}
+
+// fanOut calls notify with each channel and the incidents matching it at the same time.
+func (n *Notifier) fanOut(
+	ctx context.Context,
+	incidents []*incident.Incident,
+	notify func(context.Context, Channel, []*incident.Incident) error,
+) error {
+	ids := make([]string, 0, len(incidents))
+	for _, i := range incidents {
+		ids = append(ids, i.Id)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		matched int
+		errs    []error
+	)
+	for _, c := range n.channels {
+		var matching []*incident.Incident
+		for _, i := range incidents {
+			if c.Filter.Match(i) {
+				matching = append(matching, i)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+		matched++
+
+		wg.Add(1)
+		go func(c Channel) {
+			defer wg.Done()
+
+			if err := n.retry(ctx, c, func(ctx context.Context) error {
+				return notify(ctx, c, matching)
+			}); err != nil {
+				n.log.Error(ctx, "unable to notify channel",
+					slog.String("channel", c.Name),
+					slog.Any("ids", ids),
+					log.Error(err),
+				)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("channel %s: %w", c.Name, err))
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	if matched == 0 {
+		n.log.Warn(ctx, "no channel matches the incidents", slog.Any("ids", ids))
+		return nil
+	}
+	if len(errs) == matched {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// retry notifying the channel according to its policy.
+func (n *Notifier) retry(ctx context.Context, c Channel, notify func(context.Context) error) error {
+	backoff := c.Policy.Backoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, c.Policy.Timeout)
+		err := notify(attemptCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt >= c.Policy.Attempts {
+			return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+var (
+	errMissingLogger   = errors.New("missing logger")
+	errMissingChannels = errors.New("missing channels")
+	errMissingNotifier = errors.New("missing notifier of channel")
+)
@@ -0,0 +1,317 @@
+package multinotifier
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+
+	"safer.place/internal/log"
+)
+
+// fakeNotifier fails the first failures notifications, and blocks until the context is done if
+// it hangs.
+type fakeNotifier struct {
+	mu       sync.Mutex
+	failures int
+	hangs    bool
+	calls    int
+	notified []string
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, i *incident.Incident) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.calls++
+	if n.hangs {
+		n.mu.Unlock()
+		<-ctx.Done()
+		n.mu.Lock()
+		return ctx.Err()
+	}
+	if n.failures > 0 {
+		n.failures--
+		return errors.New("notification failed")
+	}
+	n.notified = append(n.notified, i.Id)
+	return nil
+}
+
+func TestFilter(t *testing.T) {
+	yes, no := true, false
+	dublin := &Region{North: 53.5, South: 53.2, East: -6, West: -6.5}
+	// The region crossing the antimeridian.
+	fiji := &Region{North: -15, South: -20, East: -178, West: 177}
+
+	testCases := map[string]struct {
+		filter Filter
+		inc    *incident.Incident
+		want   bool
+	}{
+		"empty": {
+			inc:  &incident.Incident{},
+			want: true,
+		},
+		"location": {
+			filter: Filter{Locations: []string{"inside", "transportation"}},
+			inc:    &incident.Incident{Location: incident.Location_LOCATION_TRANSPORTATION},
+			want:   true,
+		},
+		"other location": {
+			filter: Filter{Locations: []string{"inside"}},
+			inc:    &incident.Incident{Location: incident.Location_LOCATION_OUTSIDE},
+		},
+		"in region": {
+			filter: Filter{Region: dublin},
+			inc:    &incident.Incident{Coordinates: &incident.Coordinates{Lat: 53.35, Lon: -6.26}},
+			want:   true,
+		},
+		"outside region": {
+			filter: Filter{Region: dublin},
+			inc:    &incident.Incident{Coordinates: &incident.Coordinates{Lat: 51.9, Lon: -8.47}},
+		},
+		"without coordinates": {
+			filter: Filter{Region: dublin},
+			inc:    &incident.Incident{},
+		},
+		"across antimeridian": {
+			filter: Filter{Region: fiji},
+			inc:    &incident.Incident{Coordinates: &incident.Coordinates{Lat: -17, Lon: 179}},
+			want:   true,
+		},
+		"across antimeridian west": {
+			filter: Filter{Region: fiji},
+			inc:    &incident.Incident{Coordinates: &incident.Coordinates{Lat: -17, Lon: -179}},
+			want:   true,
+		},
+		"outside antimeridian region": {
+			filter: Filter{Region: fiji},
+			inc:    &incident.Incident{Coordinates: &incident.Coordinates{Lat: -17, Lon: 170}},
+		},
+		"with image": {
+			filter: Filter{Image: &yes},
+			inc:    &incident.Incident{ImageId: "image"},
+			want:   true,
+		},
+		"image required": {
+			filter: Filter{Image: &yes},
+			inc:    &incident.Incident{},
+		},
+		"without image": {
+			filter: Filter{Image: &no},
+			inc:    &incident.Incident{ImageId: "image"},
+		},
+		"keyword": {
+			filter: Filter{Keywords: []string{"bus lane", "footpath"}},
+			inc:    &incident.Incident{Description: "Parked on the Footpath"},
+			want:   true,
+		},
+		"no keyword": {
+			filter: Filter{Keywords: []string{"bus lane"}},
+			inc:    &incident.Incident{Description: "Parked on the footpath"},
+		},
+		"all fields": {
+			filter: Filter{
+				Locations: []string{"outside"},
+				Region:    dublin,
+				Image:     &yes,
+				Keywords:  []string{"footpath"},
+			},
+			inc: &incident.Incident{
+				Location:    incident.Location_LOCATION_OUTSIDE,
+				Coordinates: &incident.Coordinates{Lat: 53.35, Lon: -6.26},
+				ImageId:     "image",
+				Description: "Parked on the footpath",
+			},
+			want: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.filter.Match(tc.inc); got != tc.want {
+				t.Errorf("Match() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	dublin, cork := &fakeNotifier{}, &fakeNotifier{}
+	flaky := &fakeNotifier{failures: 1}
+	broken := &fakeNotifier{failures: 100}
+	hanging := &fakeNotifier{hangs: true}
+
+	n, err := New([]Channel{
+		{
+			Name:     "dublin",
+			Notifier: dublin,
+			Filter:   Filter{Region: &Region{North: 53.5, South: 53.2, East: -6, West: -6.5}},
+		},
+		{
+			Name:     "cork",
+			Notifier: cork,
+			Filter:   Filter{Region: &Region{North: 52, South: 51.8, East: -8.3, West: -8.6}},
+		},
+		{
+			Name:     "flaky",
+			Notifier: flaky,
+			Policy:   Policy{Attempts: 2, Backoff: time.Millisecond},
+		},
+		{
+			Name:     "broken",
+			Notifier: broken,
+			Policy:   Policy{Attempts: 3, Backoff: time.Millisecond},
+		},
+		{
+			Name:     "hanging",
+			Notifier: hanging,
+			Policy:   Policy{Timeout: 10 * time.Millisecond},
+		},
+	}, Logger(log.New(slog.Default().Handler())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The failing and hanging channels don't stop the others from being notified.
+	if err := n.Notify(context.Background(), &incident.Incident{
+		Id:          "incident",
+		Coordinates: &incident.Coordinates{Lat: 53.35, Lon: -6.26},
+	}); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		notifier *fakeNotifier
+		calls    int
+		notified int
+	}{
+		"dublin":  {notifier: dublin, calls: 1, notified: 1},
+		"cork":    {notifier: cork},
+		"flaky":   {notifier: flaky, calls: 2, notified: 1},
+		"broken":  {notifier: broken, calls: 3},
+		"hanging": {notifier: hanging, calls: 1},
+	} {
+		if tc.notifier.calls != tc.calls || len(tc.notifier.notified) != tc.notified {
+			t.Errorf("%s called %d times and notified %d times, want %d and %d",
+				name, tc.notifier.calls, len(tc.notifier.notified), tc.calls, tc.notified)
+		}
+	}
+}
+
+// fakeDigestNotifier records the digests it's sent.
+type fakeDigestNotifier struct {
+	fakeNotifier
+	digests [][]string
+}
+
+func (n *fakeDigestNotifier) NotifyDigest(_ context.Context, incidents []*incident.Incident) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var ids []string
+	for _, i := range incidents {
+		ids = append(ids, i.Id)
+	}
+	n.digests = append(n.digests, ids)
+	return nil
+}
+
+func TestNotifyDigest(t *testing.T) {
+	outside, images := &fakeDigestNotifier{}, &fakeNotifier{}
+	yes := true
+	n, err := New([]Channel{
+		{Name: "outside", Notifier: outside, Filter: Filter{Locations: []string{"outside"}}},
+		{Name: "images", Notifier: images, Filter: Filter{Image: &yes}},
+		{Name: "unmatched", Notifier: &fakeNotifier{failures: 1}, Filter: Filter{Keywords: []string{"other"}}},
+	}, Logger(log.New(slog.Default().Handler())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.NotifyDigest(context.Background(), []*incident.Incident{
+		{Id: "first", Location: incident.Location_LOCATION_OUTSIDE},
+		{Id: "second", Location: incident.Location_LOCATION_INSIDE, ImageId: "image"},
+		{Id: "third", Location: incident.Location_LOCATION_OUTSIDE, ImageId: "image"},
+	}); err != nil {
+		t.Fatalf("NotifyDigest() = %v", err)
+	}
+
+	// The channels only get the matching incidents, summarised if they can be.
+	if len(outside.digests) != 1 || strings.Join(outside.digests[0], ",") != "first,third" {
+		t.Errorf("outside channel got %v, want the digest of first and third", outside.digests)
+	}
+	if strings.Join(images.notified, ",") != "second,third" {
+		t.Errorf("images channel got %v, want second and third", images.notified)
+	}
+}
+
+func TestNotifyAllFailed(t *testing.T) {
+	n, err := New([]Channel{
+		{Name: "broken", Notifier: &fakeNotifier{failures: 1}},
+		{Name: "other", Notifier: &fakeNotifier{}, Filter: Filter{Keywords: []string{"other"}}},
+	}, Logger(log.New(slog.Default().Handler())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Notify(context.Background(), &incident.Incident{Id: "incident"}); err == nil {
+		t.Error("Notify() = nil, want the error of the only matching channel")
+	}
+	// No channel matching the incident is not an error.
+	if err := n.Notify(context.Background(), &incident.Incident{Id: "incident", Description: "other"}); err != nil {
+		t.Errorf("Notify() = %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	logger := Logger(log.New(slog.Default().Handler()))
+
+	testCases := map[string]struct {
+		channels []Channel
+		opts     []Option
+		err      error
+	}{
+		"valid": {
+			channels: []Channel{{Name: "all", Notifier: &fakeNotifier{}}},
+			opts:     []Option{logger},
+		},
+		"missing logger": {
+			channels: []Channel{{Name: "all", Notifier: &fakeNotifier{}}},
+			err:      errMissingLogger,
+		},
+		"no channels": {
+			opts: []Option{logger},
+			err:  errMissingChannels,
+		},
+		"missing notifier": {
+			channels: []Channel{{Name: "all"}},
+			opts:     []Option{logger},
+			err:      errMissingNotifier,
+		},
+		"unknown location": {
+			channels: []Channel{{Name: "all", Notifier: &fakeNotifier{}, Filter: Filter{Locations: []string{"underground"}}}},
+			opts:     []Option{logger},
+			err:      errUnknownLocation,
+		},
+		"invalid region": {
+			channels: []Channel{{Name: "all", Notifier: &fakeNotifier{}, Filter: Filter{Region: &Region{North: 10, South: 20}}}},
+			opts:     []Option{logger},
+			err:      errInvalidRegion,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := New(tc.channels, tc.opts...); !errors.Is(err, tc.err) {
+				t.Errorf("New() = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
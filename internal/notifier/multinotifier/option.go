@@ -0,0 +1,13 @@
+package multinotifier
+
+import "safer.place/internal/log"
+
+// Option to provide configuration to the notifier.
+type Option func(*Notifier)
+
+// Logger provides the logger recording the channels which failed.
+func Logger(l log.Logger) Option {
+	return func(n *Notifier) {
+		n.log = l
+	}
+}
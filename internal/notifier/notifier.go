@@ -2,6 +2,9 @@ package notifier
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/url"
 
 	"api.safer.place/incident/v1"
 )
@@ -10,3 +13,57 @@ import (
 type Notifier interface {
 	Notify(context.Context, *incident.Incident) error
 }
+
+// DigestNotifier sends a single notification summarising several incidents.
+type DigestNotifier interface {
+	NotifyDigest(context.Context, []*incident.Incident) error
+}
+
+// NotifyDigest summarises the incidents if the notifier is a DigestNotifier, and otherwise
+// notifies about each of them.
+func NotifyDigest(ctx context.Context, n Notifier, incidents []*incident.Incident) error {
+	if d, ok := n.(DigestNotifier); ok {
+		return d.NotifyDigest(ctx, incidents)
+	}
+
+	var errs []error
+	for _, i := range incidents {
+		if err := n.Notify(ctx, i); err != nil {
+			errs = append(errs, fmt.Errorf("incident %s: %w", i.Id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReviewURL returns the link to the incident in the review UI at base.
+func ReviewURL(base string, i *incident.Incident) (string, error) {
+	return url.JoinPath(base, "incident", i.Id)
+}
+
+// MapURL returns the link to the map showing where the incident happened, or an empty string if
+// the incident has no coordinates.
+func MapURL(i *incident.Incident) string {
+	c := i.Coordinates
+	if c == nil {
+		return ""
+	}
+	return fmt.Sprintf("https://www.openstreetmap.org/?mlat=%.6f&mlon=%.6f#map=18/%.6f/%.6f",
+		c.Lat, c.Lon, c.Lat, c.Lon)
+}
+
+// Location describes where the incident happened.
+func Location(i *incident.Incident) string {
+	switch i.Location {
+	case incident.Location_LOCATION_OUTSIDE:
+		return "Outside"
+	case incident.Location_LOCATION_INSIDE:
+		return "Inside"
+	case incident.Location_LOCATION_TRANSPORTATION:
+		if i.TransportationIdentifier != "" {
+			return "Transportation: " + i.TransportationIdentifier
+		}
+		return "Transportation"
+	default:
+		return "Unknown"
+	}
+}
@@ -0,0 +1,48 @@
+package webhooknotifier
+
+import (
+	"context"
+	"net/http"
+
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+)
+
+// Option to provide configuration to the notifier.
+type Option func(*Notifier)
+
+// Client provides the HTTP client sending the webhooks.
+func Client(c *http.Client) Option {
+	return func(n *Notifier) {
+		n.client = c
+	}
+}
+
+// ReviewURL provides the address of the review UI, which the incidents are linked to.
+func ReviewURL(u string) Option {
+	return func(n *Notifier) {
+		n.reviewURL = u
+	}
+}
+
+// Logger provides the logger recording the deliveries.
+func Logger(l log.Logger) Option {
+	return func(n *Notifier) {
+		n.log = l
+	}
+}
+
+// OnDelivery is called with the outcome of each delivery, after it is logged.
+func OnDelivery(fn func(context.Context, Delivery)) Option {
+	return func(n *Notifier) {
+		n.recorders = append(n.recorders, fn)
+	}
+}
+
+// Deliveries keeps the outcome of each delivery, so the incidents notified about again after
+// failing to be delivered to some of the URLs are only delivered to those.
+func Deliveries(db database.WebhookDeliveries) Option {
+	return func(n *Notifier) {
+		n.deliveries = db
+	}
+}
@@ -0,0 +1,387 @@
+// Package webhooknotifier posts the incidents to the configured URLs, signing each request so
+// the receivers can check it was sent by SaferPlace.
+package webhooknotifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"api.safer.place/incident/v1"
+	"safer.place/internal/config/secret"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/notifier"
+)
+
+// Formats of the request body.
+const (
+	// JSON is the Payload.
+	JSON = "json"
+	// ProtoJSON is the incident.Incident encoded with protojson.
+	ProtoJSON = "protojson"
+)
+
+// Headers sent with each request.
+const (
+	// DeliveryHeader identifies the delivery of the incident to the URL, and is the same for each
+	// attempt to deliver it, including when the incident is notified about again.
+	DeliveryHeader = "X-SaferPlace-Delivery"
+	// TimestampHeader is the Unix time of the attempt, which is part of the signature.
+	TimestampHeader = "X-SaferPlace-Timestamp"
+	// SignatureHeader is the signature of the request, see Sign.
+	SignatureHeader = "X-SaferPlace-Signature"
+)
+
+// Config of the webhooks.
+type Config struct {
+	// URLs each incident is posted to.
+	URLs []string `yaml:"urls"`
+	// Secret the requests are signed with, shared with the receivers.
+	Secret secret.Secret `yaml:"secret"`
+	// Format of the request body, either json or protojson.
+	Format string `yaml:"format" default:"json"`
+
+	// Timeout of each attempt to deliver the incident.
+	Timeout time.Duration `yaml:"timeout" default:"10s"`
+	// MaxAttempts to deliver the incident to each URL.
+	MaxAttempts int `yaml:"max_attempts" split_words:"true" default:"3"`
+	// Backoff before the first retry, doubled on each retry.
+	Backoff time.Duration `yaml:"backoff" default:"1s"`
+}
+
+// Payload is the body of the json requests.
+type Payload struct {
+	ID          string       `json:"id"`
+	Timestamp   time.Time    `json:"timestamp"`
+	Location    string       `json:"location"`
+	Coordinates *Coordinates `json:"coordinates,omitempty"`
+	Description string       `json:"description"`
+	ImageID     string       `json:"image_id,omitempty"`
+	ReviewURL   string       `json:"review_url"`
+}
+
+// Coordinates of the incident.
+type Coordinates struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Delivery is the outcome of delivering the incident to one of the URLs.
+type Delivery struct {
+	ID         string
+	URL        string
+	IncidentID string
+	Attempts   int
+	// StatusCode of the last response, zero if there was none.
+	StatusCode int
+	// Err is nil if the incident was delivered.
+	Err error
+}
+
+// Notifier posts the incidents to the webhooks.
+type Notifier struct {
+	cfg       Config
+	client    *http.Client
+	reviewURL string
+	// recorders are called with the outcome of each delivery.
+	recorders []func(context.Context, Delivery)
+	// deliveries keep the outcome of each delivery, if set, so the incidents notified about again
+	// are only delivered to the URLs which didn't get them.
+	deliveries database.WebhookDeliveries
+	log        log.Logger
+}
+
+// New creates a new webhook notifier
+func New(cfg *Config, opts ...Option) (*Notifier, error) {
+	if err := validate(cfg); err != nil {
+		return nil, err
+	}
+
+	n := &Notifier{
+		cfg:       *cfg,
+		client:    &http.Client{},
+		reviewURL: "https://review.safer.place/",
+	}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	if n.log == nil {
+		return nil, errMissingLogger
+	}
+	return n, nil
+}
+
+// Notify posts the incident to all the URLs at the same time. It fails if the incident wasn't
+// delivered to every one of them, and the deliveries have the same IDs when it's notified about
+// again. With the deliveries kept, the URLs which got the incident already are skipped.
+func (n *Notifier) Notify(ctx context.Context, i *incident.Incident) error {
+	body, err := n.payload(i)
+	if err != nil {
+		return fmt.Errorf("unable to encode incident: %w", err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, u := range n.cfg.URLs {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+
+			if n.delivered(ctx, deliveryID(i.Id, u)) {
+				return
+			}
+			d := n.deliver(ctx, u, i.Id, body)
+			n.record(ctx, d)
+			if d.Err != nil {
+				mu.Lock()
+				errs = append(errs, d.Err)
+				mu.Unlock()
+			}
+		}(u)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// deliver the body to the URL, retrying the failures which can succeed later.
+func (n *Notifier) deliver(ctx context.Context, u, incidentID string, body []byte) Delivery {
+	d := Delivery{
+		ID:         deliveryID(incidentID, u),
+		URL:        u,
+		IncidentID: incidentID,
+	}
+
+	backoff := n.cfg.Backoff
+	for {
+		d.Attempts++
+		var retry bool
+		d.StatusCode, retry, d.Err = n.post(ctx, d.ID, u, body)
+		if d.Err == nil {
+			return d
+		}
+		if !retry || d.Attempts >= n.cfg.MaxAttempts {
+			d.Err = fmt.Errorf("unable to deliver to %s after %d attempts: %w", redact(u), d.Attempts, d.Err)
+			return d
+		}
+
+		select {
+		case <-ctx.Done():
+			d.Err = fmt.Errorf("unable to deliver to %s: %w", redact(u), errors.Join(d.Err, ctx.Err()))
+			return d
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// deliveryID returns the ID of the delivery of the incident to the URL. The incidents which fail
+// to be delivered to any of the URLs are notified about again, so the receivers which already got
+// them can ignore them by their ID.
+func deliveryID(incidentID, u string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(u+"#"+incidentID)).String()
+}
+
+// post the signed body once, and return whether it's worth retrying if it failed. The network
+// errors, rate limits and server errors are retried, while the other responses are not.
+func (n *Notifier) post(ctx context.Context, delivery, u string, body []byte) (status int, retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, n.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, fmt.Errorf("unable to create request: %w", err)
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, delivery)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign([]byte(n.cfg.Secret), now, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The error contains the URL, which can contain credentials.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return resp.StatusCode, retry, fmt.Errorf("unexpected response: %s", resp.Status)
+}
+
+// delivered returns whether the delivery succeeded already. The incident is delivered again if it
+// can't be checked, as the receivers can ignore it by its ID.
+func (n *Notifier) delivered(ctx context.Context, id string) bool {
+	if n.deliveries == nil {
+		return false
+	}
+	d, err := n.deliveries.WebhookDelivery(ctx, id)
+	if err != nil {
+		if !errors.Is(err, database.ErrDoesNotExist) {
+			n.log.Warn(ctx, "unable to check the webhook delivery",
+				slog.String("delivery", id),
+				log.Error(err),
+			)
+		}
+		return false
+	}
+	if d.Delivered {
+		n.log.Debug(ctx, "webhook delivered already",
+			slog.String("delivery", id),
+			slog.String("url", d.URL),
+		)
+	}
+	return d.Delivered
+}
+
+func (n *Notifier) record(ctx context.Context, d Delivery) {
+	attrs := []slog.Attr{
+		slog.String("delivery", d.ID),
+		slog.String("url", redact(d.URL)),
+		slog.String("incident", d.IncidentID),
+		slog.Int("attempts", d.Attempts),
+		slog.Int("status", d.StatusCode),
+	}
+	if d.Err != nil {
+		n.log.Error(ctx, "webhook delivery failed", append(attrs, log.Error(d.Err))...)
+	} else {
+		n.log.Debug(ctx, "webhook delivered", attrs...)
+	}
+
+	if n.deliveries != nil {
+		saved := &database.WebhookDelivery{
+			ID:         d.ID,
+			IncidentID: d.IncidentID,
+			URL:        redact(d.URL),
+			Attempts:   d.Attempts,
+			StatusCode: d.StatusCode,
+			Delivered:  d.Err == nil,
+			Updated:    time.Now(),
+		}
+		if d.Err != nil {
+			saved.Error = d.Err.Error()
+		}
+		if err := n.deliveries.SaveWebhookDelivery(ctx, saved); err != nil {
+			n.log.Warn(ctx, "unable to save the webhook delivery", append(attrs, log.Error(err))...)
+		}
+	}
+
+	for _, r := range n.recorders {
+		r(ctx, d)
+	}
+}
+
+// payload encodes the incident in the configured format.
+func (n *Notifier) payload(i *incident.Incident) ([]byte, error) {
+	if n.cfg.Format == ProtoJSON {
+		return protojson.Marshal(i)
+	}
+
+	reviewURL, err := notifier.ReviewURL(n.reviewURL, i)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create review link: %w", err)
+	}
+	p := Payload{
+		ID:          i.Id,
+		Location:    notifier.Location(i),
+		Description: i.Description,
+		ImageID:     i.ImageId,
+		ReviewURL:   reviewURL,
+	}
+	if i.Timestamp != nil {
+		p.Timestamp = i.Timestamp.AsTime()
+	}
+	if c := i.Coordinates; c != nil {
+		p.Coordinates = &Coordinates{Lat: c.Lat, Lon: c.Lon}
+	}
+	return json.Marshal(p)
+}
+
+// Sign returns the signature of the body sent at the time: the hex encoded HMAC-SHA256 of the
+// Unix time, a dot and the body, prefixed with "sha256=". The receivers should compute the same
+// signature with the timestamp header, compare them in constant time, and reject the requests
+// with a timestamp too far in the past.
+func Sign(secret []byte, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// redact the credentials and query from the URL, so it can be logged.
+func redact(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "<invalid url>"
+	}
+	parsed.User = nil
+	parsed.RawQuery = ""
+	return parsed.String()
+}
+
+var (
+	errMissingURLs     = errors.New("missing webhook URLs")
+	errInvalidURL      = errors.New("invalid webhook URL")
+	errMissingSecret   = errors.New("missing webhook secret")
+	errUnknownFormat   = errors.New("unknown webhook format")
+	errInvalidAttempts = errors.New("max attempts must be positive")
+	errInvalidTimeout  = errors.New("timeout must be positive")
+	errMissingLogger   = errors.New("missing logger")
+)
+
+func validate(cfg *Config) error {
+	if cfg == nil || len(cfg.URLs) == 0 {
+		return errMissingURLs
+	}
+	for _, u := range cfg.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil || !strings.HasPrefix(parsed.Scheme, "http") || parsed.Host == "" {
+			return fmt.Errorf("%w: %s", errInvalidURL, redact(u))
+		}
+	}
+	if cfg.Secret == "" {
+		return errMissingSecret
+	}
+	if !slices.Contains([]string{JSON, ProtoJSON}, cfg.Format) {
+		return fmt.Errorf("%w: %q", errUnknownFormat, cfg.Format)
+	}
+	if cfg.MaxAttempts <= 0 {
+		return errInvalidAttempts
+	}
+	if cfg.Timeout <= 0 {
+		return errInvalidTimeout
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package webhooknotifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+)
+
+const testSecret = "secret"
+
+var testIncident = &incident.Incident{
+	Id:          "incident",
+	Timestamp:   timestamppb.New(time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)),
+	Description: "Parked on the footpath",
+	Location:    incident.Location_LOCATION_OUTSIDE,
+	Coordinates: &incident.Coordinates{Lat: 53.35, Lon: -6.26},
+	ImageId:     "image",
+}
+
+// receiver is the webhook receiver, which replies to the requests with the queued statuses
+// before accepting them.
+type receiver struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	statuses   []int
+	bodies     [][]byte
+	deliveries []string
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	t.Helper()
+
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			t.Errorf("unable to read body: %v", err)
+		}
+
+		// Verify the signature the same way the receivers should.
+		timestamp, err := strconv.ParseInt(req.Header.Get(TimestampHeader), 10, 64)
+		if err != nil {
+			t.Errorf("invalid timestamp: %v", err)
+		}
+		want := Sign([]byte(testSecret), time.Unix(timestamp, 0), body)
+		if !hmac.Equal([]byte(req.Header.Get(SignatureHeader)), []byte(want)) {
+			t.Errorf("signature = %s, want %s", req.Header.Get(SignatureHeader), want)
+		}
+		if age := time.Since(time.Unix(timestamp, 0)); age > time.Minute {
+			t.Errorf("timestamp is %v old", age)
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.bodies = append(r.bodies, body)
+		r.deliveries = append(r.deliveries, req.Header.Get(DeliveryHeader))
+		status := http.StatusNoContent
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func config(urls ...string) *Config {
+	return &Config{
+		URLs:        urls,
+		Secret:      testSecret,
+		Format:      JSON,
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+	}
+}
+
+func TestNotify(t *testing.T) {
+	first, second := newReceiver(t), newReceiver(t)
+
+	var (
+		mu         sync.Mutex
+		deliveries []Delivery
+	)
+	n, err := New(config(first.URL, second.URL+"/hook"),
+		Logger(log.New(slog.Default().Handler())),
+		ReviewURL("https://review.example.com/"),
+		OnDelivery(func(_ context.Context, d Delivery) {
+			mu.Lock()
+			defer mu.Unlock()
+			deliveries = append(deliveries, d)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Notify(context.Background(), testIncident); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	for _, r := range []*receiver{first, second} {
+		if len(r.bodies) != 1 {
+			t.Fatalf("receiver got %d requests, want 1", len(r.bodies))
+		}
+		var got Payload
+		if err := json.Unmarshal(r.bodies[0], &got); err != nil {
+			t.Fatalf("unable to decode payload: %v", err)
+		}
+		want := Payload{
+			ID:          "incident",
+			Timestamp:   testIncident.Timestamp.AsTime(),
+			Location:    "Outside",
+			Coordinates: &Coordinates{Lat: 53.35, Lon: -6.26},
+			Description: "Parked on the footpath",
+			ImageID:     "image",
+			ReviewURL:   "https://review.example.com/incident/incident",
+		}
+		if !got.Timestamp.Equal(want.Timestamp) || *got.Coordinates != *want.Coordinates {
+			t.Errorf("payload = %+v, want %+v", got, want)
+		}
+		got.Timestamp, got.Coordinates = want.Timestamp, want.Coordinates
+		if got != want {
+			t.Errorf("payload = %+v, want %+v", got, want)
+		}
+	}
+
+	if len(deliveries) != 2 {
+		t.Fatalf("recorded %d deliveries, want 2", len(deliveries))
+	}
+	for _, d := range deliveries {
+		if d.Err != nil || d.Attempts != 1 || d.StatusCode != http.StatusNoContent || d.IncidentID != "incident" {
+			t.Errorf("delivery = %+v, want delivered at once", d)
+		}
+	}
+}
+
+func TestNotifyProtoJSON(t *testing.T) {
+	r := newReceiver(t)
+	cfg := config(r.URL)
+	cfg.Format = ProtoJSON
+	n, err := New(cfg, Logger(log.New(slog.Default().Handler())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Notify(context.Background(), testIncident); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	got := new(incident.Incident)
+	if err := protojson.Unmarshal(r.bodies[0], got); err != nil {
+		t.Fatalf("unable to decode payload: %v", err)
+	}
+	if !proto.Equal(got, testIncident) {
+		t.Errorf("payload = %v, want %v", got, testIncident)
+	}
+}
+
+func TestNotifyRetries(t *testing.T) {
+	testCases := map[string]struct {
+		statuses []int
+		err      bool
+		attempts int
+	}{
+		"server error": {
+			statuses: []int{http.StatusBadGateway},
+			attempts: 2,
+		},
+		"rate limited": {
+			statuses: []int{http.StatusTooManyRequests, http.StatusServiceUnavailable},
+			attempts: 3,
+		},
+		"rejected": {
+			statuses: []int{http.StatusBadRequest},
+			err:      true,
+			attempts: 1,
+		},
+		"too many failures": {
+			statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			err:      true,
+			attempts: 3,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := newReceiver(t, tc.statuses...)
+			var delivery Delivery
+			n, err := New(config(r.URL),
+				Logger(log.New(slog.Default().Handler())),
+				OnDelivery(func(_ context.Context, d Delivery) { delivery = d }),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = n.Notify(context.Background(), testIncident)
+			if (err != nil) != tc.err {
+				t.Errorf("Notify() = %v, want error %v", err, tc.err)
+			}
+			if delivery.Attempts != tc.attempts || len(r.deliveries) != tc.attempts {
+				t.Errorf("delivery took %d attempts and %d requests, want %d", delivery.Attempts, len(r.deliveries), tc.attempts)
+			}
+			// Each attempt is the same delivery.
+			for _, id := range r.deliveries {
+				if id != delivery.ID {
+					t.Errorf("attempt of delivery %s, want %s", id, delivery.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestNotifyPartialFailure(t *testing.T) {
+	ok, failing := newReceiver(t), newReceiver(t, http.StatusForbidden, http.StatusForbidden)
+	n, err := New(config(ok.URL, failing.URL), Logger(log.New(slog.Default().Handler())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The incident is notified about again, as it failed to be delivered.
+	for range 2 {
+		if err := n.Notify(context.Background(), testIncident); err == nil {
+			t.Error("Notify() = nil, want the failed delivery")
+		}
+	}
+	if len(ok.deliveries) != 2 || ok.deliveries[0] != ok.deliveries[1] {
+		t.Errorf("receiver got deliveries %v, want the same delivery twice", ok.deliveries)
+	}
+	if len(failing.deliveries) == 0 || failing.deliveries[0] == ok.deliveries[0] {
+		t.Errorf("failing receiver got deliveries %v, want their own", failing.deliveries)
+	}
+}
+
+// fakeDeliveries keeps the deliveries in memory.
+type fakeDeliveries struct {
+	mu         sync.Mutex
+	deliveries map[string]*database.WebhookDelivery
+}
+
+func (db *fakeDeliveries) SaveWebhookDelivery(_ context.Context, d *database.WebhookDelivery) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	saved := *d
+	if existing, ok := db.deliveries[d.ID]; ok {
+		saved.Attempts += existing.Attempts
+	}
+	db.deliveries[d.ID] = &saved
+	return nil
+}
+
+func (db *fakeDeliveries) WebhookDelivery(_ context.Context, id string) (*database.WebhookDelivery, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if d, ok := db.deliveries[id]; ok {
+		return d, nil
+	}
+	return nil, database.ErrDoesNotExist
+}
+
+func TestNotifySkipsDelivered(t *testing.T) {
+	ok, failing := newReceiver(t), newReceiver(t, http.StatusForbidden)
+	db := &fakeDeliveries{deliveries: make(map[string]*database.WebhookDelivery)}
+	n, err := New(config(ok.URL, failing.URL+"?token=secret"),
+		Logger(log.New(slog.Default().Handler())),
+		Deliveries(db),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Notify(context.Background(), testIncident); err == nil {
+		t.Error("Notify() = nil, want the failed delivery")
+	}
+	failed, err := db.WebhookDelivery(context.Background(), deliveryID(testIncident.Id, failing.URL+"?token=secret"))
+	if err != nil || failed.Delivered || failed.StatusCode != http.StatusForbidden || failed.Error == "" || failed.URL != failing.URL {
+		t.Errorf("WebhookDelivery() = %+v, %v, want the forbidden delivery without the query", failed, err)
+	}
+
+	// The incident is only delivered again to the receiver which didn't get it.
+	if err := n.Notify(context.Background(), testIncident); err != nil {
+		t.Errorf("Notify() = %v", err)
+	}
+	if len(ok.deliveries) != 1 || len(failing.deliveries) != 2 {
+		t.Errorf("receivers got %d and %d deliveries, want 1 and 2", len(ok.deliveries), len(failing.deliveries))
+	}
+	for _, d := range db.deliveries {
+		if !d.Delivered {
+			t.Errorf("delivery to %s not delivered after %d attempts", d.URL, d.Attempts)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	timestamp := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"incident"}`)
+
+	got := Sign([]byte(testSecret), timestamp, body)
+	if got != Sign([]byte(testSecret), timestamp, body) {
+		t.Error("Sign() is not deterministic")
+	}
+	for name, other := range map[string]string{
+		"secret":    Sign([]byte("other"), timestamp, body),
+		"timestamp": Sign([]byte(testSecret), timestamp.Add(time.Second), body),
+		"body":      Sign([]byte(testSecret), timestamp, []byte(`{"id":"other"}`)),
+	} {
+		if got == other {
+			t.Errorf("Sign() doesn't depend on the %s", name)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	testCases := map[string]struct {
+		modify func(*Config)
+		err    error
+	}{
+		"valid":          {modify: func(*Config) {}},
+		"no urls":        {modify: func(c *Config) { c.URLs = nil }, err: errMissingURLs},
+		"invalid url":    {modify: func(c *Config) { c.URLs = []string{"ftp://example.com"} }, err: errInvalidURL},
+		"no secret":      {modify: func(c *Config) { c.Secret = "" }, err: errMissingSecret},
+		"unknown format": {modify: func(c *Config) { c.Format = "xml" }, err: errUnknownFormat},
+		"no attempts":    {modify: func(c *Config) { c.MaxAttempts = 0 }, err: errInvalidAttempts},
+		"no timeout":     {modify: func(c *Config) { c.Timeout = 0 }, err: errInvalidTimeout},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cfg := config("https://example.com/hook")
+			tc.modify(cfg)
+			if _, err := New(cfg, Logger(log.New(slog.Default().Handler()))); !errors.Is(err, tc.err) {
+				t.Errorf("New() = %v, want %v", err, tc.err)
+			}
+		})
+	}
+
+	if _, err := New(config("https://example.com/hook")); !errors.Is(err, errMissingLogger) {
+		t.Errorf("New() = %v, want %v", err, errMissingLogger)
+	}
+}
@@ -0,0 +1,36 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// DeadLetterReasonKey is the metadata key containing the reason why the message was moved to the
+// dead letter queue.
+const DeadLetterReasonKey = "Dead-Letter-Reason"
+
+// ErrNotFound is returned when the message does not exist in the queue.
+var ErrNotFound = errors.New("queue: message not found")
+
+// DeadLetter is a message which could not be processed.
+type DeadLetter[T proto.Message] struct {
+	ID        string
+	Timestamp time.Time
+	Reason    string
+	Body      T
+}
+
+// DeadLetters is a queue of messages which could not be processed. The messages are kept until
+// they are replayed, so they can be inspected and fixed.
+type DeadLetters[T proto.Message] interface {
+	Producer[T]
+
+	// List all the dead lettered messages, from the oldest to the newest.
+	List(context.Context) ([]*DeadLetter[T], error)
+	// Replay produces the message with the ID to the producer and removes it from the dead
+	// letters.
+	Replay(ctx context.Context, id string, to Producer[T]) error
+}
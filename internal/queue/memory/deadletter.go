@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"safer.place/internal/queue"
+)
+
+// DeadLetters keeps the messages which could not be processed in memory. They are lost on restart,
+// so it is only suitable for development.
+type DeadLetters[T proto.Message] struct {
+	mu      sync.Mutex
+	letters []*queue.DeadLetter[T]
+}
+
+// NewDeadLetters creates an empty in memory dead letter queue.
+func NewDeadLetters[T proto.Message]() *DeadLetters[T] {
+	return &DeadLetters[T]{}
+}
+
+// Produce adds the message to the dead letters.
+func (d *DeadLetters[T]) Produce(_ context.Context, msg queue.Message[T]) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.letters = append(d.letters, &queue.DeadLetter[T]{
+		ID:        uuid.New().String(),
+		Timestamp: time.Now(),
+		Reason:    msg.Metadata().Get(queue.DeadLetterReasonKey),
+		Body:      msg.Body(),
+	})
+	return nil
+}
+
+// List all dead letters.
+func (d *DeadLetters[T]) List(_ context.Context) ([]*queue.DeadLetter[T], error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return slices.Clone(d.letters), nil
+}
+
+// Replay the message back to the producer.
+func (d *DeadLetters[T]) Replay(ctx context.Context, id string, to queue.Producer[T]) error {
+	d.mu.Lock()
+	i := slices.IndexFunc(d.letters, func(l *queue.DeadLetter[T]) bool { return l.ID == id })
+	if i < 0 {
+		d.mu.Unlock()
+		return queue.ErrNotFound
+	}
+	letter := d.letters[i]
+	d.letters = slices.Delete(d.letters, i, i+1)
+	d.mu.Unlock()
+
+	if err := to.Produce(ctx, queue.NewMessage(letter.Body, nil)); err != nil {
+		// Put it back so it's not lost.
+		d.mu.Lock()
+		d.letters = append(d.letters, letter)
+		d.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"time"
 
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -21,6 +22,8 @@ type Message[T proto.Message] struct {
 	// q is only used to re-queue the message when NAcked.
 	q *Queue[T]
 
+	deliveries int
+
 	queue.Message[T]
 }
 
@@ -31,9 +34,20 @@ func (m *Message[T]) Body() T {
 // Ack does nothing
 func (m *Message[T]) Ack() {}
 
-// Nack restacks the message to the queue again
+// Nack restacks the message to the queue again. The message is requeued in the background as
+// the consumer which nacks the message is usually the one which would receive it.
 func (m *Message[T]) Nack() {
-	m.q.messages <- m
+	go func() { m.q.messages <- m }()
+}
+
+// NackAfter restacks the message to the queue once the delay has passed.
+func (m *Message[T]) NackAfter(delay time.Duration) {
+	time.AfterFunc(delay, func() { m.q.messages <- m })
+}
+
+// Deliveries returns how many times the message was consumed.
+func (m *Message[T]) Deliveries() int {
+	return m.deliveries
 }
 
 // Metadata associated with the message.
@@ -60,25 +74,31 @@ func New[T proto.Message](opts ...Option[T]) *Queue[T] {
 
 // Produce the message to the queue
 func (q *Queue[T]) Produce(ctx context.Context, msg queue.Message[T]) error {
-	_, span := otelhelper.StartProducerSpan(ctx, q.tracer, "incident publish")
+	_, span := otelhelper.StartProducerSpan(ctx, q.tracer, "memory", "incident publish", msg.Metadata())
 	defer span.End()
 
-	q.messages <- &Message[T]{Message: msg}
+	q.messages <- &Message[T]{q: q, Message: msg}
 	span.SetStatus(codes.Ok, "")
 	return nil
 }
 
 // Consume the message
-func (q *Queue[T]) Consume(_ context.Context) (queue.Message[T], error) {
-	msg := <-q.messages
-	_, span := otelhelper.StartConsumerSpan(q.tracer, "incident receive", msg.Metadata())
+func (q *Queue[T]) Consume(ctx context.Context) (queue.Message[T], error) {
+	var msg *Message[T]
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case msg = <-q.messages:
+	}
+
+	spanCtx, span := otelhelper.StartConsumerSpan(q.tracer, "memory", "incident receive", msg.Metadata())
 	defer span.End()
+	otelhelper.InjectContext(spanCtx, msg.Metadata())
+
+	msg.deliveries++
 
 	span.SetStatus(codes.Ok, "")
-	return &Message[T]{
-		q:       q,
-		Message: msg,
-	}, nil
+	return msg, nil
 }
 
 var (
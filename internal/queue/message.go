@@ -2,6 +2,7 @@ package queue
 
 import (
 	"net/http"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -39,3 +40,12 @@ func (m *message[_]) Nack() {
 func (m *message[_]) Metadata() http.Header {
 	return m.md
 }
+
+// Redeliverable is implemented by messages which keep track of how many times they were
+// delivered, and which can be delivered again after a delay.
+type Redeliverable interface {
+	// Deliveries returns how many times the message was delivered, including the current delivery.
+	Deliveries() int
+	// NackAfter makes the message available again once the delay has passed.
+	NackAfter(time.Duration)
+}
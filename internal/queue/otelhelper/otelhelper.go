@@ -11,14 +11,17 @@ import (
 	"golang.org/x/exp/maps"
 )
 
-// StartProducerSpan abstracts the span creation for producing.
+// StartProducerSpan abstracts the span creation for producing. The span context is injected into
+// the headers so the consumer can continue the same trace, even when it runs in another process.
 func StartProducerSpan(
 	ctx context.Context,
 	tracer trace.Tracer,
+	system string,
 	name string,
+	headers http.Header,
 ) (context.Context, trace.Span) {
 	attr := []attribute.KeyValue{
-		semconv.MessagingSystem("memory"),
+		semconv.MessagingSystem(system),
 		semconv.MessagingOperationPublish,
 	}
 
@@ -27,32 +30,54 @@ func StartProducerSpan(
 		trace.WithSpanKind(trace.SpanKindProducer),
 	)
 
+	if headers != nil {
+		otel.GetTextMapPropagator().Inject(ctx, carrier{headers})
+	}
+
 	return ctx, span
 }
 
 // StartConsumerSpan abstracts span consumption
 func StartConsumerSpan(
 	tracer trace.Tracer,
+	system string,
 	name string,
 	headers http.Header,
 ) (context.Context, trace.Span) {
 	attr := []attribute.KeyValue{
-		semconv.MessagingSystem("memory"),
-		semconv.MessagingOperationPublish,
+		semconv.MessagingSystem(system),
+		semconv.MessagingOperationReceive,
 	}
 
-	propagator := otel.GetTextMapPropagator()
+	ctx := context.Background()
+	if headers != nil {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, carrier{headers})
+	}
 
-	ctx := propagator.Extract(context.Background(), carrier{headers})
 	ctx, span := tracer.Start(ctx, name,
 		trace.WithAttributes(attr...),
 		trace.WithSpanKind(trace.SpanKindConsumer),
 	)
-	// propagator.Inject(ctx, carrier{headers})
 
 	return ctx, span
 }
 
+// InjectContext replaces the span context in the headers of the received message with the one
+// in the context, so the handler continues the trace from the receive span.
+func InjectContext(ctx context.Context, headers http.Header) {
+	if headers != nil {
+		otel.GetTextMapPropagator().Inject(ctx, carrier{headers})
+	}
+}
+
+// ExtractContext returns the context continuing the trace from the headers of the message.
+func ExtractContext(ctx context.Context, headers http.Header) context.Context {
+	if headers == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier{headers})
+}
+
 type carrier struct{ h http.Header }
 
 func (c carrier) Get(key string) string {
@@ -0,0 +1,65 @@
+package sqlqueue
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
+
+	"safer.place/internal/log"
+)
+
+// Option configures the queue
+type Option[T proto.Message] func(*Queue[T])
+
+// Tracer provides the tracing
+func Tracer[T proto.Message](tp trace.Tracer) Option[T] {
+	return func(q *Queue[T]) {
+		q.tracer = tp
+	}
+}
+
+// Logger is used to log errors which can't be returned, such as failed acknowledgements.
+func Logger[T proto.Message](l log.Logger) Option[T] {
+	return func(q *Queue[T]) {
+		q.log = l
+	}
+}
+
+// DeadLetter is the name of the queue the messages which can't be decoded are moved to. Without
+// it they are deleted.
+func DeadLetter[T proto.Message](name string) Option[T] {
+	return func(q *Queue[T]) {
+		q.deadLetter = name
+	}
+}
+
+var (
+	errMissingTracer = errors.New("missing tracer")
+	errMissingLogger = errors.New("missing logger")
+	errMissingName   = errors.New("missing queue name")
+	errNoVisibility  = errors.New("visibility timeout must be positive")
+	errNoPoll        = errors.New("poll interval must be positive")
+
+	errUnsupportedDriver = errors.New("unsupported driver")
+)
+
+func validate[T proto.Message](q *Queue[T]) error {
+	if q.tracer == nil {
+		return errMissingTracer
+	}
+	if q.log == nil {
+		return errMissingLogger
+	}
+	if q.name == "" {
+		return errMissingName
+	}
+	if q.visibilityTimeout <= 0 {
+		return errNoVisibility
+	}
+	if q.pollInterval <= 0 {
+		return errNoPoll
+	}
+
+	return nil
+}
@@ -0,0 +1,601 @@
+// Copyright 2024 SaferPlace
+
+// Package sqlqueue provides a durable queue persisted in a SQL table. Unlike the memory queue it
+// survives restarts and can be shared between separate producer and consumer processes.
+package sqlqueue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
+
+	"safer.place/internal/database/sqldatabase"
+	"safer.place/internal/log"
+	"safer.place/internal/queue"
+	"safer.place/internal/queue/otelhelper"
+
+	// Acceptable database drivers
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Config of the SQL queue
+type Config struct {
+	// Driver is either sqlite3 or postgres. The processes producing and consuming the queues on
+	// different hosts need postgres.
+	Driver string `yaml:"driver" default:"sqlite3"`
+	DSN    string `yaml:"dsn" default:"file:queue.db"`
+	// Name of the queue. Multiple queues can share the same table as long as their names differ.
+	Name string `yaml:"name" default:"incidents"`
+	// VisibilityTimeout is how long a consumed message is hidden from other consumers. If the
+	// message is not acknowledged within that time it is delivered again.
+	VisibilityTimeout time.Duration `yaml:"visibility_timeout" default:"30s"`
+	// PollInterval is how often the table is checked for new messages when the queue is empty.
+	PollInterval time.Duration `yaml:"poll_interval" default:"1s"`
+	// BusyTimeout is how long the queries wait for the other processes sharing the SQLite database
+	// to finish writing, instead of failing straight away.
+	BusyTimeout time.Duration `yaml:"busy_timeout" default:"5s"`
+}
+
+// DB is the database the queues are stored in, which all the queues of a process share.
+type DB struct {
+	db *sql.DB
+	// rebind rewrites the queries, which are written with ? placeholders, for the database.
+	rebind func(string) string
+}
+
+// Open the database of the queues, creating the queue table if it doesn't exist.
+func Open(cfg *Config) (*DB, error) {
+	var (
+		dataSource  = cfg.DSN
+		createTable = createTableQuery
+		rebind      = func(query string) string { return query }
+	)
+	switch cfg.Driver {
+	case "sqlite3":
+		dataSource = dsn(cfg)
+	case "postgres":
+		createTable = postgresCreateTableQuery
+		rebind = sqldatabase.RebindDollar
+	default:
+		return nil, fmt.Errorf("%w %q", errUnsupportedDriver, cfg.Driver)
+	}
+
+	db, err := sql.Open(cfg.Driver, dataSource)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+	if cfg.Driver == "sqlite3" {
+		// SQLite allows a single writer, so the queues write with a single connection, and wait
+		// for the other processes for up to the busy timeout.
+		db.SetMaxOpenConns(1)
+	}
+
+	if _, err := db.Exec(createTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to prepare database: %w", err)
+	}
+
+	return &DB{db: db, rebind: rebind}, nil
+}
+
+// Close the database, once none of its queues are used.
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
+// Queue is a queue backed by a SQL table.
+type Queue[T proto.Message] struct {
+	db     *sql.DB
+	tracer trace.Tracer
+	log    log.Logger
+
+	name              string
+	visibilityTimeout time.Duration
+	pollInterval      time.Duration
+	// deadLetter is the name of the queue the messages which can't be decoded are moved to.
+	deadLetter string
+
+	produceStmt *sql.Stmt
+	nextStmt    *sql.Stmt
+	claimStmt   *sql.Stmt
+	ackStmt     *sql.Stmt
+	nackStmt    *sql.Stmt
+	listStmt    *sql.Stmt
+	getStmt     *sql.Stmt
+	deleteStmt  *sql.Stmt
+	moveStmt    *sql.Stmt
+}
+
+// Message is a message received from the SQL queue.
+type Message[T proto.Message] struct {
+	// q is used to acknowledge the message.
+	q *Queue[T]
+
+	id         string
+	receipt    string
+	deliveries int
+
+	queue.Message[T]
+}
+
+// Body of the message
+func (m *Message[T]) Body() T {
+	return m.Message.Body()
+}
+
+// Ack removes the message from the queue.
+func (m *Message[T]) Ack() {
+	m.q.ack(m)
+}
+
+// Nack makes the message immediately visible to consumers again.
+func (m *Message[T]) Nack() {
+	m.q.nack(m, 0)
+}
+
+// NackAfter makes the message visible to consumers again once the delay has passed.
+func (m *Message[T]) NackAfter(delay time.Duration) {
+	m.q.nack(m, delay)
+}
+
+// Metadata associated with the message.
+func (m *Message[T]) Metadata() http.Header {
+	return m.Message.Metadata()
+}
+
+// Deliveries returns how many times the message was delivered, including the current delivery.
+func (m *Message[T]) Deliveries() int {
+	return m.deliveries
+}
+
+// New creates the queue with the name from the config, stored in the database.
+func New[T proto.Message](db *DB, cfg *Config, opts ...Option[T]) (*Queue[T], error) {
+	q := &Queue[T]{
+		db:                db.db,
+		name:              cfg.Name,
+		visibilityTimeout: cfg.VisibilityTimeout,
+		pollInterval:      cfg.PollInterval,
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	if err := validate(q); err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range []struct {
+		name  string
+		query string
+		dst   **sql.Stmt
+	}{
+		{"produce", produceQuery, &q.produceStmt},
+		{"next", nextQuery, &q.nextStmt},
+		{"claim", claimQuery, &q.claimStmt},
+		{"ack", ackQuery, &q.ackStmt},
+		{"nack", nackQuery, &q.nackStmt},
+		{"list", listQuery, &q.listStmt},
+		{"get", getQuery, &q.getStmt},
+		{"delete", deleteQuery, &q.deleteStmt},
+		{"move", moveQuery, &q.moveStmt},
+	} {
+		var err error
+		if *stmt.dst, err = db.db.Prepare(db.rebind(stmt.query)); err != nil {
+			return nil, fmt.Errorf("unable to prepare %s query: %w", stmt.name, err)
+		}
+	}
+
+	return q, nil
+}
+
+// dsn returns the DSN with the busy timeout, unless it already has one.
+func dsn(cfg *Config) string {
+	if strings.Contains(cfg.DSN, "_busy_timeout=") || strings.Contains(cfg.DSN, "_timeout=") {
+		return cfg.DSN
+	}
+	sep := "?"
+	if strings.Contains(cfg.DSN, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s_busy_timeout=%d", cfg.DSN, sep, cfg.BusyTimeout.Milliseconds())
+}
+
+// persistedMetadata are the metadata keys which are stored together with the message, on top of
+// the tracing headers. The rest of the metadata is dropped as it usually contains the request
+// headers, which can have credentials we don't want to store.
+var persistedMetadata = []string{
+	queue.DeadLetterReasonKey,
+}
+
+// Produce the message to the queue.
+func (q *Queue[T]) Produce(ctx context.Context, msg queue.Message[T]) (err error) {
+	md := make(http.Header)
+	for _, key := range persistedMetadata {
+		if v := msg.Metadata().Values(key); len(v) > 0 {
+			md[http.CanonicalHeaderKey(key)] = v
+		}
+	}
+	ctx, span := otelhelper.StartProducerSpan(ctx, q.tracer, "sql", q.name+" publish", md)
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		} else {
+			span.SetStatus(codes.Ok, "")
+		}
+		span.End()
+	}()
+
+	body, err := proto.Marshal(msg.Body())
+	if err != nil {
+		return fmt.Errorf("unable to marshal message: %w", err)
+	}
+	metadata, err := json.Marshal(md)
+	if err != nil {
+		return fmt.Errorf("unable to marshal metadata: %w", err)
+	}
+
+	now := time.Now().UnixMilli()
+	if _, err := q.produceStmt.ExecContext(ctx,
+		uuid.New().String(),
+		q.name,
+		body,
+		string(metadata),
+		now,
+		now,
+	); err != nil {
+		return fmt.Errorf("unable to insert message: %w", err)
+	}
+
+	return nil
+}
+
+// Consume blocks until a message is available or the context is cancelled. The message is hidden
+// from other consumers until it is acknowledged or the visibility timeout expires. The handlers
+// continue the trace from the metadata of the message, with otelhelper.ExtractContext.
+func (q *Queue[T]) Consume(ctx context.Context) (queue.Message[T], error) {
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		msg, err := q.claim(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if msg != nil {
+			spanCtx, span := otelhelper.StartConsumerSpan(q.tracer, "sql", q.name+" receive", msg.Metadata())
+			otelhelper.InjectContext(spanCtx, msg.Metadata())
+			span.SetStatus(codes.Ok, "")
+			span.End()
+			return msg, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim tries to take the oldest visible message. It returns nil without an error if there are no
+// messages available.
+func (q *Queue[T]) claim(ctx context.Context) (*Message[T], error) {
+	for {
+		now := time.Now()
+
+		var (
+			id         string
+			body       []byte
+			metadata   string
+			deliveries int
+			visibleAt  int64
+		)
+		if err := q.nextStmt.QueryRowContext(ctx, q.name, now.UnixMilli()).Scan(
+			&id, &body, &metadata, &deliveries, &visibleAt,
+		); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unable to get next message: %w", err)
+		}
+
+		// Only claim the message if nobody else claimed it in the meantime, if they did, try
+		// again with the next message.
+		receipt := uuid.New().String()
+		res, err := q.claimStmt.ExecContext(ctx,
+			now.Add(q.visibilityTimeout).UnixMilli(),
+			receipt,
+			id,
+			visibleAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("unable to claim message: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("unable to check claimed message: %w", err)
+		} else if n == 0 {
+			continue
+		}
+
+		v, md, err := unmarshal[T](body, metadata)
+		if err != nil {
+			// The message would fail to be decoded on every delivery, so it is put aside and the
+			// next message is consumed instead.
+			q.discard(ctx, id, receipt, err)
+			continue
+		}
+
+		return &Message[T]{
+			q:          q,
+			id:         id,
+			receipt:    receipt,
+			deliveries: deliveries + 1,
+			Message:    queue.NewMessage(v, md),
+		}, nil
+	}
+}
+
+// discard the claimed message which can't be decoded, moving it to the dead letter queue if
+// there is one.
+func (q *Queue[T]) discard(ctx context.Context, id, receipt string, reason error) {
+	q.log.Error(ctx, "unable to decode message",
+		slog.String("id", id),
+		slog.String("dead_letter", q.deadLetter),
+		log.Error(reason),
+	)
+
+	var err error
+	if q.deadLetter == "" {
+		_, err = q.ackStmt.ExecContext(ctx, id, receipt)
+	} else {
+		md := make(http.Header)
+		md.Set(queue.DeadLetterReasonKey, fmt.Sprintf("unable to decode message: %v", reason))
+		metadata, _ := json.Marshal(md)
+		_, err = q.moveStmt.ExecContext(ctx, q.deadLetter, string(metadata), time.Now().UnixMilli(), id, receipt)
+	}
+	if err != nil {
+		q.log.Error(ctx, "unable to discard message",
+			slog.String("id", id),
+			log.Error(err),
+		)
+	}
+}
+
+func (q *Queue[T]) ack(m *Message[T]) {
+	if _, err := q.ackStmt.Exec(m.id, m.receipt); err != nil {
+		q.log.Error(context.Background(), "unable to ack message",
+			slog.String("id", m.id),
+			log.Error(err),
+		)
+	}
+}
+
+func (q *Queue[T]) nack(m *Message[T], delay time.Duration) {
+	if _, err := q.nackStmt.Exec(time.Now().Add(delay).UnixMilli(), m.id, m.receipt); err != nil {
+		q.log.Error(context.Background(), "unable to nack message",
+			slog.String("id", m.id),
+			log.Error(err),
+		)
+	}
+}
+
+// List all the messages in the queue, no matter if they are visible or not. It is used to
+// inspect dead letter queues.
+func (q *Queue[T]) List(ctx context.Context) ([]*queue.DeadLetter[T], error) {
+	rows, err := q.listStmt.QueryContext(ctx, q.name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list messages: %w", err)
+	}
+	defer rows.Close()
+
+	letters := make([]*queue.DeadLetter[T], 0)
+	for rows.Next() {
+		var (
+			id        string
+			body      []byte
+			metadata  string
+			createdAt int64
+		)
+		if err := rows.Scan(&id, &body, &metadata, &createdAt); err != nil {
+			return nil, fmt.Errorf("unable to scan message: %w", err)
+		}
+		letter := &queue.DeadLetter[T]{
+			ID:        id,
+			Timestamp: time.UnixMilli(createdAt),
+		}
+		v, md, err := unmarshal[T](body, metadata)
+		if err != nil {
+			// The messages which can't be decoded are still listed, so they can be inspected.
+			var zero T
+			letter.Body = zero.ProtoReflect().New().Interface().(T)
+			letter.Reason = fmt.Sprintf("unable to decode message: %v", err)
+		} else {
+			letter.Body = v
+			letter.Reason = md.Get(queue.DeadLetterReasonKey)
+		}
+		letters = append(letters, letter)
+	}
+
+	return letters, rows.Err()
+}
+
+// Replay produces the message to the producer, and removes it from this queue.
+func (q *Queue[T]) Replay(ctx context.Context, id string, to queue.Producer[T]) error {
+	var (
+		body     []byte
+		metadata string
+	)
+	if err := q.getStmt.QueryRowContext(ctx, id, q.name).Scan(&body, &metadata); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return queue.ErrNotFound
+		}
+		return fmt.Errorf("unable to get message: %w", err)
+	}
+
+	v, _, err := unmarshal[T](body, metadata)
+	if err != nil {
+		return fmt.Errorf("unable to unmarshal message %s: %w", id, err)
+	}
+
+	if err := to.Produce(ctx, queue.NewMessage(v, make(http.Header))); err != nil {
+		return fmt.Errorf("unable to replay message: %w", err)
+	}
+
+	if _, err := q.deleteStmt.ExecContext(ctx, id, q.name); err != nil {
+		return fmt.Errorf("unable to remove replayed message: %w", err)
+	}
+
+	return nil
+}
+
+func unmarshal[T proto.Message](body []byte, metadata string) (T, http.Header, error) {
+	var zero T
+	v := zero.ProtoReflect().New().Interface().(T)
+	if err := proto.Unmarshal(body, v); err != nil {
+		return zero, nil, err
+	}
+	md := make(http.Header)
+	if err := json.Unmarshal([]byte(metadata), &md); err != nil {
+		return zero, nil, err
+	}
+
+	return v, md, nil
+}
+
+var createTableQuery = `
+CREATE TABLE IF NOT EXISTS queue_messages (
+	id TEXT PRIMARY KEY,
+	queue TEXT NOT NULL,
+	body BLOB NOT NULL,
+	metadata TEXT NOT NULL,
+	deliveries INTEGER NOT NULL DEFAULT 0,
+	receipt TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	visible_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS queue_messages_visible ON queue_messages (queue, visible_at);
+`
+
+// postgresCreateTableQuery is the createTableQuery with the types of Postgres, where the times in
+// milliseconds don't fit in an INTEGER.
+var postgresCreateTableQuery = `
+CREATE TABLE IF NOT EXISTS queue_messages (
+	id TEXT PRIMARY KEY,
+	queue TEXT NOT NULL,
+	body BYTEA NOT NULL,
+	metadata TEXT NOT NULL,
+	deliveries INTEGER NOT NULL DEFAULT 0,
+	receipt TEXT NOT NULL DEFAULT '',
+	created_at BIGINT NOT NULL,
+	visible_at BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS queue_messages_visible ON queue_messages (queue, visible_at);
+`
+
+var produceQuery = `
+INSERT INTO queue_messages
+	(id, queue, body, metadata, created_at, visible_at)
+VALUES
+	(?, ?, ?, ?, ?, ?);
+`
+
+// nextQuery gets the oldest message which is currently visible
+// parameters:
+//
+//	queue
+//	now
+var nextQuery = `
+SELECT id, body, metadata, deliveries, visible_at
+FROM queue_messages
+WHERE
+	queue=?
+	AND
+		visible_at <= ?
+ORDER BY visible_at, created_at
+LIMIT 1;
+`
+
+// claimQuery hides the message from other consumers, but only if it was not claimed since we
+// have seen it.
+// parameters:
+//
+//	visible_at
+//	receipt
+//	id
+//	previous visible_at
+var claimQuery = `
+UPDATE queue_messages
+SET
+	visible_at=?,
+	receipt=?,
+	deliveries=deliveries+1
+WHERE
+	id=?
+	AND
+		visible_at=?;
+`
+
+var ackQuery = `
+DELETE FROM queue_messages WHERE id=? AND receipt=?;
+`
+
+var nackQuery = `
+UPDATE queue_messages
+SET
+	visible_at=?
+WHERE
+	id=?
+	AND
+		receipt=?;
+`
+
+var listQuery = `
+SELECT id, body, metadata, created_at
+FROM queue_messages
+WHERE queue=?
+ORDER BY created_at;
+`
+
+var getQuery = `
+SELECT body, metadata FROM queue_messages WHERE id=? AND queue=?;
+`
+
+var deleteQuery = `
+DELETE FROM queue_messages WHERE id=? AND queue=?;
+`
+
+// moveQuery moves the claimed message to another queue, making it visible there.
+// parameters:
+//
+//	queue
+//	metadata
+//	visible_at
+//	id
+//	receipt
+var moveQuery = `
+UPDATE queue_messages
+SET
+	queue=?,
+	metadata=?,
+	visible_at=?,
+	deliveries=0,
+	receipt=''
+WHERE
+	id=?
+	AND
+		receipt=?;
+`
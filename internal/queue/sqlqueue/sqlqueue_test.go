@@ -0,0 +1,329 @@
+package sqlqueue
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"api.safer.place/incident/v1"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/database/sqldatabase"
+	"safer.place/internal/log"
+	"safer.place/internal/queue"
+)
+
+func openTestDB(t *testing.T, dsn string) *DB {
+	t.Helper()
+
+	db, err := Open(&Config{Driver: "sqlite3", DSN: dsn, BusyTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func newTestQueue(t *testing.T, db *DB) *Queue[*incident.Incident] {
+	t.Helper()
+
+	q, err := New(db, &Config{
+		Name:              "incidents",
+		VisibilityTimeout: 100 * time.Millisecond,
+		PollInterval:      10 * time.Millisecond,
+	},
+		Tracer[*incident.Incident](noop.NewTracerProvider().Tracer("")),
+		Logger[*incident.Incident](log.New(slog.Default().Handler())),
+	)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+
+	return q
+}
+
+func consume(t *testing.T, q *Queue[*incident.Incident]) *Message[*incident.Incident] {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	msg, err := q.Consume(ctx)
+	if err != nil {
+		t.Fatalf("Consume() = %v", err)
+	}
+	return msg.(*Message[*incident.Incident])
+}
+
+func TestProduceConsume(t *testing.T) {
+	q := newTestQueue(t, openTestDB(t, filepath.Join(t.TempDir(), "queue.db")))
+	ctx := context.Background()
+
+	for _, id := range []string{"first", "second"} {
+		if err := q.Produce(ctx, queue.NewMessage(&incident.Incident{Id: id}, nil)); err != nil {
+			t.Fatalf("Produce(%s) = %v", id, err)
+		}
+	}
+
+	for _, want := range []string{"first", "second"} {
+		msg := consume(t, q)
+		if got := msg.Body().Id; got != want {
+			t.Errorf("Consume().Body().Id = %q, want %q", got, want)
+		}
+		if got := msg.Deliveries(); got != 1 {
+			t.Errorf("Deliveries() = %d, want 1", got)
+		}
+		msg.Ack()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := q.Consume(ctx); err == nil {
+		t.Errorf("Consume() on empty queue = nil, want error")
+	}
+}
+
+func TestPersistedMetadata(t *testing.T) {
+	q := newTestQueue(t, openTestDB(t, filepath.Join(t.TempDir(), "queue.db")))
+
+	md := make(http.Header)
+	md.Set(queue.DeadLetterReasonKey, "reason")
+	md.Set("Cookie", "secret")
+	if err := q.Produce(context.Background(), queue.NewMessage(&incident.Incident{Id: "id"}, md)); err != nil {
+		t.Fatalf("Produce() = %v", err)
+	}
+
+	msg := consume(t, q)
+	if got := msg.Metadata().Get(queue.DeadLetterReasonKey); got != "reason" {
+		t.Errorf("Metadata().Get(%s) = %q, want it to be persisted", queue.DeadLetterReasonKey, got)
+	}
+	if got := msg.Metadata().Get("Cookie"); got != "" {
+		t.Errorf("Metadata().Get(Cookie) = %q, want it not to be persisted", got)
+	}
+}
+
+func TestNackRedelivers(t *testing.T) {
+	q := newTestQueue(t, openTestDB(t, filepath.Join(t.TempDir(), "queue.db")))
+
+	if err := q.Produce(context.Background(),
+		queue.NewMessage(&incident.Incident{Id: "id"}, nil),
+	); err != nil {
+		t.Fatalf("Produce() = %v", err)
+	}
+
+	consume(t, q).Nack()
+
+	msg := consume(t, q)
+	if got := msg.Deliveries(); got != 2 {
+		t.Errorf("Deliveries() = %d, want 2", got)
+	}
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	q := newTestQueue(t, openTestDB(t, filepath.Join(t.TempDir(), "queue.db")))
+
+	if err := q.Produce(context.Background(),
+		queue.NewMessage(&incident.Incident{Id: "id"}, nil),
+	); err != nil {
+		t.Fatalf("Produce() = %v", err)
+	}
+
+	// Never acknowledged, so it should be delivered again after the timeout.
+	stale := consume(t, q)
+	msg := consume(t, q)
+	if got := msg.Deliveries(); got != 2 {
+		t.Errorf("Deliveries() = %d, want 2", got)
+	}
+
+	// The stale delivery must not remove the redelivered message.
+	stale.Ack()
+	msg.Nack()
+	if got := consume(t, q).Body().Id; got != "id" {
+		t.Errorf("Consume().Body().Id = %q, want %q", got, "id")
+	}
+}
+
+func TestDurable(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "queue.db")
+
+	db := openTestDB(t, dsn)
+	if err := newTestQueue(t, db).Produce(context.Background(),
+		queue.NewMessage(&incident.Incident{Id: "id", Description: "desc"}, nil),
+	); err != nil {
+		t.Fatalf("Produce() = %v", err)
+	}
+	db.Close()
+
+	msg := consume(t, newTestQueue(t, openTestDB(t, dsn)))
+	if got := msg.Body().Description; got != "desc" {
+		t.Errorf("Consume().Body().Description = %q, want %q", got, "desc")
+	}
+}
+
+func TestListReplay(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "queue.db"))
+	incoming := newTestQueue(t, db)
+	deadLetters := newTestQueue(t, db)
+	deadLetters.name = "dead_letters"
+	ctx := context.Background()
+
+	md := make(http.Header)
+	md.Set(queue.DeadLetterReasonKey, "reason")
+	md.Set("Cookie", "secret")
+	if err := deadLetters.Produce(ctx, queue.NewMessage(&incident.Incident{Id: "id"}, md)); err != nil {
+		t.Fatalf("Produce() = %v", err)
+	}
+
+	letters, err := deadLetters.List(ctx)
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("List() returned %d letters, want 1", len(letters))
+	}
+	if got := letters[0].Reason; got != "reason" {
+		t.Errorf("List()[0].Reason = %q, want %q", got, "reason")
+	}
+
+	if err := deadLetters.Replay(ctx, "unknown", incoming); !errors.Is(err, queue.ErrNotFound) {
+		t.Errorf("Replay(unknown) = %v, want %v", err, queue.ErrNotFound)
+	}
+	if err := deadLetters.Replay(ctx, letters[0].ID, incoming); err != nil {
+		t.Fatalf("Replay() = %v", err)
+	}
+
+	msg := consume(t, incoming)
+	if got := msg.Body().Id; got != "id" {
+		t.Errorf("Consume().Body().Id = %q, want %q", got, "id")
+	}
+	if got := msg.Metadata().Get("Cookie"); got != "" {
+		t.Errorf("Metadata().Get(Cookie) = %q, want it not to be persisted", got)
+	}
+
+	if letters, err := deadLetters.List(ctx); err != nil || len(letters) != 0 {
+		t.Errorf("List() after replay = %d, %v; want 0, nil", len(letters), err)
+	}
+}
+
+func TestUndecodableMessage(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "queue.db"))
+	q := newTestQueue(t, db)
+	q.deadLetter = "dead_letters"
+	deadLetters := newTestQueue(t, db)
+	deadLetters.name = "dead_letters"
+	ctx := context.Background()
+
+	now := time.Now().UnixMilli()
+	if _, err := q.produceStmt.ExecContext(ctx, "poison", q.name, []byte("not a message"), "{}", now-1, now-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Produce(ctx, queue.NewMessage(&incident.Incident{Id: "valid"}, nil)); err != nil {
+		t.Fatalf("Produce() = %v", err)
+	}
+
+	// The message which can't be decoded doesn't block the next one.
+	msg := consume(t, q)
+	if got := msg.Body().Id; got != "valid" {
+		t.Errorf("Consume().Body().Id = %q, want %q", got, "valid")
+	}
+	msg.Ack()
+
+	letters, err := deadLetters.List(ctx)
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	if len(letters) != 1 || letters[0].ID != "poison" || letters[0].Reason == "" {
+		t.Errorf("List() = %+v, want the message which can't be decoded", letters)
+	}
+}
+
+func TestDSN(t *testing.T) {
+	testCases := map[string]struct {
+		dsn  string
+		want string
+	}{
+		"file":         {dsn: "file:queue.db", want: "file:queue.db?_busy_timeout=5000"},
+		"parameters":   {dsn: "file:queue.db?cache=shared", want: "file:queue.db?cache=shared&_busy_timeout=5000"},
+		"busy timeout": {dsn: "file:queue.db?_busy_timeout=100", want: "file:queue.db?_busy_timeout=100"},
+		"timeout":      {dsn: "file:queue.db?_timeout=100", want: "file:queue.db?_timeout=100"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := dsn(&Config{DSN: tc.dsn, BusyTimeout: 5 * time.Second}); got != tc.want {
+				t.Errorf("dsn() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestRebind runs the queue with the $n placeholders of Postgres, which SQLite understands too.
+func TestRebind(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "queue.db"))
+	db.rebind = sqldatabase.RebindDollar
+	q := newTestQueue(t, db)
+	q.deadLetter = "dead_letters"
+	deadLetters := newTestQueue(t, db)
+	deadLetters.name = "dead_letters"
+	ctx := context.Background()
+
+	for _, id := range []string{"first", "second"} {
+		if err := q.Produce(ctx, queue.NewMessage(&incident.Incident{Id: id}, nil)); err != nil {
+			t.Fatalf("Produce(%s) = %v", id, err)
+		}
+	}
+	// The first message is delivered again after the second.
+	consume(t, q).Nack()
+	for _, want := range []struct {
+		id         string
+		deliveries int
+	}{{"second", 1}, {"first", 2}} {
+		msg := consume(t, q)
+		if msg.Body().Id != want.id || msg.Deliveries() != want.deliveries {
+			t.Errorf("Consume() = %s delivered %d times, want %s delivered %d times",
+				msg.Body().Id, msg.Deliveries(), want.id, want.deliveries)
+		}
+		msg.Ack()
+	}
+
+	// The message which can't be decoded is moved to the dead letters, and replayed from there
+	// once it's fixed.
+	now := time.Now().UnixMilli()
+	if _, err := q.produceStmt.ExecContext(ctx, "poison", q.name, []byte("not a message"), "{}", now-1, now-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Produce(ctx, queue.NewMessage(&incident.Incident{Id: "valid"}, nil)); err != nil {
+		t.Fatalf("Produce() = %v", err)
+	}
+	consume(t, q).Ack()
+	letters, err := deadLetters.List(ctx)
+	if err != nil || len(letters) != 1 || letters[0].ID != "poison" {
+		t.Fatalf("List() = %+v, %v; want the message which can't be decoded", letters, err)
+	}
+	if _, err := deadLetters.deleteStmt.ExecContext(ctx, "poison", deadLetters.name); err != nil {
+		t.Fatal(err)
+	}
+	if err := deadLetters.Produce(ctx, queue.NewMessage(&incident.Incident{Id: "fixed"}, nil)); err != nil {
+		t.Fatalf("Produce() = %v", err)
+	}
+	if letters, err = deadLetters.List(ctx); err != nil || len(letters) != 1 {
+		t.Fatalf("List() = %+v, %v; want the fixed message", letters, err)
+	}
+	if err := deadLetters.Replay(ctx, letters[0].ID, q); err != nil {
+		t.Fatalf("Replay() = %v", err)
+	}
+	if msg := consume(t, q); msg.Body().Id != "fixed" {
+		t.Errorf("Consume().Body().Id = %q, want fixed", msg.Body().Id)
+	}
+}
+
+func TestOpenUnsupportedDriver(t *testing.T) {
+	if _, err := Open(&Config{Driver: "mysql"}); !errors.Is(err, errUnsupportedDriver) {
+		t.Errorf("Open() = %v, want %v", err, errUnsupportedDriver)
+	}
+}
@@ -0,0 +1,39 @@
+package redaction
+
+import (
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/storage"
+)
+
+// Option extends the functionality of the redactor
+type Option func(*Redactor)
+
+// Storage provides the storage the redacted images are stored in.
+func Storage(store storage.Storage) Option {
+	return func(r *Redactor) {
+		r.storage = store
+	}
+}
+
+// Sizes provides the sizes of the variants which are stored redacted, same as the variants of
+// the image.
+func Sizes(sizes map[storage.Variant]int) Option {
+	return func(r *Redactor) {
+		r.sizes = sizes
+	}
+}
+
+// Detectors provides the detectors finding the regions to redact in the uploaded images.
+func Detectors(detectors ...Detector) Option {
+	return func(r *Redactor) {
+		r.detectors = append(r.detectors, detectors...)
+	}
+}
+
+// Tracer provides the tracing
+func Tracer(t trace.Tracer) Option {
+	return func(r *Redactor) {
+		r.tracer = t
+	}
+}
@@ -0,0 +1,110 @@
+// Package redaction hides the parts of the uploaded images which must not be published, such as
+// the faces of the people and the number plates of the cars in the photos.
+package redaction
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// ErrInvalidRegion is returned for the regions which are empty or not within the image.
+var ErrInvalidRegion = errors.New("redaction: invalid region")
+
+// Region of the image to redact. It is given as fractions of the width and height of the image,
+// so the same region can be used with any of its variants.
+type Region struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// epsilon allows for the rounding of the regions which end at the edge of the image.
+const epsilon = 1e-9
+
+// Validate checks the region is within the image.
+func (r Region) Validate() error {
+	// The comparisons are false for NaN, so they are written to reject it.
+	if !(r.X >= 0 && r.Y >= 0 && r.Width > 0 && r.Height > 0 &&
+		r.X+r.Width <= 1+epsilon && r.Y+r.Height <= 1+epsilon) {
+		return ErrInvalidRegion
+	}
+	return nil
+}
+
+// rect is the region in the pixels of the image within the bounds, rounded outwards so the
+// region is always covered.
+func (r Region) rect(b image.Rectangle) image.Rectangle {
+	w, h := float64(b.Dx()), float64(b.Dy())
+	return image.Rect(
+		b.Min.X+int(math.Floor(r.X*w)),
+		b.Min.Y+int(math.Floor(r.Y*h)),
+		b.Min.X+int(math.Ceil((r.X+r.Width)*w)),
+		b.Min.Y+int(math.Ceil((r.Y+r.Height)*h)),
+	).Intersect(b)
+}
+
+// Detector finds the regions of the image which have to be redacted.
+type Detector interface {
+	Detect(ctx context.Context, img image.Image) ([]Region, error)
+}
+
+// DetectorFunc is a function which can be used as a Detector.
+type DetectorFunc func(ctx context.Context, img image.Image) ([]Region, error)
+
+// Detect calls the function.
+func (f DetectorFunc) Detect(ctx context.Context, img image.Image) ([]Region, error) {
+	return f(ctx, img)
+}
+
+// blocks across the longer side of each region once it is pixelated.
+const blocks = 8
+
+// Redact returns a copy of the image with the regions pixelated. The blocks are large enough so
+// the faces and number plates can't be recognised, unlike a light blur which can be reversed.
+func Redact(img image.Image, regions []Region) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+
+	for _, region := range regions {
+		pixelate(dst, region.rect(b))
+	}
+	return dst
+}
+
+// pixelate replaces the rectangle of the image with blocks of their average colour.
+func pixelate(img *image.RGBA, rect image.Rectangle) {
+	size := max(1, max(rect.Dx(), rect.Dy())/blocks)
+	for y := rect.Min.Y; y < rect.Max.Y; y += size {
+		for x := rect.Min.X; x < rect.Max.X; x += size {
+			fill(img, image.Rect(x, y, x+size, y+size).Intersect(rect))
+		}
+	}
+}
+
+// fill the block with its average colour.
+func fill(img *image.RGBA, block image.Rectangle) {
+	var sum [4]int
+	for y := block.Min.Y; y < block.Max.Y; y++ {
+		for x := block.Min.X; x < block.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			for c := range sum {
+				sum[c] += int(img.Pix[i+c])
+			}
+		}
+	}
+
+	n := block.Dx() * block.Dy()
+	for y := block.Min.Y; y < block.Max.Y; y++ {
+		for x := block.Min.X; x < block.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			for c := range sum {
+				img.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package redaction
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/storage"
+	"safer.place/internal/storage/storagetest"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := map[string]struct {
+		region Region
+		err    error
+	}{
+		"whole image":  {region: Region{Width: 1, Height: 1}},
+		"inside":       {region: Region{X: 0.25, Y: 0.5, Width: 0.5, Height: 0.25}},
+		"rounded edge": {region: Region{X: 0.7, Y: 0.1, Width: 0.3, Height: 0.9}},
+		"empty":        {region: Region{X: 0.5, Y: 0.5}, err: ErrInvalidRegion},
+		"negative":     {region: Region{X: -0.1, Width: 0.5, Height: 0.5}, err: ErrInvalidRegion},
+		"outside":      {region: Region{X: 0.75, Width: 0.5, Height: 0.5}, err: ErrInvalidRegion},
+		"nan":          {region: Region{X: math.NaN(), Width: 0.5, Height: 0.5}, err: ErrInvalidRegion},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.region.Validate(); !errors.Is(err, tc.err) {
+				t.Errorf("Validate(%+v) = %v, want %v", tc.region, err, tc.err)
+			}
+		})
+	}
+}
+
+// striped image, so every pixel differs from its neighbours until it is pixelated.
+func striped(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8((x + y) % 2 * 255)
+			img.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	return img
+}
+
+func TestRedact(t *testing.T) {
+	src := striped(64, 32)
+
+	// The left half of the image, which is 32x32 pixels pixelated in 4x4 blocks.
+	dst := Redact(src, []Region{{Width: 0.5, Height: 1}})
+
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			got := color.RGBAModel.Convert(dst.At(x, y))
+			if x < 32 {
+				// The average of the stripes.
+				if want := (color.RGBA{R: 127, G: 127, B: 127, A: 255}); got != want {
+					t.Fatalf("At(%d, %d) = %v, want %v", x, y, got, want)
+				}
+				continue
+			}
+			if want := src.At(x, y); got != want {
+				t.Fatalf("At(%d, %d) = %v, want it unchanged %v", x, y, got, want)
+			}
+		}
+	}
+
+	// The source is not changed.
+	if src.At(0, 0) == src.At(1, 0) {
+		t.Errorf("Redact() changed the source image")
+	}
+}
+
+func TestRect(t *testing.T) {
+	b := image.Rect(10, 10, 110, 60)
+
+	testCases := map[string]struct {
+		region Region
+		want   image.Rectangle
+	}{
+		"whole":   {region: Region{Width: 1, Height: 1}, want: b},
+		"rounded": {region: Region{X: 0.005, Y: 0.5, Width: 0.5, Height: 0.25}, want: image.Rect(10, 35, 61, 48)},
+		"clipped": {region: Region{X: 0.9, Y: 0.9, Width: 0.2, Height: 0.2}, want: image.Rect(100, 55, 110, 60)},
+	}
+
+	for name, tc := range testCases {
+		if got := tc.region.rect(b); got != tc.want {
+			t.Errorf("%s: rect(%+v) = %v, want %v", name, tc.region, got, tc.want)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.New(t)
+	r, err := New(
+		Storage(store),
+		Sizes(map[storage.Variant]int{storage.VariantThumbnail: 8, storage.VariantMedium: 16}),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+	)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+
+	ref := store.Store([]byte("uploaded"))
+	redacted := []string{
+		storage.VariantReference(ref, storage.VariantRedacted),
+		storage.VariantReference(ref, storage.VariantRedactedThumbnail),
+		storage.VariantReference(ref, storage.VariantRedactedMedium),
+	}
+
+	img := striped(64, 32)
+	if err := r.Store(ctx, ref, img, "png", []Region{{Width: 0.5, Height: 0.5}}); err != nil {
+		t.Fatalf("Store() = %v", err)
+	}
+	if ops := store.Ops(); len(ops) != 3 || ops[2] != "put "+redacted[0] {
+		t.Errorf("Store() = %v, want the redacted image stored last", ops)
+	}
+	for _, key := range redacted {
+		if store.Read(key) == nil {
+			t.Errorf("%s not stored", key)
+		}
+	}
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(store.Read(redacted[0]))); err != nil ||
+		format != "png" || cfg.Width != 64 || cfg.Height != 32 {
+		t.Errorf("redacted image is %s %dx%d (%v), want png 64x32", format, cfg.Width, cfg.Height, err)
+	}
+
+	if err := r.Store(ctx, ref, img, "png", []Region{{X: 1, Width: 0.5, Height: 0.5}}); !errors.Is(err, ErrInvalidRegion) {
+		t.Errorf("Store() = %v, want %v", err, ErrInvalidRegion)
+	}
+
+	// Without any regions the image is published as it is.
+	if err := r.Store(ctx, ref, img, "png", nil); err != nil {
+		t.Fatalf("Store() = %v", err)
+	}
+	if ops := store.Ops()[3:]; len(ops) == 0 || ops[0] != "delete "+redacted[0] {
+		t.Errorf("Store() = %v, want the redacted image deleted first", ops)
+	}
+	for _, key := range redacted {
+		if store.Read(key) != nil {
+			t.Errorf("%s not deleted", key)
+		}
+	}
+	if string(store.Read(ref)) != "uploaded" {
+		t.Errorf("uploaded image changed")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	face := Region{Width: 0.1, Height: 0.1}
+	plate := Region{X: 0.5, Y: 0.5, Width: 0.2, Height: 0.1}
+	detector := func(regions ...Region) Detector {
+		return DetectorFunc(func(context.Context, image.Image) ([]Region, error) {
+			return regions, nil
+		})
+	}
+
+	r, err := New(
+		Storage(storagetest.New(t)),
+		Detectors(detector(face), detector(), detector(plate)),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+	)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+
+	regions, err := r.Detect(context.Background(), striped(1, 1))
+	if err != nil {
+		t.Fatalf("Detect() = %v", err)
+	}
+	if want := []Region{face, plate}; !slices.Equal(regions, want) {
+		t.Errorf("Detect() = %v, want %v", regions, want)
+	}
+}
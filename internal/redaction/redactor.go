@@ -0,0 +1,135 @@
+package redaction
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/imaging"
+	"safer.place/internal/storage"
+)
+
+// Redactor stores the redacted versions of the images next to them.
+type Redactor struct {
+	storage   storage.Storage
+	sizes     map[storage.Variant]int
+	detectors []Detector
+	tracer    trace.Tracer
+}
+
+// New creates the redactor.
+func New(opts ...Option) (*Redactor, error) {
+	r := &Redactor{}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if err := validate(r); err != nil {
+		return nil, fmt.Errorf("redactor validation failed: %w", err)
+	}
+
+	return r, nil
+}
+
+// Detect returns the regions all the detectors found in the image.
+func (r *Redactor) Detect(ctx context.Context, img image.Image) (_ []Region, err error) {
+	ctx, span := r.tracer.Start(ctx, "detect")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	var regions []Region
+	for _, d := range r.detectors {
+		found, err := d.Detect(ctx, img)
+		if err != nil {
+			return nil, fmt.Errorf("unable to detect regions: %w", err)
+		}
+		regions = append(regions, found...)
+	}
+
+	return regions, nil
+}
+
+// Store the image with the regions redacted, and its smaller variants, next to the image. The
+// image was decoded from the format. The redacted versions are removed if there are no regions,
+// so the image is published as it is.
+//
+// The redacted image is stored last and removed first, as the redacted versions are only
+// published in place of the image once it exists.
+func (r *Redactor) Store(ctx context.Context, reference string, img image.Image, format string, regions []Region) (err error) {
+	ctx, span := r.tracer.Start(ctx, "store")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	for _, region := range regions {
+		if err := region.Validate(); err != nil {
+			return fmt.Errorf("%w: %+v", err, region)
+		}
+	}
+
+	if len(regions) == 0 {
+		for _, v := range []storage.Variant{
+			storage.VariantRedacted, storage.VariantRedactedThumbnail, storage.VariantRedactedMedium,
+		} {
+			if err := r.storage.Delete(ctx, storage.VariantReference(reference, v)); err != nil {
+				return fmt.Errorf("unable to delete redacted %s: %w", v, err)
+			}
+		}
+		return nil
+	}
+
+	redacted := Redact(img, regions)
+	for variant, size := range r.sizes {
+		var buf bytes.Buffer
+		contentType, err := imaging.Resize(&buf, redacted, size)
+		if err != nil {
+			return err
+		}
+		key := storage.VariantReference(reference, variant.Redacted())
+		if err := r.storage.Put(ctx, key, &buf, int64(buf.Len()), contentType); err != nil {
+			return fmt.Errorf("unable to store redacted %s: %w", variant, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	contentType, err := imaging.Encode(&buf, redacted, format)
+	if err != nil {
+		return err
+	}
+	key := storage.VariantReference(reference, storage.VariantRedacted)
+	if err := r.storage.Put(ctx, key, &buf, int64(buf.Len()), contentType); err != nil {
+		return fmt.Errorf("unable to store redacted image: %w", err)
+	}
+
+	return nil
+}
+
+var (
+	errMissingStorage = errors.New("missing storage")
+	errMissingTracer  = errors.New("missing tracer")
+)
+
+func validate(r *Redactor) error {
+	if r.storage == nil {
+		return errMissingStorage
+	}
+	if r.tracer == nil {
+		return errMissingTracer
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+// Package feed streams the incidents accepted or alerted in the regions of the user as they are
+// reviewed, as server-sent events.
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"api.safer.place/incident/v1"
+	"api.safer.place/viewer/v1"
+	"safer.place/internal/bus"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/service"
+	viewerv1 "safer.place/internal/service/viewer/v1"
+)
+
+// path of the feed.
+const path = "/v1/feed"
+
+// Config of the feed.
+type Config struct {
+	// Heartbeat is how often a comment is sent on the idle streams, so the proxies don't close
+	// them.
+	Heartbeat time.Duration `yaml:"heartbeat" default:"15s"`
+	// MaxRegions each stream follows.
+	MaxRegions int `yaml:"max_regions" split_words:"true" default:"25"`
+	// MaxResume is how far back the streams can be resumed from. The streams resumed from
+	// further back start from then.
+	MaxResume time.Duration `yaml:"max_resume" split_words:"true" default:"24h"`
+	// WriteTimeout of each event, after which the stream is closed.
+	WriteTimeout time.Duration `yaml:"write_timeout" split_words:"true" default:"10s"`
+	// Buffer of the events of each stream. The streams which fall further behind are closed, and
+	// the clients resume them.
+	Buffer int `yaml:"buffer" default:"64"`
+	// PollInterval is how often the incidents reviewed by any process are read from the
+	// database, and sent to the streams.
+	PollInterval time.Duration `yaml:"poll_interval" split_words:"true" default:"1s"`
+}
+
+// Service is the feed service.
+type Service struct {
+	cfg    Config
+	db     database.Incidents
+	events *bus.Bus
+	log    log.Logger
+	tracer trace.Tracer
+	// now is replaced in the tests.
+	now func() time.Time
+}
+
+// Register registers the feed service.
+func Register(opts ...Option) service.Service {
+	s := &Service{
+		now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := validate(s); err != nil {
+		panic(err)
+	}
+
+	// We can ignore the interceptors as this is a non-connect service
+	return func(_ ...connect.Interceptor) (string, http.Handler) {
+		return path, s
+	}
+}
+
+// ServeHTTP streams the incidents in the regions from the region query parameters, each of them
+// north,south,east,west in hundredths of a degree like the regions of the viewer. Each event is
+// the incident in protojson, named after its resolution, with the Unix time of the review as its
+// ID. The stream is resumed from the Last-Event-ID header or the since query parameter, with
+// the incidents reviewed at or after it.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	regions, err := s.parseRegions(r.URL.Query()["region"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	since, resume, err := s.parseSince(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The subscription starts before the incidents are resumed, so none are missed in between.
+	sub := s.events.Subscribe()
+	defer sub.Close()
+
+	var resumed []*database.ReviewedIncident
+	if resume {
+		if resumed, err = s.resume(ctx, since, regions); err != nil {
+			s.log.Error(ctx, "unable to resume feed", log.Error(err))
+			http.Error(w, "unable to resume feed", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	st := &stream{w: w, rc: http.NewResponseController(w), timeout: s.cfg.WriteTimeout}
+	if err := st.flush(); err != nil {
+		return
+	}
+
+	// The incidents reviewed in the meantime can be both resumed and published.
+	sent := make(map[string]time.Time, len(resumed))
+	for _, r := range resumed {
+		if err := st.send(r.Incident, r.Reviewed); err != nil {
+			return
+		}
+		sent[r.Incident.Id] = r.Reviewed
+	}
+
+	heartbeat := time.NewTicker(s.cfg.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				if sub.Lagged() {
+					s.log.Debug(ctx, "closing feed which fell behind")
+				}
+				return
+			}
+			if !inRegions(e.Incident, regions) {
+				continue
+			}
+			if reviewed, ok := sent[e.Incident.Id]; ok && !e.Reviewed.After(reviewed) {
+				continue
+			}
+			if err := st.send(e.Incident, e.Reviewed); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := st.write(": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// resume returns the incidents reviewed in the regions since the time, oldest review first.
+func (s *Service) resume(ctx context.Context, since time.Time, regions []*viewer.Region) (_ []*database.ReviewedIncident, err error) {
+	ctx, span := s.tracer.Start(ctx, "resume")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	var (
+		resumed []*database.ReviewedIncident
+		seen    = make(map[string]struct{})
+	)
+	for _, region := range regions {
+		incs, err := s.db.ReviewedIncidents(ctx, since, region)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list reviewed incidents: %w", err)
+		}
+		// The incidents are in a single region, unless the regions overlap.
+		for _, r := range incs {
+			if _, ok := seen[r.Incident.Id]; !ok {
+				seen[r.Incident.Id] = struct{}{}
+				resumed = append(resumed, r)
+			}
+		}
+	}
+
+	slices.SortStableFunc(resumed, func(a, b *database.ReviewedIncident) int {
+		return a.Reviewed.Compare(b.Reviewed)
+	})
+	return resumed, nil
+}
+
+// parseRegions parses the regions, which are validated the same way as the regions of the
+// viewer.
+func (s *Service) parseRegions(params []string) ([]*viewer.Region, error) {
+	if len(params) == 0 {
+		return nil, errMissingRegions
+	}
+	if len(params) > s.cfg.MaxRegions {
+		return nil, fmt.Errorf("%w: at most %d regions", errTooManyRegions, s.cfg.MaxRegions)
+	}
+
+	regions := make([]*viewer.Region, 0, len(params))
+	for _, param := range params {
+		bounds := strings.Split(param, ",")
+		if len(bounds) != 4 {
+			return nil, fmt.Errorf("%w %q: expected north,south,east,west", errInvalidRegion, param)
+		}
+		var values [4]float64
+		for i, bound := range bounds {
+			v, err := strconv.ParseFloat(strings.TrimSpace(bound), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w %q: %w", errInvalidRegion, param, err)
+			}
+			values[i] = v
+		}
+
+		region := &viewer.Region{North: values[0], South: values[1], East: values[2], West: values[3]}
+		if err := viewerv1.ValidateRegion(region); err != nil {
+			return nil, fmt.Errorf("%w %q: %w", errInvalidRegion, param, err)
+		}
+		regions = append(regions, region)
+	}
+	return regions, nil
+}
+
+// parseSince returns the time the stream is resumed from, if it is resumed. The Last-Event-ID
+// header sent by the browsers when they reconnect takes precedence over the since parameter.
+func (s *Service) parseSince(r *http.Request) (time.Time, bool, error) {
+	param := r.Header.Get("Last-Event-ID")
+	if param == "" {
+		param = r.URL.Query().Get("since")
+	}
+	if param == "" {
+		return time.Time{}, false, nil
+	}
+
+	seconds, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%w: expected Unix time", errInvalidSince)
+	}
+	since := time.Unix(seconds, 0)
+	if oldest := s.now().Add(-s.cfg.MaxResume); since.Before(oldest) {
+		since = oldest
+	}
+	return since, true, nil
+}
+
+// inRegions returns whether the incident is in any of the regions, with the same bounds as the
+// incidents found in the regions by the database.
+func inRegions(inc *incident.Incident, regions []*viewer.Region) bool {
+	c := inc.Coordinates
+	if c == nil {
+		return false
+	}
+	for _, r := range regions {
+		if c.Lat < r.North/100 && c.Lat > r.South/100 && c.Lon > r.West/100 && c.Lon < r.East/100 {
+			return true
+		}
+	}
+	return false
+}
+
+// stream writes the events, each within the timeout.
+type stream struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+// send the incident as an event.
+func (st *stream) send(inc *incident.Incident, reviewed time.Time) error {
+	data, err := protojson.Marshal(inc)
+	if err != nil {
+		return fmt.Errorf("unable to encode incident: %w", err)
+	}
+
+	event := "accepted"
+	if inc.Resolution == incident.Resolution_RESOLUTION_ALERTED {
+		event = "alerted"
+	}
+	// The encoded incident is on a single line, as the newlines in its strings are escaped.
+	return st.write(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", reviewed.Unix(), event, data))
+}
+
+func (st *stream) write(s string) error {
+	// The write timeout of the server is meant for the responses which don't stream.
+	if err := st.rc.SetWriteDeadline(time.Now().Add(st.timeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := st.w.Write([]byte(s)); err != nil {
+		return err
+	}
+	return st.flush()
+}
+
+func (st *stream) flush() error {
+	return st.rc.Flush()
+}
+
+var (
+	errMissingLogger   = errors.New("missing logger")
+	errMissingTrace    = errors.New("missing tracer")
+	errMissingDatabase = errors.New("missing database")
+	errMissingEvents   = errors.New("missing events")
+	errInvalidConfig   = errors.New("heartbeat, write timeout, max regions, buffer and poll interval must be positive")
+
+	errMissingRegions = errors.New("missing regions")
+	errTooManyRegions = errors.New("too many regions")
+	errInvalidRegion  = errors.New("invalid region")
+	errInvalidSince   = errors.New("invalid since")
+)
+
+func validate(s *Service) error {
+	if s.log == nil {
+		return errMissingLogger
+	}
+	if s.tracer == nil {
+		return errMissingTrace
+	}
+	if s.db == nil {
+		return errMissingDatabase
+	}
+	if s.events == nil {
+		return errMissingEvents
+	}
+	if s.cfg.Heartbeat <= 0 || s.cfg.WriteTimeout <= 0 || s.cfg.MaxRegions <= 0 || s.cfg.Buffer <= 0 ||
+		s.cfg.PollInterval <= 0 {
+		return errInvalidConfig
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package feed
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"api.safer.place/incident/v1"
+	"api.safer.place/viewer/v1"
+	"safer.place/internal/bus"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+)
+
+// fakeDatabase returns the reviewed incidents in the region, ignoring when they were reviewed.
+type fakeDatabase struct {
+	database.Incidents
+	reviewed []*database.ReviewedIncident
+	since    time.Time
+}
+
+func (db *fakeDatabase) ReviewedIncidents(_ context.Context, since time.Time, region *viewer.Region) ([]*database.ReviewedIncident, error) {
+	db.since = since
+	var res []*database.ReviewedIncident
+	for _, r := range db.reviewed {
+		if inRegions(r.Incident, []*viewer.Region{region}) {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+var (
+	now = time.Unix(1700000000, 0)
+
+	// dublin is in the region followed by the tests, and london is not.
+	dublin = &incident.Coordinates{Lat: 53.3498, Lon: -6.2603}
+	london = &incident.Coordinates{Lat: 51.5072, Lon: -0.1276}
+)
+
+const region = "5335,5334,-626,-627"
+
+func newService(db *fakeDatabase, events *bus.Bus) *Service {
+	_, handler := Register(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+		Database(db),
+		Events(events),
+		Configuration(Config{
+			Heartbeat:    10 * time.Millisecond,
+			MaxRegions:   2,
+			MaxResume:    time.Hour,
+			WriteTimeout: time.Second,
+			Buffer:       10,
+			PollInterval: time.Second,
+		}),
+	)()
+	s := handler.(*Service)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+// readEvent reads the next event or comment from the stream.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("unable to read event: %v", err)
+		}
+		if line == "\n" {
+			return strings.Join(lines, "\n")
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+}
+
+func TestFeed(t *testing.T) {
+	db := &fakeDatabase{
+		reviewed: []*database.ReviewedIncident{{
+			Incident: &incident.Incident{Id: "resumed", Coordinates: dublin, Resolution: incident.Resolution_RESOLUTION_ACCEPTED},
+			Reviewed: now.Add(-time.Minute),
+		}, {
+			Incident: &incident.Incident{Id: "elsewhere", Coordinates: london, Resolution: incident.Resolution_RESOLUTION_ACCEPTED},
+			Reviewed: now.Add(-time.Minute),
+		}},
+	}
+	events := bus.New(10)
+	server := httptest.NewServer(newService(db, events))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+path+"?region="+region+"&since=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The header sent by the browsers takes precedence.
+	req.Header.Set("Last-Event-ID", "1699999000")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("response %d %q, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if want := time.Unix(1699999000, 0); !db.since.Equal(want) {
+		t.Errorf("resumed since %v, want %v", db.since, want)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	if e := readEvent(t, r); !strings.HasPrefix(e, "id: 1699999940\nevent: accepted\ndata: ") || !strings.Contains(e, `"resumed"`) {
+		t.Errorf("first event = %q, want the resumed incident", e)
+	}
+
+	// The incident elsewhere and the incident which was already resumed are skipped.
+	events.Publish(&bus.Event{
+		Incident: &incident.Incident{Id: "elsewhere", Coordinates: london, Resolution: incident.Resolution_RESOLUTION_ALERTED},
+		Reviewed: now,
+	})
+	events.Publish(&bus.Event{Incident: db.reviewed[0].Incident, Reviewed: db.reviewed[0].Reviewed})
+	events.Publish(&bus.Event{
+		Incident: &incident.Incident{Id: "alerted", Coordinates: dublin, Resolution: incident.Resolution_RESOLUTION_ALERTED},
+		Reviewed: now,
+	})
+
+	var e string
+	for e = readEvent(t, r); e == ": heartbeat"; e = readEvent(t, r) {
+	}
+	if !strings.HasPrefix(e, "id: 1700000000\nevent: alerted\ndata: ") || !strings.Contains(e, `"alerted"`) {
+		t.Errorf("event = %q, want the alerted incident", e)
+	}
+	if e := readEvent(t, r); e != ": heartbeat" {
+		t.Errorf("event = %q, want a heartbeat", e)
+	}
+}
+
+func TestFeedResumeLimit(t *testing.T) {
+	db := &fakeDatabase{}
+	server := httptest.NewServer(newService(db, bus.New(1)))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + path + "?region=" + region + "&since=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if want := now.Add(-time.Hour); !db.since.Equal(want) {
+		t.Errorf("resumed since %v, want %v", db.since, want)
+	}
+}
+
+func TestFeedBadRequest(t *testing.T) {
+	testCases := map[string]struct {
+		method string
+		query  string
+		status int
+	}{
+		"method": {
+			method: http.MethodPost,
+			query:  "region=" + region,
+			status: http.StatusMethodNotAllowed,
+		},
+		"missing region": {
+			status: http.StatusBadRequest,
+		},
+		"too many regions": {
+			query:  "region=" + region + "&region=" + region + "&region=" + region,
+			status: http.StatusBadRequest,
+		},
+		"malformed region": {
+			query:  "region=5335,5334,-626",
+			status: http.StatusBadRequest,
+		},
+		"invalid region": {
+			query:  "region=5334,5335,-626,-627",
+			status: http.StatusBadRequest,
+		},
+		"invalid since": {
+			query:  "region=" + region + "&since=yesterday",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			events := bus.New(1)
+			w := httptest.NewRecorder()
+			newService(&fakeDatabase{}, events).ServeHTTP(w, httptest.NewRequest(method, path+"?"+tc.query, nil))
+
+			if w.Code != tc.status {
+				t.Errorf("status = %d, want %d", w.Code, tc.status)
+			}
+			if n := events.Subscribers(); n != 0 {
+				t.Errorf("%d subscribers, want 0", n)
+			}
+		})
+	}
+}
+
+func TestRegisterInvalidBuffer(t *testing.T) {
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, errInvalidConfig) {
+			t.Errorf("Register() panicked with %v, want %v", err, errInvalidConfig)
+		}
+	}()
+
+	Register(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+		Database(&fakeDatabase{}),
+		Events(bus.New(0)),
+		Configuration(Config{
+			Heartbeat:    time.Second,
+			MaxRegions:   1,
+			MaxResume:    time.Hour,
+			WriteTimeout: time.Second,
+			PollInterval: time.Second,
+		}),
+	)
+}
@@ -0,0 +1,47 @@
+package feed
+
+import (
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/bus"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+)
+
+// Option to provide configuration to the service.
+type Option func(*Service)
+
+// Logger provides the logger
+func Logger(log log.Logger) Option {
+	return func(s *Service) {
+		s.log = log
+	}
+}
+
+// Tracer provides the tracing
+func Tracer(tp trace.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = tp
+	}
+}
+
+// Database provides the incidents the streams are resumed from.
+func Database(db database.Incidents) Option {
+	return func(s *Service) {
+		s.db = db
+	}
+}
+
+// Events provides the bus the reviewed incidents are published to.
+func Events(b *bus.Bus) Option {
+	return func(s *Service) {
+		s.events = b
+	}
+}
+
+// Configuration provides the configuration of the feed.
+func Configuration(cfg Config) Option {
+	return func(s *Service) {
+		s.cfg = cfg
+	}
+}
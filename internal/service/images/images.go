@@ -0,0 +1,255 @@
+// Package images serves the uploaded images over HTTP. The images of the published incidents can
+// be seen by everyone, and the rest only by the reviewers.
+package images
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"connectrpc.com/connect"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"api.safer.place/incident/v1"
+	"safer.place/internal/auth/rbac"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/service"
+	"safer.place/internal/storage"
+)
+
+// Path the images are served from, followed by the image reference.
+const Path = "/v1/image/"
+
+var errNotFound = errors.New("image not found")
+
+// Service is the image service
+type Service struct {
+	tracer  trace.Tracer
+	storage storage.Storage
+	db      database.Images
+	authz   Authorizer
+	log     log.Logger
+}
+
+// Register registers the image service.
+func Register(opts ...Option) service.Service {
+	s := &Service{}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := validate(s); err != nil {
+		panic(err)
+	}
+
+	// We can ignore the interceptors as this is a non-connect service
+	return func(_ ...connect.Interceptor) (string, http.Handler) {
+		return Path, s
+	}
+}
+
+// ServeHTTP serves the image, or redirects to it if the storage can presign the URLs.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := s.tracer.Start(r.Context(), "image")
+	defer span.End()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The variants can be seen by the same users as the image they were made from.
+	key := strings.TrimPrefix(r.URL.Path, Path)
+	reference, variant := storage.ParseReference(key)
+	span.SetAttributes(
+		attribute.String("reference", reference),
+		attribute.String("variant", string(variant)),
+	)
+
+	published, err := s.authorize(ctx, reference)
+	if err == nil {
+		key, err = s.version(ctx, reference, variant, published)
+	}
+	if err == nil {
+		err = s.serve(w, r.WithContext(ctx), key, published)
+	}
+	if _, v := storage.ParseReference(key); errors.Is(err, storage.ErrNotFound) && v != "" && v != storage.VariantRedacted {
+		// The images uploaded before the variants were stored, or whose variants failed to be
+		// stored, are served in their place.
+		image := reference
+		if v.Redacted() == v {
+			image = storage.VariantReference(reference, storage.VariantRedacted)
+		}
+		err = s.serve(w, r.WithContext(ctx), image, published)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		// The images which the user can't see are not found, so they don't learn whether the
+		// image exists.
+		switch {
+		case errors.Is(err, errNotFound), errors.Is(err, storage.ErrNotFound),
+			errors.Is(err, rbac.ErrPermissionDenied):
+			http.Error(w, errNotFound.Error(), http.StatusNotFound)
+		case errors.Is(err, rbac.ErrUnauthenticated):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		default:
+			s.log.Error(ctx, "unable to serve image", log.Error(err))
+			http.Error(w, "unable to serve image", http.StatusInternalServerError)
+		}
+	}
+}
+
+// authorize checks the user can see the image, and returns whether it is published.
+func (s *Service) authorize(ctx context.Context, reference string) (bool, error) {
+	if reference == "" || strings.Contains(reference, "/") {
+		return false, errNotFound
+	}
+
+	incs, err := s.db.ImageIncidents(ctx, reference)
+	if err != nil {
+		return false, fmt.Errorf("unable to get image incidents: %w", err)
+	}
+
+	// The same image can be reported with several incidents, and it is published with any of
+	// them. The images which haven't been reported with an incident yet are not published either.
+	if slices.ContainsFunc(incs, published) {
+		return true, nil
+	}
+
+	return false, s.authz.Check(ctx, rbac.PermissionReviewIncidents)
+}
+
+// version returns the reference of the version of the image the user can see. Once the image
+// has been redacted, only the reviewers can see it as it was uploaded.
+func (s *Service) version(ctx context.Context, reference string, variant storage.Variant, published bool) (string, error) {
+	key := storage.VariantReference(reference, variant)
+	// Only the reviewers can see the images which are not published.
+	if !published {
+		return key, nil
+	}
+	switch err := s.authz.Check(ctx, rbac.PermissionReviewIncidents); {
+	case err == nil:
+		return key, nil
+	case !errors.Is(err, rbac.ErrPermissionDenied) && !errors.Is(err, rbac.ErrUnauthenticated):
+		return "", err
+	}
+
+	_, err := s.storage.Stat(ctx, storage.VariantReference(reference, storage.VariantRedacted))
+	if errors.Is(err, storage.ErrNotFound) {
+		return key, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to check the image is redacted: %w", err)
+	}
+	return storage.VariantReference(reference, variant.Redacted()), nil
+}
+
+func published(inc *incident.Incident) bool {
+	switch inc.GetResolution() {
+	case incident.Resolution_RESOLUTION_ACCEPTED, incident.Resolution_RESOLUTION_ALERTED:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Service) serve(w http.ResponseWriter, r *http.Request, reference string, published bool) error {
+	ctx := r.Context()
+
+	// The images can be unpublished, so they are only cached for a short while.
+	if published {
+		w.Header().Set("Cache-Control", "private, max-age=60")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+
+	// The image is checked before it is presigned, so the missing variants are found.
+	info, err := s.storage.Stat(ctx, reference)
+	if err != nil {
+		return err
+	}
+
+	if p, ok := s.storage.(storage.Presigner); ok {
+		u, err := p.PresignGet(ctx, reference)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, u.String(), http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	image, err := s.storage.Get(ctx, reference)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	// Anything which isn't an image is downloaded instead of being displayed, so uploading
+	// a page can't be used to run scripts on our domain.
+	h := w.Header()
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	if strings.HasPrefix(info.ContentType, "image/") {
+		h.Set("Content-Type", info.ContentType)
+	} else {
+		h.Set("Content-Type", "application/octet-stream")
+		h.Set("Content-Disposition", "attachment")
+	}
+
+	if rs, ok := image.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", info.ModTime, rs)
+		return nil
+	}
+
+	h.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	if !info.ModTime.IsZero() {
+		h.Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	if _, err := io.Copy(w, image); err != nil {
+		// The headers have been sent already, so we can only log it.
+		s.log.Warn(ctx, "unable to write image", log.Error(err))
+	}
+	return nil
+}
+
+var (
+	errMissingLogger     = errors.New("missing logger")
+	errMissingTrace      = errors.New("missing tracer")
+	errMissingStorage    = errors.New("missing storage")
+	errMissingDatabase   = errors.New("missing database")
+	errMissingAuthorizer = errors.New("missing authorizer")
+)
+
+func validate(s *Service) error {
+	if s.log == nil {
+		return errMissingLogger
+	}
+	if s.tracer == nil {
+		return errMissingTrace
+	}
+	if s.storage == nil {
+		return errMissingStorage
+	}
+	if s.db == nil {
+		return errMissingDatabase
+	}
+	if s.authz == nil {
+		return errMissingAuthorizer
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"api.safer.place/incident/v1"
+	"safer.place/internal/auth/rbac"
+	"safer.place/internal/log"
+	"safer.place/internal/storage"
+	"safer.place/internal/storage/storagetest"
+)
+
+// presigner gives out the URLs of the images in the storage, whether they exist or not.
+type presigner struct {
+	*storagetest.Storage
+}
+
+func (s presigner) PresignGet(_ context.Context, reference string) (*url.URL, error) {
+	return url.Parse("https://storage.example.com/images/" + reference + "?signature=1")
+}
+
+// fakeImages has the resolutions of the incidents reported with each image.
+type fakeImages map[string][]incident.Resolution
+
+func (db fakeImages) ImageIncidents(_ context.Context, imageID string) ([]*incident.Incident, error) {
+	var incs []*incident.Incident
+	for i, resolution := range db[imageID] {
+		incs = append(incs, &incident.Incident{Id: fmt.Sprint("incident", i), ImageId: imageID, Resolution: resolution})
+	}
+	return incs, nil
+}
+
+// fakeAuthorizer grants the review permission if the user is a reviewer.
+type fakeAuthorizer bool
+
+func (reviewer fakeAuthorizer) Check(_ context.Context, p rbac.Permission) error {
+	if p == rbac.PermissionReviewIncidents && bool(reviewer) {
+		return nil
+	}
+	return rbac.ErrPermissionDenied
+}
+
+func newTestService(s storage.Storage, images fakeImages, reviewer bool) http.Handler {
+	_, handler := Register(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+		Storage(s),
+		Database(images),
+		Authorization(fakeAuthorizer(reviewer)),
+	)()
+	return handler
+}
+
+// The images start with the signatures of their format, which their content type is detected
+// from.
+func pngImage(content string) []byte  { return append([]byte("\x89PNG\r\n\x1a\n"), content...) }
+func jpegImage(content string) []byte { return append([]byte("\xff\xd8\xff"), content...) }
+
+// testImages are stored by name, with the variants named after their image.
+type testImages struct {
+	store *storagetest.Storage
+	// refs are the references of the images by name.
+	refs map[string]string
+	// contents of the images and variants by name.
+	contents map[string][]byte
+}
+
+// storeImages stores the images, and then their variants. The images which are only named in
+// the resolutions get a reference, but aren't stored.
+func storeImages(t *testing.T, s *storagetest.Storage, images, variants map[string][]byte, resolutions map[string]incident.Resolution) (*testImages, fakeImages) {
+	t.Helper()
+
+	ti := &testImages{store: s, refs: make(map[string]string), contents: make(map[string][]byte)}
+	for name, data := range images {
+		ti.refs[name] = s.Store(data)
+		ti.contents[name] = data
+	}
+	for name := range resolutions {
+		if _, ok := ti.refs[name]; !ok {
+			ti.refs[name] = uuid.NewString()
+		}
+	}
+	for name, data := range variants {
+		s.StoreAs(ti.reference(name), data)
+		ti.contents[name] = data
+	}
+
+	db := make(fakeImages)
+	for name, resolution := range resolutions {
+		db[ti.refs[name]] = []incident.Resolution{resolution}
+	}
+	return ti, db
+}
+
+// reference replaces the name of the image at the start of the key with its reference.
+func (ti *testImages) reference(key string) string {
+	i := strings.IndexAny(key, "_/")
+	if i < 0 {
+		i = len(key)
+	}
+	if ref, ok := ti.refs[key[:i]]; ok {
+		return ref + key[i:]
+	}
+	return key
+}
+
+func TestServeHTTP(t *testing.T) {
+	png := pngImage("uploaded")
+	images, db := storeImages(t, storagetest.New(t), map[string][]byte{
+		"accepted": png,
+		"alerted":  png,
+		"pending":  png,
+		"rejected": png,
+		"orphan":   png,
+		// The image reported again is another copy, as the test storage doesn't deduplicate.
+		"reported again": png,
+		"page":           []byte("<script>"),
+		"redacted":       png,
+	}, map[string][]byte{
+		"accepted_thumbnail": jpegImage("thumbnail"),
+		"pending_thumbnail":  jpegImage("thumbnail"),
+
+		"redacted_medium":          jpegImage("medium"),
+		"redacted_redacted":        pngImage("redacted"),
+		"redacted_redacted_medium": jpegImage("redacted medium"),
+	}, map[string]incident.Resolution{
+		"accepted": incident.Resolution_RESOLUTION_ACCEPTED,
+		"alerted":  incident.Resolution_RESOLUTION_ALERTED,
+		"pending":  incident.Resolution_RESOLUTION_UNSPECIFIED,
+		"rejected": incident.Resolution_RESOLUTION_REJECTED,
+		"missing":  incident.Resolution_RESOLUTION_ACCEPTED,
+		"page":     incident.Resolution_RESOLUTION_ACCEPTED,
+		"redacted": incident.Resolution_RESOLUTION_ACCEPTED,
+	})
+	// The unknown image isn't reported or stored.
+	images.refs["unknown"] = uuid.NewString()
+	// The same images are stored once, so they can be reported with several incidents.
+	db[images.refs["pending"]] = append(db[images.refs["pending"]], incident.Resolution_RESOLUTION_REJECTED)
+	db[images.refs["reported again"]] = []incident.Resolution{
+		incident.Resolution_RESOLUTION_REJECTED,
+		incident.Resolution_RESOLUTION_ACCEPTED,
+		incident.Resolution_RESOLUTION_UNSPECIFIED,
+	}
+
+	testCases := map[string]struct {
+		method    string
+		reference string
+		reviewer  bool
+		want      int
+		wantType  string
+		// served is the name of the image served, the requested one if empty.
+		served string
+	}{
+		"accepted":             {reference: "accepted", want: http.StatusOK, wantType: "image/png"},
+		"alerted":              {reference: "alerted", want: http.StatusOK, wantType: "image/png"},
+		"pending":              {reference: "pending", want: http.StatusNotFound},
+		"pending by reviewer":  {reference: "pending", reviewer: true, want: http.StatusOK, wantType: "image/png"},
+		"rejected":             {reference: "rejected", want: http.StatusNotFound},
+		"rejected by reviewer": {reference: "rejected", reviewer: true, want: http.StatusOK, wantType: "image/png"},
+		"orphan":               {reference: "orphan", want: http.StatusNotFound},
+		"reported again":       {reference: "reported again", want: http.StatusOK, wantType: "image/png"},
+		"orphan by reviewer":   {reference: "orphan", reviewer: true, want: http.StatusOK, wantType: "image/png"},
+		"missing":              {reference: "missing", want: http.StatusNotFound},
+		"unknown by reviewer":  {reference: "unknown", reviewer: true, want: http.StatusNotFound},
+		"empty":                {reference: "", reviewer: true, want: http.StatusNotFound},
+		"nested":               {reference: "accepted/other", reviewer: true, want: http.StatusNotFound},
+		"not an image":         {reference: "page", want: http.StatusOK, wantType: "application/octet-stream"},
+		"head":                 {method: http.MethodHead, reference: "accepted", want: http.StatusOK, wantType: "image/png"},
+		"method not allowed":   {method: http.MethodPost, reference: "accepted", want: http.StatusMethodNotAllowed},
+		"variant":              {reference: "accepted_thumbnail", want: http.StatusOK, wantType: "image/jpeg"},
+		"pending variant":      {reference: "pending_thumbnail", want: http.StatusNotFound},
+		"missing variant": {
+			reference: "alerted_medium",
+			want:      http.StatusOK,
+			wantType:  "image/png",
+			served:    "alerted",
+		},
+		"unknown variant": {reference: "accepted_large", want: http.StatusNotFound},
+		// Only the reviewers can see the images as they were uploaded once they are redacted.
+		"redacted": {
+			reference: "redacted",
+			want:      http.StatusOK,
+			wantType:  "image/png",
+			served:    "redacted_redacted",
+		},
+		"redacted variant": {
+			reference: "redacted_medium",
+			want:      http.StatusOK,
+			wantType:  "image/jpeg",
+			served:    "redacted_redacted_medium",
+		},
+		"missing redacted variant": {
+			reference: "redacted_thumbnail",
+			want:      http.StatusOK,
+			wantType:  "image/png",
+			served:    "redacted_redacted",
+		},
+		"redacted by reviewer":         {reference: "redacted", reviewer: true, want: http.StatusOK, wantType: "image/png"},
+		"redacted variant by reviewer": {reference: "redacted_medium", reviewer: true, want: http.StatusOK, wantType: "image/jpeg"},
+		"explicitly redacted":          {reference: "redacted_redacted", want: http.StatusOK, wantType: "image/png"},
+		"not redacted":                 {reference: "accepted_redacted", want: http.StatusNotFound},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, Path+images.reference(tc.reference), nil)
+			rec := httptest.NewRecorder()
+
+			newTestService(images.store, db, tc.reviewer).ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.want)
+			}
+			if tc.want != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); got != tc.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tc.wantType)
+			}
+			if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+			}
+			served := tc.served
+			if served == "" {
+				served = tc.reference
+			}
+			if body := images.contents[served]; method == http.MethodGet && !bytes.Equal(rec.Body.Bytes(), body) {
+				t.Errorf("body = %q, want %q", rec.Body, body)
+			}
+		})
+	}
+}
+
+func TestServeHTTPPresigned(t *testing.T) {
+	png := pngImage("uploaded")
+	images, db := storeImages(t, storagetest.New(t), map[string][]byte{
+		"accepted": png,
+		"pending":  png,
+	}, nil, map[string]incident.Resolution{
+		"accepted": incident.Resolution_RESOLUTION_ACCEPTED,
+		"pending":  incident.Resolution_RESOLUTION_UNSPECIFIED,
+		"missing":  incident.Resolution_RESOLUTION_ACCEPTED,
+	})
+	accepted := "https://storage.example.com/images/" + images.refs["accepted"] + "?signature=1"
+
+	testCases := map[string]struct {
+		reference string
+		want      int
+		location  string
+	}{
+		"accepted": {
+			reference: "accepted",
+			want:      http.StatusTemporaryRedirect,
+			location:  accepted,
+		},
+		"missing variant": {
+			reference: "accepted_thumbnail",
+			want:      http.StatusTemporaryRedirect,
+			location:  accepted,
+		},
+		// The presigned URLs are only given to the users who can see the image.
+		"pending": {reference: "pending", want: http.StatusNotFound},
+		"missing": {reference: "missing", want: http.StatusNotFound},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newTestService(presigner{images.store}, db, false).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path+images.reference(tc.reference), nil))
+
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.want)
+			}
+			if got := rec.Header().Get("Location"); got != tc.location {
+				t.Errorf("Location = %q, want %q", got, tc.location)
+			}
+		})
+	}
+}
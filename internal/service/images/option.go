@@ -0,0 +1,55 @@
+package images
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/auth/rbac"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/storage"
+)
+
+// Option to provide configuration to the service.
+type Option func(*Service)
+
+// Logger provides the logger
+func Logger(log log.Logger) Option {
+	return func(s *Service) {
+		s.log = log
+	}
+}
+
+// Tracer provides the tracing
+func Tracer(tp trace.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = tp
+	}
+}
+
+// Storage provides the storage the images are read from.
+func Storage(store storage.Storage) Option {
+	return func(s *Service) {
+		s.storage = store
+	}
+}
+
+// Database provides the incidents the images were reported with.
+func Database(db database.Images) Option {
+	return func(s *Service) {
+		s.db = db
+	}
+}
+
+// Authorizer checks if the user is allowed to see the images which are not published.
+type Authorizer interface {
+	Check(context.Context, rbac.Permission) error
+}
+
+// Authorization provides the authorizer.
+func Authorization(a Authorizer) Option {
+	return func(s *Service) {
+		s.authz = a
+	}
+}
@@ -0,0 +1,57 @@
+package imageupload
+
+import (
+	"safer.place/internal/imaging"
+	"safer.place/internal/storage"
+)
+
+// Config limits the images which are accepted by the uploader.
+type Config struct {
+	// MaxSize of the uploaded image in bytes, both as uploaded and once it's encoded again.
+	MaxSize int64 `yaml:"max_size" split_words:"true" default:"10485760"`
+	// Formats which are accepted, detected from the content of the image. Any of jpeg, png and
+	// webp.
+	Formats []string `yaml:"formats" default:"jpeg,png,webp"`
+	// MaxWidth and MaxHeight of the image in pixels.
+	MaxWidth  int `yaml:"max_width" split_words:"true" default:"8192"`
+	MaxHeight int `yaml:"max_height" split_words:"true" default:"8192"`
+	// MaxPixels is the maximum width times height of the image. It bounds the memory used to
+	// decode the image, no matter how well it is compressed, to imaging.MaxBytesPerPixel bytes
+	// per pixel, which is 192MB by default.
+	MaxPixels int `yaml:"max_pixels" split_words:"true" default:"24000000"`
+	// MaxDecodes is how many images are decoded at once. The other uploads wait for their turn,
+	// so the memory used by the decoded images is bounded by DecodeMemory, 768MB by default.
+	MaxDecodes int `yaml:"max_decodes" split_words:"true" default:"4"`
+
+	// ThumbnailSize and MediumSize are the largest dimension of the variants of the image in
+	// pixels, or 0 to not store the variant.
+	ThumbnailSize int `yaml:"thumbnail_size" split_words:"true" default:"256"`
+	MediumSize    int `yaml:"medium_size" split_words:"true" default:"1024"`
+}
+
+// DecodeMemory returns the most memory taken by the images decoded at once, in bytes. It is zero
+// if the number of pixels is unlimited.
+func (c Config) DecodeMemory() int64 {
+	return int64(c.MaxDecodes) * int64(c.MaxPixels) * imaging.MaxBytesPerPixel
+}
+
+func (c Config) limits() imaging.Limits {
+	return imaging.Limits{
+		Formats:   c.Formats,
+		MaxWidth:  c.MaxWidth,
+		MaxHeight: c.MaxHeight,
+		MaxPixels: c.MaxPixels,
+	}
+}
+
+// Variants returns the sizes of the variants which are stored.
+func (c Config) Variants() map[storage.Variant]int {
+	variants := make(map[storage.Variant]int)
+	if c.ThumbnailSize > 0 {
+		variants[storage.VariantThumbnail] = c.ThumbnailSize
+	}
+	if c.MediumSize > 0 {
+		variants[storage.VariantMedium] = c.MediumSize
+	}
+	return variants
+}
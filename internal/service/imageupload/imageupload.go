@@ -4,15 +4,28 @@
 package imageupload
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
+	"io"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"connectrpc.com/connect"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 
+	"safer.place/internal/auth"
+	"safer.place/internal/database"
+	"safer.place/internal/imaging"
 	"safer.place/internal/log"
+	"safer.place/internal/redaction"
 	"safer.place/internal/service"
 	"safer.place/internal/storage"
 )
@@ -21,7 +34,13 @@ import (
 type Service struct {
 	tracer  trace.Tracer
 	storage storage.Storage
+	uploads database.Uploads
 	log     log.Logger
+	cfg     Config
+	// redactor is optional, and redacts the regions its detectors find in the image.
+	redactor *redaction.Redactor
+	// decodes holds a slot for each image which is decoded.
+	decodes chan struct{}
 }
 
 // Register registers the image upload service.
@@ -35,6 +54,15 @@ func Register(opts ...Option) service.Service {
 	if err := validate(s); err != nil {
 		panic(err)
 	}
+	s.decodes = make(chan struct{}, s.cfg.MaxDecodes)
+	if memory := s.cfg.DecodeMemory(); memory > 0 {
+		s.log.Info(context.Background(), "decoding the uploaded images",
+			slog.Int("max_decodes", s.cfg.MaxDecodes),
+			slog.Int64("max_memory", memory),
+		)
+	} else {
+		s.log.Warn(context.Background(), "the memory used to decode the uploaded images is unlimited, set max_pixels")
+	}
 
 	// We can ignore the interceptors as this is a non-connect service
 	return func(_ ...connect.Interceptor) (string, http.Handler) {
@@ -42,51 +70,237 @@ func Register(opts ...Option) service.Service {
 	}
 }
 
+// formOverhead is the size allowed for the rest of the multipart form on top of the image.
+const formOverhead = 64 << 10
+
+// uploadError is the body of the response to a failed upload.
+type uploadError struct {
+	// Code identifies the error, so the clients can show their own message.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 // ServeHTTP is the handler accepting the image upload.
 func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx, span := s.tracer.Start(r.Context(), "upload")
 	defer span.End()
-	if err := r.ParseForm(); err != nil {
-		s.log.Error(ctx, "unable to parse form data",
-			log.Error(err),
-		)
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "unable to parse form", http.StatusBadRequest)
+
+	// The uploads are recorded against the user, so only they can report the image.
+	id, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		s.fail(ctx, w, http.StatusUnauthorized, "unauthenticated", "user is not authenticated",
+			auth.ErrUserUnauthenticated)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxSize+formOverhead)
+	if err := r.ParseMultipartForm(s.cfg.MaxSize); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			s.fail(ctx, w, http.StatusRequestEntityTooLarge, "too_large",
+				fmt.Sprintf("image is larger than %d bytes", s.cfg.MaxSize), err)
+			return
+		}
+		s.fail(ctx, w, http.StatusBadRequest, "invalid_form", "unable to parse form", err)
 		return
 	}
+	defer r.MultipartForm.RemoveAll()
+
 	file, header, err := r.FormFile("image")
 	if err != nil {
-		s.log.Error(ctx, "unable to get image from user",
-			log.Error(err),
-		)
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "image upload failed", http.StatusBadRequest)
+		s.fail(ctx, w, http.StatusBadRequest, "missing_image", "image is missing from the form", err)
 		return
 	}
 	defer file.Close()
 
+	// The size in the header can't be trusted, but is checked to not read images which are
+	// obviously too large.
+	data, err := io.ReadAll(io.LimitReader(file, s.cfg.MaxSize+1))
+	if err != nil {
+		s.fail(ctx, w, http.StatusBadRequest, "invalid_form", "unable to read image", err)
+		return
+	}
+	if header.Size > s.cfg.MaxSize || int64(len(data)) > s.cfg.MaxSize {
+		s.fail(ctx, w, http.StatusRequestEntityTooLarge, "too_large",
+			fmt.Sprintf("image is larger than %d bytes", s.cfg.MaxSize), storage.ErrTooLarge)
+		return
+	}
+
+	// The decoded image is kept until its variants are stored and it is redacted.
+	select {
+	case s.decodes <- struct{}{}:
+		defer func() { <-s.decodes }()
+	case <-ctx.Done():
+		s.fail(ctx, w, http.StatusServiceUnavailable, "busy", "too many images are being uploaded", ctx.Err())
+		return
+	}
+
+	img, format, err := imaging.Decode(bytes.NewReader(data), s.cfg.limits())
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrUnsupportedFormat):
+			s.fail(ctx, w, http.StatusUnsupportedMediaType, "unsupported_format",
+				fmt.Sprintf("image must be one of %s", strings.Join(s.cfg.Formats, ", ")), err)
+		case errors.Is(err, imaging.ErrTooLarge):
+			s.fail(ctx, w, http.StatusUnprocessableEntity, "dimensions_too_large",
+				fmt.Sprintf("image must be at most %dx%d pixels", s.cfg.MaxWidth, s.cfg.MaxHeight), err)
+		default:
+			s.fail(ctx, w, http.StatusBadRequest, "invalid_image", "unable to read image", err)
+		}
+		return
+	}
+
+	// The image is encoded again to remove the metadata, such as where the photo was taken.
+	var stripped bytes.Buffer
+	contentType, err := imaging.Encode(&stripped, img, format)
+	if err != nil {
+		s.fail(ctx, w, http.StatusInternalServerError, "upload_failed", "image upload failed", err)
+		return
+	}
+	// The image can grow once it's encoded again, especially the WebP images encoded as PNG, so
+	// the size is checked again to tell the user why the image isn't stored.
+	if int64(stripped.Len()) > s.cfg.MaxSize {
+		s.fail(ctx, w, http.StatusRequestEntityTooLarge, "too_large",
+			fmt.Sprintf("image is larger than %d bytes once encoded as %s without its metadata",
+				s.cfg.MaxSize, contentType), storage.ErrTooLarge)
+		return
+	}
+
 	reference, err := s.storage.Upload(
-		ctx, file, header.Size, header.Header.Get("Content-Type"))
+		ctx, &stripped, int64(stripped.Len()), contentType)
 	if err != nil {
-		s.log.Error(ctx, "image upload failed",
-			log.Error(err),
-		)
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, "image upload failed", http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, storage.ErrTooLarge):
+			s.fail(ctx, w, http.StatusRequestEntityTooLarge, "too_large",
+				fmt.Sprintf("image is larger than the storage allows once encoded as %s without its metadata",
+					contentType), err)
+		case errors.Is(err, storage.ErrQuotaExceeded):
+			s.fail(ctx, w, http.StatusInsufficientStorage, "storage_full", "image storage is full", err)
+		default:
+			s.fail(ctx, w, http.StatusInternalServerError, "upload_failed", "image upload failed", err)
+		}
 		return
 	}
 
+	if err := s.uploads.SaveUpload(ctx, reference, id.Subject, time.Now()); err != nil {
+		s.discard(ctx, reference)
+		s.fail(ctx, w, http.StatusInternalServerError, "upload_failed", "image upload failed", err)
+		return
+	}
+
+	variants := s.storeVariants(ctx, reference, img)
+	s.redact(ctx, reference, img, format)
+
+	// The clients which ask for JSON are told about the variants, while the rest only get the
+	// reference of the image.
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(uploadResponse{Reference: reference, Variants: variants})
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprint(w, reference)
 }
 
+// discard the image which failed to be recorded, as it can't be reported without the record. The
+// image stored by a storage which deduplicates the images might have been uploaded by someone
+// else before, so it is kept, and collected once it is orphaned if it was recorded.
+func (s *Service) discard(ctx context.Context, reference string) {
+	if d, ok := s.storage.(storage.Deduplicator); ok && d.Deduplicates() {
+		s.log.Warn(ctx, "keeping unrecorded image, which might have been uploaded before",
+			slog.String("reference", reference),
+		)
+		return
+	}
+
+	if err := s.storage.Delete(ctx, reference); err != nil {
+		s.log.Error(ctx, "unable to delete unrecorded image", log.Error(err))
+	}
+}
+
+// uploadResponse is the body of the response to the uploads which accept JSON.
+type uploadResponse struct {
+	Reference string `json:"reference"`
+	// Variants are the references of the smaller versions of the image, which can be requested
+	// instead of the image.
+	Variants map[storage.Variant]string `json:"variants"`
+}
+
+// storeVariants stores the smaller versions of the image next to it, and returns their
+// references. The upload doesn't fail if the variants can't be stored, as the image is served
+// in their place.
+func (s *Service) storeVariants(ctx context.Context, reference string, img image.Image) map[storage.Variant]string {
+	ctx, span := s.tracer.Start(ctx, "variants")
+	defer span.End()
+
+	variants := make(map[storage.Variant]string)
+	for variant, size := range s.cfg.Variants() {
+		key := storage.VariantReference(reference, variant)
+
+		var buf bytes.Buffer
+		contentType, err := imaging.Resize(&buf, img, size)
+		if err == nil {
+			err = s.storage.Put(ctx, key, &buf, int64(buf.Len()), contentType)
+		}
+		if err != nil {
+			span.RecordError(err)
+			s.log.Error(ctx, "unable to store image variant",
+				slog.String("variant", string(variant)),
+				log.Error(err),
+			)
+			continue
+		}
+		variants[variant] = key
+	}
+
+	return variants
+}
+
+// redact the regions found by the detectors. The reviewers can still redact the image if the
+// detectors fail, so the upload doesn't fail.
+func (s *Service) redact(ctx context.Context, reference string, img image.Image, format string) {
+	if s.redactor == nil {
+		return
+	}
+
+	regions, err := s.redactor.Detect(ctx, img)
+	if err == nil && len(regions) > 0 {
+		err = s.redactor.Store(ctx, reference, img, format, regions)
+	}
+	if err != nil {
+		s.log.Error(ctx, "unable to redact image", log.Error(err))
+	}
+}
+
+// fail records the error, and responds with it to the user.
+func (s *Service) fail(ctx context.Context, w http.ResponseWriter, status int, code, message string, err error) {
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	logger := s.log.Warn
+	if status >= http.StatusInternalServerError {
+		logger = s.log.Error
+	}
+	logger(ctx, "image upload failed",
+		slog.String("code", code),
+		log.Error(err),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(uploadError{Code: code, Message: message})
+}
+
 var (
 	errMissingLogger  = errors.New("missing logger")
 	errMissingTrace   = errors.New("missing tracer")
 	errMissingStorage = errors.New("missing storage")
+	errMissingUploads = errors.New("missing uploads database")
+	errInvalidMaxSize = errors.New("invalid max size")
+	errInvalidDecodes = errors.New("max decodes must be positive")
+	errUnknownFormat  = errors.New("unknown image format")
 )
 
 func validate(s *Service) error {
@@ -99,5 +313,19 @@ func validate(s *Service) error {
 	if s.storage == nil {
 		return errMissingStorage
 	}
+	if s.uploads == nil {
+		return errMissingUploads
+	}
+	if s.cfg.MaxSize <= 0 {
+		return errInvalidMaxSize
+	}
+	if s.cfg.MaxDecodes <= 0 {
+		return errInvalidDecodes
+	}
+	for _, format := range s.cfg.Formats {
+		if !slices.Contains(imaging.Formats, format) {
+			return fmt.Errorf("%w: %s", errUnknownFormat, format)
+		}
+	}
 	return nil
 }
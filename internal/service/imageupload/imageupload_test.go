@@ -0,0 +1,527 @@
+package imageupload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/auth"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/redaction"
+	"safer.place/internal/storage"
+	"safer.place/internal/storage/filesystem"
+	"safer.place/internal/storage/storagetest"
+)
+
+// fakeUploads records the owners of the uploaded images.
+type fakeUploads struct {
+	database.Uploads
+	err    error
+	owners map[string]string
+}
+
+func (u *fakeUploads) SaveUpload(_ context.Context, imageID, owner string, _ time.Time) error {
+	if u.err != nil {
+		return u.err
+	}
+	if u.owners == nil {
+		u.owners = make(map[string]string)
+	}
+	u.owners[imageID] = owner
+	return nil
+}
+
+// newRequest creates the upload request of the user.
+func newRequest(contentType string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	return req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Subject: "user"}))
+}
+
+func encode(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// form creates the multipart form with the image, sent with the content type the user claims
+// the image has.
+func form(t *testing.T, field, contentType string, data []byte) (string, io.Reader) {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="`+field+`"; filename="image"`)
+	header.Set("Content-Type", contentType)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return w.FormDataContentType(), &body
+}
+
+func TestUpload(t *testing.T) {
+	cfg := Config{
+		MaxSize:    4096,
+		Formats:    []string{"jpeg", "png", "webp"},
+		MaxWidth:   32,
+		MaxHeight:  32,
+		MaxPixels:  512,
+		MaxDecodes: 1,
+	}
+	jpg := encode(t, "jpeg", 16, 16)
+
+	testCases := map[string]struct {
+		cfg         Config
+		field       string
+		contentType string
+		data        []byte
+		storageErr  error
+		uploadsErr  error
+		anonymous   bool
+		status      int
+		code        string
+		stored      string
+	}{
+		"jpeg": {
+			data:   jpg,
+			status: http.StatusOK,
+			stored: "image/jpeg",
+		},
+		"png": {
+			data:   encode(t, "png", 16, 16),
+			status: http.StatusOK,
+			stored: "image/png",
+		},
+		"claimed content type is ignored": {
+			contentType: "image/png",
+			data:        jpg,
+			status:      http.StatusOK,
+			stored:      "image/jpeg",
+		},
+		"not an image": {
+			contentType: "image/jpeg",
+			data:        []byte("<html><script>alert(1)</script></html>"),
+			status:      http.StatusUnsupportedMediaType,
+			code:        "unsupported_format",
+		},
+		"gif": {
+			data:   encode(t, "gif", 16, 16),
+			status: http.StatusUnsupportedMediaType,
+			code:   "unsupported_format",
+		},
+		"format not allowed": {
+			cfg:    Config{MaxSize: 4096, MaxDecodes: 1, Formats: []string{"png"}},
+			data:   jpg,
+			status: http.StatusUnsupportedMediaType,
+			code:   "unsupported_format",
+		},
+		"too large": {
+			data:   bytes.Repeat([]byte{0xFF}, 4097),
+			status: http.StatusRequestEntityTooLarge,
+			code:   "too_large",
+		},
+		"form too large": {
+			data:   bytes.Repeat([]byte{0xFF}, 4096+formOverhead),
+			status: http.StatusRequestEntityTooLarge,
+			code:   "too_large",
+		},
+		"too wide": {
+			data:   encode(t, "png", 33, 1),
+			status: http.StatusUnprocessableEntity,
+			code:   "dimensions_too_large",
+		},
+		"too many pixels": {
+			data:   encode(t, "png", 32, 17),
+			status: http.StatusUnprocessableEntity,
+			code:   "dimensions_too_large",
+		},
+		"corrupt": {
+			data:   encode(t, "png", 16, 16)[:40],
+			status: http.StatusBadRequest,
+			code:   "invalid_image",
+		},
+		"missing image": {
+			field:  "file",
+			data:   jpg,
+			status: http.StatusBadRequest,
+			code:   "missing_image",
+		},
+		"unauthenticated": {
+			data:      jpg,
+			anonymous: true,
+			status:    http.StatusUnauthorized,
+			code:      "unauthenticated",
+		},
+		// The image is deleted, as it can't be reported without the record.
+		"not recorded": {
+			data:       jpg,
+			uploadsErr: errors.New("database down"),
+			status:     http.StatusInternalServerError,
+			code:       "upload_failed",
+		},
+		"storage full": {
+			data:       jpg,
+			storageErr: storage.ErrQuotaExceeded,
+			status:     http.StatusInsufficientStorage,
+			code:       "storage_full",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if tc.cfg.MaxSize == 0 {
+				tc.cfg = cfg
+			}
+			if tc.field == "" {
+				tc.field = "image"
+			}
+			if tc.contentType == "" {
+				tc.contentType = "application/octet-stream"
+			}
+
+			store := storagetest.New(t)
+			store.Fail("upload", tc.storageErr)
+			uploads := &fakeUploads{err: tc.uploadsErr}
+			_, handler := Register(
+				Logger(log.New(slog.Default().Handler())),
+				Tracer(noop.NewTracerProvider().Tracer("")),
+				Storage(store),
+				Uploads(uploads),
+				Configuration(tc.cfg),
+			)()
+
+			req := newRequest(form(t, tc.field, tc.contentType, tc.data))
+			if tc.anonymous {
+				req = req.WithContext(context.Background())
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Fatalf("ServeHTTP() status = %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+			if tc.status == http.StatusOK {
+				reference := rec.Body.String()
+				if info, err := store.Stat(context.Background(), reference); err != nil || info.ContentType != tc.stored {
+					t.Errorf("ServeHTTP() stored %+v (%v), want %s", info, err, tc.stored)
+				}
+				if owner := uploads.owners[reference]; owner != "user" {
+					t.Errorf("ServeHTTP() recorded owner %q, want %q", owner, "user")
+				}
+				return
+			}
+			if tc.uploadsErr != nil {
+				ops := store.Ops()
+				if len(ops) != 2 || ops[1] != strings.Replace(ops[0], "upload", "delete", 1) {
+					t.Errorf("ServeHTTP() = %v, want the unrecorded image deleted", ops)
+				}
+			}
+
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("ServeHTTP() content type = %s, want application/json", got)
+			}
+			var uploadErr uploadError
+			if err := json.NewDecoder(rec.Body).Decode(&uploadErr); err != nil {
+				t.Fatalf("unable to decode error: %v", err)
+			}
+			if uploadErr.Code != tc.code || uploadErr.Message == "" {
+				t.Errorf("ServeHTTP() error = %+v, want code %s", uploadErr, tc.code)
+			}
+		})
+	}
+}
+
+// TestUploadGrows checks the image which is larger than the maximum size once it's encoded again
+// is rejected before it is stored.
+func TestUploadGrows(t *testing.T) {
+	// The noise compressed at the lowest quality grows once it's encoded at the usual quality.
+	img := image.NewGray(image.Rect(0, 0, 32, 16))
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rnd.IntN(256))
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := storagetest.New(t)
+	_, handler := Register(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+		Storage(store),
+		Uploads(&fakeUploads{}),
+		Configuration(Config{MaxSize: int64(buf.Len()), MaxDecodes: 1}),
+	)()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(form(t, "image", "image/jpeg", buf.Bytes())))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("ServeHTTP() status = %d, want %d: %s", rec.Code, http.StatusRequestEntityTooLarge, rec.Body)
+	}
+	var uploadErr uploadError
+	if err := json.NewDecoder(rec.Body).Decode(&uploadErr); err != nil {
+		t.Fatalf("unable to decode error: %v", err)
+	}
+	if uploadErr.Code != "too_large" || !strings.Contains(uploadErr.Message, "image/jpeg") {
+		t.Errorf("ServeHTTP() error = %+v, want too_large once encoded as image/jpeg", uploadErr)
+	}
+	if ops := store.Ops(); len(ops) != 0 {
+		t.Errorf("ServeHTTP() = %v, want nothing stored", ops)
+	}
+}
+
+func TestUploadVariants(t *testing.T) {
+	testCases := map[string]struct {
+		putErr error
+		sizes  map[storage.Variant][2]int
+	}{
+		"stored": {
+			sizes: map[storage.Variant][2]int{
+				storage.VariantThumbnail: {8, 4},
+				// The medium variant is not scaled up.
+				storage.VariantMedium: {32, 16},
+			},
+		},
+		// The image is uploaded, and served in place of the variants.
+		"failed": {
+			putErr: errors.New("put failed"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store := storagetest.New(t)
+			store.Fail("put", tc.putErr)
+			_, handler := Register(
+				Logger(log.New(slog.Default().Handler())),
+				Tracer(noop.NewTracerProvider().Tracer("")),
+				Storage(store),
+				Uploads(&fakeUploads{}),
+				Configuration(Config{MaxSize: 4096, MaxDecodes: 1, ThumbnailSize: 8, MediumSize: 64}),
+			)()
+
+			req := newRequest(form(t, "image", "image/png", encode(t, "png", 32, 16)))
+			req.Header.Set("Accept", "application/json")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("ServeHTTP() status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			var resp uploadResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("unable to decode response: %v", err)
+			}
+			variants := make(map[storage.Variant]string)
+			for variant := range tc.sizes {
+				variants[variant] = storage.VariantReference(resp.Reference, variant)
+			}
+			if store.Read(resp.Reference) == nil || !maps.Equal(resp.Variants, variants) {
+				t.Errorf("ServeHTTP() = %+v, want variants %v", resp, variants)
+			}
+
+			for variant, size := range tc.sizes {
+				cfg, err := jpeg.DecodeConfig(bytes.NewReader(store.Read(variants[variant])))
+				if err != nil {
+					t.Errorf("variant %s is not a stored JPEG: %v", variant, err)
+					continue
+				}
+				if cfg.Width != size[0] || cfg.Height != size[1] {
+					t.Errorf("variant %s is %dx%d, want %dx%d", variant, cfg.Width, cfg.Height, size[0], size[1])
+				}
+			}
+		})
+	}
+}
+
+func TestUploadRedacted(t *testing.T) {
+	store := storagetest.New(t)
+	tracer := noop.NewTracerProvider().Tracer("")
+	redactor, err := redaction.New(
+		redaction.Storage(store),
+		redaction.Sizes(map[storage.Variant]int{storage.VariantThumbnail: 8}),
+		redaction.Detectors(redaction.DetectorFunc(func(context.Context, image.Image) ([]redaction.Region, error) {
+			return []redaction.Region{{Width: 0.5, Height: 0.5}}, nil
+		})),
+		redaction.Tracer(tracer),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, handler := Register(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(tracer),
+		Storage(store),
+		Uploads(&fakeUploads{}),
+		Configuration(Config{MaxSize: 4096, MaxDecodes: 1, ThumbnailSize: 8}),
+		Redactor(redactor),
+	)()
+
+	req := newRequest(form(t, "image", "image/jpeg", encode(t, "jpeg", 32, 16)))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	for _, variant := range []storage.Variant{storage.VariantThumbnail, storage.VariantRedacted, storage.VariantRedactedThumbnail} {
+		if reference := storage.VariantReference(rec.Body.String(), variant); store.Read(reference) == nil {
+			t.Errorf("%s not stored", reference)
+		}
+	}
+}
+
+func TestUploadSharedImage(t *testing.T) {
+	store, err := filesystem.New(&filesystem.Config{
+		Directory: t.TempDir(),
+		Layout:    filesystem.LayoutContent,
+		MaxSize:   4096,
+	}, filesystem.Tracer(noop.NewTracerProvider().Tracer("")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads := &fakeUploads{}
+	_, handler := Register(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+		Storage(store),
+		Uploads(uploads),
+		Configuration(Config{MaxSize: 4096, MaxDecodes: 1, Formats: []string{"jpeg"}}),
+	)()
+	jpg := encode(t, "jpeg", 16, 16)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(form(t, "image", "image/jpeg", jpg)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ServeHTTP() status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	reference := rec.Body.String()
+
+	// The same image uploaded by someone else is stored once, so it isn't deleted when their
+	// upload fails to be recorded.
+	uploads.err = errors.New("database down")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(form(t, "image", "image/jpeg", jpg)))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("ServeHTTP() status = %d, want %d: %s", rec.Code, http.StatusInternalServerError, rec.Body)
+	}
+	if _, err := store.Stat(context.Background(), reference); err != nil {
+		t.Errorf("Stat() = %v, want the image uploaded before to be kept", err)
+	}
+}
+
+func TestUploadBusy(t *testing.T) {
+	_, handler := Register(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+		Storage(storagetest.New(t)),
+		Uploads(&fakeUploads{}),
+		Configuration(Config{MaxSize: 4096, MaxDecodes: 1}),
+	)()
+	// Another image is being decoded.
+	handler.(*Service).decodes <- struct{}{}
+
+	req := newRequest(form(t, "image", "image/jpeg", encode(t, "jpeg", 16, 16)))
+	ctx, cancel := context.WithTimeout(req.Context(), 10*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req.WithContext(ctx))
+
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"busy"`) {
+		t.Errorf("ServeHTTP() = %d %s, want %d busy", rec.Code, rec.Body, http.StatusServiceUnavailable)
+	}
+}
+
+func TestUploadNotMultipart(t *testing.T) {
+	_, handler := Register(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+		Storage(storagetest.New(t)),
+		Uploads(&fakeUploads{}),
+		Configuration(Config{MaxSize: 4096, MaxDecodes: 1}),
+	)()
+
+	req := newRequest("application/x-www-form-urlencoded", strings.NewReader("image=abc"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("ServeHTTP() status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := map[string]struct {
+		cfg Config
+		err string
+	}{
+		"valid":          {cfg: Config{MaxSize: 1, MaxDecodes: 1, Formats: []string{"jpeg"}}},
+		"all formats":    {cfg: Config{MaxSize: 1, MaxDecodes: 1}},
+		"no max size":    {cfg: Config{}, err: errInvalidMaxSize.Error()},
+		"no decodes":     {cfg: Config{MaxSize: 1}, err: errInvalidDecodes.Error()},
+		"unknown format": {cfg: Config{MaxSize: 1, MaxDecodes: 1, Formats: []string{"gif"}}, err: "unknown image format: gif"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s := &Service{}
+			for _, opt := range []Option{
+				Logger(log.New(slog.Default().Handler())),
+				Tracer(noop.NewTracerProvider().Tracer("")),
+				Storage(storagetest.New(t)),
+				Uploads(&fakeUploads{}),
+				Configuration(tc.cfg),
+			} {
+				opt(s)
+			}
+
+			err := validate(s)
+			if (err == nil && tc.err != "") || (err != nil && err.Error() != tc.err) {
+				t.Errorf("validate() = %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
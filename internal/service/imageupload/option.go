@@ -3,7 +3,10 @@ package imageupload
 import (
 	"go.opentelemetry.io/otel/trace"
 
+	"safer.place/internal/database"
+	"safer.place/internal/imaging"
 	"safer.place/internal/log"
+	"safer.place/internal/redaction"
 	"safer.place/internal/storage"
 )
 
@@ -30,3 +33,29 @@ func Storage(store storage.Storage) Option {
 		s.storage = store
 	}
 }
+
+// Uploads provides the database recording who uploaded each image.
+func Uploads(uploads database.Uploads) Option {
+	return func(s *Service) {
+		s.uploads = uploads
+	}
+}
+
+// Configuration provides the limits of the uploaded images. All the formats are accepted if
+// none are configured.
+func Configuration(cfg Config) Option {
+	return func(s *Service) {
+		if len(cfg.Formats) == 0 {
+			cfg.Formats = imaging.Formats
+		}
+		s.cfg = cfg
+	}
+}
+
+// Redactor provides the redactor, which redacts the regions its detectors find in the uploaded
+// images.
+func Redactor(r *redaction.Redactor) Option {
+	return func(s *Service) {
+		s.redactor = r
+	}
+}
@@ -0,0 +1,242 @@
+// Package redact lets the reviewers hide the parts of the incident images which must not be
+// published, such as faces and number plates.
+//
+// The review API doesn't have a procedure for the redactions, and the regions aren't a comment
+// which could be added with a review, so they are sent as JSON to their own endpoint instead. The
+// redactions keep the resolution of the incident, and are recorded in its history with the
+// reviewer who made them, the same way as the reviews.
+package redact
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/auth"
+	"safer.place/internal/auth/rbac"
+	"safer.place/internal/database"
+	"safer.place/internal/imaging"
+	"safer.place/internal/log"
+	"safer.place/internal/redaction"
+	"safer.place/internal/service"
+	"safer.place/internal/storage"
+)
+
+// Path the redactions are submitted to, followed by the incident ID.
+const Path = "/v1/redact/"
+
+const (
+	// maxRequestSize of the body, which is only a list of regions.
+	maxRequestSize = 64 << 10
+	// maxRegions which can be redacted in a single image.
+	maxRegions = 64
+)
+
+var (
+	errNotFound       = errors.New("incident not found")
+	errInvalidRequest = errors.New("invalid request")
+	errNoImage        = errors.New("incident has no image")
+	errTooManyRegions = fmt.Errorf("at most %d regions can be redacted", maxRegions)
+)
+
+// Request is the body of the redaction. The regions replace the ones the image was redacted
+// with before, and the image is published as it was uploaded if there are none.
+type Request struct {
+	Regions []redaction.Region `json:"regions"`
+}
+
+// Service is the redaction service
+type Service struct {
+	tracer   trace.Tracer
+	storage  storage.Storage
+	db       database.Incidents
+	history  database.History
+	redactor *redaction.Redactor
+	authz    Authorizer
+	log      log.Logger
+}
+
+// Register registers the redaction service.
+func Register(opts ...Option) service.Service {
+	s := &Service{}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := validate(s); err != nil {
+		panic(err)
+	}
+
+	// We can ignore the interceptors as this is a non-connect service
+	return func(_ ...connect.Interceptor) (string, http.Handler) {
+		return Path, s
+	}
+}
+
+// ServeHTTP redacts the image of the incident in the regions sent by the reviewer.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := s.tracer.Start(r.Context(), "redact")
+	defer span.End()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, Path)
+	span.SetAttributes(attribute.String("id", id))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	if err := s.redact(ctx, id, r.Body); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, rbac.ErrUnauthenticated):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case errors.Is(err, rbac.ErrPermissionDenied):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, errNotFound), errors.Is(err, errNoImage):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.As(err, &maxBytesErr):
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		case errors.Is(err, redaction.ErrInvalidRegion), errors.Is(err, errTooManyRegions),
+			errors.Is(err, errInvalidRequest):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			s.log.Error(ctx, "unable to redact image", log.Error(err))
+			http.Error(w, "unable to redact image", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) redact(ctx context.Context, id string, body io.Reader) error {
+	if err := s.authz.Check(ctx, rbac.PermissionReviewIncidents); err != nil {
+		return err
+	}
+	reviewer, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return rbac.ErrUnauthenticated
+	}
+	if id == "" || strings.Contains(id, "/") {
+		return errNotFound
+	}
+
+	var req Request
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidRequest, err)
+	}
+	if len(req.Regions) > maxRegions {
+		return errTooManyRegions
+	}
+	for _, region := range req.Regions {
+		if err := region.Validate(); err != nil {
+			return fmt.Errorf("%w: %+v", err, region)
+		}
+	}
+
+	inc, err := s.db.ViewIncident(ctx, id)
+	if errors.Is(err, database.ErrDoesNotExist) {
+		return errNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get incident: %w", err)
+	}
+	if inc.GetImageId() == "" {
+		return errNoImage
+	}
+
+	// The regions are always applied to the image as it was uploaded, so they can be changed.
+	original, err := s.storage.Get(ctx, inc.GetImageId())
+	if errors.Is(err, storage.ErrNotFound) {
+		return errNoImage
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get image: %w", err)
+	}
+	defer original.Close()
+
+	img, format, err := imaging.Decode(original, imaging.Limits{})
+	if err != nil {
+		return fmt.Errorf("unable to decode image: %w", err)
+	}
+	if err := s.redactor.Store(ctx, inc.GetImageId(), img, format, req.Regions); err != nil {
+		return fmt.Errorf("unable to store redacted image: %w", err)
+	}
+
+	// The redaction can be sent again if it fails to be recorded, as it replaces the previous one.
+	reason := "redacted the image"
+	if len(req.Regions) == 0 {
+		reason = "removed the redaction of the image"
+	}
+	if err := s.history.SaveTransition(ctx, &database.Transition{
+		IncidentID: id,
+		Actor:      reviewer.Subject,
+		From:       inc.Resolution,
+		To:         inc.Resolution,
+		Reason:     reason,
+		Timestamp:  time.Now(),
+	}); err != nil {
+		return fmt.Errorf("unable to record redaction: %w", err)
+	}
+
+	s.log.Info(ctx, "image redacted",
+		slog.String("id", id),
+		slog.Int("regions", len(req.Regions)),
+	)
+	return nil
+}
+
+var (
+	errMissingLogger     = errors.New("missing logger")
+	errMissingTrace      = errors.New("missing tracer")
+	errMissingStorage    = errors.New("missing storage")
+	errMissingDatabase   = errors.New("missing database")
+	errMissingHistory    = errors.New("missing history")
+	errMissingRedactor   = errors.New("missing redactor")
+	errMissingAuthorizer = errors.New("missing authorizer")
+)
+
+func validate(s *Service) error {
+	if s.log == nil {
+		return errMissingLogger
+	}
+	if s.tracer == nil {
+		return errMissingTrace
+	}
+	if s.storage == nil {
+		return errMissingStorage
+	}
+	if s.db == nil {
+		return errMissingDatabase
+	}
+	if s.history == nil {
+		return errMissingHistory
+	}
+	if s.redactor == nil {
+		return errMissingRedactor
+	}
+	if s.authz == nil {
+		return errMissingAuthorizer
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package redact
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"api.safer.place/incident/v1"
+	"safer.place/internal/auth"
+	"safer.place/internal/auth/rbac"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/redaction"
+	"safer.place/internal/storage"
+	"safer.place/internal/storage/storagetest"
+)
+
+// fakeIncidents have the stored image, and the image which is missing from the storage.
+type fakeIncidents struct {
+	database.Incidents
+	image, missing string
+}
+
+func (db fakeIncidents) ViewIncident(_ context.Context, id string) (*incident.Incident, error) {
+	switch id {
+	case "with-image":
+		return &incident.Incident{Id: id, ImageId: db.image}, nil
+	case "missing-image":
+		return &incident.Incident{Id: id, ImageId: db.missing}, nil
+	case "without-image":
+		return &incident.Incident{Id: id}, nil
+	default:
+		return nil, database.ErrDoesNotExist
+	}
+}
+
+type fakeHistory struct {
+	database.History
+	saved []*database.Transition
+	err   error
+}
+
+func (h *fakeHistory) SaveTransition(_ context.Context, t *database.Transition) error {
+	if h.err != nil {
+		return h.err
+	}
+	h.saved = append(h.saved, t)
+	return nil
+}
+
+type fakeAuthorizer struct {
+	err error
+}
+
+func (a fakeAuthorizer) Check(context.Context, rbac.Permission) error {
+	return a.err
+}
+
+func TestServeHTTP(t *testing.T) {
+	var original bytes.Buffer
+	if err := png.Encode(&original, image.NewGray(image.Rect(0, 0, 16, 8))); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		method     string
+		id         string
+		body       string
+		authzErr   error
+		historyErr error
+		anonymous  bool
+		want       int
+		redacted   bool
+		reason     string
+	}{
+		"redacted": {
+			id:       "with-image",
+			body:     `{"regions": [{"x": 0.25, "y": 0.25, "width": 0.5, "height": 0.5}]}`,
+			want:     http.StatusNoContent,
+			redacted: true,
+			reason:   "redacted the image",
+		},
+		"no regions": {
+			id:     "with-image",
+			body:   `{"regions": []}`,
+			want:   http.StatusNoContent,
+			reason: "removed the redaction of the image",
+		},
+		// The redaction replaces the previous one, so it can be sent again.
+		"not recorded": {
+			id:         "with-image",
+			body:       `{"regions": [{"x": 0.25, "y": 0.25, "width": 0.5, "height": 0.5}]}`,
+			historyErr: errors.New("database down"),
+			want:       http.StatusInternalServerError,
+		},
+		"anonymous": {
+			id:        "with-image",
+			body:      `{"regions": []}`,
+			anonymous: true,
+			want:      http.StatusUnauthorized,
+		},
+		"reporter": {
+			id:       "with-image",
+			body:     `{"regions": []}`,
+			authzErr: rbac.ErrPermissionDenied,
+			want:     http.StatusForbidden,
+		},
+		"unauthenticated": {
+			id:       "with-image",
+			body:     `{"regions": []}`,
+			authzErr: rbac.ErrUnauthenticated,
+			want:     http.StatusUnauthorized,
+		},
+		"unknown incident": {id: "unknown", body: `{"regions": []}`, want: http.StatusNotFound},
+		"without image":    {id: "without-image", body: `{"regions": []}`, want: http.StatusNotFound},
+		"missing image":    {id: "missing-image", body: `{"regions": []}`, want: http.StatusNotFound},
+		"empty id":         {id: "", body: `{"regions": []}`, want: http.StatusNotFound},
+		"invalid region": {
+			id:   "with-image",
+			body: `{"regions": [{"x": 0.75, "y": 0, "width": 0.5, "height": 0.5}]}`,
+			want: http.StatusBadRequest,
+		},
+		"too many regions": {
+			id:   "with-image",
+			body: `{"regions": [` + strings.Repeat(`{"width": 1, "height": 1},`, maxRegions) + `{"width": 1, "height": 1}]}`,
+			want: http.StatusBadRequest,
+		},
+		"unknown field": {id: "with-image", body: `{"boxes": []}`, want: http.StatusBadRequest},
+		"invalid json":  {id: "with-image", body: `{"regions": [`, want: http.StatusBadRequest},
+		"wrong type":    {id: "with-image", body: `{"regions": "all"}`, want: http.StatusBadRequest},
+		"too large":     {id: "with-image", body: `{"regions": [` + strings.Repeat(" ", maxRequestSize) + `]}`, want: http.StatusRequestEntityTooLarge},
+		"method":        {method: http.MethodGet, id: "with-image", want: http.StatusMethodNotAllowed},
+		"nested id":     {id: "with-image/other", body: `{"regions": []}`, want: http.StatusNotFound},
+		"empty body":    {id: "with-image", body: ``, want: http.StatusBadRequest},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store := storagetest.New(t)
+			uploaded := store.Store(original.Bytes())
+			redactedImage := storage.VariantReference(uploaded, storage.VariantRedacted)
+			store.StoreAs(redactedImage, []byte("previous"))
+			history := &fakeHistory{err: tc.historyErr}
+			tracer := noop.NewTracerProvider().Tracer("")
+			redactor, err := redaction.New(
+				redaction.Storage(store),
+				redaction.Sizes(map[storage.Variant]int{storage.VariantThumbnail: 4}),
+				redaction.Tracer(tracer),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, handler := Register(
+				Logger(log.New(slog.Default().Handler())),
+				Tracer(tracer),
+				Storage(store),
+				Database(fakeIncidents{image: uploaded, missing: uuid.NewString()}),
+				History(history),
+				Redactor(redactor),
+				Authorization(fakeAuthorizer{err: tc.authzErr}),
+			)()
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, Path+tc.id, strings.NewReader(tc.body))
+			if !tc.anonymous {
+				req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Subject: "github:reviewer"}))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+			if tc.want != http.StatusNoContent {
+				if got := string(store.Read(redactedImage)); got != "previous" && tc.historyErr == nil {
+					t.Errorf("redacted image changed to %q", got)
+				}
+				if len(history.saved) != 0 {
+					t.Errorf("recorded %+v, want nothing", history.saved)
+				}
+				return
+			}
+
+			if len(history.saved) != 1 || history.saved[0].Actor != "github:reviewer" ||
+				history.saved[0].IncidentID != tc.id || history.saved[0].Reason != tc.reason {
+				t.Errorf("recorded %+v, want the redaction by the reviewer", history.saved)
+			}
+
+			redacted := store.Read(redactedImage) != nil
+			thumbnail := store.Read(storage.VariantReference(uploaded, storage.VariantRedactedThumbnail)) != nil
+			if redacted != tc.redacted || thumbnail != tc.redacted {
+				t.Errorf("redacted image stored = %t, thumbnail = %t, want %t", redacted, thumbnail, tc.redacted)
+			}
+		})
+	}
+}
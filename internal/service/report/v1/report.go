@@ -4,6 +4,7 @@ package report
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -16,6 +17,8 @@ import (
 	ipb "api.safer.place/incident/v1"
 	pb "api.safer.place/report/v1"
 	connectpb "api.safer.place/report/v1/reportconnect"
+	"safer.place/internal/auth"
+	"safer.place/internal/database"
 	"safer.place/internal/log"
 	"safer.place/internal/queue"
 	"safer.place/internal/service"
@@ -23,19 +26,21 @@ import (
 
 // Service is the report service
 type Service struct {
-	queue queue.Producer[*ipb.Incident]
-	log   log.Logger
+	queue   queue.Producer[*ipb.Incident]
+	uploads database.Uploads
+	log     log.Logger
 
 	validator Validator
 }
 
 // Register creates a new service and and returns the
-func Register(q queue.Producer[*ipb.Incident], log log.Logger) service.Service {
+func Register(q queue.Producer[*ipb.Incident], uploads database.Uploads, log log.Logger) service.Service {
 	return func(interceptors ...connect.Interceptor) (string, http.Handler) {
 		return connectpb.NewReportServiceHandler(
 			&Service{
-				queue: q,
-				log:   log,
+				queue:   q,
+				uploads: uploads,
+				log:     log,
 				validator: NewMultiValidator(
 					validateDescription,
 					validateCoordinates,
@@ -63,11 +68,16 @@ func (s *Service) SendReport(
 		return nil, connect.NewError(connect.CodeInvalidArgument, err)
 	}
 
+	if err := s.attachImage(ctx, incident); err != nil {
+		return nil, err
+	}
+
 	s.log.Info(ctx, "received report",
 		slog.String("id", incident.Id),
 	)
 
 	if err := s.queue.Produce(ctx, queue.NewMessage(incident, req.Header())); err != nil {
+		s.detachImage(ctx, incident)
 		return nil, connect.NewError(connect.CodeInternal, err)
 	}
 
@@ -76,6 +86,54 @@ func (s *Service) SendReport(
 	}), nil
 }
 
+// attachImage attaches the image to the incident, if the user reporting it uploaded the image
+// and it isn't reported with another incident already.
+func (s *Service) attachImage(ctx context.Context, incident *ipb.Incident) error {
+	if incident.ImageId == "" {
+		return nil
+	}
+
+	id, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return connect.NewError(connect.CodeUnauthenticated, auth.ErrUserUnauthenticated)
+	}
+
+	err := s.uploads.AttachUpload(ctx, incident.ImageId, id.Subject, incident.Id)
+	switch {
+	case errors.Is(err, database.ErrDoesNotExist):
+		return connect.NewError(connect.CodeInvalidArgument, errUnknownImage)
+	case errors.Is(err, database.ErrConflict):
+		return connect.NewError(connect.CodeInvalidArgument, errImageReported)
+	case err != nil:
+		return connect.NewError(connect.CodeUnavailable, err)
+	}
+
+	return nil
+}
+
+// detachImage detaches the image from the incident which failed to be reported, so the user can
+// report it again with the image. The incident is retried with another ID, which the image could
+// not be attached to otherwise.
+func (s *Service) detachImage(ctx context.Context, incident *ipb.Incident) {
+	if incident.ImageId == "" {
+		return
+	}
+
+	id, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	// The image is detached even if the user gave up waiting for the report.
+	if err := s.uploads.DetachUpload(context.WithoutCancel(ctx), incident.ImageId, id.Subject, incident.Id); err != nil {
+		s.log.Error(ctx, "unable to detach image",
+			slog.String("id", incident.Id),
+			slog.String("image", incident.ImageId),
+			log.Error(err),
+		)
+	}
+}
+
 // CoordinateError is returned when the provided coordinate does not match the
 // max and min
 type CoordinateError struct {
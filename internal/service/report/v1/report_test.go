@@ -0,0 +1,193 @@
+// Copyright 2026 SaferPlace
+
+package report
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"connectrpc.com/connect"
+
+	ipb "api.safer.place/incident/v1"
+	pb "api.safer.place/report/v1"
+	"safer.place/internal/auth"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/queue"
+)
+
+type fakeQueue struct {
+	produced []*ipb.Incident
+	err      error
+}
+
+func (q *fakeQueue) Produce(_ context.Context, msg queue.Message[*ipb.Incident]) error {
+	if q.err != nil {
+		return q.err
+	}
+	q.produced = append(q.produced, msg.Body())
+	return nil
+}
+
+// fakeUploads has the images uploaded by alice, where reported is attached to another incident.
+type fakeUploads struct {
+	database.Uploads
+	err error
+}
+
+func (u *fakeUploads) AttachUpload(_ context.Context, imageID, owner, _ string) error {
+	switch {
+	case u.err != nil:
+		return u.err
+	case owner != "alice" || imageID == "unknown":
+		return database.ErrDoesNotExist
+	case imageID == "reported":
+		return database.ErrConflict
+	default:
+		return nil
+	}
+}
+
+func TestSendReport(t *testing.T) {
+	testCases := map[string]struct {
+		imageID   string
+		subject   string
+		uploadErr error
+		code      connect.Code
+	}{
+		"without image": {
+			subject: "bob",
+		},
+		"uploaded image": {
+			imageID: "image",
+			subject: "alice",
+		},
+		"uploaded by someone else": {
+			imageID: "image",
+			subject: "bob",
+			code:    connect.CodeInvalidArgument,
+		},
+		"unknown image": {
+			imageID: "unknown",
+			subject: "alice",
+			code:    connect.CodeInvalidArgument,
+		},
+		"already reported": {
+			imageID: "reported",
+			subject: "alice",
+			code:    connect.CodeInvalidArgument,
+		},
+		"unauthenticated": {
+			imageID: "image",
+			code:    connect.CodeUnauthenticated,
+		},
+		"database down": {
+			imageID:   "image",
+			subject:   "alice",
+			uploadErr: errors.New("database down"),
+			code:      connect.CodeUnavailable,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			q := &fakeQueue{}
+			s := &Service{
+				queue:     q,
+				uploads:   &fakeUploads{err: tc.uploadErr},
+				log:       log.New(slog.Default().Handler()),
+				validator: NewMultiValidator(validateDescription, validateCoordinates),
+			}
+
+			ctx := context.Background()
+			if tc.subject != "" {
+				ctx = auth.WithIdentity(ctx, &auth.Identity{Subject: tc.subject})
+			}
+			_, err := s.SendReport(ctx, connect.NewRequest(&pb.SendReportRequest{
+				Incident: &ipb.Incident{
+					Description: "description",
+					Coordinates: &ipb.Coordinates{},
+					ImageId:     tc.imageID,
+				},
+			}))
+
+			if tc.code == 0 {
+				if err != nil {
+					t.Fatalf("SendReport() = %v", err)
+				}
+				if len(q.produced) != 1 || q.produced[0].ImageId != tc.imageID {
+					t.Errorf("SendReport() produced %v, want the incident", q.produced)
+				}
+				return
+			}
+			if got := connect.CodeOf(err); got != tc.code {
+				t.Errorf("SendReport() = %v, want code %v", err, tc.code)
+			}
+			if len(q.produced) != 0 {
+				t.Errorf("SendReport() produced %v, want nothing", q.produced)
+			}
+		})
+	}
+}
+
+// attachedUploads remembers the incident each image is attached to.
+type attachedUploads struct {
+	database.Uploads
+	incidents map[string]string
+}
+
+func (u *attachedUploads) AttachUpload(_ context.Context, imageID, _, incidentID string) error {
+	if attached, ok := u.incidents[imageID]; ok && attached != incidentID {
+		return database.ErrConflict
+	}
+	u.incidents[imageID] = incidentID
+	return nil
+}
+
+func (u *attachedUploads) DetachUpload(_ context.Context, imageID, _, incidentID string) error {
+	if u.incidents[imageID] == incidentID {
+		delete(u.incidents, imageID)
+	}
+	return nil
+}
+
+func TestSendReportRetry(t *testing.T) {
+	q := &fakeQueue{err: errors.New("queue down")}
+	uploads := &attachedUploads{incidents: make(map[string]string)}
+	s := &Service{
+		queue:     q,
+		uploads:   uploads,
+		log:       log.New(slog.Default().Handler()),
+		validator: NewMultiValidator(validateDescription, validateCoordinates),
+	}
+
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{Subject: "alice"})
+	report := func() (*connect.Response[pb.SendReportResponse], error) {
+		return s.SendReport(ctx, connect.NewRequest(&pb.SendReportRequest{
+			Incident: &ipb.Incident{
+				Description: "description",
+				Coordinates: &ipb.Coordinates{},
+				ImageId:     "image",
+			},
+		}))
+	}
+
+	if _, err := report(); connect.CodeOf(err) != connect.CodeInternal {
+		t.Fatalf("SendReport() = %v, want code %v", err, connect.CodeInternal)
+	}
+	if len(uploads.incidents) != 0 {
+		t.Errorf("image attached to %v, want it detached from the failed incident", uploads.incidents)
+	}
+
+	// The report is retried once the queue is back, and gets another ID.
+	q.err = nil
+	resp, err := report()
+	if err != nil {
+		t.Fatalf("SendReport() = %v", err)
+	}
+	if got := uploads.incidents["image"]; got != resp.Msg.Id {
+		t.Errorf("image attached to %q, want %q", got, resp.Msg.Id)
+	}
+}
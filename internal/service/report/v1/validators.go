@@ -12,6 +12,8 @@ import (
 var (
 	errMissingDescription = errors.New("missing description")
 	errMissingCoordinates = errors.New("missing coordinates")
+	errUnknownImage       = errors.New("image was not uploaded by the user")
+	errImageReported      = errors.New("image is reported with another incident")
 )
 
 type ValidatorFunc func(i *incident.Incident) error
@@ -1,9 +1,14 @@
 package review
 
 import (
+	"context"
+
+	"api.safer.place/incident/v1"
 	"go.opentelemetry.io/otel/trace"
+	"safer.place/internal/auth/rbac"
 	"safer.place/internal/database"
 	"safer.place/internal/log"
+	"safer.place/internal/queue"
 )
 
 type Option func(*Service)
@@ -25,3 +30,22 @@ func Database(db database.Review) Option {
 		s.db = db
 	}
 }
+
+// Authorizer checks if the reviewer is allowed to change the resolution of the incident.
+type Authorizer interface {
+	Check(context.Context, rbac.Permission) error
+}
+
+func Authorization(a Authorizer) Option {
+	return func(s *Service) {
+		s.authz = a
+	}
+}
+
+// Alerts provides the queue of the incidents which were alerted, to notify the users subscribed
+// to their area.
+func Alerts(p queue.Producer[*incident.Incident]) Option {
+	return func(s *Service) {
+		s.alerts = p
+	}
+}
@@ -15,8 +15,12 @@ import (
 	"api.safer.place/incident/v1"
 	pb "api.safer.place/review/v1"
 	connectpb "api.safer.place/review/v1/reviewconnect"
+	"safer.place/internal/auth"
+	"safer.place/internal/auth/rbac"
 	"safer.place/internal/database"
+	"safer.place/internal/lifecycle"
 	"safer.place/internal/log"
+	"safer.place/internal/queue"
 	"safer.place/internal/service"
 )
 
@@ -24,20 +28,26 @@ import (
 type Service struct {
 	tracer trace.Tracer
 	db     database.Review
+	authz  Authorizer
 	log    log.Logger
+	alerts queue.Producer[*incident.Incident]
 }
 
 // Register the review service
 func Register(
 	opts ...Option,
 ) service.Service {
-	return func(interceptors ...connect.Interceptor) (string, http.Handler) {
-		s := &Service{}
+	s := &Service{}
 
-		for _, opt := range opts {
-			opt(s)
-		}
+	for _, opt := range opts {
+		opt(s)
+	}
 
+	if err := validate(s); err != nil {
+		panic(err)
+	}
+
+	return func(interceptors ...connect.Interceptor) (string, http.Handler) {
 		return connectpb.NewReviewServiceHandler(s, connect.WithInterceptors(interceptors...))
 	}
 }
@@ -55,9 +65,32 @@ func (s *Service) ReviewIncident(
 		slog.String("resolution", req.Msg.Resolution.String()),
 	)
 
+	reviewer, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return nil, connect.NewError(connect.CodeUnauthenticated, auth.ErrUserUnauthenticated)
+	}
+
+	inc, err := s.db.ViewIncident(ctx, req.Msg.Id)
+	if err != nil {
+		if errors.Is(err, database.ErrDoesNotExist) {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		}
+		return nil, connect.NewError(connect.CodeUnavailable, err)
+	}
+
+	permission, err := lifecycle.Permission(inc.Resolution, req.Msg.Resolution)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, err)
+	}
+	if err := s.authz.Check(ctx, permission); err != nil {
+		if errors.Is(err, rbac.ErrPermissionDenied) {
+			return nil, connect.NewError(connect.CodePermissionDenied, err)
+		}
+		return nil, connect.NewError(connect.CodeUnavailable, err)
+	}
+
 	comment := &incident.Comment{
-		// TODO: Actually perform authentication and authorization and not just blindly accept this.
-		AuthorId:  req.Header().Get("email"),
+		AuthorId:  reviewer.Subject,
 		Timestamp: time.Now().Unix(),
 		Message:   req.Msg.Comment,
 	}
@@ -65,15 +98,62 @@ func (s *Service) ReviewIncident(
 	if err := s.db.SaveReview(
 		ctx,
 		req.Msg.Id,
+		inc.Resolution,
 		req.Msg.Resolution,
 		comment,
 	); err != nil {
-		return nil, connect.NewError(connect.CodeUnavailable, err)
+		switch {
+		case errors.Is(err, database.ErrConflict):
+			// Someone else reviewed the incident since we checked the transition.
+			return nil, connect.NewError(connect.CodeFailedPrecondition, err)
+		case errors.Is(err, database.ErrDoesNotExist):
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		default:
+			return nil, connect.NewError(connect.CodeUnavailable, err)
+		}
 	}
 
+	inc.Resolution = req.Msg.Resolution
+	if req.Msg.Resolution == incident.Resolution_RESOLUTION_ALERTED && s.alerts != nil {
+		if err := s.queueAlert(ctx, inc); err != nil {
+			s.log.Error(ctx, "unable to queue alert",
+				slog.String("id", inc.Id),
+				log.Error(err),
+			)
+			// The review is saved already, so a moderator has to move the incident back to
+			// accepted and alert it again.
+			return nil, connect.NewError(connect.CodeUnavailable, errAlertNotQueued)
+		}
+	}
 	return connect.NewResponse(&pb.ReviewIncidentResponse{}), nil
 }
 
+// The alerts are produced a few times before the review fails, as the subscribers are only
+// alerted through the queue.
+const (
+	maxAlertAttempts = 3
+	alertBackoff     = 100 * time.Millisecond
+)
+
+var errAlertNotQueued = errors.New("review saved, but the alert was not sent to the subscribers")
+
+// queueAlert produces the alerted incident, retrying with a backoff.
+func (s *Service) queueAlert(ctx context.Context, inc *incident.Incident) error {
+	backoff := alertBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.alerts.Produce(ctx, queue.NewMessage(inc, make(http.Header)))
+		if err == nil || attempt == maxAlertAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
 // ViewIncident shows the incident information
 func (s *Service) ViewIncident(
 	ctx context.Context,
@@ -115,3 +195,26 @@ func (s *Service) IncidentsWithoutReview(
 		Incidents: incidents,
 	}), nil
 }
+
+var (
+	errMissingLogger        = errors.New("missing logger")
+	errMissingTracer        = errors.New("missing tracer")
+	errMissingDatabase      = errors.New("missing database")
+	errMissingAuthorization = errors.New("missing authorization")
+)
+
+func validate(s *Service) error {
+	if s.log == nil {
+		return errMissingLogger
+	}
+	if s.tracer == nil {
+		return errMissingTracer
+	}
+	if s.db == nil {
+		return errMissingDatabase
+	}
+	if s.authz == nil {
+		return errMissingAuthorization
+	}
+	return nil
+}
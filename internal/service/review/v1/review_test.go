@@ -0,0 +1,202 @@
+// Copyright 2026 SaferPlace
+
+package review
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"connectrpc.com/connect"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/protobuf/proto"
+
+	"api.safer.place/incident/v1"
+	pb "api.safer.place/review/v1"
+	"safer.place/internal/auth"
+	"safer.place/internal/auth/rbac"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/queue"
+)
+
+// fakeDatabase has a single incident, which has a comment from another reviewer.
+type fakeDatabase struct {
+	database.Review
+	inc     *incident.Incident
+	saveErr error
+	saved   bool
+}
+
+func (db *fakeDatabase) ViewIncident(_ context.Context, id string) (*incident.Incident, error) {
+	if id != db.inc.Id {
+		return nil, database.ErrDoesNotExist
+	}
+	return proto.Clone(db.inc).(*incident.Incident), nil
+}
+
+func (db *fakeDatabase) SaveReview(_ context.Context, _ string, _, _ incident.Resolution, _ *incident.Comment) error {
+	if db.saveErr != nil {
+		return db.saveErr
+	}
+	db.saved = true
+	return nil
+}
+
+// fakeAuthorizer allows the permissions of the reviewer.
+type fakeAuthorizer []rbac.Permission
+
+func (a fakeAuthorizer) Check(_ context.Context, permission rbac.Permission) error {
+	if !slices.Contains(a, permission) {
+		return rbac.ErrPermissionDenied
+	}
+	return nil
+}
+
+type fakeQueue struct {
+	produced []queue.Message[*incident.Incident]
+	attempts int
+	err      error
+}
+
+func (q *fakeQueue) Produce(_ context.Context, msg queue.Message[*incident.Incident]) error {
+	q.attempts++
+	if q.err != nil {
+		return q.err
+	}
+	q.produced = append(q.produced, msg)
+	return nil
+}
+
+func TestReviewIncident(t *testing.T) {
+	testCases := map[string]struct {
+		id          string
+		from, to    incident.Resolution
+		permissions fakeAuthorizer
+		saveErr     error
+		alertsErr   error
+		code        connect.Code
+		saved       bool
+		alerted     bool
+	}{
+		"accepted": {
+			to:    incident.Resolution_RESOLUTION_ACCEPTED,
+			saved: true,
+		},
+		"alerted": {
+			to:      incident.Resolution_RESOLUTION_ALERTED,
+			saved:   true,
+			alerted: true,
+		},
+		"rejected": {
+			to:    incident.Resolution_RESOLUTION_REJECTED,
+			saved: true,
+		},
+		"not found": {
+			id:   "unknown",
+			to:   incident.Resolution_RESOLUTION_ACCEPTED,
+			code: connect.CodeNotFound,
+		},
+		"invalid transition": {
+			from: incident.Resolution_RESOLUTION_ACCEPTED,
+			to:   incident.Resolution_RESOLUTION_ACCEPTED,
+			code: connect.CodeFailedPrecondition,
+		},
+		"permission denied": {
+			from: incident.Resolution_RESOLUTION_ACCEPTED,
+			to:   incident.Resolution_RESOLUTION_ALERTED,
+			code: connect.CodePermissionDenied,
+		},
+		"moderated": {
+			from:        incident.Resolution_RESOLUTION_ACCEPTED,
+			to:          incident.Resolution_RESOLUTION_ALERTED,
+			permissions: fakeAuthorizer{rbac.PermissionReviewIncidents, rbac.PermissionModerateIncidents},
+			saved:       true,
+			alerted:     true,
+		},
+		"reviewed in the meantime": {
+			to:      incident.Resolution_RESOLUTION_ACCEPTED,
+			saveErr: database.ErrConflict,
+			code:    connect.CodeFailedPrecondition,
+		},
+		"alert not queued": {
+			to:        incident.Resolution_RESOLUTION_ALERTED,
+			alertsErr: errors.New("queue unavailable"),
+			code:      connect.CodeUnavailable,
+			saved:     true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			id := tc.id
+			if id == "" {
+				id = "incident"
+			}
+			permissions := tc.permissions
+			if permissions == nil {
+				permissions = fakeAuthorizer{rbac.PermissionReviewIncidents}
+			}
+			db := &fakeDatabase{
+				inc: &incident.Incident{
+					Id:               "incident",
+					Resolution:       tc.from,
+					ReviewerComments: []*incident.Comment{{AuthorId: "github:other", Message: "looks legit"}},
+				},
+				saveErr: tc.saveErr,
+			}
+			alerts := &fakeQueue{err: tc.alertsErr}
+
+			s := &Service{}
+			for _, opt := range []Option{
+				Logger(log.New(slog.Default().Handler())),
+				Tracer(noop.NewTracerProvider().Tracer("")),
+				Database(db),
+				Authorization(permissions),
+				Alerts(alerts),
+			} {
+				opt(s)
+			}
+			ctx := auth.WithIdentity(context.Background(), &auth.Identity{Subject: "github:reviewer"})
+			_, err := s.ReviewIncident(ctx, connect.NewRequest(&pb.ReviewIncidentRequest{
+				Id:         id,
+				Resolution: tc.to,
+				Comment:    "checked",
+			}))
+			if code := connect.CodeOf(err); err != nil && code != tc.code || err == nil && tc.code != 0 {
+				t.Fatalf("ReviewIncident() = %v, want code %v", err, tc.code)
+			}
+			if db.saved != tc.saved {
+				t.Errorf("saved = %v, want %v", db.saved, tc.saved)
+			}
+
+			if alerted := len(alerts.produced) > 0; alerted != tc.alerted {
+				t.Errorf("alerted = %v, want %v", alerted, tc.alerted)
+			}
+			if tc.alertsErr != nil && alerts.attempts != maxAlertAttempts {
+				t.Errorf("alert produced %d times, want %d", alerts.attempts, maxAlertAttempts)
+			}
+			for _, msg := range alerts.produced {
+				if msg.Body().Resolution != incident.Resolution_RESOLUTION_ALERTED {
+					t.Errorf("alerted incident resolution = %v, want alerted", msg.Body().Resolution)
+				}
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, errMissingAuthorization) {
+			t.Errorf("Register() panicked with %v, want %v", err, errMissingAuthorization)
+		}
+	}()
+
+	Register(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+		Database(&fakeDatabase{}),
+	)
+}
@@ -0,0 +1,32 @@
+package roles
+
+import (
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+)
+
+// Option to provide configuration to the service.
+type Option func(*Service)
+
+// Logger provides the logger
+func Logger(log log.Logger) Option {
+	return func(s *Service) {
+		s.log = log
+	}
+}
+
+// Tracer provides the tracing
+func Tracer(tp trace.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = tp
+	}
+}
+
+// Roles provides the database of the roles granted to the users.
+func Roles(db database.Roles) Option {
+	return func(s *Service) {
+		s.db = db
+	}
+}
@@ -0,0 +1,227 @@
+// Package roles allows the admins to list, grant and revoke the roles of the users.
+package roles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"connectrpc.com/connect"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/auth"
+	"safer.place/internal/auth/rbac"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/service"
+)
+
+// path of the roles, which are granted and revoked below it.
+const path = "/v1/roles/"
+
+const (
+	grantPath  = "grant"
+	revokePath = "revoke"
+)
+
+// maxBody is the largest request accepted, in bytes.
+const maxBody = 4 << 10
+
+// Service is the roles service. Only the admins are allowed to use it, which is enforced by the
+// access control policy.
+type Service struct {
+	tracer trace.Tracer
+	db     database.Roles
+	log    log.Logger
+}
+
+// Register registers the roles service.
+func Register(opts ...Option) service.Service {
+	s := &Service{}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := validate(s); err != nil {
+		panic(err)
+	}
+
+	// We can ignore the interceptors as this is a non-connect service
+	return func(_ ...connect.Interceptor) (string, http.Handler) {
+		return path, s
+	}
+}
+
+// Grant of roles to a user, who is identified by their qualified subject.
+type Grant struct {
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles"`
+}
+
+// roleRequest is the body of the requests to grant and revoke a role.
+type roleRequest struct {
+	Subject string `json:"subject"`
+	Role    string `json:"role"`
+}
+
+// listResponse is the body of the response listing the grants.
+type listResponse struct {
+	Grants []Grant `json:"grants"`
+}
+
+// rolesError is the body of the response to a failed request.
+type rolesError struct {
+	// Code identifies the error, so the clients can show their own message.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ServeHTTP lists the grants on the path, and grants or revokes a role below it.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := s.tracer.Start(r.Context(), "roles")
+	defer span.End()
+
+	id, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		s.fail(ctx, w, http.StatusUnauthorized, "unauthenticated", "user is not authenticated",
+			auth.ErrUserUnauthenticated)
+		return
+	}
+
+	action := strings.TrimPrefix(r.URL.Path, path)
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		s.list(ctx, w)
+	case (action == grantPath || action == revokePath) && r.Method == http.MethodPost:
+		s.change(ctx, w, r, action, id.Subject)
+	case action == "":
+		w.Header().Set("Allow", "GET")
+		s.fail(ctx, w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed",
+			errMethodNotAllowed)
+	case action == grantPath || action == revokePath:
+		w.Header().Set("Allow", "POST")
+		s.fail(ctx, w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed",
+			errMethodNotAllowed)
+	default:
+		s.fail(ctx, w, http.StatusNotFound, "not_found", "not found", errNotFound)
+	}
+}
+
+func (s *Service) list(ctx context.Context, w http.ResponseWriter) {
+	grants, err := s.db.RoleGrants(ctx)
+	if err != nil {
+		s.fail(ctx, w, http.StatusInternalServerError, "unavailable", "unable to list roles", err)
+		return
+	}
+
+	resp := listResponse{Grants: make([]Grant, 0, len(grants))}
+	for subject, roles := range grants {
+		resp.Grants = append(resp.Grants, Grant{Subject: subject, Roles: roles})
+	}
+	slices.SortFunc(resp.Grants, func(a, b Grant) int {
+		return strings.Compare(a.Subject, b.Subject)
+	})
+	s.respond(w, http.StatusOK, resp)
+}
+
+// change grants or revokes the role, on behalf of the admin.
+func (s *Service) change(ctx context.Context, w http.ResponseWriter, r *http.Request, action, admin string) {
+	var req roleRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody)).Decode(&req); err != nil {
+		s.fail(ctx, w, http.StatusBadRequest, "invalid_request", "unable to parse request", err)
+		return
+	}
+
+	role, err := rbac.ParseRole(req.Role)
+	if err != nil {
+		s.fail(ctx, w, http.StatusBadRequest, "unknown_role", err.Error(), err)
+		return
+	}
+
+	msg := "granted role"
+	if action == grantPath {
+		// The roles granted to a subject without its identity provider would never apply.
+		if err := auth.ValidateSubject(req.Subject); err != nil {
+			s.fail(ctx, w, http.StatusBadRequest, "invalid_subject", err.Error(), err)
+			return
+		}
+		if err := s.db.GrantRole(ctx, req.Subject, string(role)); err != nil {
+			s.fail(ctx, w, http.StatusInternalServerError, "unavailable", "unable to grant role", err)
+			return
+		}
+	} else {
+		msg = "revoked role"
+		// The admins would otherwise be able to lock everyone out, as the roles of the last
+		// admin can only be granted again from the command line.
+		if req.Subject == admin && role == rbac.RoleAdmin {
+			s.fail(ctx, w, http.StatusConflict, "own_admin_role", "admins can't revoke their own admin role",
+				errOwnAdminRole)
+			return
+		}
+		if err := s.db.RevokeRole(ctx, req.Subject, string(role)); err != nil {
+			s.fail(ctx, w, http.StatusInternalServerError, "unavailable", "unable to revoke role", err)
+			return
+		}
+	}
+
+	s.log.Info(ctx, msg,
+		slog.String("admin", admin),
+		slog.String("subject", req.Subject),
+		slog.String("role", string(role)),
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) respond(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// fail records the error, and responds with it to the user.
+func (s *Service) fail(ctx context.Context, w http.ResponseWriter, status int, code, message string, err error) {
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	logger := s.log.Warn
+	if status >= http.StatusInternalServerError {
+		logger = s.log.Error
+	}
+	logger(ctx, "roles request failed",
+		slog.String("code", code),
+		log.Error(err),
+	)
+
+	s.respond(w, status, rolesError{Code: code, Message: message})
+}
+
+var (
+	errMissingLogger = errors.New("missing logger")
+	errMissingTrace  = errors.New("missing tracer")
+	errMissingRoles  = errors.New("missing roles database")
+
+	errMethodNotAllowed = errors.New("method not allowed")
+	errNotFound         = errors.New("not found")
+	errOwnAdminRole     = errors.New("unable to revoke own admin role")
+)
+
+func validate(s *Service) error {
+	if s.log == nil {
+		return errMissingLogger
+	}
+	if s.tracer == nil {
+		return errMissingTrace
+	}
+	if s.db == nil {
+		return errMissingRoles
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package roles
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/auth"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+)
+
+const admin = "github:admin"
+
+// fakeDatabase keeps the grants in memory.
+type fakeDatabase struct {
+	database.Roles
+	grants map[string][]string
+}
+
+func (db *fakeDatabase) GrantRole(_ context.Context, subject, role string) error {
+	if !slices.Contains(db.grants[subject], role) {
+		db.grants[subject] = append(db.grants[subject], role)
+	}
+	return nil
+}
+
+func (db *fakeDatabase) RevokeRole(_ context.Context, subject, role string) error {
+	db.grants[subject] = slices.DeleteFunc(db.grants[subject], func(r string) bool { return r == role })
+	if len(db.grants[subject]) == 0 {
+		delete(db.grants, subject)
+	}
+	return nil
+}
+
+func (db *fakeDatabase) RoleGrants(context.Context) (map[string][]string, error) {
+	return db.grants, nil
+}
+
+func newService(db *fakeDatabase) http.Handler {
+	_, handler := Register(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+		Roles(db),
+	)()
+	return handler
+}
+
+func serve(handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Subject: admin}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestRoles(t *testing.T) {
+	db := &fakeDatabase{grants: map[string][]string{admin: {"admin"}}}
+	handler := newService(db)
+
+	if w := serve(handler, http.MethodPost, path+grantPath, `{"subject":"oidc:https://issuer|user","role":"reviewer"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("grant status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+	}
+
+	w := serve(handler, http.MethodGet, path, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var resp listResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []Grant{
+		{Subject: admin, Roles: []string{"admin"}},
+		{Subject: "oidc:https://issuer|user", Roles: []string{"reviewer"}},
+	}
+	if len(resp.Grants) != len(want) {
+		t.Fatalf("grants = %+v, want %+v", resp.Grants, want)
+	}
+	for i := range want {
+		if resp.Grants[i].Subject != want[i].Subject || !slices.Equal(resp.Grants[i].Roles, want[i].Roles) {
+			t.Errorf("grant %d = %+v, want %+v", i, resp.Grants[i], want[i])
+		}
+	}
+
+	if w := serve(handler, http.MethodPost, path+revokePath, `{"subject":"oidc:https://issuer|user","role":"reviewer"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+	}
+	if _, ok := db.grants["oidc:https://issuer|user"]; ok {
+		t.Errorf("role was not revoked: %v", db.grants)
+	}
+}
+
+func TestRolesBadRequest(t *testing.T) {
+	testCases := map[string]struct {
+		method string
+		target string
+		body   string
+		status int
+		code   string
+	}{
+		"unknown role": {
+			method: http.MethodPost,
+			target: path + grantPath,
+			body:   `{"subject":"github:user","role":"superuser"}`,
+			status: http.StatusBadRequest,
+			code:   "unknown_role",
+		},
+		"unqualified subject": {
+			method: http.MethodPost,
+			target: path + grantPath,
+			body:   `{"subject":"user","role":"reviewer"}`,
+			status: http.StatusBadRequest,
+			code:   "invalid_subject",
+		},
+		"own admin role": {
+			method: http.MethodPost,
+			target: path + revokePath,
+			body:   `{"subject":"` + admin + `","role":"admin"}`,
+			status: http.StatusConflict,
+			code:   "own_admin_role",
+		},
+		"malformed body": {
+			method: http.MethodPost,
+			target: path + grantPath,
+			body:   `{`,
+			status: http.StatusBadRequest,
+			code:   "invalid_request",
+		},
+		"method": {
+			method: http.MethodGet,
+			target: path + grantPath,
+			status: http.StatusMethodNotAllowed,
+			code:   "method_not_allowed",
+		},
+		"unknown action": {
+			method: http.MethodPost,
+			target: path + "delete",
+			status: http.StatusNotFound,
+			code:   "not_found",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := &fakeDatabase{grants: map[string][]string{admin: {"admin"}}}
+			w := serve(newService(db), tc.method, tc.target, tc.body)
+
+			if w.Code != tc.status {
+				t.Errorf("status = %d, want %d", w.Code, tc.status)
+			}
+			var resp rolesError
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != tc.code {
+				t.Errorf("code = %q, want %q", resp.Code, tc.code)
+			}
+			if !slices.Equal(db.grants[admin], []string{"admin"}) || len(db.grants) != 1 {
+				t.Errorf("grants changed to %v", db.grants)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package subscriptions
+
+import (
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/alerts"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+)
+
+// Option to provide configuration to the service.
+type Option func(*Service)
+
+// Logger provides the logger
+func Logger(log log.Logger) Option {
+	return func(s *Service) {
+		s.log = log
+	}
+}
+
+// Tracer provides the tracing
+func Tracer(tp trace.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = tp
+	}
+}
+
+// Subscriptions provides the database of the subscriptions.
+func Subscriptions(db database.Subscriptions) Option {
+	return func(s *Service) {
+		s.db = db
+	}
+}
+
+// Channels provides the channels the users can subscribe with, by their name.
+func Channels(channels map[string]alerts.Channel) Option {
+	return func(s *Service) {
+		s.channels = channels
+	}
+}
+
+// Configuration provides the limits of the subscriptions.
+func Configuration(cfg alerts.Config) Option {
+	return func(s *Service) {
+		s.cfg = cfg
+	}
+}
@@ -0,0 +1,418 @@
+// Package subscriptions allows the users to subscribe to the alerts about the incidents in their
+// area.
+package subscriptions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/alerts"
+	"safer.place/internal/auth"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+	"safer.place/internal/service"
+)
+
+// path of the subscriptions, and the prefix of each subscription.
+const path = "/v1/subscriptions/"
+
+// channelsPath lists the channels below the path.
+const channelsPath = "channels"
+
+// maxBody is the largest request accepted, in bytes.
+const maxBody = 64 << 10
+
+// Service is the subscription service
+type Service struct {
+	tracer   trace.Tracer
+	db       database.Subscriptions
+	channels map[string]alerts.Channel
+	log      log.Logger
+	cfg      alerts.Config
+	// now is replaced in the tests.
+	now func() time.Time
+}
+
+// Register registers the subscription service.
+func Register(opts ...Option) service.Service {
+	s := &Service{
+		now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := validate(s); err != nil {
+		panic(err)
+	}
+
+	// We can ignore the interceptors as this is a non-connect service
+	return func(_ ...connect.Interceptor) (string, http.Handler) {
+		return path, s
+	}
+}
+
+// Region the user subscribes to, in hundredths of a degree like the regions of the viewer. It
+// is extended to the whole cells it overlaps, so the users can't subscribe to an area smaller
+// than a cell.
+type Region struct {
+	North float64 `json:"north"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	West  float64 `json:"west"`
+}
+
+// subscribeRequest is the body of the request to subscribe.
+type subscribeRequest struct {
+	Regions  []Region `json:"regions"`
+	Channel  string   `json:"channel"`
+	Endpoint string   `json:"endpoint"`
+}
+
+// Subscription is returned to its owner.
+type Subscription struct {
+	ID string `json:"id"`
+	// Cells are identified by their south west corner in hundredths of a degree, and are a
+	// hundredth of a degree on each side.
+	Cells    []Cell    `json:"cells"`
+	Channel  string    `json:"channel"`
+	Endpoint string    `json:"endpoint"`
+	Created  time.Time `json:"created"`
+	// Secret signs the alerts, and is only returned when subscribing.
+	Secret string `json:"secret,omitempty"`
+}
+
+// Cell of the subscription.
+type Cell struct {
+	Lat int `json:"lat"`
+	Lon int `json:"lon"`
+}
+
+// Channel the users can subscribe with.
+type Channel struct {
+	Name string `json:"name"`
+	// ApplicationServerKey is the VAPID public key the browsers subscribe to the web push with.
+	ApplicationServerKey string `json:"application_server_key,omitempty"`
+}
+
+// applicationServerKeyer is implemented by the channels of the web push.
+type applicationServerKeyer interface {
+	ApplicationServerKey() string
+}
+
+// channelsResponse is the body of the response listing the channels.
+type channelsResponse struct {
+	Channels []Channel `json:"channels"`
+}
+
+// listResponse is the body of the response listing the subscriptions.
+type listResponse struct {
+	Subscriptions []*Subscription `json:"subscriptions"`
+}
+
+// subscriptionError is the body of the response to a failed request.
+type subscriptionError struct {
+	// Code identifies the error, so the clients can show their own message.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ServeHTTP lists and creates the subscriptions of the user on the path, and deletes the
+// subscription below it. The channels are listed below the path too.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := s.tracer.Start(r.Context(), "subscriptions")
+	defer span.End()
+
+	id, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		s.fail(ctx, w, http.StatusUnauthorized, "unauthenticated", "user is not authenticated",
+			auth.ErrUserUnauthenticated)
+		return
+	}
+
+	subscription := strings.TrimPrefix(r.URL.Path, path)
+	switch {
+	case subscription == "" && r.Method == http.MethodGet:
+		s.list(ctx, w, id.Subject)
+	case subscription == "" && r.Method == http.MethodPost:
+		s.subscribe(ctx, w, r, id.Subject)
+	case subscription == channelsPath && r.Method == http.MethodGet:
+		s.listChannels(w)
+	case subscription != "" && r.Method == http.MethodDelete:
+		s.unsubscribe(ctx, w, subscription, id.Subject)
+	case subscription == "":
+		w.Header().Set("Allow", "GET, POST")
+		s.fail(ctx, w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed",
+			errMethodNotAllowed)
+	default:
+		w.Header().Set("Allow", "DELETE")
+		s.fail(ctx, w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed",
+			errMethodNotAllowed)
+	}
+}
+
+func (s *Service) list(ctx context.Context, w http.ResponseWriter, owner string) {
+	subs, err := s.db.UserSubscriptions(ctx, owner)
+	if err != nil {
+		s.fail(ctx, w, http.StatusInternalServerError, "unavailable", "unable to list subscriptions", err)
+		return
+	}
+
+	resp := listResponse{Subscriptions: make([]*Subscription, 0, len(subs))}
+	for _, sub := range subs {
+		resp.Subscriptions = append(resp.Subscriptions, newSubscription(sub))
+	}
+	s.respond(w, http.StatusOK, resp)
+}
+
+func (s *Service) listChannels(w http.ResponseWriter) {
+	resp := channelsResponse{Channels: make([]Channel, 0, len(s.channels))}
+	for name, channel := range s.channels {
+		c := Channel{Name: name}
+		if keyer, ok := channel.(applicationServerKeyer); ok {
+			c.ApplicationServerKey = keyer.ApplicationServerKey()
+		}
+		resp.Channels = append(resp.Channels, c)
+	}
+	slices.SortFunc(resp.Channels, func(a, b Channel) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	s.respond(w, http.StatusOK, resp)
+}
+
+func (s *Service) subscribe(ctx context.Context, w http.ResponseWriter, r *http.Request, owner string) {
+	var req subscribeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody)).Decode(&req); err != nil {
+		s.fail(ctx, w, http.StatusBadRequest, "invalid_request", "unable to parse request", err)
+		return
+	}
+
+	channel, ok := s.channels[req.Channel]
+	if !ok {
+		s.fail(ctx, w, http.StatusBadRequest, "unknown_channel",
+			fmt.Sprintf("unknown channel %q", req.Channel), errUnknownChannel)
+		return
+	}
+	if err := channel.Validate(req.Endpoint); err != nil {
+		s.fail(ctx, w, http.StatusBadRequest, "invalid_endpoint", err.Error(), err)
+		return
+	}
+
+	cells, err := s.cells(req.Regions)
+	if err != nil {
+		code := "invalid_region"
+		if errors.Is(err, errTooManyCells) {
+			code = "too_many_cells"
+		}
+		s.fail(ctx, w, http.StatusBadRequest, code, err.Error(), err)
+		return
+	}
+
+	// The subscriptions created at the same time can go over the limit, which only stops the
+	// users from subscribing to everything.
+	existing, err := s.db.UserSubscriptions(ctx, owner)
+	if err != nil {
+		s.fail(ctx, w, http.StatusInternalServerError, "unavailable", "unable to list subscriptions", err)
+		return
+	}
+	if len(existing) >= s.cfg.MaxSubscriptions {
+		s.fail(ctx, w, http.StatusConflict, "too_many_subscriptions",
+			fmt.Sprintf("users can have at most %d subscriptions", s.cfg.MaxSubscriptions),
+			errTooManySubscriptions)
+		return
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		s.fail(ctx, w, http.StatusInternalServerError, "unavailable", "unable to subscribe", err)
+		return
+	}
+	sub := &database.Subscription{
+		ID:       uuid.NewString(),
+		Owner:    owner,
+		Cells:    cells,
+		Channel:  req.Channel,
+		Endpoint: req.Endpoint,
+		Secret:   secret,
+		Created:  s.now().Truncate(time.Second),
+	}
+	if err := s.db.SaveSubscription(ctx, sub); err != nil {
+		s.fail(ctx, w, http.StatusInternalServerError, "unavailable", "unable to subscribe", err)
+		return
+	}
+
+	s.log.Info(ctx, "subscribed to alerts",
+		slog.String("subscription", sub.ID),
+		slog.String("channel", sub.Channel),
+		slog.Int("cells", len(sub.Cells)),
+	)
+
+	resp := newSubscription(sub)
+	resp.Secret = sub.Secret
+	s.respond(w, http.StatusCreated, resp)
+}
+
+func (s *Service) unsubscribe(ctx context.Context, w http.ResponseWriter, id, owner string) {
+	if err := s.db.DeleteSubscription(ctx, id, owner); err != nil {
+		if errors.Is(err, database.ErrDoesNotExist) {
+			s.fail(ctx, w, http.StatusNotFound, "not_found", "subscription not found", err)
+			return
+		}
+		s.fail(ctx, w, http.StatusInternalServerError, "unavailable", "unable to unsubscribe", err)
+		return
+	}
+
+	s.log.Info(ctx, "unsubscribed from alerts", slog.String("subscription", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// cells returns the cells overlapping the regions, without duplicates.
+func (s *Service) cells(regions []Region) ([]database.Cell, error) {
+	if len(regions) == 0 {
+		return nil, errMissingRegions
+	}
+
+	seen := make(map[database.Cell]struct{})
+	var cells []database.Cell
+	for _, r := range regions {
+		if err := validateRegion(r); err != nil {
+			return nil, err
+		}
+
+		south, west := int(math.Floor(r.South)), int(math.Floor(r.West))
+		// The cells are extended to cover the regions on their edge too.
+		north, east := max(int(math.Ceil(r.North)), south+1), max(int(math.Ceil(r.East)), west+1)
+		if (north-south)*(east-west) > s.cfg.MaxCells {
+			return nil, fmt.Errorf("%w: subscriptions can cover at most %d cells", errTooManyCells, s.cfg.MaxCells)
+		}
+
+		for lat := south; lat < north; lat++ {
+			for lon := west; lon < east; lon++ {
+				cell := database.Cell{Lat: lat, Lon: lon}
+				if _, ok := seen[cell]; ok {
+					continue
+				}
+				seen[cell] = struct{}{}
+				cells = append(cells, cell)
+			}
+		}
+		if len(cells) > s.cfg.MaxCells {
+			return nil, fmt.Errorf("%w: subscriptions can cover at most %d cells", errTooManyCells, s.cfg.MaxCells)
+		}
+	}
+
+	return cells, nil
+}
+
+// validateRegion ensures the region is on the planet Earth, and doesn't cross the antimeridian.
+func validateRegion(r Region) error {
+	switch {
+	case r.North < -9000 || r.North > 9000 || r.South < -9000 || r.South > 9000:
+		return fmt.Errorf("%w: latitude must be between -9000 and 9000", errInvalidRegion)
+	case r.East < -18000 || r.East > 18000 || r.West < -18000 || r.West > 18000:
+		return fmt.Errorf("%w: longitude must be between -18000 and 18000", errInvalidRegion)
+	case r.North < r.South:
+		return fmt.Errorf("%w: north must not be south of south", errInvalidRegion)
+	case r.East < r.West:
+		return fmt.Errorf("%w: east must not be west of west", errInvalidRegion)
+	}
+	return nil
+}
+
+func newSubscription(sub *database.Subscription) *Subscription {
+	resp := &Subscription{
+		ID:       sub.ID,
+		Cells:    make([]Cell, 0, len(sub.Cells)),
+		Channel:  sub.Channel,
+		Endpoint: sub.Endpoint,
+		Created:  sub.Created,
+	}
+	for _, c := range sub.Cells {
+		resp.Cells = append(resp.Cells, Cell{Lat: c.Lat, Lon: c.Lon})
+	}
+	return resp
+}
+
+// newSecret returns the random secret signing the alerts of the subscription.
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("unable to generate secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func (s *Service) respond(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// fail records the error, and responds with it to the user.
+func (s *Service) fail(ctx context.Context, w http.ResponseWriter, status int, code, message string, err error) {
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	logger := s.log.Warn
+	if status >= http.StatusInternalServerError {
+		logger = s.log.Error
+	}
+	logger(ctx, "subscription request failed",
+		slog.String("code", code),
+		log.Error(err),
+	)
+
+	s.respond(w, status, subscriptionError{Code: code, Message: message})
+}
+
+var (
+	errMissingLogger        = errors.New("missing logger")
+	errMissingTrace         = errors.New("missing tracer")
+	errMissingSubscriptions = errors.New("missing subscriptions database")
+	errMissingChannels      = errors.New("missing channels")
+	errInvalidLimits        = errors.New("subscription limits must be positive")
+
+	errMethodNotAllowed     = errors.New("method not allowed")
+	errUnknownChannel       = errors.New("unknown channel")
+	errMissingRegions       = errors.New("missing regions")
+	errInvalidRegion        = errors.New("invalid region")
+	errTooManyCells         = errors.New("too many cells")
+	errTooManySubscriptions = errors.New("too many subscriptions")
+)
+
+func validate(s *Service) error {
+	if s.log == nil {
+		return errMissingLogger
+	}
+	if s.tracer == nil {
+		return errMissingTrace
+	}
+	if s.db == nil {
+		return errMissingSubscriptions
+	}
+	if len(s.channels) == 0 {
+		return errMissingChannels
+	}
+	if s.cfg.MaxSubscriptions <= 0 || s.cfg.MaxCells <= 0 {
+		return errInvalidLimits
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package subscriptions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"api.safer.place/incident/v1"
+	"safer.place/internal/alerts"
+	"safer.place/internal/auth"
+	"safer.place/internal/database"
+	"safer.place/internal/log"
+)
+
+// fakeDatabase keeps the subscriptions in memory.
+type fakeDatabase struct {
+	database.Subscriptions
+	subs []*database.Subscription
+}
+
+func (db *fakeDatabase) SaveSubscription(_ context.Context, sub *database.Subscription) error {
+	db.subs = append(db.subs, sub)
+	return nil
+}
+
+func (db *fakeDatabase) UserSubscriptions(_ context.Context, owner string) ([]*database.Subscription, error) {
+	var subs []*database.Subscription
+	for _, sub := range db.subs {
+		if sub.Owner == owner {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+func (db *fakeDatabase) DeleteSubscription(_ context.Context, id, owner string) error {
+	for i, sub := range db.subs {
+		if sub.ID == id && sub.Owner == owner {
+			db.subs = slices.Delete(db.subs, i, i+1)
+			return nil
+		}
+	}
+	return database.ErrDoesNotExist
+}
+
+// fakeChannel accepts the endpoints starting with https.
+type fakeChannel struct{}
+
+func (fakeChannel) Validate(endpoint string) error {
+	if !strings.HasPrefix(endpoint, "https://") {
+		return errors.New("invalid endpoint")
+	}
+	return nil
+}
+
+func (fakeChannel) Deliver(context.Context, *database.Subscription, *incident.Incident) error {
+	return nil
+}
+
+// fakePushChannel has the key the browsers subscribe with.
+type fakePushChannel struct {
+	fakeChannel
+}
+
+func (fakePushChannel) ApplicationServerKey() string {
+	return "key"
+}
+
+func newService(db *fakeDatabase) http.Handler {
+	_, handler := Register(
+		Logger(log.New(slog.Default().Handler())),
+		Tracer(noop.NewTracerProvider().Tracer("")),
+		Subscriptions(db),
+		Channels(map[string]alerts.Channel{"fake": fakeChannel{}, "push": fakePushChannel{}}),
+		Configuration(alerts.Config{MaxSubscriptions: 2, MaxCells: 6}),
+	)()
+	return handler
+}
+
+func newRequest(method, target, body, subject string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if subject == "" {
+		return req
+	}
+	return req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{Subject: subject}))
+}
+
+func TestSubscribe(t *testing.T) {
+	testCases := map[string]struct {
+		body   string
+		status int
+		code   string
+		cells  []Cell
+	}{
+		"snapped to cells": {
+			body:   `{"regions": [{"north": 5334.5, "south": 5333.2, "east": -626.1, "west": -627}], "channel": "fake", "endpoint": "https://example.com"}`,
+			status: http.StatusCreated,
+			cells:  []Cell{{5333, -627}, {5334, -627}},
+		},
+		"point": {
+			body:   `{"regions": [{"north": 5334, "south": 5334, "east": -627, "west": -627}], "channel": "fake", "endpoint": "https://example.com"}`,
+			status: http.StatusCreated,
+			cells:  []Cell{{5334, -627}},
+		},
+		"overlapping regions": {
+			body: `{"regions": [
+				{"north": 2, "south": 0, "east": 1, "west": 0},
+				{"north": 1, "south": 0, "east": 2, "west": 0}
+			], "channel": "fake", "endpoint": "https://example.com"}`,
+			status: http.StatusCreated,
+			cells:  []Cell{{0, 0}, {1, 0}, {0, 1}},
+		},
+		"too many cells": {
+			body:   `{"regions": [{"north": 3, "south": 0, "east": 3, "west": 0}], "channel": "fake", "endpoint": "https://example.com"}`,
+			status: http.StatusBadRequest,
+			code:   "too_many_cells",
+		},
+		"too many cells in regions": {
+			body: `{"regions": [
+				{"north": 2, "south": 0, "east": 2, "west": 0},
+				{"north": 12, "south": 10, "east": 2, "west": 0}
+			], "channel": "fake", "endpoint": "https://example.com"}`,
+			status: http.StatusBadRequest,
+			code:   "too_many_cells",
+		},
+		"off the planet": {
+			body:   `{"regions": [{"north": 9100, "south": 9000, "east": 1, "west": 0}], "channel": "fake", "endpoint": "https://example.com"}`,
+			status: http.StatusBadRequest,
+			code:   "invalid_region",
+		},
+		"inverted": {
+			body:   `{"regions": [{"north": 0, "south": 1, "east": 1, "west": 0}], "channel": "fake", "endpoint": "https://example.com"}`,
+			status: http.StatusBadRequest,
+			code:   "invalid_region",
+		},
+		"no regions": {
+			body:   `{"channel": "fake", "endpoint": "https://example.com"}`,
+			status: http.StatusBadRequest,
+			code:   "invalid_region",
+		},
+		"unknown channel": {
+			body:   `{"regions": [{"north": 1, "south": 0, "east": 1, "west": 0}], "channel": "sms", "endpoint": "+353"}`,
+			status: http.StatusBadRequest,
+			code:   "unknown_channel",
+		},
+		"invalid endpoint": {
+			body:   `{"regions": [{"north": 1, "south": 0, "east": 1, "west": 0}], "channel": "fake", "endpoint": "http://example.com"}`,
+			status: http.StatusBadRequest,
+			code:   "invalid_endpoint",
+		},
+		"invalid json": {
+			body:   `{"regions":`,
+			status: http.StatusBadRequest,
+			code:   "invalid_request",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db := &fakeDatabase{}
+			rec := httptest.NewRecorder()
+			newService(db).ServeHTTP(rec, newRequest(http.MethodPost, path, tc.body, "alice"))
+
+			if rec.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+			if tc.code != "" {
+				var resp subscriptionError
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Code != tc.code {
+					t.Errorf("error = %+v, %v, want %s", resp, err, tc.code)
+				}
+				return
+			}
+
+			var resp Subscription
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.ID == "" || len(resp.Secret) != 64 {
+				t.Errorf("subscription = %+v, want the ID and the secret", resp)
+			}
+			if !slices.Equal(resp.Cells, tc.cells) {
+				t.Errorf("cells = %v, want %v", resp.Cells, tc.cells)
+			}
+			if len(db.subs) != 1 || db.subs[0].Owner != "alice" || db.subs[0].Secret != resp.Secret {
+				t.Errorf("saved %+v, want the subscription of alice", db.subs)
+			}
+		})
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	db := &fakeDatabase{}
+	handler := newService(db)
+	body := `{"regions": [{"north": 1, "south": 0, "east": 1, "west": 0}], "channel": "fake", "endpoint": "https://example.com"}`
+
+	for i, want := range []int{http.StatusCreated, http.StatusCreated, http.StatusConflict} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest(http.MethodPost, path, body, "alice"))
+		if rec.Code != want {
+			t.Errorf("subscription %d: status = %d, want %d", i, rec.Code, want)
+		}
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(http.MethodPost, path, body, "bob"))
+	if rec.Code != http.StatusCreated {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+
+	// The users only see their own subscriptions, without the secrets.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(http.MethodGet, path, "", "alice"))
+	var list listResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Subscriptions) != 2 || list.Subscriptions[0].Secret != "" {
+		t.Fatalf("subscriptions = %+v, want the two subscriptions of alice", list.Subscriptions)
+	}
+
+	id := list.Subscriptions[0].ID
+	for _, tt := range []struct {
+		subject string
+		want    int
+	}{
+		{subject: "bob", want: http.StatusNotFound},
+		{subject: "alice", want: http.StatusNoContent},
+		{subject: "alice", want: http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest(http.MethodDelete, path+id, "", tt.subject))
+		if rec.Code != tt.want {
+			t.Errorf("%s unsubscribing: status = %d, want %d", tt.subject, rec.Code, tt.want)
+		}
+	}
+	if len(db.subs) != 2 {
+		t.Errorf("%d subscriptions left, want 2", len(db.subs))
+	}
+}
+
+func TestChannels(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newService(&fakeDatabase{}).ServeHTTP(rec, newRequest(http.MethodGet, path+channelsPath, "", "alice"))
+
+	var resp channelsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []Channel{{Name: "fake"}, {Name: "push", ApplicationServerKey: "key"}}
+	if !slices.Equal(resp.Channels, want) {
+		t.Errorf("channels = %+v, want %+v", resp.Channels, want)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	testCases := map[string]struct {
+		method  string
+		target  string
+		subject string
+		want    int
+	}{
+		"unauthenticated": {method: http.MethodGet, target: path, want: http.StatusUnauthorized},
+		"list":            {method: http.MethodGet, target: path, subject: "alice", want: http.StatusOK},
+		"delete all":      {method: http.MethodDelete, target: path, subject: "alice", want: http.StatusMethodNotAllowed},
+		"get one":         {method: http.MethodGet, target: path + "id", subject: "alice", want: http.StatusMethodNotAllowed},
+		"channels":        {method: http.MethodGet, target: path + channelsPath, subject: "alice", want: http.StatusOK},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newService(&fakeDatabase{}).ServeHTTP(rec, newRequest(tc.method, tc.target, "", tc.subject))
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
@@ -67,7 +67,7 @@ func (s *Service) ViewInRegion(
 	*connect.Response[viewer.ViewInRegionResponse],
 	error,
 ) {
-	if err := validateRegion(req.Msg.Region); err != nil {
+	if err := ValidateRegion(req.Msg.Region); err != nil {
 		return nil, connect.NewError(connect.CodeInvalidArgument,
 			fmt.Errorf("invalid region: %w", err),
 		)
@@ -130,7 +130,7 @@ func (s *Service) ViewAlerting(
 	error,
 ) {
 
-	if err := validateRegion(req.Msg.Region); err != nil {
+	if err := ValidateRegion(req.Msg.Region); err != nil {
 		return nil, connect.NewError(connect.CodeInvalidArgument,
 			fmt.Errorf("invalid region: %w", err),
 		)
@@ -180,11 +180,12 @@ func (e RegionError) Unwrap() error {
 	return e.cause
 }
 
-// validateRegion ensures that the region is specified in the correct format:
+// ValidateRegion ensures that the region is specified in the correct format, and is shared by
+// the services viewing the incidents in the regions:
 //   - on the planet Earth
 //   - in increments of `RegionDegreesIncrement` (or rounded if slightly inaccurate, up to a 1/10 of
 //     the increment)
-func validateRegion(region *viewer.Region) error {
+func ValidateRegion(region *viewer.Region) error {
 	// north and south
 	if -9000 > region.North || region.North > 9000 {
 		return &RegionError{"north", region.North, errOutOfBounds}
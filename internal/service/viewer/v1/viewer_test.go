@@ -31,8 +31,8 @@ func TestValidateRegion(t *testing.T) {
 		t.Run(fmt.Sprintf("%+v", in), func(t *testing.T) {
 			// TODO: Fix the plain string error checking since errors.Is doesn't seem to be working
 
-			if got := validateRegion(in); fmt.Sprint(got) != fmt.Sprint(want) {
-				t.Errorf("validateRegion(%v) = %v; want %v", in, got, want)
+			if got := ValidateRegion(in); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("ValidateRegion(%v) = %v; want %v", in, got, want)
 			}
 		})
 	}
@@ -0,0 +1,372 @@
+// Package filesystem stores the images in a local directory, for development and single machine
+// deployments which don't want to run an object storage.
+package filesystem
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"safer.place/internal/storage"
+)
+
+const (
+	// LayoutUUID names each image with a random UUID.
+	LayoutUUID = "uuid"
+	// LayoutContent names each image with the SHA-256 of its content, so the same image is
+	// only stored once.
+	LayoutContent = "content"
+)
+
+type Config struct {
+	Directory string `yaml:"directory" default:"images"`
+	// Layout of the images in the directory, either uuid or content.
+	Layout string `yaml:"layout" default:"uuid"`
+	// MaxSize of a single image in bytes.
+	MaxSize int64 `yaml:"max_size" split_words:"true" default:"10485760"`
+	// Quota of all the images in bytes, where 0 is unlimited.
+	Quota int64 `yaml:"quota"`
+}
+
+type Storage struct {
+	dir     string
+	layout  string
+	maxSize int64
+	quota   int64
+	tracer  trace.Tracer
+
+	// mu guards used, which is the size of all the stored images.
+	mu   sync.Mutex
+	used int64
+}
+
+// tmpDir is where the images are written before they are moved in place, so the partially
+// written images are never visible.
+const tmpDir = "tmp"
+
+var (
+	errMissingDirectory = errors.New("missing directory")
+	errMissingTracer    = errors.New("missing tracer")
+	errUnknownLayout    = errors.New("unknown layout")
+	errInvalidReference = errors.New("invalid reference")
+)
+
+var (
+	uuidReference    = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	contentReference = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+func New(cfg *Config, opts ...Option) (*Storage, error) {
+	s := &Storage{
+		dir:     cfg.Directory,
+		layout:  cfg.Layout,
+		maxSize: cfg.MaxSize,
+		quota:   cfg.Quota,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := validate(s); err != nil {
+		return nil, fmt.Errorf("filesystem validation failed: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(s.dir, tmpDir), 0o750); err != nil {
+		return nil, fmt.Errorf("unable to create directory: %w", err)
+	}
+
+	// Remove the images which were being written when the process stopped, and count the ones
+	// which were stored towards the quota.
+	if err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if filepath.Base(filepath.Dir(path)) == tmpDir {
+			return os.Remove(path)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		s.used += info.Size()
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to scan directory: %w", err)
+	}
+
+	return s, nil
+}
+
+// Deduplicates returns true with the content layout, which stores the same image only once.
+func (s *Storage) Deduplicates() bool {
+	return s.layout == LayoutContent
+}
+
+// Upload the image to the directory. The image is written to a temporary file first and moved
+// in place once it has been written completely.
+func (s *Storage) Upload(ctx context.Context, r io.Reader, size int64, _ string) (_ string, err error) {
+	_, span := s.tracer.Start(ctx, "upload")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	tmp, written, sum, err := s.writeTemp(r, size)
+	if err != nil {
+		return "", err
+	}
+	// Removing fails once the file has been moved in place.
+	defer os.Remove(tmp)
+
+	reference := uuid.New().String()
+	if s.layout == LayoutContent {
+		reference = hex.EncodeToString(sum)
+	}
+	path, err := s.path(reference)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The same image is already stored.
+	if _, err := os.Stat(path); err == nil {
+		return reference, nil
+	}
+	if err := s.move(tmp, path, written, 0); err != nil {
+		return "", err
+	}
+
+	return reference, nil
+}
+
+// Put the image under the reference, replacing the image which is already stored.
+func (s *Storage) Put(ctx context.Context, reference string, r io.Reader, size int64, _ string) (err error) {
+	_, span := s.tracer.Start(ctx, "put")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	path, err := s.path(reference)
+	if err != nil {
+		return err
+	}
+
+	tmp, written, _, err := s.writeTemp(r, size)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var replaced int64
+	if info, err := os.Stat(path); err == nil {
+		replaced = info.Size()
+	}
+	return s.move(tmp, path, written, replaced)
+}
+
+// writeTemp writes the image to a temporary file, returning its name, size and SHA-256. The
+// caller has to remove the file.
+func (s *Storage) writeTemp(r io.Reader, size int64) (_ string, _ int64, _ []byte, err error) {
+	if s.maxSize > 0 && size > s.maxSize {
+		return "", 0, nil, storage.ErrTooLarge
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, tmpDir), "upload-*")
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("unable to create temporary file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if s.maxSize > 0 {
+		// Read one byte more than allowed to know if the image is too large.
+		r = io.LimitReader(r, s.maxSize+1)
+	}
+	hash := sha256.New()
+	written, err := io.Copy(tmp, io.TeeReader(r, hash))
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("unable to write image: %w", err)
+	}
+	if s.maxSize > 0 && written > s.maxSize {
+		return "", 0, nil, storage.ErrTooLarge
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", 0, nil, fmt.Errorf("unable to sync image: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, nil, fmt.Errorf("unable to close image: %w", err)
+	}
+
+	return tmp.Name(), written, hash.Sum(nil), nil
+}
+
+// move the temporary file in place, replacing the image of the replaced size. The caller has to
+// hold the lock.
+func (s *Storage) move(tmp, path string, written, replaced int64) error {
+	if s.quota > 0 && s.used-replaced+written > s.quota {
+		return storage.ErrQuotaExceeded
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("unable to create image directory: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("unable to move image in place: %w", err)
+	}
+	s.used += written - replaced
+
+	return nil
+}
+
+// Get the image with the reference. The caller has to close the image.
+func (s *Storage) Get(ctx context.Context, reference string) (_ io.ReadCloser, err error) {
+	_, span := s.tracer.Start(ctx, "get")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	path, err := s.path(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("unable to open image: %w", err)
+	}
+
+	return f, nil
+}
+
+// Stat returns the information about the image. The content type is detected from the start of
+// the image, as it isn't stored.
+func (s *Storage) Stat(ctx context.Context, reference string) (_ *storage.Info, err error) {
+	ctx, span := s.tracer.Start(ctx, "stat")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	r, err := s.Get(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	f := r.(*os.File)
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("unable to stat image: %w", err)
+	}
+
+	// DetectContentType considers at most the first 512 bytes.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unable to read image: %w", err)
+	}
+
+	return &storage.Info{
+		Size:        info.Size(),
+		ContentType: http.DetectContentType(head[:n]),
+		ModTime:     info.ModTime(),
+	}, nil
+}
+
+// Delete the image, and release the space it used from the quota.
+func (s *Storage) Delete(ctx context.Context, reference string) (err error) {
+	_, span := s.tracer.Start(ctx, "delete")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	path, err := s.path(reference)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to stat image: %w", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("unable to delete image: %w", err)
+	}
+	s.used -= info.Size()
+
+	return nil
+}
+
+// path of the image, which is placed in a subdirectory named by the first two characters of
+// the reference to keep the directories small, next to its variants. Only the references created
+// by the storage are accepted, so they can't point outside of the directory.
+func (s *Storage) path(reference string) (string, error) {
+	image, _ := storage.ParseReference(reference)
+	if !uuidReference.MatchString(image) && !contentReference.MatchString(image) {
+		return "", fmt.Errorf("%w %q", errInvalidReference, reference)
+	}
+	return filepath.Join(s.dir, reference[:2], reference), nil
+}
+
+func validate(s *Storage) error {
+	if s.dir == "" {
+		return errMissingDirectory
+	}
+	if s.layout != LayoutUUID && s.layout != LayoutContent {
+		return fmt.Errorf("%w %q", errUnknownLayout, s.layout)
+	}
+	if s.tracer == nil {
+		return errMissingTracer
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/storage"
+)
+
+func newTestStorage(t *testing.T, cfg Config) *Storage {
+	t.Helper()
+
+	if cfg.Directory == "" {
+		cfg.Directory = t.TempDir()
+	}
+	if cfg.Layout == "" {
+		cfg.Layout = LayoutUUID
+	}
+
+	s, err := New(&cfg, Tracer(noop.NewTracerProvider().Tracer("")))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	return s
+}
+
+func upload(s *Storage, content string) (string, error) {
+	return s.Upload(context.Background(), strings.NewReader(content), int64(len(content)), "image/png")
+}
+
+func read(t *testing.T, s *Storage, reference string) string {
+	t.Helper()
+
+	r, err := s.Get(context.Background(), reference)
+	if err != nil {
+		t.Fatalf("Get(%s) = %v", reference, err)
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() = %v", err)
+	}
+	return string(content)
+}
+
+func TestUploadUUID(t *testing.T) {
+	s := newTestStorage(t, Config{})
+
+	first, err := upload(s, "image")
+	if err != nil {
+		t.Fatalf("Upload() = %v", err)
+	}
+	second, err := upload(s, "image")
+	if err != nil {
+		t.Fatalf("Upload() = %v", err)
+	}
+	if first == second {
+		t.Errorf("Upload() returned %s twice, want different references", first)
+	}
+
+	for _, reference := range []string{first, second} {
+		if got := read(t, s, reference); got != "image" {
+			t.Errorf("Get(%s) = %q, want %q", reference, got, "image")
+		}
+	}
+}
+
+func TestUploadContent(t *testing.T) {
+	s := newTestStorage(t, Config{Layout: LayoutContent, Quota: 10})
+
+	// The SHA-256 of "image".
+	const want = "6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d"
+	for i := 0; i < 2; i++ {
+		got, err := upload(s, "image")
+		if err != nil {
+			t.Fatalf("Upload() = %v", err)
+		}
+		if got != want {
+			t.Errorf("Upload() = %s, want %s", got, want)
+		}
+	}
+
+	// The same image is only counted towards the quota once.
+	if s.used != int64(len("image")) {
+		t.Errorf("used = %d, want %d", s.used, len("image"))
+	}
+	if got := read(t, s, want); got != "image" {
+		t.Errorf("Get() = %q, want %q", got, "image")
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	tests := map[string]struct {
+		cfg     Config
+		content string
+		// size is the size claimed by the uploader, -1 if unknown.
+		size int64
+		want error
+	}{
+		"within limits": {
+			cfg:     Config{MaxSize: 5, Quota: 5},
+			content: "image",
+			size:    5,
+		},
+		"too large": {
+			cfg:     Config{MaxSize: 4},
+			content: "image",
+			size:    5,
+			want:    storage.ErrTooLarge,
+		},
+		"too large with unknown size": {
+			cfg:     Config{MaxSize: 4},
+			content: "image",
+			size:    -1,
+			want:    storage.ErrTooLarge,
+		},
+		"too large with wrong size": {
+			cfg:     Config{MaxSize: 4},
+			content: "image",
+			size:    1,
+			want:    storage.ErrTooLarge,
+		},
+		"quota exceeded": {
+			cfg:     Config{Quota: 4},
+			content: "image",
+			size:    5,
+			want:    storage.ErrQuotaExceeded,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := newTestStorage(t, tt.cfg)
+
+			_, err := s.Upload(context.Background(), strings.NewReader(tt.content), tt.size, "image/png")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Upload() = %v, want %v", err, tt.want)
+			}
+
+			// The temporary files are removed even when the upload fails.
+			tmp, err := os.ReadDir(filepath.Join(s.dir, tmpDir))
+			if err != nil {
+				t.Fatalf("ReadDir() = %v", err)
+			}
+			if len(tmp) != 0 {
+				t.Errorf("%d temporary files left behind", len(tmp))
+			}
+		})
+	}
+}
+
+func TestPut(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Config{Quota: 10})
+
+	reference, err := upload(s, "image")
+	if err != nil {
+		t.Fatalf("Upload() = %v", err)
+	}
+	thumbnail := storage.VariantReference(reference, storage.VariantThumbnail)
+
+	put := func(content string) error {
+		return s.Put(ctx, thumbnail, strings.NewReader(content), int64(len(content)), "image/jpeg")
+	}
+	if err := put("thumb"); err != nil {
+		t.Fatalf("Put() = %v", err)
+	}
+	// Replacing the variant only counts the new one towards the quota.
+	if err := put("thum"); err != nil {
+		t.Fatalf("Put() = %v", err)
+	}
+	if s.used != 9 {
+		t.Errorf("used = %d, want 9", s.used)
+	}
+	if got := read(t, s, thumbnail); got != "thum" {
+		t.Errorf("Get() = %q, want %q", got, "thum")
+	}
+	if err := put("thumbnail"); !errors.Is(err, storage.ErrQuotaExceeded) {
+		t.Errorf("Put() = %v, want %v", err, storage.ErrQuotaExceeded)
+	}
+
+	// The variant is stored next to the image.
+	if _, err := os.Stat(filepath.Join(s.dir, reference[:2], thumbnail)); err != nil {
+		t.Errorf("Stat() = %v", err)
+	}
+	if err := s.Put(ctx, "../outside", strings.NewReader("image"), 5, "image/jpeg"); !errors.Is(err, errInvalidReference) {
+		t.Errorf("Put(../outside) = %v, want %v", err, errInvalidReference)
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	s := newTestStorage(t, Config{})
+
+	tests := map[string]struct {
+		reference string
+		want      error
+	}{
+		"not found":      {reference: "00000000-0000-0000-0000-000000000000", want: storage.ErrNotFound},
+		"path traversal": {reference: "../../etc/passwd", want: errInvalidReference},
+		"empty":          {reference: "", want: errInvalidReference},
+		"variant":        {reference: "00000000-0000-0000-0000-000000000000_thumbnail", want: storage.ErrNotFound},
+		"unknown suffix": {reference: "00000000-0000-0000-0000-000000000000_large", want: errInvalidReference},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := s.Get(context.Background(), tt.reference); !errors.Is(err, tt.want) {
+				t.Errorf("Get(%q) = %v, want %v", tt.reference, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRestores(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newTestStorage(t, Config{Directory: dir})
+	reference, err := upload(s, "image")
+	if err != nil {
+		t.Fatalf("Upload() = %v", err)
+	}
+	// An upload which was interrupted.
+	partial := filepath.Join(dir, tmpDir, "upload-partial")
+	if err := os.WriteFile(partial, bytes.Repeat([]byte{0}, 100), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s = newTestStorage(t, Config{Directory: dir})
+	if s.used != int64(len("image")) {
+		t.Errorf("used = %d, want %d", s.used, len("image"))
+	}
+	if _, err := os.Stat(partial); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat(partial) = %v, want it removed", err)
+	}
+	if got := read(t, s, reference); got != "image" {
+		t.Errorf("Get() = %q, want %q", got, "image")
+	}
+}
+
+func TestStatDelete(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, Config{})
+
+	png := "\x89PNG\r\n\x1a\n"
+	reference, err := upload(s, png)
+	if err != nil {
+		t.Fatalf("Upload() = %v", err)
+	}
+
+	info, err := s.Stat(ctx, reference)
+	if err != nil {
+		t.Fatalf("Stat() = %v", err)
+	}
+	if info.Size != int64(len(png)) || info.ContentType != "image/png" {
+		t.Errorf("Stat() = %+v, want %d bytes of image/png", info, len(png))
+	}
+
+	if err := s.Delete(ctx, reference); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if s.used != 0 {
+		t.Errorf("used = %d after deleting, want 0", s.used)
+	}
+	if _, err := s.Stat(ctx, reference); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat() = %v after deleting, want %v", err, storage.ErrNotFound)
+	}
+	// Deleting the image again is not an error.
+	if err := s.Delete(ctx, reference); err != nil {
+		t.Errorf("Delete() = %v, want nil", err)
+	}
+	if err := s.Delete(ctx, "../outside"); !errors.Is(err, errInvalidReference) {
+		t.Errorf("Delete(../outside) = %v, want %v", err, errInvalidReference)
+	}
+}
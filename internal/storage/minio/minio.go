@@ -8,6 +8,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
@@ -15,6 +17,7 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"safer.place/internal/config/secret"
+	"safer.place/internal/storage"
 )
 
 type Config struct {
@@ -23,18 +26,24 @@ type Config struct {
 	AccessKey string        `yaml:"access_key" split_words:"true"`
 	SecretKey secret.Secret `yaml:"secret_key" split_words:"true"`
 	Secure    bool          `yaml:"secure" default:"false"`
+	// PresignExpiry is how long the presigned URLs to the images are valid for.
+	PresignExpiry time.Duration `yaml:"presign_expiry" split_words:"true" default:"5m"`
 }
 
 type Storage struct {
-	client *minio.Client
-	bucket string
-	tracer trace.Tracer
+	client        *minio.Client
+	bucket        string
+	presignExpiry time.Duration
+	tracer        trace.Tracer
 }
 
 func New(ctx context.Context, cfg *Config, opts ...Option) (*Storage, error) {
 	var err error
 
-	s := &Storage{bucket: cfg.Bucket}
+	s := &Storage{
+		bucket:        cfg.Bucket,
+		presignExpiry: cfg.PresignExpiry,
+	}
 
 	for _, opt := range opts {
 		opt(s)
@@ -85,6 +94,125 @@ func (s *Storage) Upload(ctx context.Context, r io.Reader, size int64, contentTy
 	return id, nil
 }
 
+// Put the image in the minio bucket under the reference.
+func (s *Storage) Put(ctx context.Context, reference string, r io.Reader, size int64, contentType string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "put")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if _, err := s.client.PutObject(
+		ctx, s.bucket, reference, r, size, minio.PutObjectOptions{
+			ContentType: contentType,
+		},
+	); err != nil {
+		return fmt.Errorf("unable to put image: %w", err)
+	}
+
+	return nil
+}
+
+// Get the image from the minio bucket.
+func (s *Storage) Get(ctx context.Context, reference string) (_ io.ReadCloser, err error) {
+	ctx, span := s.tracer.Start(ctx, "get")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	obj, err := s.client.GetObject(ctx, s.bucket, reference, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get image: %w", err)
+	}
+	// The object is only requested once it is read, so stat it to know it exists.
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, objectError(err)
+	}
+
+	return obj, nil
+}
+
+// Stat the image in the minio bucket.
+func (s *Storage) Stat(ctx context.Context, reference string) (_ *storage.Info, err error) {
+	ctx, span := s.tracer.Start(ctx, "stat")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	info, err := s.client.StatObject(ctx, s.bucket, reference, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, objectError(err)
+	}
+
+	return &storage.Info{
+		Size:        info.Size,
+		ContentType: info.ContentType,
+		ModTime:     info.LastModified,
+	}, nil
+}
+
+// Delete the image from the minio bucket.
+func (s *Storage) Delete(ctx context.Context, reference string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "delete")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	// Removing an object which doesn't exist succeeds.
+	if err := s.client.RemoveObject(ctx, s.bucket, reference, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("unable to delete image: %w", err)
+	}
+
+	return nil
+}
+
+// PresignGet returns the URL to read the image directly from minio.
+func (s *Storage) PresignGet(ctx context.Context, reference string) (_ *url.URL, err error) {
+	ctx, span := s.tracer.Start(ctx, "presign")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if _, err := s.client.StatObject(ctx, s.bucket, reference, minio.StatObjectOptions{}); err != nil {
+		return nil, objectError(err)
+	}
+
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, reference, s.presignExpiry, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to presign image URL: %w", err)
+	}
+
+	return u, nil
+}
+
+// objectError converts the error for a missing object to storage.ErrNotFound.
+func objectError(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return storage.ErrNotFound
+	}
+	return fmt.Errorf("unable to stat image: %w", err)
+}
+
 var (
 	errMissingClient = errors.New("missing client")
 	errMissingBucket = errors.New("missing bucket")
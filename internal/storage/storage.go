@@ -4,7 +4,20 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTooLarge is returned when the image is larger than the storage accepts.
+	ErrTooLarge = errors.New("storage: image too large")
+	// ErrQuotaExceeded is returned when storing the image would exceed the storage quota.
+	ErrQuotaExceeded = errors.New("storage: quota exceeded")
+	// ErrNotFound is returned when there is no image with the reference.
+	ErrNotFound = errors.New("storage: image not found")
 )
 
 // Storage allows to upload the image
@@ -13,4 +26,102 @@ type Storage interface {
 	// reference which can uniquely identify the image, or an error if there was a problem uploading
 	// to the bucket.
 	Upload(ctx context.Context, r io.Reader, size int64, contentType string) (string, error)
+	// Put the image under the reference, replacing the image already stored under it. It is used
+	// to store the variants next to the uploaded image.
+	Put(ctx context.Context, reference string, r io.Reader, size int64, contentType string) error
+	// Get the image with the reference, which the caller has to close. ErrNotFound is returned
+	// if there is no such image.
+	Get(ctx context.Context, reference string) (io.ReadCloser, error)
+	// Stat returns the information about the image without reading it.
+	Stat(ctx context.Context, reference string) (*Info, error)
+	// Delete the image. Deleting an image which doesn't exist is not an error.
+	Delete(ctx context.Context, reference string) error
+}
+
+// Info about the stored image.
+type Info struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Presigner is implemented by the storages which can give out URLs to read the image directly
+// from the storage, without going through the server.
+type Presigner interface {
+	// PresignGet returns the URL from which the image can be read until it expires. The URL is
+	// returned even if the image doesn't exist.
+	PresignGet(ctx context.Context, reference string) (*url.URL, error)
+}
+
+// Deduplicator is implemented by the storages which can store the same image only once. The
+// reference of the image already stored is returned when it is uploaded again, so the image
+// might not belong only to the upload which got its reference.
+type Deduplicator interface {
+	// Deduplicates returns true if the same image is only stored once.
+	Deduplicates() bool
+}
+
+// Variant is another version of the uploaded image, such as a smaller one so the clients don't
+// have to load the full image when they show it in a list or on a small screen, or a redacted
+// one which can be published.
+type Variant string
+
+const (
+	// VariantThumbnail is small enough to show the image in a list.
+	VariantThumbnail Variant = "thumbnail"
+	// VariantMedium is large enough to fill a phone screen.
+	VariantMedium Variant = "medium"
+	// VariantRedacted is the image with the faces and number plates hidden, which is shown in
+	// place of the image to everyone except the reviewers.
+	VariantRedacted Variant = "redacted"
+	// VariantRedactedThumbnail and VariantRedactedMedium are the smaller versions of the
+	// redacted image.
+	VariantRedactedThumbnail Variant = "redacted_thumbnail"
+	VariantRedactedMedium    Variant = "redacted_medium"
+)
+
+// Variants are all the variants which can be stored for each image.
+var Variants = []Variant{
+	VariantThumbnail, VariantMedium,
+	VariantRedacted, VariantRedactedThumbnail, VariantRedactedMedium,
+}
+
+// Redacted returns the redacted version of the variant, where the empty variant is the uploaded
+// image.
+func (v Variant) Redacted() Variant {
+	switch v {
+	case "", VariantRedacted:
+		return VariantRedacted
+	case VariantThumbnail, VariantRedactedThumbnail:
+		return VariantRedactedThumbnail
+	case VariantMedium, VariantRedactedMedium:
+		return VariantRedactedMedium
+	default:
+		return v
+	}
+}
+
+// VariantReference is the reference the variant of the image is stored under, which is the
+// reference of the image itself for the empty variant.
+func VariantReference(reference string, variant Variant) string {
+	if variant == "" {
+		return reference
+	}
+	return reference + "_" + string(variant)
+}
+
+// ParseReference splits the reference into the reference of the uploaded image and the variant,
+// which is empty if the reference is of the uploaded image itself.
+func ParseReference(reference string) (string, Variant) {
+	var found Variant
+	for _, v := range Variants {
+		// The longest suffix wins, so redacted_medium isn't mistaken for medium.
+		if strings.HasSuffix(reference, "_"+string(v)) && len(v) > len(found) {
+			found = v
+		}
+	}
+	if found == "" {
+		return reference, ""
+	}
+	return strings.TrimSuffix(reference, "_"+string(found)), found
 }
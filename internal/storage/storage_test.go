@@ -0,0 +1,52 @@
+package storage
+
+import "testing"
+
+func TestParseReference(t *testing.T) {
+	testCases := map[string]struct {
+		reference string
+		variant   Variant
+	}{
+		"abc":           {reference: "abc"},
+		"abc_thumbnail": {reference: "abc", variant: VariantThumbnail},
+		"abc_medium":    {reference: "abc", variant: VariantMedium},
+		"abc_large":     {reference: "abc_large"},
+		"a_b_medium":    {reference: "a_b", variant: VariantMedium},
+		"_thumbnail":    {reference: "", variant: VariantThumbnail},
+
+		"abc_redacted":           {reference: "abc", variant: VariantRedacted},
+		"abc_redacted_medium":    {reference: "abc", variant: VariantRedactedMedium},
+		"abc_redacted_thumbnail": {reference: "abc", variant: VariantRedactedThumbnail},
+	}
+
+	for in, tc := range testCases {
+		reference, variant := ParseReference(in)
+		if reference != tc.reference || variant != tc.variant {
+			t.Errorf("ParseReference(%q) = %q, %q, want %q, %q", in, reference, variant, tc.reference, tc.variant)
+		}
+	}
+
+	if got := VariantReference("abc", VariantThumbnail); got != "abc_thumbnail" {
+		t.Errorf("VariantReference() = %q, want %q", got, "abc_thumbnail")
+	}
+	if got := VariantReference("abc", ""); got != "abc" {
+		t.Errorf("VariantReference() = %q, want %q", got, "abc")
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	testCases := map[Variant]Variant{
+		"":                       VariantRedacted,
+		VariantThumbnail:         VariantRedactedThumbnail,
+		VariantMedium:            VariantRedactedMedium,
+		VariantRedacted:          VariantRedacted,
+		VariantRedactedThumbnail: VariantRedactedThumbnail,
+		VariantRedactedMedium:    VariantRedactedMedium,
+	}
+
+	for variant, want := range testCases {
+		if got := variant.Redacted(); got != want {
+			t.Errorf("%q.Redacted() = %q, want %q", variant, got, want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package storagetest provides the storage the tests of the packages storing the images run
+// against, so they exercise a real storage instead of a partial fake.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"safer.place/internal/storage"
+	"safer.place/internal/storage/filesystem"
+)
+
+// maxSize of the images stored in the tests.
+const maxSize = 1 << 20
+
+// New returns the filesystem storage in a temporary directory of the test, which names the
+// images with UUIDs.
+func New(t testing.TB) *Storage {
+	t.Helper()
+
+	s, err := filesystem.New(&filesystem.Config{
+		Directory: t.TempDir(),
+		Layout:    filesystem.LayoutUUID,
+		MaxSize:   maxSize,
+	}, filesystem.Tracer(noop.NewTracerProvider().Tracer("")))
+	if err != nil {
+		t.Fatalf("unable to create storage: %v", err)
+	}
+	return &Storage{Storage: s, t: t}
+}
+
+// Storage records the images uploaded, put and deleted, and fails them with the errors set by
+// Fail.
+type Storage struct {
+	*filesystem.Storage
+	t testing.TB
+
+	mu   sync.Mutex
+	ops  []string
+	errs map[string]error
+}
+
+// Fail the operation with the error. The operation is upload, put or delete, optionally
+// followed by the reference, such as "delete <reference>", to fail only that image. A nil error
+// lets the operation succeed again.
+func (s *Storage) Fail(op string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.errs == nil {
+		s.errs = make(map[string]error)
+	}
+	s.errs[op] = err
+}
+
+// Ops returns the operations which succeeded in order, each as the operation followed by the
+// reference.
+func (s *Storage) Ops() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.ops...)
+}
+
+// fail returns the error the operation on the image fails with, if any.
+func (s *Storage) fail(op, reference string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.errs[op+" "+reference]; err != nil {
+		return err
+	}
+	return s.errs[op]
+}
+
+func (s *Storage) record(op, reference string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ops = append(s.ops, op+" "+reference)
+}
+
+// Upload the image, unless the uploads fail.
+func (s *Storage) Upload(ctx context.Context, r io.Reader, size int64, contentType string) (string, error) {
+	if err := s.fail("upload", ""); err != nil {
+		return "", err
+	}
+	reference, err := s.Storage.Upload(ctx, r, size, contentType)
+	if err != nil {
+		return "", err
+	}
+	s.record("upload", reference)
+	return reference, nil
+}
+
+// Put the image under the reference, unless the puts fail.
+func (s *Storage) Put(ctx context.Context, reference string, r io.Reader, size int64, contentType string) error {
+	if err := s.fail("put", reference); err != nil {
+		return err
+	}
+	if err := s.Storage.Put(ctx, reference, r, size, contentType); err != nil {
+		return err
+	}
+	s.record("put", reference)
+	return nil
+}
+
+// Delete the image, unless the deletes fail.
+func (s *Storage) Delete(ctx context.Context, reference string) error {
+	if err := s.fail("delete", reference); err != nil {
+		return err
+	}
+	if err := s.Storage.Delete(ctx, reference); err != nil {
+		return err
+	}
+	s.record("delete", reference)
+	return nil
+}
+
+// Store uploads the image, and returns its reference.
+func (s *Storage) Store(data []byte) string {
+	s.t.Helper()
+
+	reference, err := s.Storage.Upload(context.Background(), bytes.NewReader(data), int64(len(data)), "")
+	if err != nil {
+		s.t.Fatalf("unable to store image: %v", err)
+	}
+	return reference
+}
+
+// StoreAs puts the image under the reference, such as a variant of an image which was stored.
+func (s *Storage) StoreAs(reference string, data []byte) {
+	s.t.Helper()
+
+	if err := s.Storage.Put(context.Background(), reference, bytes.NewReader(data), int64(len(data)), ""); err != nil {
+		s.t.Fatalf("unable to store %s: %v", reference, err)
+	}
+}
+
+// Read returns the image, or nil if it isn't stored.
+func (s *Storage) Read(reference string) []byte {
+	s.t.Helper()
+
+	r, err := s.Storage.Get(context.Background(), reference)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		s.t.Fatalf("unable to get %s: %v", reference, err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		s.t.Fatalf("unable to read %s: %v", reference, err)
+	}
+	return data
+}
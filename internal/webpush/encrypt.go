@@ -0,0 +1,96 @@
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// The messages are encrypted in a single record of the aes128gcm content encoding from RFC 8188.
+const (
+	recordSize = 4096
+	saltSize   = 16
+	authSize   = 16
+	keySize    = 65
+	tagSize    = 16
+	// headerSize is the salt, the record size, and the length of the key followed by the
+	// public key of the server.
+	headerSize = saltSize + 4 + 1 + keySize
+	// lastRecord delimits the payload of the last record from its padding.
+	lastRecord = 0x02
+)
+
+// encrypt the payload for the browser of the subscription with a new key and salt.
+func encrypt(sub *Subscription, payload []byte) ([]byte, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate key: %w", err)
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("unable to generate salt: %w", err)
+	}
+	return encryptWith(sub, payload, key, salt)
+}
+
+// encryptWith encrypts the payload as in RFC 8291, with the key and the salt of the server.
+func encryptWith(sub *Subscription, payload []byte, key *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	uaPublic, authSecret, err := sub.keys()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := key.ECDH(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("unable to agree on secret: %w", err)
+	}
+	asPublic := key.PublicKey().Bytes()
+
+	// The secret is combined with the authentication secret of the browser, and both public
+	// keys.
+	info := append([]byte("WebPush: info\x00"), uaPublic.Bytes()...)
+	ikm := hkdf(authSecret, secret, append(info, asPublic...), 32)
+
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cipher: %w", err)
+	}
+
+	body := make([]byte, 0, headerSize+len(payload)+1+tagSize)
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, recordSize)
+	body = append(body, byte(len(asPublic)))
+	body = append(body, asPublic...)
+
+	plaintext := append(append(make([]byte, 0, len(payload)+1), payload...), lastRecord)
+	return gcm.Seal(body, nonce, plaintext, nil), nil
+}
+
+// hkdf derives the key of the length from the input keying material, as in RFC 5869. The keys
+// are at most as long as the hash, so they are expanded from a single block.
+func hkdf(salt, ikm, info []byte, length int) []byte {
+	prk := hmacSum(salt, ikm)
+	return hmacSum(prk, append(append([]byte{}, info...), 0x01))[:length]
+}
+
+func hmacSum(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
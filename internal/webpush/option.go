@@ -0,0 +1,13 @@
+package webpush
+
+import "net/http"
+
+// Option to provide configuration to the sender.
+type Option func(*Sender)
+
+// Client provides the HTTP client sending the messages to the push services.
+func Client(c *http.Client) Option {
+	return func(s *Sender) {
+		s.client = c
+	}
+}
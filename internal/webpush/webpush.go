@@ -0,0 +1,309 @@
+// Package webpush sends the push messages to the browsers through their push services. The
+// messages are encrypted for the browser as in RFC 8291, and the requests are authenticated with
+// the VAPID key of the server as in RFC 8292.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"safer.place/internal/config/secret"
+)
+
+// Config of the web push.
+type Config struct {
+	// Subject is the contact of the operator for the push services, a mailto: or https: URL.
+	Subject string `yaml:"subject"`
+	// PrivateKey is the VAPID key, the P-256 private key in unpadded base64url. The public key
+	// is derived from it. See GenerateKey.
+	PrivateKey secret.Secret `yaml:"private_key" split_words:"true"`
+	// TTL of the messages the push services keep for the browsers which are offline.
+	TTL time.Duration `yaml:"ttl" default:"12h"`
+}
+
+// Enabled returns whether the VAPID key is configured.
+func (cfg Config) Enabled() bool {
+	return cfg.PrivateKey != ""
+}
+
+// Urgency of the message, which the browsers use to decide whether to wake the device up.
+type Urgency string
+
+// Urgencies of the messages, from RFC 8030.
+const (
+	UrgencyVeryLow Urgency = "very-low"
+	UrgencyLow     Urgency = "low"
+	UrgencyNormal  Urgency = "normal"
+	UrgencyHigh    Urgency = "high"
+)
+
+// MaxPayload is the largest payload which can be sent, in bytes. The push services accept at
+// most 4096 bytes, including the header and the padding of the encryption.
+const MaxPayload = recordSize - headerSize - tagSize - 1
+
+// ErrGone is returned when the push service no longer knows the subscription, because the
+// user unsubscribed or it expired.
+var ErrGone = errors.New("push subscription is gone")
+
+// Subscription of the browser, as returned by PushSubscription.toJSON().
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     Keys   `json:"keys"`
+}
+
+// Keys of the browser the messages are encrypted for.
+type Keys struct {
+	// P256dh is the public key of the browser, in unpadded base64url.
+	P256dh string `json:"p256dh"`
+	// Auth is the authentication secret of the browser, in unpadded base64url.
+	Auth string `json:"auth"`
+}
+
+// ParseSubscription parses the JSON of the push subscription, and checks its keys.
+func ParseSubscription(data []byte) (*Subscription, error) {
+	var sub Subscription
+	if err := json.Unmarshal(data, &sub); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidSubscription, err)
+	}
+
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidSubscription, err)
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return nil, fmt.Errorf("%w: endpoint must be an absolute URL", errInvalidSubscription)
+	}
+	if _, _, err := sub.keys(); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// keys decodes the keys of the browser.
+func (s *Subscription) keys() (*ecdh.PublicKey, []byte, error) {
+	p256dh, err := decode(s.Keys.P256dh)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: p256dh: %w", errInvalidSubscription, err)
+	}
+	key, err := ecdh.P256().NewPublicKey(p256dh)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: p256dh: %w", errInvalidSubscription, err)
+	}
+	auth, err := decode(s.Keys.Auth)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: auth: %w", errInvalidSubscription, err)
+	}
+	if len(auth) != authSize {
+		return nil, nil, fmt.Errorf("%w: auth must be %d bytes", errInvalidSubscription, authSize)
+	}
+	return key, auth, nil
+}
+
+// Sender sends the push messages.
+type Sender struct {
+	cfg       Config
+	key       *ecdsa.PrivateKey
+	publicKey string
+	client    *http.Client
+	// now is replaced in the tests.
+	now func() time.Time
+}
+
+// New creates a new sender with the VAPID key from the config.
+func New(cfg Config, opts ...Option) (*Sender, error) {
+	key, err := parseKey(string(cfg.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sender{
+		cfg:       cfg,
+		key:       key,
+		publicKey: encode(publicKeyBytes(key)),
+		client:    &http.Client{Timeout: 10 * time.Second},
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, validate(s)
+}
+
+// PublicKey returns the VAPID public key in unpadded base64url, which the browsers subscribe
+// with as the applicationServerKey.
+func (s *Sender) PublicKey() string {
+	return s.publicKey
+}
+
+// Send the payload to the browser of the subscription. The push services which respond with
+// 404 or 410 no longer know the subscription, and ErrGone is returned.
+func (s *Sender) Send(ctx context.Context, sub *Subscription, payload []byte, urgency Urgency) error {
+	if len(payload) > MaxPayload {
+		return fmt.Errorf("%w: %d bytes", errPayloadTooLarge, len(payload))
+	}
+	body, err := encrypt(sub, payload)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidSubscription, err)
+	}
+	token, err := s.token(u.Scheme + "://" + u.Host)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(s.cfg.TTL.Seconds())))
+	req.Header.Set("Urgency", string(urgency))
+	req.Header.Set("Authorization", "vapid t="+token+", k="+s.publicKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// The error contains the URL, which identifies the browser.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("unable to send push message: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return fmt.Errorf("%w: %s", ErrGone, resp.Status)
+	default:
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+}
+
+// tokenExpiry is how long the VAPID tokens are valid for. The push services reject the tokens
+// valid for more than 24 hours.
+const tokenExpiry = 12 * time.Hour
+
+// token returns the VAPID token for the origin of the push service, a JWT signed with ES256.
+func (s *Sender) token(audience string) (string, error) {
+	header := encode([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(struct {
+		Audience string `json:"aud"`
+		Expiry   int64  `json:"exp"`
+		Subject  string `json:"sub"`
+	}{
+		Audience: audience,
+		Expiry:   s.now().Add(tokenExpiry).Unix(),
+		Subject:  s.cfg.Subject,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to encode claims: %w", err)
+	}
+
+	unsigned := header + "." + encode(claims)
+	r, sig, err := ecdsa.Sign(rand.Reader, s.key, sha256Sum([]byte(unsigned)))
+	if err != nil {
+		return "", fmt.Errorf("unable to sign token: %w", err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+
+	return unsigned + "." + encode(signature), nil
+}
+
+// GenerateKey returns a new VAPID private key and its public key, in unpadded base64url.
+func GenerateKey() (privateKey, publicKey string, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to generate key: %w", err)
+	}
+	return encode(key.Bytes()), encode(key.PublicKey().Bytes()), nil
+}
+
+// parseKey parses the VAPID private key.
+func parseKey(privateKey string) (*ecdsa.PrivateKey, error) {
+	if privateKey == "" {
+		return nil, errMissingPrivateKey
+	}
+	d, err := decode(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidPrivateKey, err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidPrivateKey, err)
+	}
+
+	// The public key is the uncompressed point, 0x04 followed by its coordinates.
+	point := key.PublicKey().Bytes()
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}, nil
+}
+
+// publicKeyBytes returns the uncompressed point of the public key.
+func publicKeyBytes(key *ecdsa.PrivateKey) []byte {
+	point := make([]byte, 65)
+	point[0] = 4
+	key.X.FillBytes(point[1:33])
+	key.Y.FillBytes(point[33:])
+	return point
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decode the base64url keys, which the browsers send without padding but some libraries pad.
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+var (
+	errMissingPrivateKey   = errors.New("missing VAPID private key")
+	errInvalidPrivateKey   = errors.New("invalid VAPID private key")
+	errInvalidSubject      = errors.New("VAPID subject must be a mailto: or https: URL")
+	errMissingClient       = errors.New("missing http client")
+	errInvalidSubscription = errors.New("invalid push subscription")
+	errPayloadTooLarge     = errors.New("payload is too large")
+)
+
+func validate(s *Sender) error {
+	if !strings.HasPrefix(s.cfg.Subject, "mailto:") && !strings.HasPrefix(s.cfg.Subject, "https://") {
+		return errInvalidSubject
+	}
+	if s.client == nil {
+		return errMissingClient
+	}
+	return nil
+}
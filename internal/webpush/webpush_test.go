@@ -0,0 +1,297 @@
+package webpush
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"safer.place/internal/config/secret"
+)
+
+// TestEncryptWith checks the example from the appendix of RFC 8291.
+func TestEncryptWith(t *testing.T) {
+	sub := &Subscription{
+		Endpoint: "https://push.example.net/push/JzLQ3raZJfFBR0aqvOMsLrt54w4rJUsV",
+		Keys: Keys{
+			P256dh: "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4",
+			Auth:   "BTBZMqHH6r4Tts7J_aSIgg",
+		},
+	}
+	asPrivate, _ := decode("yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw")
+	key, err := ecdh.P256().NewPrivateKey(asPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt, _ := decode("DGv6ra1nlYgDCS1FRnbzlw")
+
+	body, err := encryptWith(sub, []byte("When I grow up, I want to be a watermelon"), key, salt)
+	if err != nil {
+		t.Fatalf("encryptWith() = %v", err)
+	}
+
+	want := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if got := encode(body); got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+}
+
+// browser subscribes to the fake push service.
+type browser struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newBrowser(t *testing.T) *browser {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, authSize)
+	_, _ = rand.Read(auth)
+	return &browser{key: key, auth: auth}
+}
+
+func (b *browser) subscription(endpoint string) *Subscription {
+	return &Subscription{
+		Endpoint: endpoint,
+		Keys:     Keys{P256dh: encode(b.key.PublicKey().Bytes()), Auth: encode(b.auth)},
+	}
+}
+
+// decrypt the message as the browser would.
+func (b *browser) decrypt(body []byte) ([]byte, error) {
+	if len(body) < headerSize || body[saltSize+4] != keySize {
+		return nil, errors.New("invalid header")
+	}
+	salt := body[:saltSize]
+	if rs := binary.BigEndian.Uint32(body[saltSize:]); rs != recordSize {
+		return nil, errors.New("unexpected record size")
+	}
+	asPublic, err := ecdh.P256().NewPublicKey(body[saltSize+5 : headerSize])
+	if err != nil {
+		return nil, err
+	}
+	secret, err := b.key.ECDH(asPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	info := append([]byte("WebPush: info\x00"), b.key.PublicKey().Bytes()...)
+	ikm := hkdf(b.auth, secret, append(info, asPublic.Bytes()...), 32)
+	block, _ := aes.NewCipher(hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16))
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12), body[headerSize:], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	end := strings.LastIndexByte(string(plaintext), lastRecord)
+	if end < 0 {
+		return nil, errors.New("missing delimiter")
+	}
+	return plaintext[:end], nil
+}
+
+// verifyToken checks the VAPID token from the Authorization header was signed with the key.
+func verifyToken(header, audience string) (map[string]any, error) {
+	var token, key string
+	for _, param := range strings.Split(strings.TrimPrefix(header, "vapid "), ", ") {
+		name, value, _ := strings.Cut(param, "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			key = value
+		}
+	}
+
+	point, err := decode(key)
+	if err != nil || len(point) != keySize {
+		return nil, errors.New("invalid key")
+	}
+	public := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(point[1:33]),
+		Y:     new(big.Int).SetBytes(point[33:]),
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid token")
+	}
+	signature, err := decode(parts[2])
+	if err != nil || len(signature) != 64 {
+		return nil, errors.New("invalid signature")
+	}
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(public, sha256Sum([]byte(parts[0]+"."+parts[1])), r, s) {
+		return nil, errors.New("signature does not match")
+	}
+
+	payload, err := decode(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	if claims["aud"] != audience {
+		return nil, errors.New("unexpected audience")
+	}
+	return claims, nil
+}
+
+func TestSend(t *testing.T) {
+	privateKey, _, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	b := newBrowser(t)
+
+	var (
+		status = http.StatusCreated
+		got    []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := verifyToken(r.Header.Get("Authorization"), "http://"+r.Host)
+		if err != nil {
+			t.Errorf("invalid token: %v", err)
+		} else if claims["sub"] != "mailto:admin@safer.place" || claims["exp"] != float64(now.Add(tokenExpiry).Unix()) {
+			t.Errorf("claims = %v", claims)
+		}
+		if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") != "60" || r.Header.Get("Urgency") != "high" {
+			t.Errorf("headers = %v", r.Header)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if got, err = b.decrypt(body); err != nil {
+			t.Errorf("unable to decrypt: %v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	s, err := New(Config{
+		Subject:    "mailto:admin@safer.place",
+		PrivateKey: secret.Secret(privateKey),
+		TTL:        time.Minute,
+	}, Client(server.Client()))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	s.now = func() time.Time { return now }
+
+	sub := b.subscription(server.URL + "/push/abc")
+	if err := s.Send(context.Background(), sub, []byte(`{"alert": true}`), UrgencyHigh); err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+	if string(got) != `{"alert": true}` {
+		t.Errorf("payload = %q", got)
+	}
+
+	status = http.StatusGone
+	if err := s.Send(context.Background(), sub, []byte("{}"), UrgencyHigh); !errors.Is(err, ErrGone) {
+		t.Errorf("Send() = %v, want %v", err, ErrGone)
+	}
+	status = http.StatusTooManyRequests
+	if err := s.Send(context.Background(), sub, []byte("{}"), UrgencyHigh); err == nil || errors.Is(err, ErrGone) {
+		t.Errorf("Send() = %v, want an error", err)
+	}
+	if err := s.Send(context.Background(), sub, make([]byte, MaxPayload+1), UrgencyHigh); !errors.Is(err, errPayloadTooLarge) {
+		t.Errorf("Send() = %v, want %v", err, errPayloadTooLarge)
+	}
+}
+
+func TestNew(t *testing.T) {
+	privateKey, publicKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		cfg Config
+		err error
+	}{
+		"valid": {
+			cfg: Config{Subject: "https://safer.place", PrivateKey: secret.Secret(privateKey)},
+		},
+		"missing key": {
+			cfg: Config{Subject: "https://safer.place"},
+			err: errMissingPrivateKey,
+		},
+		"invalid key": {
+			cfg: Config{Subject: "https://safer.place", PrivateKey: "AAAA"},
+			err: errInvalidPrivateKey,
+		},
+		"invalid subject": {
+			cfg: Config{Subject: "admin@safer.place", PrivateKey: secret.Secret(privateKey)},
+			err: errInvalidSubject,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, err := New(tc.cfg)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("New() = %v, want %v", err, tc.err)
+			}
+			if err == nil && s.PublicKey() != publicKey {
+				t.Errorf("PublicKey() = %s, want %s", s.PublicKey(), publicKey)
+			}
+		})
+	}
+}
+
+func TestParseSubscription(t *testing.T) {
+	b := newBrowser(t)
+	valid, _ := json.Marshal(b.subscription("https://push.example.net/push/abc"))
+
+	testCases := map[string]struct {
+		data string
+		err  error
+	}{
+		"valid": {
+			data: string(valid),
+		},
+		"not json": {
+			data: "https://push.example.net/push/abc",
+			err:  errInvalidSubscription,
+		},
+		"relative endpoint": {
+			data: `{"endpoint": "/push/abc", "keys": {"p256dh": "` + encode(b.key.PublicKey().Bytes()) + `", "auth": "` + encode(b.auth) + `"}}`,
+			err:  errInvalidSubscription,
+		},
+		"missing keys": {
+			data: `{"endpoint": "https://push.example.net/push/abc"}`,
+			err:  errInvalidSubscription,
+		},
+		"short auth": {
+			data: `{"endpoint": "https://push.example.net/push/abc", "keys": {"p256dh": "` + encode(b.key.PublicKey().Bytes()) + `", "auth": "AAAA"}}`,
+			err:  errInvalidSubscription,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseSubscription([]byte(tc.data)); !errors.Is(err, tc.err) {
+				t.Errorf("ParseSubscription() = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
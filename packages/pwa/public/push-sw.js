@@ -0,0 +1,21 @@
+// Shows the alerts pushed by the webpush channel of the alerter, which are the
+// same JSON as the alerts posted to the webhooks.
+self.addEventListener('push', (event) => {
+  if (!event.data) {
+    return
+  }
+  const alert = event.data.json()
+  event.waitUntil(
+    self.registration.showNotification('SaferPlace', {
+      body: alert.description,
+      icon: '/pwa-192x192.png',
+      tag: alert.incident_id,
+      data: alert,
+    }),
+  )
+})
+
+self.addEventListener('notificationclick', (event) => {
+  event.notification.close()
+  event.waitUntil(self.clients.openWindow('/'))
+})
@@ -11,21 +11,22 @@ export function getEndpoint(): string {
     return localStorage.getItem('backend') ?? import.meta.env.VITE_BACKEND
 }
 
-export function getCDNEndpoint(): string {
-    return localStorage.getItem('cdn') ?? import.meta.env.VITE_CDN
-}
-
 /**
- * emailInterceptor is a temporary interceptor designed to send the specified email
- * address until we have user authentication. In the future, the intercerceptor on the server
- * side will remove this header, authenticate, then re-add based on the verified user credentials.
+ * authInterceptor sends the ID token issued by the identity provider so the server can verify
+ * who the user is. Without a token we fall back to the email address, which is only accepted
+ * by servers using the insecure authentication for development.
  */
-const emailInterceptor: Interceptor = (next) => async (req) => {
-    emailHeaders(req.header)
+const authInterceptor: Interceptor = (next) => async (req) => {
+    authHeaders(req.header)
     return await next(req)
 }
 
-function emailHeaders(headers: Headers) {
+function authHeaders(headers: Headers) {
+    const token = localStorage.getItem('token')
+    if (token) {
+        headers.set('Authorization', `Bearer ${token}`)
+        return
+    }
     headers.set('X-Email', localStorage.getItem('email') ?? '')
 }
 
@@ -37,7 +38,7 @@ export function getClient<T extends ServiceType>(service: T): PromiseClient<T> {
     const backend = getEndpoint()
     const transport = createConnectTransport({
         baseUrl: backend,
-        interceptors: [emailInterceptor],
+        interceptors: [authInterceptor],
     })
     console.debug(`connecting to ${backend}/${service.typeName}`)
     return createPromiseClient(service, transport)
@@ -46,7 +47,7 @@ export function getClient<T extends ServiceType>(service: T): PromiseClient<T> {
 export async function uploadImage(image?: File): Promise<string> {
     if (!image) { return '' }
         const headers = new Headers()
-        emailHeaders(headers)
+        authHeaders(headers)
         const body = new FormData()
         body.append('image', image)
         return fetch(`${getEndpoint()}/v1/upload`, {
@@ -54,5 +55,49 @@ export async function uploadImage(image?: File): Promise<string> {
             body,
             headers,
         })
-            .then(resp => resp.text())
+            .then(async resp => {
+                if (!resp.ok) {
+                    // Failed uploads are described by a JSON body with a code and message.
+                    const { message } = await resp.json()
+                        .catch(() => ({ message: resp.statusText }))
+                    throw new Error(message)
+                }
+                return resp.text()
+            })
+}
+
+/** ImageVariant is a smaller version of the image, stored when it is uploaded. */
+export type ImageVariant = 'thumbnail' | 'medium'
+
+/**
+ * useImage fetches the image with the user credentials, as they can't be sent by an img tag,
+ * and returns the URL to show it. The image is released once the component is unmounted.
+ * @param imageId of the image to show.
+ * @param variant of the image to show, `thumbnail` or `medium`, or the full image if not given.
+ */
+export function useImage(imageId?: string, variant?: ImageVariant): string | undefined {
+    const [src, setSrc] = React.useState<string>()
+    React.useEffect(() => {
+        if (!imageId) { return }
+        const controller = new AbortController()
+        let url: string | undefined
+        const headers = new Headers()
+        authHeaders(headers)
+        const key = variant ? `${imageId}_${variant}` : imageId
+        fetch(`${getEndpoint()}/v1/image/${encodeURIComponent(key)}`, {
+            headers,
+            signal: controller.signal,
+        })
+            .then(resp => resp.ok ? resp.blob() : Promise.reject(new Error(resp.statusText)))
+            .then(blob => {
+                url = URL.createObjectURL(blob)
+                setSrc(url)
+            })
+            .catch(err => console.debug('unable to load image', err))
+        return () => {
+            controller.abort()
+            if (url) { URL.revokeObjectURL(url) }
+        }
+    }, [imageId, variant])
+    return src
 }
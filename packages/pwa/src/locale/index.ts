@@ -2,7 +2,6 @@ export type TranslationFile = {
     common: Partial<{
         email: string
         backend: string
-        cdn: string
         description: string
         submittedAtTime: string
         reportStatus: string
@@ -10,7 +9,6 @@ export type TranslationFile = {
     action: Partial<{
         useEmail: string
         useBackend: string
-        useCDN: string
         viewIncidents: string
         viewIncident: string
         submitReport: string
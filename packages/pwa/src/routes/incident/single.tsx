@@ -4,7 +4,7 @@ import { useLoaderData } from "react-router-dom"
 import { useTranslation } from "react-i18next"
 
 import { AccessTime, Done, Warning, HighlightOff } from '@mui/icons-material'
-import { getCDNEndpoint } from "../../hooks/client"
+import { useImage } from "../../hooks/client"
 
 export type Props = {
     incident: Incident
@@ -20,6 +20,7 @@ type Status = {
 export default function IncidentDetails() {
     const { incident, isNewReport } = useLoaderData() as Props
     const { t } = useTranslation() 
+    const image = useImage(incident.imageId, 'medium')
 
     const created = incident.timestamp?.toDate()
 
@@ -66,10 +67,10 @@ export default function IncidentDetails() {
                 </Alert>
             )}
             <Card>
-                { incident.imageId && (
+                { image && (
                     <CardMedia
                         component='img'
-                        src={`${getCDNEndpoint()}/images/${incident.imageId}`}
+                        src={image}
                         width='100%'
                     />
                 )}
@@ -7,7 +7,6 @@ import { Warning } from "@mui/icons-material"
 export default function Login() {
     const [email, setEmail] =  React.useState<string>(localStorage.getItem('email') ?? '')
     const [backend, setBackend] = React.useState<string>(localStorage.getItem('backend') ?? import.meta.env.VITE_BACKEND)
-    const [cdn, setCDN] = React.useState<string>(localStorage.getItem('cdn') ?? import.meta.env.VITE_CDN)
     const navigate = useNavigate()
     const { t } = useTranslation()
     const theme = useTheme()
@@ -32,10 +31,6 @@ export default function Login() {
         localStorage.setItem('backend', backend)
     }
 
-    const saveCDN = () => {
-        localStorage.setItem('cdn', cdn)
-    }
-
     const handleChangedAdvanced = (e: ChangeEvent<HTMLInputElement>) => {
         setShowAdvanced(e.target.checked)
     }
@@ -106,23 +101,6 @@ export default function Login() {
                                 >
                                     {t('action:useBackend')}
                                 </Button>
-                                <TextField
-                                    label={t('common:cdn')}
-                                    variant='outlined'
-                                    fullWidth
-                                    type='url'
-                                    value={cdn}
-                                    onChange={(e: React.ChangeEvent<HTMLInputElement>) => {
-                                        setCDN(e.target.value)
-                                    }}
-                                />
-                                <Button
-                                    variant='contained'
-                                    fullWidth
-                                    onClick={saveCDN}
-                                >
-                                    {t('action:useCDN')}
-                                </Button>
                             </Stack>
                         </Paper>
                     </Fade>
@@ -2,7 +2,6 @@
 
 interface ImportMetaEnv {
     readonly VITE_BACKEND: string
-    readonly VITE_CDN: string
 }
 
 interface ImportMeta {
@@ -16,6 +16,9 @@ export default defineConfig({
       devOptions: {
         enabled: true
       },
+      workbox: {
+        importScripts: ['push-sw.js'],
+      },
       includeAssets: ['favicon.ico', 'apple-touch-icon.png', 'mask-icon.svg'],
       manifest: {
         id: 'place.safer.app',
@@ -0,0 +1,119 @@
+import { Box, Button, Stack, Typography } from '@mui/material'
+import React from 'react'
+
+/**
+ * Region of the image to redact, as fractions of its width and height so it doesn't depend on
+ * the size the image is shown at.
+ */
+export type Region = {
+  x: number
+  y: number
+  width: number
+  height: number
+}
+
+export type Props = {
+  src: string
+  incidentId: string
+}
+
+/**
+ * RedactImage shows the image, and lets the reviewer draw the regions which have to be hidden
+ * before it is published, such as faces and number plates. The regions replace the ones the image
+ * was redacted with before.
+ */
+export default function RedactImage({ src, incidentId }: Props) {
+  const [regions, setRegions] = React.useState<Region[]>([])
+  const [drawing, setDrawing] = React.useState<{ start: [number, number], region: Region }>()
+  const [status, setStatus] = React.useState<string>('')
+
+  const position = (e: React.PointerEvent<HTMLElement>): [number, number] => {
+    const rect = e.currentTarget.getBoundingClientRect()
+    const clamp = (v: number) => Math.min(1, Math.max(0, v))
+    return [clamp((e.clientX - rect.left) / rect.width), clamp((e.clientY - rect.top) / rect.height)]
+  }
+
+  const onPointerDown = (e: React.PointerEvent<HTMLElement>) => {
+    e.currentTarget.setPointerCapture(e.pointerId)
+    const [x, y] = position(e)
+    setDrawing({ start: [x, y], region: { x, y, width: 0, height: 0 } })
+  }
+  const onPointerMove = (e: React.PointerEvent<HTMLElement>) => {
+    if (!drawing) return
+    const [x, y] = position(e)
+    const [sx, sy] = drawing.start
+    setDrawing({
+      start: drawing.start,
+      region: {
+        x: Math.min(x, sx),
+        y: Math.min(y, sy),
+        width: Math.abs(x - sx),
+        height: Math.abs(y - sy),
+      },
+    })
+  }
+  const onPointerUp = () => {
+    if (drawing && drawing.region.width > 0 && drawing.region.height > 0) {
+      setRegions([...regions, drawing.region])
+    }
+    setDrawing(undefined)
+  }
+
+  const submit = (regions: Region[]) => {
+    setStatus('Saving...')
+    fetch(`${import.meta.env.VITE_BACKEND}/v1/redact/${encodeURIComponent(incidentId)}`, {
+      method: 'POST',
+      headers: {
+        'Authorization': `Bearer ${localStorage.getItem('session') ?? ''}`,
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ regions }),
+    })
+      .then(async resp => resp.ok ? resp : Promise.reject(new Error(await resp.text())))
+      .then(() => setStatus(regions.length ? 'The published image is redacted' : 'The image is published as uploaded'))
+      .catch(err => setStatus(`Unable to redact the image: ${err.message}`))
+  }
+
+  const box = (region: Region, key?: number) => (
+    <Box
+      key={key}
+      sx={{
+        position: 'absolute',
+        left: `${region.x * 100}%`,
+        top: `${region.y * 100}%`,
+        width: `${region.width * 100}%`,
+        height: `${region.height * 100}%`,
+        border: '2px solid red',
+        backgroundColor: 'rgba(0, 0, 0, 0.5)',
+        pointerEvents: 'none',
+      }}
+    />
+  )
+
+  return (
+    <Stack spacing={1}>
+      <Box
+        sx={{ position: 'relative', cursor: 'crosshair', touchAction: 'none', userSelect: 'none' }}
+        onPointerDown={onPointerDown}
+        onPointerMove={onPointerMove}
+        onPointerUp={onPointerUp}
+      >
+        <img src={src} width='100%' draggable={false} style={{ display: 'block' }} />
+        {regions.map(box)}
+        {drawing && box(drawing.region)}
+      </Box>
+      <Stack direction='row' spacing={1} alignItems='center'>
+        <Button onClick={() => submit(regions)}>
+          Redact {regions.length} region{regions.length === 1 ? '' : 's'}
+        </Button>
+        <Button onClick={() => setRegions(regions.slice(0, -1))} disabled={!regions.length}>
+          Undo
+        </Button>
+        <Button onClick={() => { setRegions([]); submit([]) }} color='error'>
+          Remove Redaction
+        </Button>
+        <Typography variant='body2'>{status}</Typography>
+      </Stack>
+    </Stack>
+  )
+}
@@ -8,20 +8,43 @@ import Root from './routes/root'
 import { ReviewService } from '@saferplace/api/review/v1/review_connect'
 import ErrorPage from './routes/error'
 
-import { createPromiseClient, Interceptor } from '@bufbuild/connect'
+import { Code, ConnectError, createPromiseClient, Interceptor } from '@bufbuild/connect'
 import { createConnectTransport } from '@bufbuild/connect-web'
 import { Incident } from '@saferplace/api/incident/v1/incident_pb'
 
-const addReviewerEmailInterceptor: Interceptor = (next) => async (req) => {
-  req.header.set('email', localStorage.getItem('email') ?? '')
-  return await next(req)
+// After logging in, the backend redirects back with the session in the URL fragment so it
+// never reaches any server logs.
+const session = new URLSearchParams(window.location.hash.slice(1)).get('session')
+if (session) {
+  localStorage.setItem('session', session)
+  window.history.replaceState(null, '', window.location.pathname + window.location.search)
+}
+
+const login = () => {
+  localStorage.removeItem('session')
+  window.location.assign(`${import.meta.env.VITE_BACKEND}/auth/`)
+}
+
+const addReviewerSessionInterceptor: Interceptor = (next) => async (req) => {
+  const session = localStorage.getItem('session')
+  if (session) {
+    req.header.set('Authorization', `Bearer ${session}`)
+  }
+  try {
+    return await next(req)
+  } catch (err) {
+    if (err instanceof ConnectError && err.code === Code.Unauthenticated) {
+      login()
+    }
+    throw err
+  }
 }
 
 const client = createPromiseClient(
   ReviewService,
   createConnectTransport({
     baseUrl: import.meta.env.VITE_BACKEND,
-    interceptors: [addReviewerEmailInterceptor],
+    interceptors: [addReviewerSessionInterceptor],
   }),
 )
 
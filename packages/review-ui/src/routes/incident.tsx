@@ -8,8 +8,38 @@ import { ReviewIncidentRequest } from '@saferplace/api/review/v1/review_pb'
 import * as ipb from '@saferplace/api/incident/v1/incident_pb'
 import { Close, Done, Notifications } from '@mui/icons-material'
 import { useLoaderData, useNavigate, useRevalidator } from 'react-router-dom'
+import RedactImage from '../components/redact'
 
 
+/**
+ * useImage fetches the image with the reviewer session, which is needed to see the images of the
+ * incidents which are not published, and returns the URL to show it. The medium variant is shown,
+ * as the full image of a phone camera is much larger than the page.
+ */
+function useImage(imageId: string): string | undefined {
+  const [src, setSrc] = React.useState<string>()
+  React.useEffect(() => {
+    if (!imageId) return
+    const controller = new AbortController()
+    let url: string | undefined
+    fetch(`${import.meta.env.VITE_BACKEND}/v1/image/${encodeURIComponent(`${imageId}_medium`)}`, {
+      headers: { Authorization: `Bearer ${localStorage.getItem('session') ?? ''}` },
+      signal: controller.signal,
+    })
+      .then(resp => resp.ok ? resp.blob() : Promise.reject(new Error(resp.statusText)))
+      .then(blob => {
+        url = URL.createObjectURL(blob)
+        setSrc(url)
+      })
+      .catch(err => console.debug('unable to load image', err))
+    return () => {
+      controller.abort()
+      if (url) URL.revokeObjectURL(url)
+    }
+  }, [imageId])
+  return src
+}
+
 export type Props = {
   incident: ipb.Incident
   onSubmit: (review: PartialMessage<ReviewIncidentRequest>) => void
@@ -23,6 +53,7 @@ function Review({incident, onSubmit}: Props) {
   const [description, setDescription] = React.useState<string>(incident.description)
   const [comment, setComment] = React.useState<string>('')
   const [resolution, setResolution] = React.useState<ipb.Resolution>(incident.resolution)
+  const image = useImage(incident.imageId)
 
   const submit = () => {
     onSubmit({
@@ -55,7 +86,7 @@ function Review({incident, onSubmit}: Props) {
             <Marker position={latlon(incident.coordinates)} />
           </MapContainer>
         </Box>
-        <img src={`${import.meta.env.VITE_CDN}/images/${incident.imageId}`} width='100%' />
+        { image && <RedactImage src={image} incidentId={incident.id} /> }
       </CardMedia>
       <CardHeader>
         <Typography variant='h4'>Review Incident {incident.id}</Typography>